@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// ArchiveCmd merges saved analyses into archive of per-interval summaries, or prints history of a sqlid from it
+func ArchiveCmd(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	in := fs.String("in", "", "saved analyses to add: comma separated files, globs or directories")
+	out := fs.String("out", "", "archive file, created if it doesn't exist, analyses are added to it")
+	resolution := fs.Duration("resolution", time.Hour, "<duration> interval of summaries in a new archive, the archive keeps its own")
+	sqlID := fs.String("sqlid", "", "print intervals of this sqlid from the archive")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	if *out == "" || (*in == "" && *sqlID == "") || *resolution < stats.IntervalResolution {
+		fmt.Println("Usage: stado archive -in analyses/ -out archive.json [-resolution 1h]")
+		fmt.Println("       stado archive -out archive.json -sqlid <sqlid>")
+		fmt.Println("-resolution can't be finer than intervals of saved analyses (" + stats.IntervalResolution.String() + ")")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	ar, err := stats.LoadArchive(*out)
+	if os.IsNotExist(err) && *in != "" {
+		ar, err = &stats.Archive{FormatVersion: stats.ArchiveFormatVersion, ResolutionS: resolution.Seconds()}, nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if *in != "" {
+		files, err := analysisFiles(*in)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		for _, file := range files {
+			a, err := stats.LoadAnalysis(file)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+			ar.Merge(a, file)
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if err := json.NewEncoder(f).Encode(ar); err != nil {
+			fmt.Println(err)
+		}
+		if err := f.Close(); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Printf("%s: %d captures, %d sqlids\n", *out, len(ar.Captures), len(ar.SQLs))
+	}
+	if *sqlID != "" {
+		printArchivedSQL(ar, *sqlID)
+	}
+}
+
+func printArchivedSQL(ar *stats.Archive, sqlID string) {
+	for _, s := range ar.SQLs {
+		if s.SQLid != sqlID {
+			continue
+		}
+		fmt.Println("\n" + s.SQLid + "\t" + s.SQLtxt)
+		fmt.Println("Interval start\t\t\tExec\tEla App (ms)\tApp/Exec\tMax App\t\tEla Net(ms)\tErrors")
+		for _, iv := range s.Intervals {
+			fmt.Printf("%s\t%d\t%f\t%f\t%f\t%f\t%d\n", iv.Start.Format(time.RFC3339), iv.Executions, iv.AppMs,
+				iv.AppMs/float64(iv.Executions), iv.MaxAppMs, iv.NetMs, iv.Errors)
+		}
+		return
+	}
+	fmt.Println(sqlID, "not found in archive")
+}
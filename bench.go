@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// benchStages are measured in this order in every iteration of stado bench
+var benchStages = []string{"decode", "parse", "aggregate", "analyze"}
+
+// StageMetrics is cost of a single pipeline stage in one iteration
+type StageMetrics struct {
+	Time   time.Duration
+	Allocs uint64
+	Bytes  uint64
+}
+
+// measureStage runs fn and returns its time and heap allocations
+func measureStage(fn func()) StageMetrics {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	begin := time.Now()
+	fn()
+	elapsed := time.Since(begin)
+	runtime.ReadMemStats(&after)
+	return StageMetrics{Time: elapsed, Allocs: after.Mallocs - before.Mallocs, Bytes: after.TotalAlloc - before.TotalAlloc}
+}
+
+// readFrames loads all frames of the capture into memory, so reading the file is not measured by stages
+func readFrames(backend string, file string) ([][]byte, []gopacket.CaptureInfo, gopacket.Decoder, error) {
+	src, err := OpenCaptureSource(backend, file, "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer src.Close()
+	var frames [][]byte
+	var infos []gopacket.CaptureInfo
+	for {
+		data, ci, err := src.ReadPacketData()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+		frames = append(frames, append([]byte(nil), data...))
+		infos = append(infos, ci)
+	}
+	return frames, infos, PacketDecoder(src.LinkType()), nil
+}
+
+// benchIteration runs the whole pipeline once on frames kept in memory
+func benchIteration(frames [][]byte, infos []gopacket.CaptureInfo, decoder gopacket.Decoder,
+	dbIPs []string, dbPort string, dedup time.Duration) map[string]StageMetrics {
+	parser := tnsparse.NewParser(dbIPs, dbPort)
+	parser.SoftFilter = true //Bez BPF - parser odrzuca obce pakiety, tak jak przy -capture pcapgo
+	if dedup > 0 {
+		parser.Dedup = tnsparse.NewDeduper(dedup)
+	}
+
+	stages := make(map[string]StageMetrics)
+	packets := make([]gopacket.Packet, len(frames))
+	stages["decode"] = measureStage(func() {
+		for i, data := range frames {
+			packets[i] = gopacket.NewPacket(data, decoder, gopacket.Default)
+			packets[i].Metadata().CaptureInfo = infos[i]
+		}
+	})
+	stages["parse"] = measureStage(func() {
+		for _, p := range packets {
+			parser.Parse(p)
+		}
+		parser.FlushStreams()
+	})
+	st := stats.New(parser)
+	stages["aggregate"] = measureStage(st.Count)
+	stages["analyze"] = measureStage(func() { st.Analyze(true) })
+	return stages
+}
+
+// BenchCmd runs decoding and aggregation pipeline repeatedly on a capture and reports cost of each stage
+func BenchCmd(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	file := fs.String("f", "", "path to PCAP file")
+	dbIP := fs.String("i", "", "IP address of database server")
+	dbPort := fs.String("p", "", "Listener port for database server")
+	n := fs.Int("n", 5, "number of iterations")
+	backend := fs.String("capture", "auto", "capture backend used to read the file: "+strings.Join(CaptureBackends, "|"))
+	dedup := fs.Duration("dedup", tnsparse.DedupWindow, "<duration> drop frames seen twice within the window, 0 disables")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	if *file == "" || *dbIP == "" || *dbPort == "" || *n < 1 {
+		fmt.Println("Usage: stado bench -f file.pcap -i <db ip> -p <db port> [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	frames, infos, decoder, err := readFrames(*backend, *file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if len(frames) == 0 {
+		fmt.Println(*file, "has no packets")
+		os.Exit(2)
+	}
+	dbIPs := strings.Split(*dbIP, "or")
+	stats.MultiDB = len(dbIPs) > 1
+	var frameBytes uint64
+	for _, f := range frames {
+		frameBytes += uint64(len(f))
+	}
+	fmt.Printf("%s: %d frames, %.1f MB, %d iterations, GOMAXPROCS %d\n\n",
+		*file, len(frames), float64(frameBytes)/1024/1024, *n, runtime.GOMAXPROCS(0))
+
+	runs := make(map[string][]StageMetrics)
+	for i := 0; i < *n; i++ {
+		for stage, m := range benchIteration(frames, infos, decoder, dbIPs, *dbPort, *dedup) {
+			runs[stage] = append(runs[stage], m)
+		}
+	}
+	printBench(runs, len(frames))
+}
+
+func printBench(runs map[string][]StageMetrics, frames int) {
+	fmt.Println("Stage\t\tMin\t\tMedian\t\tPackets/s\tAllocs/packet\tBytes/packet")
+	total := make([]time.Duration, len(runs[benchStages[0]]))
+	for _, stage := range benchStages {
+		ms := runs[stage]
+		times := make([]time.Duration, len(ms))
+		for i, m := range ms {
+			times[i] = m.Time
+			total[i] += m.Time
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		median := times[len(times)/2]
+		//Alokacje sa powtarzalne miedzy iteracjami, wystarczy pierwsza
+		fmt.Printf("%-10s\t%-10v\t%-10v\t%.0f\t\t%.1f\t\t%.1f\n", stage, times[0].Round(time.Microsecond), median.Round(time.Microsecond),
+			perSec(frames, median), float64(ms[0].Allocs)/float64(frames), float64(ms[0].Bytes)/float64(frames))
+	}
+	sort.Slice(total, func(i, j int) bool { return total[i] < total[j] })
+	fmt.Printf("%-10s\t%-10v\t%-10v\t%.0f\n", "total", total[0].Round(time.Microsecond), total[len(total)/2].Round(time.Microsecond),
+		perSec(frames, total[len(total)/2]))
+}
+
+func perSec(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
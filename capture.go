@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// ErrNoBPF is returned by CaptureSource which can't filter packets in kernel/library,
+// tnsparse.Parser has to filter them by itself then
+var ErrNoBPF = errors.New("BPF filters not supported by capture source")
+
+// CaptureSource is a source of packets (live interface or capture file) feeding the parser
+type CaptureSource interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	SetBPFFilter(filter string) error
+	Close()
+}
+
+// DLT_RAW values returned by libpcap on some platforms for raw IP links,
+// gopacket decodes only LinkTypeRaw used in capture files
+const (
+	linkTypeDLTRaw    = layers.LinkType(12)
+	linkTypeDLTRawBSD = layers.LinkType(14)
+)
+
+// PacketDecoder returns decoder of the first layer for link type of capture source. Ethernet is decoded
+// with its VLAN tags and MPLS labels, loopback (Null/Loop, i.e. lo0), raw IP and Linux cooked (-i any)
+// framing is decoded by gopacket itself
+func PacketDecoder(lt layers.LinkType) gopacket.Decoder {
+	switch lt {
+	case layers.LinkTypeEthernet:
+		return gopacket.DecodeFunc(decodeEthernet)
+	case linkTypeDLTRaw, linkTypeDLTRawBSD:
+		return gopacket.DecodeFunc(decodeRawIP)
+	}
+	return lt
+}
+
+func decodeRawIP(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) > 0 && data[0]>>4 == 6 {
+		return layers.LayerTypeIPv6.Decode(data, p)
+	}
+	return layers.LayerTypeIPv4.Decode(data, p)
+}
+
+// liveSnaplen is snapshot length of live captures, enough for whole frames of standard and jumbo MTU
+// (TNS packets split over segments are glued back by the parser, so nothing of the payload may be cut)
+const liveSnaplen = 65535
+
+// CaptureBackends lists values accepted by -capture
+var CaptureBackends = []string{"auto", "pcap", "npcap", "afpacket", "pcapgo"}
+
+// OpenCaptureSource opens live capture on iface (if set) or pcap file using backend.
+// For "auto" the backend is selected per platform: afpacket on Linux, Npcap on Windows, libpcap elsewhere
+// for live capture, and libpcap for files
+func OpenCaptureSource(backend, file, iface string) (CaptureSource, error) {
+	if iface == "" && IsRemote(file) {
+		//libpcap czyta tylko pliki, zdalny capture jest strumieniowany przez pcapgo
+		if backend != "auto" && backend != "pcapgo" {
+			return nil, fmt.Errorf("capture backend %s can't read remote capture %s, use -capture pcapgo", backend, file)
+		}
+		return openPcapgoRemote(file)
+	}
+	if iface == "" && IsCaptureSet(file) {
+		return OpenRotatedSource(backend, file)
+	}
+	if backend == "auto" {
+		backend = "pcap"
+		if iface == "" && IsPcapng(file) {
+			backend = "pcapgo" //libpcap nie czyta pcapng z interfejsami o roznych typach lacza
+		} else if iface != "" && !IsLoopback(iface) {
+			backend = defaultLiveBackend //On loopback AF_PACKET sees every packet twice, libpcap skips outgoing copies
+		}
+	}
+	if iface != "" {
+		switch backend {
+		case "pcap", "npcap":
+			return openPcapLive(iface)
+		case "afpacket":
+			return openAfpacket(iface)
+		}
+		return nil, fmt.Errorf("capture backend %s can't capture live traffic", backend)
+	}
+	switch backend {
+	case "pcap", "npcap":
+		h, err := pcap.OpenOffline(file)
+		if err != nil {
+			return nil, err
+		}
+		return &pcapSource{h}, nil
+	case "pcapgo":
+		return openPcapgoFile(file)
+	}
+	return nil, fmt.Errorf("capture backend %s can't read capture files", backend)
+}
+
+// pcapSource is a libpcap (or Npcap on Windows) handle
+type pcapSource struct {
+	*pcap.Handle
+}
+
+func openPcapLive(iface string) (CaptureSource, error) {
+	device, err := ResolveInterface(iface)
+	if err != nil {
+		return nil, err
+	}
+	h, err := pcap.OpenLive(device, liveSnaplen, true, pcap.BlockForever)
+	if err != nil {
+		return nil, fmt.Errorf("%v - %s", err, captureHint)
+	}
+	return &pcapSource{h}, nil
+}
+
+// pcapgoSource reads pcap files in pure Go, so it works without libpcap installed
+type pcapgoSource struct {
+	*pcapgo.Reader
+	f io.Closer
+}
+
+func openPcapgoFile(file string) (CaptureSource, error) {
+	f := os.Stdin
+	if file != "-" {
+		var err error
+		if f, err = os.Open(file); err != nil {
+			return nil, err
+		}
+	}
+	s, err := openPcapgoReader(f, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func openPcapgoRemote(url string) (CaptureSource, error) {
+	body, err := OpenRemote(url)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openPcapgoReader(body, body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return s, nil
+}
+
+func (s *pcapgoSource) SetBPFFilter(filter string) error { return ErrNoBPF }
+func (s *pcapgoSource) Close()                           { s.f.Close() }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+const defaultLiveBackend = "afpacket"
+
+// captureHint is appended to live capture errors
+const captureHint = "live capture requires root or CAP_NET_RAW privileges"
+
+// afpacketSource is a memory mapped AF_PACKET socket, it doesn't need libpcap for capturing
+type afpacketSource struct {
+	*afpacket.TPacket
+}
+
+func openAfpacket(iface string) (CaptureSource, error) {
+	var opts []interface{}
+	if iface != "any" {
+		opts = append(opts, afpacket.OptInterface(iface))
+	}
+	opts = append(opts, afpacket.OptPollTimeout(time.Second))
+	h, err := afpacket.NewTPacket(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &afpacketSource{h}, nil
+}
+
+func (s *afpacketSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := s.TPacket.ReadPacketData()
+		if err == afpacket.ErrTimeout {
+			continue
+		}
+		return data, ci, err
+	}
+}
+
+func (s *afpacketSource) LinkType() layers.LinkType { return layers.LinkTypeEthernet }
+
+// SetBPFFilter compiles filter with libpcap and attaches it to the socket
+func (s *afpacketSource) SetBPFFilter(filter string) error {
+	insns, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, liveSnaplen, filter)
+	if err != nil {
+		return err
+	}
+	raw := make([]bpf.RawInstruction, len(insns))
+	for i, ins := range insns {
+		raw[i] = bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	return s.SetBPF(raw)
+}
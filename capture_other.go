@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package main
+
+import "errors"
+
+const defaultLiveBackend = "pcap"
+
+// captureHint is appended to live capture errors
+const captureHint = "live capture requires libpcap and root privileges (or access to /dev/bpf*)"
+
+func openAfpacket(iface string) (CaptureSource, error) {
+	return nil, errors.New("afpacket capture is available only on Linux")
+}
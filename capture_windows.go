@@ -0,0 +1,12 @@
+package main
+
+import "errors"
+
+const defaultLiveBackend = "npcap"
+
+// captureHint is appended to live capture errors
+const captureHint = "live capture on Windows requires Npcap (https://npcap.com) installed in WinPcap API-compatible mode"
+
+func openAfpacket(iface string) (CaptureSource, error) {
+	return nil, errors.New("afpacket capture is available only on Linux")
+}
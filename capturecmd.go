@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// CaptureFilter is BPF filter of traffic stado needs: SQL*Net of the databases, ICMP and further IP
+// fragments (they have no ports, but are needed to find MTU problems). dbIP may list hosts with "or"
+func CaptureFilter(dbIP, port string) string {
+	f := "host " + dbIP + " and (port " + port + " or icmp or icmp6 or ip[6:2] & 0x1fff != 0)"
+	//Kazde "vlan" przesuwa offsety reszty filtra o tag, stad zagniezdzenie - pojedynczy i podwojny tag (QinQ)
+	return f + " or (vlan and (" + f + " or (vlan and " + f + ")))"
+}
+
+// ringWriter writes packets to a pcap file, and with rotation to out_0001.pcap, out_0002.pcap, ...
+// keeping at most Files of them (0 - all)
+type ringWriter struct {
+	Out        string
+	LinkType   layers.LinkType
+	RotateSize int64         //bytes, 0 - no rotation by size
+	RotateTime time.Duration //0 - no rotation by time
+	Files      int
+	f          *os.File
+	w          *pcapgo.Writer
+	size       int64
+	opened     time.Time
+	written    []string
+	Packets    uint64
+}
+
+// name of n-th file of the ring
+func (r *ringWriter) name(n int) string {
+	if r.RotateSize == 0 && r.RotateTime == 0 {
+		return r.Out
+	}
+	ext := filepath.Ext(r.Out)
+	return fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(r.Out, ext), n, ext)
+}
+
+// Pattern is what -f has to be given to read all files written
+func (r *ringWriter) Pattern() string {
+	if r.RotateSize == 0 && r.RotateTime == 0 {
+		return r.Out
+	}
+	ext := filepath.Ext(r.Out)
+	return "'" + strings.TrimSuffix(r.Out, ext) + "_*" + ext + "'"
+}
+
+func (r *ringWriter) open(now time.Time) error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+	name := r.name(len(r.written) + 1)
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(liveSnaplen, r.LinkType); err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.w, r.size, r.opened = f, w, 24, now
+	r.written = append(r.written, name)
+	//Najstarszy plik wypada z bufora
+	if r.Files > 0 && len(r.written) > r.Files {
+		if err := os.Remove(r.written[len(r.written)-r.Files-1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePacket writes packet to the current file, opening the next one when it is full or old enough
+func (r *ringWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	if r.f == nil ||
+		(r.RotateSize > 0 && r.size+16+int64(len(data)) > r.RotateSize) ||
+		(r.RotateTime > 0 && ci.Timestamp.Sub(r.opened) >= r.RotateTime) {
+		if err := r.open(ci.Timestamp); err != nil {
+			return err
+		}
+	}
+	if len(data) > liveSnaplen {
+		data = data[:liveSnaplen]
+		ci.CaptureLength = liveSnaplen
+	}
+	if err := r.w.WritePacket(ci, data); err != nil {
+		return err
+	}
+	r.size += 16 + int64(len(data))
+	r.Packets++
+	return nil
+}
+
+func (r *ringWriter) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	f := r.f
+	r.f, r.w = nil, nil
+	return f.Close()
+}
+
+// CaptureCmd captures traffic of databases on an interface into pcap files ready for analysis: filtered
+// to SQL*Net, ICMP and IP fragments, with whole frames and optionally rotated in a ring buffer
+func CaptureCmd(args []string) {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	iface := fs.String("iface", "", "<dev> network interface to capture on i.e. -iface eth0")
+	dbIP := fs.String("i", "", "<dbip> IP address of the database, list more of them with or i.e. \"10.0.0.5 or 10.0.0.6\"")
+	dbPort := fs.String("p", "", "<dbport> listener port of the database")
+	out := fs.String("w", "", "<file> pcap file written")
+	duration := fs.Duration("duration", 0, "stop capturing after duration i.e. 10m (0 - on Ctrl-C/SIGTERM)")
+	backend := fs.String("capture", "auto", "capture backend: "+strings.Join(CaptureBackends, "|"))
+	rotateSize := fs.Int("rotate-size", 0, "start the next file when the current one has MB (0 - no rotation by size)")
+	rotateEvery := fs.Duration("rotate-every", 0, "start the next file after duration i.e. 1m (0 - no rotation by time)")
+	files := fs.Int("files", 0, "ring buffer: keep only the last files when rotating (0 - keep all)")
+	fs.Usage = func() {
+		fmt.Println("Usage: stado capture -iface eth0 -i 10.0.0.5 -p 1521 -w out.pcap [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *iface == "" || *dbIP == "" || *dbPort == "" || *out == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+	log.SetOutput(ioutil.Discard)
+
+	src, err := OpenCaptureSource(*backend, "", *iface)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defer src.Close()
+	//Bez filtra w kernelu plik rosnie o caly ruch interfejsu, wiec nie kontynuujemy
+	if err := src.SetBPFFilter(CaptureFilter(*dbIP, *dbPort)); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	w := &ringWriter{Out: *out, LinkType: src.LinkType(), RotateSize: int64(*rotateSize) << 20, RotateTime: *rotateEvery, Files: *files}
+	if err := w.open(time.Now()); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	//Czytanie blokuje sie na cichym interfejsie, wiec koniec wyznacza timer lub sygnal, nie kolejny pakiet
+	type captured struct {
+		data []byte
+		ci   gopacket.CaptureInfo
+		err  error
+	}
+	packets := make(chan captured, 1024)
+	go func() {
+		for {
+			data, ci, err := src.ReadPacketData()
+			packets <- captured{data, ci, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	fmt.Fprintf(os.Stderr, "Capturing %s on %s into %s, Ctrl-C to stop\n", CaptureFilter(*dbIP, *dbPort), *iface, w.Pattern())
+	stopped := ""
+	for stopped == "" {
+		select {
+		case p := <-packets:
+			if p.err != nil {
+				stopped = p.err.Error()
+			} else if err := w.WritePacket(p.ci, p.data); err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
+		case sig := <-sigs:
+			stopped = sig.String()
+		case <-timeout:
+			stopped = "duration " + duration.String() + " elapsed"
+		}
+	}
+	if err := w.Close(); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	kept := len(w.written)
+	if w.Files > 0 && kept > w.Files {
+		kept = w.Files
+	}
+	fmt.Fprintf(os.Stderr, "Stopped (%s): %d packets written, %d files kept\n", stopped, w.Packets, kept)
+	fmt.Printf("stado -f %s -i \"%s\" -p %s\n", w.Pattern(), *dbIP, *dbPort)
+}
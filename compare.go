@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// Environment is a labeled capture (prod, staging, DR) compared with others: a pcap with database endpoint
+// or an analysis saved with -save
+type Environment struct {
+	Name string
+	File string
+	IP   string
+	Port string
+	SQLs map[string]stats.SQLstatsJSON
+}
+
+// ParseEnvironments parses "name=file@ip:port,..." or "name=analysis.json,..."
+func ParseEnvironments(list string) ([]*Environment, error) {
+	var envs []*Environment
+	names := make(map[string]bool)
+	for _, spec := range strings.Split(list, ",") {
+		eq := strings.Index(spec, "=")
+		if eq < 1 || eq == len(spec)-1 {
+			return nil, fmt.Errorf("environment %q, expected name=file@ip:port or name=analysis.json", spec)
+		}
+		env := &Environment{Name: spec[:eq], File: spec[eq+1:]}
+		if !strings.HasSuffix(env.File, ".json") {
+			at, colon := strings.LastIndex(spec, "@"), strings.LastIndex(spec, ":")
+			if at < eq+2 || colon < at+2 || colon == len(spec)-1 {
+				return nil, fmt.Errorf("environment %q, expected name=file@ip:port for a capture", spec)
+			}
+			env.File, env.IP, env.Port = spec[eq+1:at], strings.Trim(spec[at+1:colon], "[]"), spec[colon+1:]
+		}
+		if names[env.Name] {
+			return nil, fmt.Errorf("environment %s given twice", env.Name)
+		}
+		names[env.Name] = true
+		envs = append(envs, env)
+	}
+	if len(envs) < 2 {
+		return nil, fmt.Errorf("at least two environments are needed for a comparison")
+	}
+	return envs, nil
+}
+
+// analyze parses capture of environment or loads its saved analysis and keeps per-sqlid statistics
+func (env *Environment) analyze(backend string) error {
+	var a *stats.Analysis
+	if env.IP == "" {
+		var err error
+		if a, err = stats.LoadAnalysis(env.File); err != nil {
+			return err
+		}
+	} else {
+		src, err := OpenCaptureSource(backend, env.File, "")
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		analyzer := tnsparse.NewAnalyzer([]string{env.IP}, env.Port, tnsparse.WithSoftFilter(), tnsparse.WithDedup(tnsparse.DedupWindow))
+		analyzer.Run(gopacket.NewPacketSource(src, PacketDecoder(src.LinkType())))
+		st := stats.New(analyzer.Parser)
+		st.Count()
+		a = st.Analyze(false)
+	}
+	env.SQLs = make(map[string]stats.SQLstatsJSON, len(a.SQLs))
+	for _, r := range a.SQLs {
+		env.SQLs[r.SQLid] = r
+	}
+	return nil
+}
+
+// EnvCell is a sqlid in one environment
+type EnvCell struct {
+	Executions   uint    `json:"executions"`
+	AppPerExecMs float64 `json:"app_per_exec_ms"`
+	AppP95Ms     float64 `json:"app_p95_ms"`
+	NetPerExecMs float64 `json:"net_per_exec_ms"`
+	Regression   bool    `json:"regression"` //Slower than the median of other environments by RegressionRatio
+}
+
+// MatrixRow is a sqlid across environments, nil cell if the environment did not execute it
+type MatrixRow struct {
+	SQLid    string     `json:"sql_id"`
+	SQLtxt   string     `json:"sql_text"`
+	ElaAppMs float64    `json:"ela_app_ms"` //All environments together
+	Cells    []*EnvCell `json:"environments"`
+}
+
+// EnvRegression is a sqlid slower in one environment than in the others
+type EnvRegression struct {
+	SQLid        string  `json:"sql_id"`
+	Environment  string  `json:"environment"`
+	AppPerExecMs float64 `json:"app_per_exec_ms"`
+	OthersMs     float64 `json:"others_app_per_exec_ms"` //Median of the other environments
+	Ratio        float64 `json:"ratio"`
+}
+
+// EnvMatrix is per-sqlid latency of environments, in the order they were given
+type EnvMatrix struct {
+	Environments []string        `json:"environments"`
+	Rows         []MatrixRow     `json:"sqls"`
+	Regressions  []EnvRegression `json:"regressions"` //The largest ratio first
+}
+
+// Comparison thresholds of "stado compare" (-ratio, -min-execs)
+var (
+	RegressionRatio = 2.0
+	CompareMinExecs = uint(5)
+)
+
+// Compare builds matrix of sqlids executed in any environment, ordered by app time of all environments.
+// A cell is a regression if its app time per execution is RegressionRatio times the median of the other
+// environments executing the sqlid, cells with fewer than CompareMinExecs executions are not judged
+func Compare(envs []*Environment) *EnvMatrix {
+	m := &EnvMatrix{Rows: []MatrixRow{}, Regressions: []EnvRegression{}}
+	bySQL := make(map[string]*MatrixRow)
+	for i, env := range envs {
+		m.Environments = append(m.Environments, env.Name)
+		for _, r := range env.SQLs {
+			row, ok := bySQL[r.SQLid]
+			if !ok {
+				row = &MatrixRow{SQLid: r.SQLid, SQLtxt: r.SQLtxt, Cells: make([]*EnvCell, len(envs))}
+				bySQL[r.SQLid] = row
+			}
+			row.Cells[i] = &EnvCell{Executions: r.Executions, AppPerExecMs: r.AppPerExecMs, AppP95Ms: r.AppP95Ms, NetPerExecMs: r.NetPerExecMs}
+			row.ElaAppMs += r.ElaAppMs
+		}
+	}
+	for _, row := range bySQL {
+		for i, c := range row.Cells {
+			if c == nil || c.Executions < CompareMinExecs {
+				continue
+			}
+			var others []float64
+			for j, o := range row.Cells {
+				if j != i && o != nil && o.Executions >= CompareMinExecs {
+					others = append(others, o.AppPerExecMs)
+				}
+			}
+			if len(others) == 0 {
+				continue
+			}
+			sort.Float64s(others)
+			median := others[len(others)/2]
+			if len(others)%2 == 0 {
+				median = (others[len(others)/2-1] + others[len(others)/2]) / 2
+			}
+			if median > 0 && c.AppPerExecMs >= RegressionRatio*median {
+				c.Regression = true
+				m.Regressions = append(m.Regressions, EnvRegression{SQLid: row.SQLid, Environment: envs[i].Name,
+					AppPerExecMs: c.AppPerExecMs, OthersMs: median, Ratio: c.AppPerExecMs / median})
+			}
+		}
+		m.Rows = append(m.Rows, *row)
+	}
+	sort.Slice(m.Rows, func(i, j int) bool {
+		if m.Rows[i].ElaAppMs != m.Rows[j].ElaAppMs {
+			return m.Rows[i].ElaAppMs > m.Rows[j].ElaAppMs
+		}
+		return m.Rows[i].SQLid < m.Rows[j].SQLid
+	})
+	sort.Slice(m.Regressions, func(i, j int) bool {
+		if m.Regressions[i].Ratio != m.Regressions[j].Ratio {
+			return m.Regressions[i].Ratio > m.Regressions[j].Ratio
+		}
+		return m.Regressions[i].SQLid < m.Regressions[j].SQLid
+	})
+	return m
+}
+
+// CompareCmd analyzes captures of several environments and reports app time per execution of each sqlid
+// side by side, with sqlids slower in one environment than in the others
+func CompareCmd(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	envList := fs.String("envs", "", "labeled captures or saved analyses: name=file@db_ip:port or name=analysis.json,... i.e. prod=prod.pcap@10.0.0.10:1521,staging=stg.json")
+	backend := fs.String("capture", "auto", "capture backend used to read the files: "+strings.Join(CaptureBackends, "|"))
+	fs.StringVar(&tnsparse.Protocol, "protocol", tnsparse.Protocol, "wire protocol of the databases: "+strings.Join(tnsparse.Protocols, "|"))
+	fs.Float64Var(&RegressionRatio, "ratio", RegressionRatio, "sqlids that many times slower than the median of other environments are reported as regressions")
+	fs.UintVar(&CompareMinExecs, "min-execs", CompareMinExecs, "environments executing sqlid fewer times are left out of regression checks")
+	top := fs.Int("top", 20, "number of sqlids with the longest app time reported (0 - all)")
+	jsonOut := fs.Bool("json", false, "write the matrix as JSON instead of text report")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	envs, err := ParseEnvironments(*envList)
+	if *envList == "" || err != nil {
+		if err != nil && *envList != "" {
+			fmt.Println(err)
+		}
+		fmt.Println("Usage: stado compare -envs prod=prod.pcap@10.0.0.10:1521,staging=stg.pcap@10.1.0.10:1521,dr=dr.json [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := tnsparse.CheckProtocol(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, env := range envs {
+		if err := env.analyze(*backend); err != nil {
+			fmt.Println(env.Name+":", err)
+			os.Exit(2)
+		}
+	}
+	m := Compare(envs)
+	if *top > 0 && len(m.Rows) > *top {
+		m.Rows = m.Rows[:*top]
+	}
+	if *jsonOut {
+		if err := json.NewEncoder(os.Stdout).Encode(m); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	printMatrix(envs, m)
+}
+
+func printMatrix(envs []*Environment, m *EnvMatrix) {
+	fmt.Println("Environment\tSource\t\t\tSQL IDs\tExec\tEla App (ms)")
+	for _, env := range envs {
+		exec, app := uint(0), 0.0
+		for _, r := range env.SQLs {
+			exec += r.Executions
+			app += r.ElaAppMs
+		}
+		source := env.File
+		if env.IP != "" {
+			source += "@" + env.IP + ":" + env.Port
+		}
+		fmt.Printf("%s\t\t%s\t%d\t%d\t%f\n", env.Name, source, len(env.SQLs), exec, app)
+	}
+
+	fmt.Print("\nApp time per execution (ms), ! - regression, - - not executed\nSQL ID\t")
+	for _, name := range m.Environments {
+		fmt.Print("\t" + name)
+	}
+	fmt.Println()
+	for _, row := range m.Rows {
+		fmt.Print(row.SQLid)
+		for _, c := range row.Cells {
+			switch {
+			case c == nil:
+				fmt.Print("\t-")
+			case c.Regression:
+				fmt.Printf("\t%.2f!", c.AppPerExecMs)
+			default:
+				fmt.Printf("\t%.2f", c.AppPerExecMs)
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(m.Regressions) == 0 {
+		fmt.Println("\nNo environment specific regressions")
+		return
+	}
+	fmt.Printf("\nEnvironment specific regressions (%.1fx the median of other environments)\n", RegressionRatio)
+	fmt.Println("SQL ID\t\tEnvironment\tApp/Exec\tOthers\tRatio")
+	for _, r := range m.Regressions {
+		fmt.Printf("%s\t%s\t\t%.2f\t\t%.2f\t%.1f\n", r.SQLid, r.Environment, r.AppPerExecMs, r.OthersMs, r.Ratio)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// DaemonHealth is a state of daemon mode exposed on /healthz and /readyz
+type DaemonHealth struct {
+	ready   int32
+	packets uint64
+}
+
+func (h *DaemonHealth) SetReady(ready bool) {
+	if ready {
+		atomic.StoreInt32(&h.ready, 1)
+	} else {
+		atomic.StoreInt32(&h.ready, 0)
+	}
+}
+
+func (h *DaemonHealth) IsReady() bool {
+	return atomic.LoadInt32(&h.ready) == 1
+}
+
+// StartHealthServer serves /healthz (process is alive) and /readyz (capture is running) on addr
+func StartHealthServer(addr string, h *DaemonHealth) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !h.IsReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "not ready")
+			return
+		}
+		fmt.Fprintln(w, "ready, packets:", atomic.LoadUint64(&h.packets))
+	})
+	go func() {
+		log.Println("Health server listening on", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Println("Health server:", err)
+			os.Exit(2)
+		}
+	}()
+}
+
+// SdNotify sends state (i.e. READY=1) to systemd if stado was started with Type=notify
+func SdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// RunDaemon feeds packets to the analyzer until the source is exhausted or SIGTERM/SIGINT is received.
+// If interval is set, onInterval is called periodically i.e. to emit intermediate reports
+func RunDaemon(a *tnsparse.Analyzer, packetSource *gopacket.PacketSource, h *DaemonHealth, systemd bool,
+	interval time.Duration, onInterval func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	packets := packetSource.Packets()
+	h.SetReady(true)
+	if systemd {
+		if err := SdNotify("READY=1"); err != nil {
+			log.Println("systemd notify failed:", err)
+		}
+	}
+
+loop:
+	for {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				log.Println("Packet source closed")
+				break loop
+			}
+			a.Feed(packet)
+			atomic.AddUint64(&h.packets, 1)
+		case <-tick:
+			onInterval()
+		case sig := <-sigs:
+			log.Println("Received signal", sig, "- flushing final report")
+			break loop
+		}
+	}
+	a.Flush()
+
+	h.SetReady(false)
+	if systemd {
+		if err := SdNotify("STOPPING=1"); err != nil {
+			log.Println("systemd notify failed:", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// debugDumpBytes is how much of each payload is hex dumped
+const debugDumpBytes = 512
+
+// ConversationSampler writes the first conversations of the capture packet by packet with all fields the
+// parser decoded (-debug-conversations), an audit of parsing without -d logging of every packet
+type ConversationSampler struct {
+	Dir    string
+	Max    int
+	parser *tnsparse.Parser
+	chosen map[string]int //Number of each sampled conversation, in order of their first packets
+	err    error
+}
+
+// NewConversationSampler creates dir for dumps of the first max conversations
+func NewConversationSampler(dir string, max int) (*ConversationSampler, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ConversationSampler{Dir: dir, Max: max, chosen: make(map[string]int)}, nil
+}
+
+// WithConversationSampler dumps the first conversations seen by the analyzer
+func WithConversationSampler(s *ConversationSampler) tnsparse.Option {
+	return func(a *tnsparse.Analyzer) {
+		s.parser = a.Parser
+		a.Parser.ConversationStartHooks = append(a.Parser.ConversationStartHooks, s.start)
+		a.Parser.EvictionHooks = append(a.Parser.EvictionHooks, s.dump)
+	}
+}
+
+func (s *ConversationSampler) start(conversationId string) {
+	if _, ok := s.chosen[conversationId]; !ok && len(s.chosen) < s.Max {
+		s.chosen[conversationId] = len(s.chosen) + 1
+	}
+}
+
+// dump writes conversation if it is sampled, before its packets are dropped by eviction or at Close
+func (s *ConversationSampler) dump(conversationId string) {
+	n, ok := s.chosen[conversationId]
+	if !ok || n == 0 {
+		return
+	}
+	s.chosen[conversationId] = 0 //Kolejne pakiety tej samej konwersacji po eviction juz nie
+	if err := s.write(n, conversationId, s.parser.Conversations[conversationId]); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *ConversationSampler) write(n int, conversationId string, packets []tnsparse.SQLtcp) error {
+	name := strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(conversationId)
+	f, err := os.Create(filepath.Join(s.Dir, fmt.Sprintf("%03d_%s.txt", n, name)))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	profile := s.parser.Profile(conversationId)
+	fmt.Fprintf(w, "Conversation %s\tdatabase %s\tclient %s\tTTC profile %s\t%d packets\n", conversationId,
+		tnsparse.DBLabelOf(conversationId), stats.ClientLabel(tnsparse.ClientIP(conversationId)), profile.Name, len(packets))
+	if c, ok := s.parser.Connections[conversationId]; ok {
+		fmt.Fprintf(w, "First seen %v\topened %v\tclosed %v %s\tlast seen %v\n", c.FirstSeen, c.Opened, c.Closed, c.CloseFlag, c.LastSeen)
+	}
+	for i := range packets {
+		p := &packets[i]
+		dir := "->"
+		if p.Response {
+			dir = "<-"
+		}
+		offset := float64(p.Timestamp.Sub(packets[0].Timestamp).Nanoseconds()) / 1000000
+		fmt.Fprintf(w, "\n#%d %s %s +%f ms\t%d bytes\tseq %d ack %d\tRTT %f ms", i, dir,
+			p.Timestamp.Format("2006-01-02 15:04:05.000000"), offset, p.Size, p.Seq, p.Ack, float64(p.RTT)/1000000)
+		if p.Reordered {
+			fmt.Fprint(w, "\treordered")
+		}
+		if len(p.Payload) > 4 {
+			fmt.Fprintf(w, "\tTNS type %d", p.Payload[4])
+		}
+		if len(p.Payload) > profile.MsgType+1 {
+			fmt.Fprintf(w, "\tTTC message %d function 0x%02x", p.Payload[profile.MsgType], p.Payload[profile.MsgType+1])
+		}
+		fmt.Fprintf(w, "\nsqlid %s\treused %d\trows %d", p.SQL_id, p.IsReused, p.Rows)
+		if p.OraErr != "" {
+			fmt.Fprint(w, "\t", p.OraErr)
+		}
+		if p.SQL != "_" && p.SQL != "SQL_END" {
+			fmt.Fprint(w, "\nSQL: ", p.SQL)
+		} else {
+			fmt.Fprint(w, "\t", p.SQL)
+		}
+		fmt.Fprintln(w)
+		if p.Payload == nil && p.Size > 0 {
+			fmt.Fprintln(w, "payload dropped by -low-memory")
+			continue
+		}
+		payload := p.Payload
+		if len(payload) > debugDumpBytes {
+			payload = payload[:debugDumpBytes]
+		}
+		w.WriteString(hex.Dump(payload))
+		if len(p.Payload) > debugDumpBytes {
+			fmt.Fprintf(w, "... %d more bytes\n", len(p.Payload)-debugDumpBytes)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close dumps sampled conversations still kept in memory
+func (s *ConversationSampler) Close() error {
+	for c := range s.chosen {
+		s.dump(c)
+	}
+	if s.err != nil {
+		return fmt.Errorf("can't write conversation dump: %v", s.err)
+	}
+	return nil
+}
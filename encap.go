@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Encapsulations between Ethernet and IP delivered by SPAN ports and taps: 802.1Q tags, 802.1ad (QinQ)
+// service tags also with pre-standard types, and MPLS label stacks, also carrying Ethernet pseudowires
+const (
+	ethTypeQinQ9100 = layers.EthernetType(0x9100)
+	ethTypeQinQ9200 = layers.EthernetType(0x9200)
+
+	mplsLabelLen      = 4
+	mplsBottomOfStack = 0x100
+	pwControlWordLen  = 4  //Control word of Ethernet over MPLS pseudowire, first nibble 0
+	maxEncapsulations = 16 //Tags and labels skipped at most
+)
+
+var errEncapsulation = errors.New("too many VLAN tags or MPLS labels")
+
+// decodeEthernet decodes Ethernet frame and skips VLAN tags and MPLS labels in front of its IP packet
+func decodeEthernet(data []byte, p gopacket.PacketBuilder) error {
+	eth := &layers.Ethernet{}
+	if err := eth.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(eth)
+	p.SetLinkLayer(eth)
+	return decodeEncapsulated(eth.EthernetType, eth.Payload, p)
+}
+
+// decodeEncapsulated walks tags and labels of type typ at the beginning of data and decodes what follows them
+func decodeEncapsulated(typ layers.EthernetType, data []byte, p gopacket.PacketBuilder) error {
+	for i := 0; i < maxEncapsulations; i++ {
+		switch typ {
+		case layers.EthernetTypeDot1Q, layers.EthernetTypeQinQ, ethTypeQinQ9100, ethTypeQinQ9200:
+			tag := &layers.Dot1Q{}
+			if err := tag.DecodeFromBytes(data, p); err != nil {
+				return err
+			}
+			p.AddLayer(tag)
+			typ, data = tag.Type, tag.Payload
+		case layers.EthernetTypeMPLSUnicast, layers.EthernetTypeMPLSMulticast:
+			if len(data) < mplsLabelLen {
+				return errors.New("MPLS label too short")
+			}
+			v := binary.BigEndian.Uint32(data)
+			label := &layers.MPLS{
+				BaseLayer:    layers.BaseLayer{Contents: data[:mplsLabelLen], Payload: data[mplsLabelLen:]},
+				Label:        v >> 12,
+				TrafficClass: uint8(v>>9) & 0x7,
+				StackBottom:  v&mplsBottomOfStack != 0,
+				TTL:          uint8(v),
+			}
+			p.AddLayer(label)
+			data = label.Payload
+			if !label.StackBottom {
+				continue
+			}
+			if len(data) == 0 {
+				return nil
+			}
+			//Pod etykietami nie ma typu - IP poznaje sie po wersji, 0 to control word pseudowire z ramka Ethernet
+			switch data[0] >> 4 {
+			case 4:
+				return layers.LayerTypeIPv4.Decode(data, p)
+			case 6:
+				return layers.LayerTypeIPv6.Decode(data, p)
+			case 0:
+				if len(data) > pwControlWordLen {
+					return decodeEthernet(data[pwControlWordLen:], p)
+				}
+			}
+			return p.NextDecoder(gopacket.LayerTypePayload)
+		default:
+			return typ.Decode(data, p)
+		}
+	}
+	return errEncapsulation
+}
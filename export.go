@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// CSVExporter writes one row per execution, so executions can be pivoted outside of stado
+type CSVExporter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+// NewCSVExporter creates file and writes the header
+func NewCSVExporter(file string) (*CSVExporter, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	e := &CSVExporter{f: f, w: csv.NewWriter(f)}
+	header := []string{"timestamp", "start_unix_ns", "sql_id", "conversation", "db", "client_host", "client_label", "client_port", "app_ms", "net_ms", "packets", "bytes", "reused", "error", "rows", "first_response_ms", "streaming_ms"}
+	for _, m := range tnsparse.CustomMetrics {
+		header = append(header, m.Name)
+	}
+	e.w.Write(header)
+	return e, nil
+}
+
+// Write is an ExecutionHook
+func (e *CSVExporter) Write(ex *tnsparse.Execution) {
+	row := []string{
+		ex.Start.Format(time.RFC3339Nano),
+		strconv.FormatInt(ex.Start.UnixNano(), 10),
+		ex.SQLid,
+		ex.Conversation,
+		tnsparse.DBLabelOf(ex.Conversation),
+		tnsparse.HostName(tnsparse.ClientIP(ex.Conversation)),
+		stats.ClientLabel(tnsparse.ClientIP(ex.Conversation)),
+		tnsparse.ClientPort(ex.Conversation),
+		strconv.FormatFloat(float64(ex.AppNs)/1000000, 'f', 6, 64),
+		strconv.FormatFloat(float64(ex.NetNs)/1000000, 'f', 6, 64),
+		strconv.FormatUint(uint64(ex.Packets), 10),
+		strconv.FormatUint(ex.Bytes, 10),
+		strconv.FormatUint(uint64(ex.Reused), 10),
+		ex.Error,
+		strconv.FormatUint(ex.Rows, 10),
+		strconv.FormatFloat(float64(ex.FirstNs)/1000000, 'f', 6, 64),
+		strconv.FormatFloat(float64(ex.StreamNs())/1000000, 'f', 6, 64),
+	}
+	for i := range tnsparse.CustomMetrics {
+		v := 0.0
+		if ex.Metrics != nil {
+			v = ex.Metrics[i]
+		}
+		row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	e.w.Write(row)
+}
+
+func (e *CSVExporter) Close() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		e.f.Close()
+		return fmt.Errorf("can't write CSV: %v", err)
+	}
+	return e.f.Close()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// ListInterfaces prints capture devices with their friendly names, so they can be passed to -iface
+func ListInterfaces() error {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		return fmt.Errorf("can't list interfaces: %v (%s)", err, captureHint)
+	}
+	for i, dev := range devs {
+		var addrs []string
+		for _, a := range dev.Addresses {
+			addrs = append(addrs, a.IP.String())
+		}
+		desc := dev.Description
+		if desc == "" {
+			desc = "-"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", i+1, dev.Name, desc, strings.Join(addrs, ","))
+	}
+	return nil
+}
+
+// ResolveInterface translates -iface value to a pcap device name.
+// It accepts the device name, its number from -list-interfaces or friendly name (adapter description),
+// because on Windows device names look like \Device\NPF_{GUID}
+func ResolveInterface(iface string) (string, error) {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		//Nie da sie wylistowac - moze sie uda otworzyc po nazwie
+		return iface, nil
+	}
+	for _, dev := range devs {
+		if dev.Name == iface {
+			return dev.Name, nil
+		}
+	}
+	if n, err := strconv.Atoi(iface); err == nil && n >= 1 && n <= len(devs) {
+		return devs[n-1].Name, nil
+	}
+	for _, dev := range devs {
+		if dev.Description != "" && strings.EqualFold(dev.Description, iface) {
+			return dev.Name, nil
+		}
+	}
+	return "", fmt.Errorf("interface %q not found, use -list-interfaces", iface)
+}
+
+// IsLoopback tells if iface (name, number or description as for -iface) is a loopback interface
+func IsLoopback(iface string) bool {
+	name, err := ResolveInterface(iface)
+	if err != nil {
+		name = iface
+	}
+	if i, err := net.InterfaceByName(name); err == nil {
+		return i.Flags&net.FlagLoopback != 0
+	}
+	return name == "lo" || strings.HasPrefix(name, "lo0") || strings.Contains(strings.ToLower(name), "loopback")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvExecution is an execution read back from -csv export
+type csvExecution struct {
+	start  time.Time
+	appMs  float64
+	record []string
+}
+
+// JoinCmd attributes application log lines to executions exported with -csv,
+// matching client port and time of the log line with execution window
+func JoinCmd(args []string) {
+	fs := flag.NewFlagSet("join", flag.ExitOnError)
+	csvFile := fs.String("csv", "", "executions exported with -csv")
+	logFile := fs.String("log", "", "application log file")
+	timeRe := fs.String("time-re", `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?`, "regular expression of timestamp in log line")
+	timeLayout := fs.String("time-layout", "2006-01-02 15:04:05.999999999", "Go time layout of the timestamp (T and comma are normalized)")
+	portRe := fs.String("port-re", `(?i)port[=: ](\d+)`, "regular expression with client port as the first group")
+	offset := fs.Duration("offset", 0, "added to log timestamps i.e. to fix timezone or clock difference")
+	tolerance := fs.Duration("tolerance", 100*time.Millisecond, "how far from execution window log timestamp may be")
+	fs.Parse(args)
+
+	if *csvFile == "" || *logFile == "" {
+		fmt.Println("Usage: stado join -csv executions.csv -log app.log [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	rTime, err := regexp.Compile(*timeRe)
+	if err != nil {
+		fmt.Println("Bad -time-re:", err)
+		os.Exit(1)
+	}
+	rPort, err := regexp.Compile(*portRe)
+	if err == nil && rPort.NumSubexp() == 0 {
+		err = fmt.Errorf("no group with client port")
+	}
+	if err != nil {
+		fmt.Println("Bad -port-re:", err)
+		os.Exit(1)
+	}
+
+	byPort, header, err := readExecutionsCSV(*csvFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*logFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defer f.Close()
+
+	out := csv.NewWriter(os.Stdout)
+	out.Comma = '\t'
+	out.Write(append([]string{"log_line"}, header...))
+	matched, lines := 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines++
+		pm := rPort.FindStringSubmatch(line)
+		ts := rTime.FindString(line)
+		if pm == nil || len(pm) < 2 || ts == "" {
+			continue
+		}
+		ts = strings.Replace(strings.Replace(ts, "T", " ", 1), ",", ".", 1)
+		t, err := time.Parse(*timeLayout, ts)
+		if err != nil {
+			continue
+		}
+		if ex := matchExecution(byPort[pm[1]], t.Add(*offset), *tolerance); ex != nil {
+			out.Write(append([]string{line}, ex.record...))
+			matched++
+		}
+	}
+	out.Flush()
+	fmt.Fprintln(os.Stderr, "Matched", matched, "of", lines, "log lines")
+}
+
+func readExecutionsCSV(file string) (map[string][]csvExecution, []string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	col := make(map[string]int)
+	for i, h := range header {
+		col[h] = i
+	}
+	for _, c := range []string{"start_unix_ns", "client_port", "app_ms"} {
+		if _, ok := col[c]; !ok {
+			return nil, nil, fmt.Errorf("%s: column %s not found, export executions with -csv", file, c)
+		}
+	}
+
+	byPort := make(map[string][]csvExecution)
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		ns, _ := strconv.ParseInt(rec[col["start_unix_ns"]], 10, 64)
+		appMs, _ := strconv.ParseFloat(rec[col["app_ms"]], 64)
+		port := rec[col["client_port"]]
+		byPort[port] = append(byPort[port], csvExecution{start: time.Unix(0, ns).UTC(), appMs: appMs, record: rec})
+	}
+	for port := range byPort {
+		execs := byPort[port]
+		sort.Slice(execs, func(i, j int) bool { return execs[i].start.Before(execs[j].start) })
+	}
+	return byPort, header, nil
+}
+
+// matchExecution returns execution whose window [start, start+app] is the closest to t
+func matchExecution(execs []csvExecution, t time.Time, tolerance time.Duration) *csvExecution {
+	var best *csvExecution
+	bestDist := tolerance + 1
+	for i := range execs {
+		start := execs[i].start
+		end := start.Add(time.Duration(execs[i].appMs * float64(time.Millisecond)))
+		dist := time.Duration(0)
+		if t.Before(start) {
+			dist = start.Sub(t)
+		} else if t.After(end) {
+			dist = t.Sub(end)
+		}
+		if dist <= tolerance && dist < bestDist {
+			best, bestDist = &execs[i], dist
+		}
+	}
+	return best
+}
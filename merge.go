@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// estimateSamples is how many packets of each file are read to estimate time offset between captures
+const estimateSamples = 200000
+
+// mergedSource interleaves packets of several capture files in timestamp order,
+// shifting each file by its time offset (i.e. clock difference between hosts)
+type mergedSource struct {
+	sources  []CaptureSource
+	offsets  []time.Duration
+	heads    []*mergedPacket //next packet of each source, nil if not read yet
+	linkType layers.LinkType
+}
+
+type mergedPacket struct {
+	data []byte
+	ci   gopacket.CaptureInfo
+	err  error
+}
+
+// OpenMergedSource opens capture files taken on different hosts as a single source. offsets are
+// durations ("-350ms") or "auto" (estimated from packets seen in both files), one per file, empty means 0
+func OpenMergedSource(backend string, files []string, offsets []string, dbPort string) (CaptureSource, error) {
+	if len(offsets) > 0 && len(offsets) != len(files) {
+		return nil, fmt.Errorf("%d time offsets given for %d capture files", len(offsets), len(files))
+	}
+	m := &mergedSource{}
+	for i, file := range files {
+		s, err := OpenCaptureSource(backend, file, "")
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if i > 0 && s.LinkType() != m.linkType {
+			s.Close()
+			m.Close()
+			return nil, fmt.Errorf("%s: link type %v differs from %v of %s", file, s.LinkType(), m.linkType, files[0])
+		}
+		m.linkType = s.LinkType()
+
+		offset := time.Duration(0)
+		if len(offsets) > 0 && offsets[i] == "auto" && i > 0 {
+			if offset, err = EstimateOffset(backend, files[0], file, dbPort); err != nil {
+				s.Close()
+				m.Close()
+				return nil, err
+			}
+			if !Quiet {
+				fmt.Fprintln(os.Stderr, "Estimated time offset of", file, "is", offset)
+			}
+		} else if len(offsets) > 0 && offsets[i] != "auto" {
+			if offset, err = time.ParseDuration(offsets[i]); err != nil {
+				s.Close()
+				m.Close()
+				return nil, fmt.Errorf("time offset of %s: %v", file, err)
+			}
+		}
+		m.sources = append(m.sources, s)
+		m.offsets = append(m.offsets, offset)
+		m.heads = append(m.heads, nil)
+	}
+	return m, nil
+}
+
+func (m *mergedSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	next := -1
+	for i, s := range m.sources {
+		if m.heads[i] == nil {
+			data, ci, err := s.ReadPacketData()
+			ci.Timestamp = ci.Timestamp.Add(m.offsets[i])
+			m.heads[i] = &mergedPacket{data, ci, err}
+		}
+		if m.heads[i].err == io.EOF {
+			continue
+		}
+		if m.heads[i].err != nil {
+			err := m.heads[i].err
+			m.heads[i] = nil
+			return nil, gopacket.CaptureInfo{}, err
+		}
+		if next < 0 || m.heads[i].ci.Timestamp.Before(m.heads[next].ci.Timestamp) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	p := m.heads[next]
+	m.heads[next] = nil
+	return p.data, p.ci, nil
+}
+
+func (m *mergedSource) LinkType() layers.LinkType { return m.linkType }
+
+// SetBPFFilter sets filter on all files, if any of them can't filter, parser has to
+func (m *mergedSource) SetBPFFilter(filter string) error {
+	var noBPF error
+	for _, s := range m.sources {
+		if err := s.SetBPFFilter(filter); err == ErrNoBPF {
+			noBPF = ErrNoBPF
+		} else if err != nil {
+			return err
+		}
+	}
+	return noBPF
+}
+
+func (m *mergedSource) Close() {
+	for _, s := range m.sources {
+		s.Close()
+	}
+}
+
+// segmentKey identifies the same TCP segment seen at two capture points
+type segmentKey struct {
+	src, dst     string
+	sport, dport layers.TCPPort
+	seq, ack     uint32
+	length       int
+}
+
+// readSegments returns timestamp of the first occurrence of each TCP segment with payload in file
+func readSegments(backend string, file string) (map[segmentKey]time.Time, error) {
+	s, err := OpenCaptureSource(backend, file, "")
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	segments := make(map[segmentKey]time.Time)
+	decoder := PacketDecoder(s.LinkType())
+	for n := 0; n < estimateSamples; n++ {
+		data, ci, err := s.ReadPacketData()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		packet := gopacket.NewPacket(data, decoder, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		ip, ok := tnsparse.IPHeaderOf(packet)
+		tcp, _ := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || tcp == nil || len(tcp.Payload) == 0 {
+			continue
+		}
+		k := segmentKey{ip.SrcIP.String(), ip.DstIP.String(), tcp.SrcPort, tcp.DstPort, tcp.Seq, tcp.Ack, len(tcp.Payload)}
+		if _, ok := segments[k]; !ok {
+			segments[k] = ci.Timestamp
+		}
+	}
+	return segments, nil
+}
+
+// EstimateOffset estimates how much file has to be shifted to match clock of ref, using segments seen in both.
+// Requests reach the database side later by one-way latency and responses earlier by the same latency,
+// so the mean of both median differences is the clock difference
+func EstimateOffset(backend string, ref string, file string, dbPort string) (time.Duration, error) {
+	refSegments, err := readSegments(backend, ref)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", ref, err)
+	}
+	segments, err := readSegments(backend, file)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", file, err)
+	}
+	var requests, responses []time.Duration
+	for k, ts := range segments {
+		refTs, ok := refSegments[k]
+		if !ok {
+			continue
+		}
+		if tnsparse.IsPort(k.dport, dbPort) {
+			requests = append(requests, ts.Sub(refTs))
+		} else {
+			responses = append(responses, ts.Sub(refTs))
+		}
+	}
+	log.Println("Time offset estimation of", file, "- matched requests:", len(requests), "responses:", len(responses))
+	switch {
+	case len(requests) > 0 && len(responses) > 0:
+		return -(medianDuration(requests) + medianDuration(responses)) / 2, nil
+	case len(requests) > 0:
+		return -medianDuration(requests), nil
+	case len(responses) > 0:
+		return -medianDuration(responses), nil
+	}
+	return 0, fmt.Errorf("can't estimate time offset of %s: no TCP segments common with %s, give the offset manually", file, ref)
+}
+
+func medianDuration(d []time.Duration) time.Duration {
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return d[len(d)/2]
+}
+
+// SplitFiles splits -f value into capture files merged into one timeline
+func SplitFiles(files string) []string {
+	var list []string
+	for _, f := range strings.Split(files, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			list = append(list, f)
+		}
+	}
+	return list
+}
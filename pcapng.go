@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a} //Section Header Block, the first block of every pcapng file
+	gzipMagic   = []byte{0x1f, 0x8b}
+)
+
+// IsPcapng tells if capture file is in pcapng format (default of current Wireshark and tcpdump)
+func IsPcapng(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(pcapngMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, pcapngMagic)
+}
+
+// openPcapgoReader reads classic pcap or pcapng from r, the format (and gzip compression) is detected from the first bytes
+func openPcapgoReader(r io.Reader, c io.Closer) (CaptureSource, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	if magic, err := br.Peek(len(pcapngMagic)); err == nil && bytes.Equal(magic, pcapngMagic) {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, err
+		}
+		return &pcapngSource{r: ng, f: c}, nil
+	}
+	pr, err := pcapgo.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return &pcapgoSource{Reader: pr, f: c}, nil
+}
+
+// pcapngSource reads pcapng with pure Go reader. Interfaces of one file may have different link types
+// (i.e. eth0 and lo captured together), so frames of non-Ethernet interfaces get a synthetic Ethernet
+// header and the whole source is decoded as Ethernet
+type pcapngSource struct {
+	r *pcapgo.NgReader
+	f io.Closer
+}
+
+func (s *pcapngSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := s.r.ReadPacketData()
+	if err != nil {
+		return data, ci, err
+	}
+	iface, err := s.r.Interface(ci.InterfaceIndex)
+	if err != nil || iface.LinkType == layers.LinkTypeEthernet {
+		return data, ci, nil
+	}
+	frame := toEthernet(data, iface.LinkType)
+	ci.CaptureLength, ci.Length = len(frame), ci.Length-len(data)+len(frame)
+	return frame, ci, nil
+}
+
+// toEthernet replaces link layer of frame with Ethernet header carrying its IP packet
+func toEthernet(data []byte, lt layers.LinkType) []byte {
+	p := gopacket.NewPacket(data, PacketDecoder(lt), gopacket.NoCopy)
+	nl := p.NetworkLayer()
+	if nl == nil {
+		return data
+	}
+	ethType := layers.EthernetTypeIPv4
+	if nl.LayerType() == layers.LayerTypeIPv6 {
+		ethType = layers.EthernetTypeIPv6
+	}
+	frame := make([]byte, 14, 14+len(nl.LayerContents())+len(nl.LayerPayload()))
+	binary.BigEndian.PutUint16(frame[12:14], uint16(ethType))
+	frame = append(frame, nl.LayerContents()...)
+	return append(frame, nl.LayerPayload()...)
+}
+
+func (s *pcapngSource) LinkType() layers.LinkType        { return layers.LinkTypeEthernet }
+func (s *pcapngSource) SetBPFFilter(filter string) error { return ErrNoBPF }
+func (s *pcapngSource) Close()                           { s.f.Close() }
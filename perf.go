@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	_ "net/http/pprof" //rejestruje /debug/pprof/ w http.DefaultServeMux
+	"os"
+	"runtime"
+	"time"
+)
+
+// StartPprof serves Go profiling endpoints on addr, i.e. go tool pprof http://localhost:6060/debug/pprof/profile
+func StartPprof(addr string) {
+	go func() {
+		log.Println("pprof server listening on", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			fmt.Println("pprof server:", err)
+			os.Exit(2)
+		}
+	}()
+}
+
+// SelfMetrics is performance of stado itself, printed at the end of run so slow analyses can be reported with data
+type SelfMetrics struct {
+	Packets    uint64
+	Parsing    time.Duration //time spent in the packet loop
+	Wall       time.Duration //whole run including statistics and report
+	PeakRSS    uint64        //bytes, 0 if the platform doesn't report it
+	TotalAlloc uint64
+	NumGC      uint32
+	GCPause    time.Duration
+	GCCPU      float64 //fraction of CPU time used by GC since start
+}
+
+// MeasureSelf collects self metrics of a run which started at start and parsed packets in parsing time
+func MeasureSelf(packets uint64, start time.Time, parsing time.Duration) SelfMetrics {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return SelfMetrics{
+		Packets:    packets,
+		Parsing:    parsing,
+		Wall:       time.Since(start),
+		PeakRSS:    peakRSS(),
+		TotalAlloc: ms.TotalAlloc,
+		NumGC:      ms.NumGC,
+		GCPause:    time.Duration(ms.PauseTotalNs),
+		GCCPU:      ms.GCCPUFraction,
+	}
+}
+
+// PacketsPerSec returns parsing throughput
+func (m SelfMetrics) PacketsPerSec() float64 {
+	if m.Parsing <= 0 {
+		return 0
+	}
+	return float64(m.Packets) / m.Parsing.Seconds()
+}
+
+func (m SelfMetrics) Print(w io.Writer) {
+	rss := "n/a"
+	if m.PeakRSS > 0 {
+		rss = fmt.Sprintf("%.1f MB", float64(m.PeakRSS)/1024/1024)
+	}
+	fmt.Fprintf(w, "Self-metrics: %d packets in %v (%.0f packets/s), wall time %v, peak RSS %s, allocated %.1f MB, GC: %d cycles, pause %v, %.2f%% CPU\n",
+		m.Packets, m.Parsing.Round(time.Millisecond), m.PacketsPerSec(), m.Wall.Round(time.Millisecond), rss,
+		float64(m.TotalAlloc)/1024/1024, m.NumGC, m.GCPause.Round(time.Microsecond), m.GCCPU*100)
+}
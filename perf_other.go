@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// peakRSS is not reported on this platform
+func peakRSS() uint64 {
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Sizes of pcap headers, offset in capture files is estimated from them and captured lengths
+const (
+	pcapFileHeader   = 24
+	pcapRecordHeader = 16
+)
+
+// ProgressSource counts packets and bytes read from capture source and prints progress to stderr
+// every interval (-progress): percentage of the files read, packets/s and estimated time remaining
+type ProgressSource struct {
+	CaptureSource
+	Total   int64 //size of capture files, 0 if unknown (live capture, stdin, remote)
+	read    int64
+	packets int64
+	start   time.Time
+	all     bool //all packets were read
+	out     io.Writer
+	done    chan struct{}
+}
+
+// CaptureSize is the size of capture files given in -f, 0 if it can't be known before reading
+func CaptureSize(files string) int64 {
+	var size int64
+	for _, file := range SplitFiles(files) {
+		set := []string{file}
+		if IsRemote(file) || file == "-" {
+			return 0
+		} else if IsCaptureSet(file) {
+			var err error
+			if set, err = captureSetFiles(file); err != nil {
+				return 0
+			}
+		}
+		for _, f := range set {
+			st, err := os.Stat(f)
+			if err != nil {
+				return 0
+			}
+			size += st.Size()
+		}
+	}
+	return size
+}
+
+// NewProgressSource starts printing progress of src every interval, total is size of its files or 0
+func NewProgressSource(src CaptureSource, total int64, interval time.Duration) *ProgressSource {
+	p := &ProgressSource{CaptureSource: src, Total: total, start: time.Now(), out: os.Stderr, done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprint(p.out, "\r"+p.line(time.Now()))
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *ProgressSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := p.CaptureSource.ReadPacketData()
+	if err == nil {
+		atomic.AddInt64(&p.read, pcapRecordHeader+int64(ci.CaptureLength))
+		atomic.AddInt64(&p.packets, 1)
+	}
+	return data, ci, err
+}
+
+// line is the progress line at now
+func (p *ProgressSource) line(now time.Time) string {
+	read, packets := atomic.LoadInt64(&p.read)+pcapFileHeader, atomic.LoadInt64(&p.packets)
+	elapsed := now.Sub(p.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(packets) / elapsed.Seconds()
+	}
+	if p.Total == 0 {
+		return fmt.Sprintf("%d MB read, %d packets, %.0f packets/s, %v elapsed   ",
+			read>>20, packets, rate, elapsed.Round(time.Second))
+	}
+	//Przesuniecie jest szacowane, wiec 100% dopiero po przeczytaniu calego zrodla
+	done := float64(read) / float64(p.Total)
+	if p.all {
+		done = 1
+	} else if done > 0.999 {
+		done = 0.999
+	}
+	eta := time.Duration(float64(elapsed) * (1 - done) / done)
+	return fmt.Sprintf("%5.1f%% of %d MB, %.0f packets/s, %v elapsed, %v remaining   ",
+		100*done, p.Total>>20, rate, elapsed.Round(time.Second), eta.Round(time.Second))
+}
+
+// Finish stops printing progress and ends the progress line before the report is printed, all tells
+// if the source was read to the end
+func (p *ProgressSource) Finish(all bool) {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+		p.all = all
+		fmt.Fprintln(p.out, "\r"+p.line(time.Now()))
+	}
+}
+
+func (p *ProgressSource) Close() {
+	p.Finish(false)
+	p.CaptureSource.Close()
+}
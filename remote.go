@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var rS3ErrorCode = regexp.MustCompile(`<Code>([^<]+)</Code>`)
+
+// IsRemote tells if -f points to object storage or web server instead of a local file
+func IsRemote(file string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(strings.ToLower(file), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenRemote streams capture from http(s):// or s3://bucket/key URL, nothing is stored on disk.
+// S3 requests are signed with credentials from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY (or ~/.aws/credentials),
+// without credentials the object has to be public. AWS_ENDPOINT_URL selects S3 compatible storage (i.e. MinIO)
+func OpenRemote(rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var req *http.Request
+	if strings.EqualFold(u.Scheme, "s3") {
+		req, err = s3Request(u.Host, strings.TrimPrefix(u.Path, "/"))
+	} else {
+		req, err = http.NewRequest("GET", rawURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		//S3 opisuje blad w XML, np. <Code>AccessDenied</Code>
+		if code := rS3ErrorCode.FindSubmatch(body); code != nil {
+			return nil, fmt.Errorf("%s: %s (%s)", rawURL, resp.Status, code[1])
+		}
+		return nil, fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// awsCredentials are taken from environment first, then from the shared credentials file
+type awsCredentials struct {
+	AccessKey, SecretKey, Token string
+}
+
+func loadAWSCredentials() awsCredentials {
+	c := awsCredentials{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+	if c.AccessKey != "" {
+		return c
+	}
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return c
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return c
+	}
+	defer f.Close()
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if section != profile || len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			c.AccessKey = strings.TrimSpace(kv[1])
+		case "aws_secret_access_key":
+			c.SecretKey = strings.TrimSpace(kv[1])
+		case "aws_session_token":
+			c.Token = strings.TrimSpace(kv[1])
+		}
+	}
+	return c
+}
+
+// s3Request builds GET of the object, signed with AWS Signature Version 4 if credentials are available
+func s3Request(bucket string, key string) (*http.Request, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	//Z wlasnym endpointem (MinIO, Ceph) bucket idzie w sciezce, w AWS w nazwie hosta
+	endpoint, path := "https://"+bucket+".s3."+region+".amazonaws.com", "/"+key
+	if e := os.Getenv("AWS_ENDPOINT_URL"); e != "" {
+		endpoint, path = strings.TrimSuffix(e, "/"), "/"+bucket+"/"+key
+	}
+	req, err := http.NewRequest("GET", endpoint+s3EscapePath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	creds := loadAWSCredentials()
+	if creds.AccessKey == "" {
+		return req, nil
+	}
+	signS3Request(req, creds, region, time.Now().UTC())
+	return req, nil
+}
+
+// s3EscapePath URI-encodes everything except unreserved characters and '/', as required by SigV4 canonical request
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func signS3Request(req *http.Request, creds awsCredentials, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", "UNSIGNED-PAYLOAD")
+	if creds.Token != "" {
+		req.Header.Set("x-amz-security-token", creds.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{"GET", req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, "UNSIGNED-PAYLOAD"}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + creds.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,39 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// apdexTop is number of sqlids with the worst scores printed
+const apdexTop = 10
+
+// printApdex prints overall score and sqlids with the worst scores
+func printApdex(a *stats.Analysis) {
+	if a.Apdex == nil {
+		return
+	}
+	fmt.Printf("\nApdex (T = %s ms): %.2f\t%d satisfied, %d tolerating, %d frustrated\n", Number(a.Apdex.ThresholdMs, 0),
+		a.Apdex.Score, a.Apdex.Satisfied, a.Apdex.Tolerating, a.Apdex.Frustrated)
+	var rows []stats.SQLstatsJSON
+	for _, r := range a.SQLs {
+		if r.Apdex != nil {
+			rows = append(rows, r)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Apdex.Score != rows[j].Apdex.Score {
+			return rows[i].Apdex.Score < rows[j].Apdex.Score
+		}
+		return rows[i].ElaAppMs > rows[j].ElaAppMs
+	})
+	fmt.Println("SQL ID\t\tApdex\tExec\tSatisfied\tTolerating\tFrustrated")
+	for i, r := range rows {
+		if i == apdexTop {
+			break
+		}
+		fmt.Printf("%s\t%.2f\t%d\t%d\t\t%d\t\t%d\n", r.SQLid, r.Apdex.Score, r.Executions, r.Apdex.Satisfied, r.Apdex.Tolerating, r.Apdex.Frustrated)
+	}
+}
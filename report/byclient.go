@@ -0,0 +1,24 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printSQLClients prints workload of each client executing sqlid. App time per execution relative to all
+// executions of the sqlid shows a client running a slow variant of the statement (i.e. other binds or NLS)
+func printSQLClients(a *stats.Analysis, rows []stats.SQLstatsJSON) {
+	fmt.Println("\nSQL by client")
+	fmt.Println("SQL ID\t\tClient\t\t\tS\tExec\tEla App" + unit("ms") + "\tEla Net" + unitNoSpace("ms") + "\tEla App/Exec\tApp p95\tx SQL App/Exec")
+	for _, r := range rows {
+		for _, c := range r.Clients {
+			ratio := 0.0
+			if r.AppPerExecMs > 0 {
+				ratio = c.AppPerExecMs / r.AppPerExecMs
+			}
+			fmt.Printf("%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%.2f\n", r.SQLid, a.HostLabel(c.Name), c.Sessions, c.Executions,
+				Ms(c.ElaAppMs), Ms(c.ElaNetMs), Ms(c.AppPerExecMs), Ms(c.AppP95Ms), ratio)
+		}
+	}
+}
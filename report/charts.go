@@ -0,0 +1,40 @@
+package report
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Chart rendering limits (-chart-workers, -max-charts)
+var (
+	ChartWorkers = runtime.NumCPU() //Charts rendered at the same time
+	MaxCharts    = 0                //Per-sqlid charts rendered at most, 0 - all
+)
+
+// renderParallel calls render for 0..n-1 from ChartWorkers goroutines. PNG encoding of thousands of
+// charts dominates runtime of large workloads, each chart is independent so they are spread over cores
+func renderParallel(n int, render func(i int)) {
+	workers := ChartWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				render(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
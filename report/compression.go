@@ -0,0 +1,20 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printCompression(cs *stats.CompressionStats) {
+	fmt.Println("\nSQL*Net compression\tS\tExec\t" + sizeHeader() + "\tBytes/Exec\tBytes/Session")
+	for _, g := range []struct {
+		name string
+		g    stats.CompressionGroup
+	}{{"compressed", cs.Compressed}, {"uncompressed", cs.Uncompressed}} {
+		fmt.Printf("%s\t\t%d\t%d\t%s\t%s\t%s\n", g.name, g.g.Sessions, g.g.Executions, Bytes(g.g.Bytes), BytesF(g.g.BytesPerExec), BytesF(g.g.BytesPerSession))
+	}
+	if cs.Ratio > 0 {
+		fmt.Printf("Uncompressed sessions send %.2fx more bytes per execution\n", cs.Ratio)
+	}
+}
@@ -0,0 +1,17 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printConcurrency prints how many sessions execute each sqlid at the same time - serialized vs parallel load
+func printConcurrency(rows []stats.SQLstatsJSON) {
+	fmt.Println("\nSession concurrency\nSQL ID\t\tMax\tAvg")
+	for _, r := range rows {
+		if r.MaxSessions > 0 {
+			fmt.Printf("%s\t%d\t%.2f\n", r.SQLid, r.MaxSessions, r.AvgSessions)
+		}
+	}
+}
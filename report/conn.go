@@ -0,0 +1,43 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/wcharczuk/go-chart"
+)
+
+func printSessionDurations(sd *stats.SessionDurationStats) {
+	fmt.Printf("\nSession duration%s of %d sessions: min %s median %s p95 %s max %s, shorter than %v: %d\n", unit("s"),
+		sd.Sessions, Sec(sd.MinS), Sec(sd.MedianS), Sec(sd.P95S), Sec(sd.MaxS), stats.ShortLifetime, sd.ShortLived)
+	for _, b := range sd.Histogram {
+		fmt.Printf("\t%s\t%d\n", b.Label, b.Sessions)
+	}
+}
+
+func renderSessionDurationsChart(sd *stats.SessionDurationStats, file string) {
+	var bars []chart.Value
+	for _, b := range sd.Histogram {
+		bars = append(bars, chart.Value{Value: float64(b.Sessions), Label: b.Label})
+	}
+	renderBars("Sessions by duration", bars, file)
+}
+
+func printChurn(a *stats.Analysis) {
+	ch := a.Churn
+	fmt.Println("\nConnections opened:", ch.Opened, "closed:", ch.Closed, "(RST:", ch.ClosedByRST, ")")
+	if len(ch.PerMinute) > 0 {
+		fmt.Println("Minute\t\t\tOpened\tClosed")
+		for _, m := range ch.PerMinute {
+			fmt.Printf("%s\t%d\t%d\n", m.Minute.Format("2006-01-02 15:04"), m.Opened, m.Closed)
+		}
+	}
+	fmt.Printf("Connection lifetime%s: min %s p50 %s p90 %s p99 %s max %s\n", unit("s"),
+		Sec(ch.LifetimeMinS), Sec(ch.LifetimeP50S), Sec(ch.LifetimeP90S), Sec(ch.LifetimeP99S), Sec(ch.LifetimeMaxS))
+	if len(ch.ShortSessions) > 0 {
+		fmt.Println("Sessions closed after fewer than", stats.ShortSessionExecs, "executions:", len(ch.ShortSessions))
+		for _, s := range ch.ShortSessions {
+			fmt.Printf("\t%s\t%d\t%s\n", a.ConversationLabel(s.Conversation), s.Executions, Sec(s.LifetimeS))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printIdleClients(a *stats.Analysis) {
+	rows := a.Idle
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Println("\nIdle client (idle >=", stats.IdleThreshold, ")\tSessions\tIdle sessions\tIdle"+unit("s")+"\tLongest idle"+unit("s"))
+	for _, ic := range rows {
+		fmt.Printf("%s\t%d\t%d\t%s\t%s\n", a.HostLabel(ic.Client), ic.Sessions, ic.IdleSessions, Sec(ic.IdleS), Sec(ic.LongestS))
+	}
+}
+
+func printIdleKills(a *stats.Analysis) {
+	kills := a.IdleKills
+	if len(kills) == 0 {
+		return
+	}
+	perSubnet := make(map[string]int)
+	for _, k := range kills {
+		perSubnet[k.Subnet]++
+	}
+	fmt.Println("\nConnections reset after idle >=", stats.IdleKillThreshold, "(firewall idle timeout suspected):", len(kills))
+	fmt.Println("Subnet\t\tResets")
+	for subnet, n := range perSubnet {
+		fmt.Printf("%s\t%d\n", a.SubnetLabel(subnet), n)
+	}
+	for _, k := range kills {
+		by := "client side"
+		if k.ResetByDB {
+			by = "db side"
+		}
+		fmt.Printf("\t%s\t%s\tidle %s%s\tRST from %s\n", k.Reset.Format("2006-01-02 15:04:05"), a.ConversationLabel(k.Conversation), Sec(k.IdleS), unitSuffix("s"), by)
+	}
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// profileSpike - buckets which app time per execution is that many times the median of buckets are marked as spikes
+const profileSpike = 2.0
+
+// printLoadProfile prints buckets of all sqlids and of the top ones, buckets with app time per execution
+// far above the usual one are marked with *
+func printLoadProfile(lp *stats.LoadProfileJSON) {
+	if lp == nil {
+		return
+	}
+	interval := time.Duration(lp.IntervalS * float64(time.Second))
+	fmt.Printf("\nLoad profile per %s (* - app time per execution over %.0fx the median of buckets)\n", interval, profileSpike)
+	printProfileBuckets(lp.Buckets, interval)
+	for _, s := range lp.SQLs {
+		fmt.Println("\nLoad profile of", s.SQLid)
+		printProfileBuckets(s.Buckets, interval)
+	}
+}
+
+func printProfileBuckets(buckets []stats.IntervalJSON, interval time.Duration) {
+	spike := spikeThreshold(buckets)
+	fmt.Println("Time\t\t\tExec\tExec/s\tEla App" + unit("ms") + "\tApp/Exec\tMax App\t\tEla Net" + unit("ms") + "\t" + sizeHeader())
+	for _, b := range buckets {
+		perExec, mark := 0.0, ""
+		if b.Executions > 0 {
+			perExec = b.AppMs / float64(b.Executions)
+		}
+		if spike > 0 && perExec > spike {
+			mark = " *"
+		}
+		fmt.Printf("%s\t%d\t%.1f\t%s\t\t%s%s\t\t%s\t\t%s\t\t%s\n", b.Start.Format("2006-01-02 15:04:05"), b.Executions,
+			float64(b.Executions)/interval.Seconds(), Ms(b.AppMs), Ms(perExec), mark, Ms(b.MaxAppMs), Ms(b.NetMs), Bytes(b.Bytes))
+	}
+}
+
+// renderLoadProfileChart renders app time per bucket of all sqlids and of the top ones
+func renderLoadProfileChart(lp *stats.LoadProfileJSON, file string) {
+	if lp == nil || len(lp.Buckets) < 2 {
+		return
+	}
+	series := func(buckets []stats.IntervalJSON, style chart.Style) chart.Series {
+		var x []time.Time
+		var y []float64
+		for _, b := range buckets {
+			x, y = append(x, b.Start), append(y, b.AppMs)
+		}
+		style.Show = true
+		return chart.TimeSeries{Style: style, XValues: x, YValues: y}
+	}
+	graph := chart.Chart{
+		Title: fmt.Sprintf("Ela app time per %s (ms) - red: all sqlids, other colors: top %d in report order",
+			time.Duration(lp.IntervalS*float64(time.Second)), len(lp.SQLs)),
+		TitleStyle: chart.StyleShow(),
+		Width:      1600,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    40,
+				Bottom: 10,
+			},
+		},
+		XAxis: chart.XAxis{Style: chart.StyleShow(), ValueFormatter: chart.TimeValueFormatterWithFormat("15:04:05")},
+		YAxis: chart.YAxis{Name: "Ela App (ms)", NameStyle: chart.StyleShow(), Style: chart.StyleShow()},
+		Series: []chart.Series{
+			series(lp.Buckets, chart.Style{StrokeColor: drawing.ColorRed, FillColor: drawing.ColorRed.WithAlpha(32)}),
+		},
+	}
+	for i, s := range lp.SQLs {
+		graph.Series = append(graph.Series, series(s.Buckets, chart.Style{StrokeColor: chart.GetDefaultColor(i + 1)}))
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	graph.Render(chart.PNG, f)
+	f.Close()
+}
+
+// spikeThreshold returns app time per execution above which bucket is a spike
+func spikeThreshold(buckets []stats.IntervalJSON) float64 {
+	var perExec []float64
+	for _, b := range buckets {
+		if b.Executions > 0 {
+			perExec = append(perExec, b.AppMs/float64(b.Executions))
+		}
+	}
+	if len(perExec) < 3 {
+		return 0
+	}
+	sort.Float64s(perExec)
+	return profileSpike * perExec[len(perExec)/2]
+}
@@ -0,0 +1,39 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printLogons(ls *stats.LogonStats) {
+	if ls.Sessions > 0 {
+		fmt.Printf("Logon latency%s of %d sessions: min %s avg %s p50 %s p90 %s p99 %s max %s\n", unit("ms"),
+			ls.Sessions, Ms(ls.MinMs), Ms(ls.AvgMs), Ms(ls.P50Ms), Ms(ls.P90Ms), Ms(ls.P99Ms), Ms(ls.MaxMs))
+		fmt.Printf("Average logon breakdown%s: connect %s auth %s session setup %s\n", unit("ms"), Ms(ls.ConnectAvgMs), Ms(ls.AuthAvgMs), Ms(ls.SetupAvgMs))
+	}
+	for _, m := range ls.AuthMethods {
+		fmt.Printf("\tauthentication %s: %d sessions, avg %s%s\n", m.Method, m.Sessions, Ms(m.AvgAuthMs), unitSuffix("ms"))
+	}
+}
+
+func printConnects(cs *stats.ConnectStats) {
+	if cs.Resends > 0 {
+		fmt.Println("TNS RESEND packets:", cs.Resends, "in", cs.ResendSessions, "sessions (each costs an extra round trip of logon)")
+	}
+	if len(cs.Refused) == 0 {
+		return
+	}
+	perError := make(map[string]int)
+	for _, r := range cs.Refused {
+		perError[r.Error+"\t"+r.Service]++
+	}
+	fmt.Println("\nConnections refused by listener:", len(cs.Refused))
+	fmt.Println("Error\t\tService\tRefused")
+	for e, n := range perError {
+		fmt.Printf("%s\t%d\n", e, n)
+	}
+	for _, r := range cs.Refused {
+		fmt.Printf("\t%s\t%s\t%s\t%s\n", r.At.Format("2006-01-02 15:04:05"), r.Conversation, r.Service, r.Error)
+	}
+}
@@ -0,0 +1,37 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printCustomMetrics prints sum and per-execution value of each custom metric of each sqlid
+func printCustomMetrics(rows []stats.SQLstatsJSON) {
+	var names []string
+	for _, r := range rows {
+		for name := range r.Metrics {
+			names = append(names, name)
+		}
+		if names != nil {
+			break
+		}
+	}
+	if names == nil {
+		return
+	}
+	sort.Strings(names)
+	fmt.Print("\nCustom metrics\nSQL ID\t\tExec")
+	for _, name := range names {
+		fmt.Print("\t" + name + "\t" + name + "/Exec")
+	}
+	fmt.Println()
+	for _, r := range rows {
+		fmt.Printf("%s\t%d", r.SQLid, r.Executions)
+		for _, name := range names {
+			fmt.Printf("\t%.0f\t%f", r.Metrics[name], r.Metrics[name]/float64(r.Executions))
+		}
+		fmt.Println()
+	}
+}
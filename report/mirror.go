@@ -0,0 +1,15 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printMirrors(ms *stats.MirrorStats) {
+	if ms == nil {
+		return
+	}
+	fmt.Println("\nSessions captured on both legs (analyzed once):", ms.Sessions)
+	fmt.Println("Executions refined with the server side leg:", ms.Refined, "hop time avg"+unit("ms")+":", Ms(ms.HopAvgMs))
+}
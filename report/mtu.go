@@ -0,0 +1,17 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printMTUFindings(findings []stats.MTUFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Println("\nMTU/fragmentation findings:")
+	for _, f := range findings {
+		fmt.Printf("\t%s\t%s\n", f.Where, f.Finding)
+	}
+}
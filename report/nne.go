@@ -0,0 +1,41 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printEncryption warns about sessions which SQL can't be decoded because of encryption
+func printEncryption(es *stats.EncryptionStats) {
+	if es == nil {
+		return
+	}
+	if es.Undetected {
+		fmt.Printf("WARNING: no SQL decoded from TNS data of %d sessions - if they connected before the capture started, "+
+			"they may be encrypted with Native Network Encryption (SQLNET.ENCRYPTION_SERVER) and the negotiation was not captured\n\n", es.DataSessions)
+		return
+	}
+	var algorithms []string
+	for a := range es.Algorithms {
+		algorithms = append(algorithms, a)
+	}
+	sort.Strings(algorithms)
+	list := ""
+	for _, a := range algorithms {
+		list += fmt.Sprintf(" %s: %d", a, es.Algorithms[a])
+	}
+	if es.Decrypted {
+		fmt.Printf("%d of %d sessions encrypted with Native Network Encryption (%s) were decrypted, %d packets, %d executions\n\n",
+			es.DecSessions, es.Sessions, list[1:], es.DecPackets, es.Executions)
+		if es.DecSessions == es.Sessions {
+			return
+		}
+	}
+	//Sesje, ktorych Decryptor nie odszyfrowal (zly klucz, nieobslugiwany algorytm) sa jak bez niego
+	fmt.Printf("WARNING: %d sessions negotiated Native Network Encryption (%s), their SQL can't be decoded and is missing from the report\n",
+		es.Sessions-es.DecSessions, list[1:])
+	fmt.Println("Encrypted traffic"+unit("kb")+":", Bytes(es.Bytes), "in", es.Packets, "packets")
+	fmt.Printf("Round trips: %d RTT avg / max%s: %s / %s\n\n", es.RoundTrips, unit("ms"), Ms(es.RTTAvgMs), Ms(es.RTTMaxMs))
+}
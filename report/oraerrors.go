@@ -0,0 +1,46 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// errorSessions is number of conversations with the most errors printed
+const errorSessions = 10
+
+// printOraErrors prints the most frequent errors, errors of each sqlid and sessions with the most errors
+func printOraErrors(a *stats.Analysis) {
+	if len(a.OraErrors) == 0 {
+		return
+	}
+	fmt.Println("\nTop ORA- errors")
+	fmt.Println("Error\t\tExec\tSQL IDs\tS\tTop SQL ID\tMessage")
+	for _, e := range a.OraErrors {
+		fmt.Printf("%s\t%d\t%d\t%d\t%s\t%s\n", e.Code, e.Executions, e.SQLids, e.Sessions, e.TopSQLid, e.Message)
+	}
+
+	fmt.Println("\nSQL ID\t\tExec\tFailed\t% Failed\tErrors")
+	for _, r := range a.SQLs {
+		if len(r.Errors) == 0 {
+			continue
+		}
+		errs := ""
+		for _, code := range stats.SortedKeys(r.Errors) {
+			errs += fmt.Sprintf("%s:%d ", code, r.Errors[code])
+		}
+		fmt.Printf("%s\t%d\t%d\t%.1f\t\t%s\n", r.SQLid, r.Executions, r.Failed, 100*float64(r.Failed)/float64(r.Executions), errs)
+	}
+
+	fmt.Println("\nConversation\t\t\t\tFailed\tErrors")
+	for i, s := range a.ErrorSessions {
+		if i == errorSessions {
+			break
+		}
+		errs := ""
+		for _, code := range stats.SortedKeys(s.Errors) {
+			errs += fmt.Sprintf("%s:%d ", code, s.Errors[code])
+		}
+		fmt.Printf("%s\t%d\t%s\n", s.Conversation, s.Executions, errs)
+	}
+}
@@ -0,0 +1,19 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printFrameworks prints workload summary per framework which generated the SQL
+func printFrameworks(rows []stats.FrameworkJSON) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Println("\nFramework\t\tSQLs\tBy behavior\tS\tExec\tEla App" + unit("ms") + "\tEla Net" + unitNoSpace("ms") + "\tTop SQL ID")
+	for _, r := range rows {
+		fmt.Printf("%s\t\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n", r.Name, r.SQLs, r.ByBehavior, r.Sessions,
+			r.Executions, Ms(r.ElaAppMs), Ms(r.ElaNetMs), r.TopSQLid)
+	}
+}
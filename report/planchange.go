@@ -0,0 +1,26 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printPlanChanges prints sqlids suspected of changing execution plan during the capture, to be checked
+// in the database (i.e. DBA_HIST_SQLSTAT, V$SQL_SHARED_CURSOR)
+func printPlanChanges(rows []stats.SQLstatsJSON) {
+	header := false
+	for _, r := range rows {
+		p := r.PlanChange
+		if p == nil {
+			continue
+		}
+		if !header {
+			fmt.Println("\nSuspected plan changes")
+			fmt.Println("SQL ID\t\tKind\tSwitch\t\t\t\tBefore" + unit("ms") + "\tAfter" + unit("ms") + "\t% After")
+			header = true
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%.1f\n", r.SQLid, p.Kind, p.Switch.Format("2006-01-02 15:04:05.000000"),
+			Ms(p.BeforeMs), Ms(p.AfterMs), 100*p.Share)
+	}
+}
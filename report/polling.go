@@ -0,0 +1,29 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// printPolling prints sqlids executed in polling loops and the total time and bytes spent on polling
+func printPolling(rows []stats.SQLstatsJSON) {
+	var appMs float64
+	var bytes uint64
+	for _, r := range rows {
+		p := r.Polling
+		if p == nil {
+			continue
+		}
+		if appMs == 0 && bytes == 0 {
+			fmt.Println("\nPolling SQLs (executed every ~interval in a session)")
+			fmt.Println("SQL ID\t\tS\tInterval" + unit("ms") + "\tExec\tEla App" + unit("ms") + "\t" + sizeHeader())
+		}
+		fmt.Printf("%s\t%d\t%s\t%d\t%s\t%s\n", r.SQLid, p.Sessions, Ms(p.IntervalMs), p.Executions, Ms(p.AppMs), Bytes(p.Bytes))
+		appMs += p.AppMs
+		bytes += p.Bytes
+	}
+	if appMs > 0 || bytes > 0 {
+		fmt.Printf("Time spent polling: %s%s, %s%s\n", Ms(appMs), unitSuffix("ms"), Bytes(bytes), unitSuffix("kb"))
+	}
+}
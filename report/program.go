@@ -0,0 +1,31 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printPrograms(programs []stats.ProgramJSON) {
+	known := false
+	for _, p := range programs {
+		known = known || p.Program != ""
+	}
+	if !known {
+		return
+	}
+	fmt.Println("\nPrograms")
+	fmt.Println("Program\t\t\tSessions\tExec")
+	for _, p := range programs {
+		name := p.Program
+		if name == "" {
+			name = "(connect not captured)"
+		}
+		if p.Skipped {
+			//Pominiete sesje nie sa przechodzone, wiec ich wykonan nie znamy
+			fmt.Printf("%s [skipped]\t\t%d\t-\n", name, p.Sessions)
+			continue
+		}
+		fmt.Printf("%s\t\t%d\t%d\n", name, p.Sessions, p.Executions)
+	}
+}
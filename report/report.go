@@ -0,0 +1,482 @@
+// Package report prints Analysis as the text report of stado and renders its charts
+package report
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// Report prints summary of analysis and renders charts into chartsDir
+func Report(a *stats.Analysis, chartsDir string) {
+	log.Println("Starting to disaplay SQLstats - len: ", len(a.SQLs))
+	printPartial(a)
+	printEncryption(a.Encryption)
+	printSummary(a.Summary)
+	printFindings(a.Findings)
+	rows, others := stats.TopRows(a.SQLs)
+	if len(a.Databases) > 1 {
+		//Kazda baza osobno, zeby sqlidy roznych baz sie nie mieszaly
+		for _, db := range a.Databases {
+			fmt.Println("Database: " + db.Name + "\n")
+			printSQLTable(stats.TopRows(db.SQLs))
+			fmt.Println()
+		}
+	} else {
+		printSQLTable(rows, others)
+	}
+	renderSQLCharts(rows, chartsDir)
+	renderScatters(a.SQLs, chartsDir)
+
+	if Units == "raw" {
+		fmt.Println("\nSum App Time(s):", a.SumAppS)
+		fmt.Printf("Sum Net Time(s): %v\n\n", a.SumNetS)
+	} else {
+		fmt.Println("\nSum App Time:", Sec(a.SumAppS))
+		fmt.Printf("Sum Net Time: %s\n\n", Sec(a.SumNetS))
+	}
+
+	for _, ip := range stats.SortedKeys(a.TnsBytes) {
+		bytes := a.TnsBytes[ip]
+		if label := a.DBNames[ip]; label != "" && label != ip+":"+a.DBPort {
+			fmt.Println(a.HostLabel(ip), "("+label+")", Bytes(bytes)+unitSuffix("kb"))
+		} else {
+			fmt.Println(a.HostLabel(ip), Bytes(bytes)+unitSuffix("kb"))
+		}
+	}
+
+	if len(a.Databases) > 1 {
+		printDatabaseComparison(a.Databases, a.SumAppS*1000)
+	}
+
+	printApdex(a)
+	printSLA(a.SLA)
+	renderSLAChart(a.SLA, chartsDir+"/_sla_burn.png")
+	printLoadProfile(a.LoadProfile)
+	renderLoadProfileChart(a.LoadProfile, chartsDir+"/_load_profile.png")
+	printSignatures(a.SQLs)
+	printWhatIfs(a.SQLs, a.SumAppS*1000)
+	printSQLSeen(rows)
+	printSlowest(a)
+	printOraErrors(a)
+	printPrograms(a.Programs)
+	if stats.ByClient {
+		printSQLClients(a, rows)
+	}
+	printRows(rows)
+	printCustomMetrics(rows)
+	printGaps(rows)
+	printPolling(rows)
+	printPlanChanges(rows)
+	printConcurrency(rows)
+	printStreaming(rows)
+	printTimeModel(a)
+	renderTimeModelChart(tnsparse.WaitTimesOf(a.TimeModel), chartsDir+"/_time_model.png")
+
+	printChurn(a)
+	printLogons(a.Logons)
+	if a.Connects != nil {
+		printConnects(a.Connects)
+	}
+	if a.Compression != nil {
+		printCompression(a.Compression)
+	}
+	printSessionDurations(a.Durations)
+	renderSessionDurationsChart(a.Durations, chartsDir+"/_session_durations.png")
+	printIdleClients(a)
+	printIdleKills(a)
+	printMTUFindings(a.MTU)
+	printTiming(&a.Timing)
+
+	subnets := make([]stats.ClientGroupJSON, len(a.Subnets))
+	for i, g := range a.Subnets {
+		g.Name = a.SubnetLabel(g.Name)
+		subnets[i] = g
+	}
+	printClientGroups("Subnet", subnets)
+	if len(a.Labels) > 0 {
+		printClientGroups("Client label", a.Labels)
+		renderClientGroupsChart("Elapsed app time per client label (ms)", a.Labels, chartsDir+"/_client_labels_ela.png")
+	}
+	printFrameworks(a.Frameworks)
+	if len(a.Tags) > 0 {
+		printClientGroups("SQL tag", a.Tags)
+		renderClientGroupsChart("Elapsed app time per SQL tag (ms)", a.Tags, chartsDir+"/_sql_tags_ela.png")
+	}
+
+	if a.Dups > 0 {
+		fmt.Println("\nDuplicate frames dropped:", a.Dups)
+	}
+	printMirrors(a.Mirrors)
+	if a.OutsideWindow > 0 {
+		fmt.Println("\nPackets outside -from/-to skipped:", a.OutsideWindow)
+	}
+
+	fmt.Println("\n\n\tTime frame: ", a.TimeBegin, " <=> ", a.TimeEnd)
+	fmt.Println("\tTime frame duration (s): ", a.DurationS, "\n")
+	printPartial(a)
+}
+
+// MakeChartsDir creates directory for charts, ./SQLCharts if dir is empty
+func MakeChartsDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "./SQLCharts"
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err = os.Mkdir(dir, 0755); err != nil {
+				return dir, err
+			}
+			fmt.Println("All SQL Charts will be saved into " + dir + " dierectory\n")
+		}
+	} else if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return dir, os.Mkdir(dir, 0755)
+	}
+	return dir, nil
+}
+
+// printSQLTable prints summary row of each sqlid and sums of sqlids left out by -top
+func printSQLTable(rows []stats.SQLstatsJSON, others *stats.SQLRollup) {
+	centerLabel, dispLabel := stats.StatLabels()
+	fmt.Println("SQL ID\t\tEla App" + unit("ms") + "\tEla Net" + unitNoSpace("ms") + "\tExec\tEla " + dispLabel + " App\tEla App" + centerLabel +
+		"\tEla " + dispLabel + " Net\tEla Net" + centerLabel + "\tP\tS\tRC\tApp p50\tApp p90\tApp p95\tApp p99\tNet p50\tNet p90\tNet p95\tNet p99\tImpact")
+	fmt.Println("----------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------\n")
+	for _, r := range rows {
+		fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%f\n", r.SQLid,
+			Ms(r.ElaAppMs),
+			Ms(r.ElaNetMs),
+			r.Executions,
+			Ms(r.Dispersion(true)),
+			Ms(r.Center(true)),
+			Ms(r.Dispersion(false)),
+			Ms(r.Center(false)),
+			r.Packets,
+			r.Sessions,
+			r.ReusedCursors,
+			Ms(r.AppP50Ms),
+			Ms(r.AppP90Ms),
+			Ms(r.AppP95Ms),
+			Ms(r.AppP99Ms),
+			Ms(r.NetP50Ms),
+			Ms(r.NetP90Ms),
+			Ms(r.NetP95Ms),
+			Ms(r.NetP99Ms),
+			r.Impact)
+	}
+	if others != nil {
+		fmt.Printf("others (%d)\t%s\t%s\t%d\t-\t%s\t-\t%s\t%d\t-\t%d\t-\t-\t-\t-\t-\t-\t-\t-\t%f\n", others.SQLids,
+			Ms(others.ElaAppMs),
+			Ms(others.ElaNetMs),
+			others.Executions,
+			Ms(others.ElaAppMs/float64(others.Executions)),
+			Ms(others.ElaNetMs/float64(others.Executions)),
+			others.Packets,
+			others.ReusedCursors,
+			others.Impact)
+	}
+}
+
+// printSQLSeen prints when each sqlid was executed for the first and the last time in the capture
+func printSQLSeen(rows []stats.SQLstatsJSON) {
+	const layout = "2006-01-02 15:04:05.000"
+	fmt.Println("\nSQL ID\t\tFirst seen\t\t\tLast seen")
+	for _, r := range rows {
+		if r.FirstSeen.IsZero() {
+			continue //Analiza zapisana przez starsze stado
+		}
+		fmt.Printf("%s\t%s\t%s\n", r.SQLid, r.FirstSeen.Format(layout), r.LastSeen.Format(layout))
+	}
+}
+
+// slowestSQLs is number of the top sqlids which slowest executions are printed
+const slowestSQLs = 10
+
+// printSlowest prints the slowest executions of the top sqlids - concrete examples to chase
+func printSlowest(a *stats.Analysis) {
+	fmt.Println("\nSlowest executions of top SQLs")
+	fmt.Println("SQL ID\t\tStart\t\t\t\tApp" + unit("ms") + "\tNet" + unit("ms") + "\tP\tBytes\tConversation\tError")
+	for i, r := range a.SQLs {
+		if i == slowestSQLs {
+			break
+		}
+		for _, e := range r.Slowest {
+			fmt.Printf("%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", r.SQLid, e.Start.Format("2006-01-02 15:04:05.000000"),
+				Ms(e.AppMs), Ms(e.NetMs), e.Packets, e.Bytes, e.Conversation, e.Error)
+		}
+	}
+}
+
+// printRows prints rows affected by DML or fetched by queries of each sqlid, so statements slow because of
+// the amount of rows (or of round trips per row) stand out from those slow in the database
+func printRows(rows []stats.SQLstatsJSON) {
+	header := false
+	for _, r := range rows {
+		if r.Rows == 0 {
+			continue
+		}
+		if !header {
+			fmt.Println("\nSQL ID\t\tExec\tRows\tRows/Exec\tRT/Exec\tRows/RT\tApp/Row" + unit("ms"))
+			header = true
+		}
+		fmt.Printf("%s\t%d\t%d\t%f\t%.1f\t%.1f\t%s\n", r.SQLid, r.Executions, r.Rows, r.RowsPerExec,
+			float64(r.RoundTrips)/float64(r.Executions), r.RowsPerRT, Ms(r.ElaAppMs/float64(r.Rows)))
+	}
+}
+
+// printGaps prints distribution of time between re-executions of sqlid in a session - periodic ones are polling loops
+func printGaps(rows []stats.SQLstatsJSON) {
+	fmt.Println("\nRe-execution gaps" + unit("ms") + "\nSQL ID\t\tGaps\tMin\tP50\tP90\tMax\tCV\tPattern")
+	for _, r := range rows {
+		if g := r.Gaps; g != nil {
+			fmt.Printf("%s\t%d\t%s\t%s\t%s\t%s\t%.2f\t%s\n", r.SQLid, g.Count, Ms(g.MinMs), Ms(g.P50Ms), Ms(g.P90Ms), Ms(g.MaxMs), g.CV, g.Pattern)
+		}
+	}
+}
+
+// printStreaming separates initial server latency from time spent streaming the result in further fetches,
+// so slow queries and huge results are told apart
+func printStreaming(rows []stats.SQLstatsJSON) {
+	fmt.Println("\nSQL ID\t\tFirst resp/Exec" + unit("ms") + "\tStreaming/Exec" + unit("ms") + "\t% Streaming")
+	for _, r := range rows {
+		share := 0.0
+		if total := r.FirstPerExec + r.StreamPerExec; total > 0 {
+			share = 100 * r.StreamPerExec / total
+		}
+		fmt.Printf("%s\t%s\t%s\t%.1f\n", r.SQLid, Ms(r.FirstPerExec), Ms(r.StreamPerExec), share)
+	}
+}
+
+// printDatabaseComparison prints one row per database, so their workloads can be compared side by side
+func printDatabaseComparison(dbs []stats.DatabaseJSON, sumApp float64) {
+	fmt.Println("\nDatabase comparison")
+	fmt.Println("Database\t\tSQLids\tClients\tS\tExec\tEla App" + unit("ms") + "\t% App\tEla Net" + unitNoSpace("ms") + "\tEla App/Exec\tApp p95\t" + sizeHeader())
+	for _, db := range dbs {
+		share := 0.0
+		if sumApp > 0 {
+			share = 100 * db.ElaAppMs / sumApp
+		}
+		fmt.Printf("%s\t%d\t%d\t%d\t%d\t%s\t%.1f\t%s\t%s\t%s\t%s\n", db.Name,
+			len(db.SQLs), db.Clients, db.Sessions, db.Executions,
+			Ms(db.ElaAppMs), share, Ms(db.ElaNetMs), Ms(db.AppPerExecMs),
+			Ms(db.AppP95Ms), Bytes(db.Bytes))
+	}
+}
+
+// renderSQLCharts renders elapsed time chart of each sqlid (at most MaxCharts, ChartWorkers at a time)
+// and the summary bar chart
+func renderSQLCharts(rows []stats.SQLstatsJSON, chartsDir string) {
+	var graphVal []chart.Value
+	var charted []int
+	for rank, r := range rows {
+		graphVal = append(graphVal, chart.Value{Value: r.NetPerExecMs, Label: r.SQLid})
+		if r.Samples != nil {
+			charted = append(charted, rank)
+		}
+	}
+	if MaxCharts > 0 && len(charted) > MaxCharts {
+		fmt.Printf("Charts of %d sqlids skipped by -max-charts %d\n", len(charted)-MaxCharts, MaxCharts)
+		charted = charted[:MaxCharts]
+	}
+	renderParallel(len(charted), func(i int) {
+		rank := charted[i]
+		//Numer w rankingu na poczatku nazwy - wykresy leza w katalogu w kolejnosci raportu
+		renderSQLChart(&rows[rank], fmt.Sprintf("%s/%03d_%s.png", chartsDir, rank+1, rows[rank].SQLid))
+	})
+
+	graph := chart.BarChart{
+		Title: "SQLid Elapsed Time Summary (ms)",
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    100,
+				Bottom: 70,
+			},
+		},
+		Height:   1024,
+		Width:    2000,
+		BarWidth: 7,
+		XAxis:    chart.Style{TextRotationDegrees: 90.0},
+		Bars:     graphVal, //[]chart.Value of Value: Label:
+	}
+
+	f, err := os.Create(chartsDir + "/" + "_sql_ela_exec.png")
+	if err != nil {
+		log.Println(err)
+	}
+	graph.Render(chart.PNG, f)
+	f.Close()
+
+}
+
+// renderSQLChart renders net time of each kept execution of sqlid into file
+func renderSQLChart(r *stats.SQLstatsJSON, file string) {
+	sqlid := r.SQLid
+	SQLgraph := chart.Chart{
+		Title:      sqlid + " elapsed time per execution (ms)",
+		TitleStyle: chart.StyleShow(),
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    40,
+				Bottom: 10,
+			},
+		},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Style: chart.Style{
+					Show:        true,                           // go-chart doesn't draw styled series without it
+					StrokeColor: drawing.ColorRed,               // will supercede defaults
+					FillColor:   drawing.ColorRed.WithAlpha(64), // will supercede defaults
+				},
+				XValues: r.Samples.ExecNo,
+				YValues: r.Samples.NetMs,
+			},
+		},
+	}
+	if markers := errorMarkers(r.Samples); len(markers) > 0 {
+		//Legenda go-chart nie rysuje kropek, wiec opis idzie do tytulu
+		SQLgraph.Series = append(SQLgraph.Series, markers...)
+		SQLgraph.Title += " - blue: error, black: cancelled"
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	SQLgraph.Render(chart.PNG, f)
+	f.Close()
+}
+
+// errorMarkers returns dot series placed on the latency line at executions which failed or were cancelled
+func errorMarkers(s *stats.SamplesJSON) []chart.Series {
+	var errX, errY, cancelX, cancelY []float64
+	for i, e := range s.Errors {
+		switch {
+		case e == "":
+		case tnsparse.CancelErrors[e]:
+			cancelX, cancelY = append(cancelX, s.ExecNo[i]), append(cancelY, s.NetMs[i])
+		default:
+			errX, errY = append(errX, s.ExecNo[i]), append(errY, s.NetMs[i])
+		}
+	}
+	var series []chart.Series
+	dots := func(color drawing.Color, x, y []float64) {
+		if len(x) > 0 {
+			series = append(series, chart.ContinuousSeries{
+				Style:   chart.Style{Show: true, StrokeWidth: chart.Disabled, DotWidth: 4, DotColor: color},
+				XValues: x,
+				YValues: y,
+			})
+		}
+	}
+	dots(drawing.ColorBlue, errX, errY)
+	dots(drawing.ColorBlack, cancelX, cancelY)
+	return series
+}
+
+func printClientGroups(title string, groups []stats.ClientGroupJSON) {
+	fmt.Println("\n" + title + "\t\tClients\tS\tExec\tEla App" + unit("ms") + "\tEla Net" + unitNoSpace("ms") + "\tEla App/Exec\tApp p95\t" + sizeHeader())
+	for _, g := range groups {
+		fmt.Printf("%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", g.Name,
+			g.Clients, g.Sessions, g.Executions,
+			Ms(g.ElaAppMs), Ms(g.ElaNetMs), Ms(g.AppPerExecMs),
+			Ms(g.AppP95Ms), Bytes(g.Bytes))
+	}
+}
+
+func renderClientGroupsChart(title string, groups []stats.ClientGroupJSON, file string) {
+	var bars []chart.Value
+	for _, g := range groups {
+		bars = append(bars, chart.Value{Value: g.ElaAppMs, Label: g.Name})
+	}
+	renderBars(title, bars, file)
+}
+
+// renderBars renders a bar chart of values into file
+func renderBars(title string, bars []chart.Value, file string) {
+	if len(bars) < 2 {
+		return //go-chart nie narysuje wykresu z jednym slupkiem o zerowym zakresie
+	}
+	graph := chart.BarChart{
+		Title: title,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    100,
+				Bottom: 70,
+			},
+		},
+		Height:   1024,
+		Width:    1024,
+		BarWidth: 30,
+		XAxis:    chart.Style{TextRotationDegrees: 90.0},
+		Bars:     bars,
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	graph.Render(chart.PNG, f)
+	f.Close()
+}
+
+// printTimeModel prints AWR-like time model of the whole capture and share of wait classes for each sqlid
+func printTimeModel(a *stats.Analysis) {
+	fmt.Println("\nTime model\tTime" + unit("ms") + "\t% App Time")
+	tm := tnsparse.WaitTimesOf(a.TimeModel)
+	pct := tm.Percent()
+	for i, v := range tm {
+		fmt.Printf("%s\t%s\t%.2f\n", tnsparse.WaitClassNames[i], Ms(v), pct[i])
+	}
+
+	fmt.Print("\nSQL ID\t")
+	for _, name := range tnsparse.WaitClassNames {
+		fmt.Print("\t% " + name)
+	}
+	fmt.Println()
+	for _, r := range a.SQLs {
+		fmt.Print(r.SQLid)
+		for _, v := range tnsparse.WaitTimesOf(r.TimeModelMs).Percent() {
+			fmt.Printf("\t%.2f", v)
+		}
+		fmt.Println()
+	}
+}
+
+func renderTimeModelChart(tm tnsparse.WaitTimes, file string) {
+	var values []chart.Value
+	for i, v := range tm {
+		if v > 0 {
+			values = append(values, chart.Value{Value: v, Label: tnsparse.WaitClassNames[i]})
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+	pie := chart.PieChart{
+		Title:      "Time model",
+		TitleStyle: chart.StyleShow(),
+		Width:      512,
+		Height:     512,
+		Values:     values,
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	pie.Render(chart.PNG, f)
+	f.Close()
+}
+
+// printPartial warns that the report covers only part of the capture
+func printPartial(a *stats.Analysis) {
+	if a.Partial {
+		fmt.Printf("PARTIAL REPORT - analysis was interrupted, only packets till %s were parsed\n\n", a.TimeEnd.Format("2006-01-02 15:04:05.000"))
+	}
+	if d := a.EvictedDrops; d != nil {
+		fmt.Printf("PARTIAL REPORT - %d conversations evicted first with %d executions were dropped above -max-evicted\n\n", d.Sessions, d.Executions)
+	}
+}
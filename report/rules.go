@@ -0,0 +1,25 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// findingRows is number of findings printed in the text report
+const findingRows = 30
+
+func printFindings(findings []stats.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Println("\nFindings")
+	for i, f := range findings {
+		if i == findingRows {
+			fmt.Printf("... and %d more (all are in JSON output)\n", len(findings)-findingRows)
+			break
+		}
+		fmt.Printf("%-8s\t%-12s\t%s\n", strings.ToUpper(f.Severity), f.Rule, f.Message)
+	}
+}
@@ -0,0 +1,99 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// ScatterSQLs are sqlids which net vs app time scatter chart is rendered (-scatter)
+var ScatterSQLs []string
+
+// NetDominatedShare - executions spending at least that fraction of app time in round trips are network-dominated
+const NetDominatedShare = 0.5
+
+// renderScatters renders scatter chart of each sqlid of ScatterSQLs
+func renderScatters(rows []stats.SQLstatsJSON, chartsDir string) {
+	for _, sqlid := range ScatterSQLs {
+		found := false
+		for i := range rows {
+			if rows[i].SQLid == sqlid {
+				renderScatter(&rows[i], chartsDir+"/scatter_"+sqlid+".png")
+				found = true
+				break
+			}
+		}
+		if !found {
+			fmt.Println("-scatter:", sqlid, "not found")
+		}
+	}
+}
+
+// renderScatter renders net time against app time of each kept execution of sqlid. Network-dominated
+// executions (red) lie above the line net = NetDominatedShare x app, server-dominated ones (green) below it
+func renderScatter(r *stats.SQLstatsJSON, file string) {
+	if r.Samples == nil || len(r.Samples.AppMs) < 2 {
+		fmt.Println("-scatter:", r.SQLid, "has no samples to chart")
+		return
+	}
+	var netX, netY, dbX, dbY []float64
+	maxApp := 0.0
+	for i, app := range r.Samples.AppMs {
+		net := r.Samples.NetMs[i]
+		if net >= NetDominatedShare*app {
+			netX, netY = append(netX, app), append(netY, net)
+		} else {
+			dbX, dbY = append(dbX, app), append(dbY, net)
+		}
+		if app > maxApp {
+			maxApp = app
+		}
+	}
+
+	dots := func(color drawing.Color, x, y []float64) chart.Series {
+		return chart.ContinuousSeries{
+			Style:   chart.Style{Show: true, StrokeWidth: chart.Disabled, DotWidth: 3, DotColor: color},
+			XValues: x,
+			YValues: y,
+		}
+	}
+	graph := chart.Chart{
+		Title: fmt.Sprintf("%s net vs app time per execution (ms) - red: network-dominated %d, green: server-dominated %d",
+			r.SQLid, len(netX), len(dbX)),
+		TitleStyle: chart.StyleShow(),
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    40,
+				Bottom: 10,
+			},
+		},
+		XAxis: chart.XAxis{Name: "App (ms)", NameStyle: chart.StyleShow(), Style: chart.StyleShow()},
+		YAxis: chart.YAxis{Name: "Net (ms)", NameStyle: chart.StyleShow(), Style: chart.StyleShow()},
+		Series: []chart.Series{
+			chart.ContinuousSeries{
+				Style:   chart.Style{Show: true, StrokeColor: drawing.ColorBlack.WithAlpha(96), StrokeDashArray: []float64{5, 5}},
+				XValues: []float64{0, maxApp},
+				YValues: []float64{0, NetDominatedShare * maxApp},
+			},
+		},
+	}
+	//Pusta seria psuje zakres osi w go-chart
+	if len(netX) > 0 {
+		graph.Series = append(graph.Series, dots(drawing.ColorRed, netX, netY))
+	}
+	if len(dbX) > 0 {
+		graph.Series = append(graph.Series, dots(drawing.ColorGreen, dbX, dbY))
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	graph.Render(chart.PNG, f)
+	f.Close()
+}
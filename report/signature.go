@@ -0,0 +1,60 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// signatureGroup is workload of all sqlids with the same signature
+type signatureGroup struct {
+	Signature  string
+	SQLids     int
+	Executions uint
+	ElaAppMs   float64
+	SQLtxt     string
+}
+
+// printSignatures prints signatures shared by many sqlids - statements which differ only in literals
+// and should use binds (or be aggregated with -by-signature)
+func printSignatures(rows []stats.SQLstatsJSON) {
+	groups := make(map[string]*signatureGroup)
+	for _, r := range rows {
+		if r.Signature == "" {
+			continue //Analiza zapisana przez starsze stado
+		}
+		g, ok := groups[r.Signature]
+		if !ok {
+			g = &signatureGroup{Signature: r.Signature, SQLtxt: stats.Normalized(r.SQLtxt).SQLtxt}
+			groups[r.Signature] = g
+		}
+		g.SQLids += r.Variants
+		g.Executions += r.Executions
+		g.ElaAppMs += r.ElaAppMs
+	}
+	var shared []*signatureGroup
+	for _, g := range groups {
+		if g.SQLids > 1 {
+			shared = append(shared, g)
+		}
+	}
+	if len(shared) == 0 {
+		return
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].SQLids != shared[j].SQLids {
+			return shared[i].SQLids > shared[j].SQLids
+		}
+		return shared[i].Signature < shared[j].Signature
+	})
+	fmt.Println("\nSQLs differing only in literals (force matching signature)")
+	fmt.Println("Signature\tSQL IDs\tExec\tEla App" + unit("ms") + "\tNormalized SQL")
+	for _, g := range shared {
+		txt := g.SQLtxt
+		if len(txt) > 100 {
+			txt = txt[:100] + "..."
+		}
+		fmt.Printf("%s\t%d\t%d\t%s\t%s\n", g.Signature, g.SQLids, g.Executions, Ms(g.ElaAppMs), txt)
+	}
+}
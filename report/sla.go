@@ -0,0 +1,87 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// printSLA prints overall breach fraction and periods when the service degraded
+func printSLA(b *stats.SLABurn) {
+	if b == nil {
+		return
+	}
+	fmt.Printf("\nSLA (app time <= %s ms, budget %.1f%% per %s): %.2f%% of %d executions breached\n", Number(b.ThresholdMs, 0),
+		b.BudgetPct, time.Duration(b.IntervalS*float64(time.Second)), b.BreachedPct, b.Executions)
+	if len(b.Degradations) == 0 {
+		fmt.Println("No interval breached more than the budget")
+		return
+	}
+	fmt.Println("Degraded from\t\tRecovered at\t\tPeak %\tExec\tBreached")
+	for _, d := range b.Degradations {
+		fmt.Printf("%s\t%s\t%.1f\t%d\t%d\n", d.Start.Format("2006-01-02 15:04:05"), d.End.Format("2006-01-02 15:04:05"),
+			d.PeakPct, d.Executions, d.Breached)
+	}
+}
+
+// renderSLAChart renders percent of breaching executions per interval against the budget, with executions
+// per interval on the secondary axis showing how much traffic each point stands for
+func renderSLAChart(b *stats.SLABurn, file string) {
+	if b == nil || len(b.Points) < 2 {
+		return
+	}
+	var x []time.Time
+	var pct, execs []float64
+	for _, p := range b.Points {
+		x = append(x, p.Start)
+		pct = append(pct, p.BreachedPct)
+		execs = append(execs, float64(p.Executions))
+	}
+	graph := chart.Chart{
+		Title: fmt.Sprintf("Executions breaching SLA %s ms per interval (%%) - red: breached, dashed: budget %.1f%%, gray: executions",
+			Number(b.ThresholdMs, 0), b.BudgetPct),
+		TitleStyle: chart.StyleShow(),
+		Width:      1600,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:    40,
+				Bottom: 10,
+			},
+		},
+		XAxis: chart.XAxis{Style: chart.StyleShow(), ValueFormatter: chart.TimeValueFormatterWithFormat("15:04")},
+		YAxis: chart.YAxis{Name: "Breached (%)", NameStyle: chart.StyleShow(), Style: chart.StyleShow(),
+			Range: &chart.ContinuousRange{Min: 0, Max: 100}},
+		YAxisSecondary: chart.YAxis{Name: "Exec", NameStyle: chart.StyleShow(), Style: chart.StyleShow()},
+		Series: []chart.Series{
+			chart.TimeSeries{
+				Style:   chart.Style{Show: true, StrokeColor: drawing.ColorBlack.WithAlpha(64), FillColor: drawing.ColorBlack.WithAlpha(16)},
+				YAxis:   chart.YAxisSecondary,
+				XValues: x,
+				YValues: execs,
+			},
+			chart.TimeSeries{
+				Style:   chart.Style{Show: true, StrokeColor: drawing.ColorBlack.WithAlpha(96), StrokeDashArray: []float64{5, 5}},
+				XValues: []time.Time{x[0], x[len(x)-1]},
+				YValues: []float64{b.BudgetPct, b.BudgetPct},
+			},
+			chart.TimeSeries{
+				Style:   chart.Style{Show: true, StrokeColor: drawing.ColorRed, FillColor: drawing.ColorRed.WithAlpha(64)},
+				XValues: x,
+				YValues: pct,
+			},
+		},
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	graph.Render(chart.PNG, f)
+	f.Close()
+}
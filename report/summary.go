@@ -0,0 +1,15 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printSummary(s *stats.Summary) {
+	if s == nil {
+		return
+	}
+	fmt.Println("\nSummary")
+	fmt.Println(s.Text)
+}
@@ -0,0 +1,21 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+func printTiming(t *stats.TimingStats) {
+	if len(t.ClockSteps) == 0 && t.Reordered == 0 && t.SameTimestamp == 0 && t.NegativeRTT == 0 {
+		return
+	}
+	fmt.Println("\nCapture timestamp issues:")
+	for _, s := range t.ClockSteps {
+		fmt.Printf("\tclock stepped back by %v at %s\n", s.Step, s.At.Format("2006-01-02 15:04:05.000000"))
+	}
+	fmt.Println("\tExecutions spanning a clock step (corrected):", t.ClockStep)
+	fmt.Println("\tExecutions with packets captured out of order (corrected):", t.Reordered)
+	fmt.Println("\tExecutions with all packets at the same timestamp (low clock resolution, not timed):", t.SameTimestamp)
+	fmt.Println("\tExecutions dropped because of negative RTT:", t.NegativeRTT)
+}
@@ -0,0 +1,162 @@
+package report
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Units of durations and sizes in text reports (-units): raw prints milliseconds, seconds and kilobytes as
+// plain numbers to be read by scripts, human prints each value with its own unit (1.2 s, 34 ms, 5.6 MB)
+var Units = "raw"
+
+// Locale sets decimal and thousands separators of human units (-locale)
+var Locale = "en"
+
+// locales are decimal and thousands separators of supported locales
+var locales = map[string][2]string{
+	"en": {".", ","},
+	"pl": {",", " "},
+	"de": {",", "."},
+	"fr": {",", " "},
+	"ch": {".", "'"},
+}
+
+// CheckUnits validates -units and -locale
+func CheckUnits() error {
+	if Units != "raw" && Units != "human" {
+		return fmt.Errorf("unknown -units %q, expected raw|human", Units)
+	}
+	if _, ok := locales[Locale]; !ok {
+		names := make([]string, 0, len(locales))
+		for name := range locales {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown -locale %q, expected %s", Locale, strings.Join(names, "|"))
+	}
+	return nil
+}
+
+// Number formats v with prec decimals and separators of Locale
+func Number(v float64, prec int) string {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+	sep := locales[Locale]
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(sep[1])
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(sep[0])
+		b.WriteString(frac)
+	}
+	return sign + b.String()
+}
+
+// significant formats v with 3 significant digits (at least none after the decimal separator)
+func significant(v float64) string {
+	switch a := math.Abs(v); {
+	case a >= 100:
+		return Number(v, 0)
+	case a >= 10:
+		return Number(v, 1)
+	}
+	return Number(v, 2)
+}
+
+// Ms formats duration in milliseconds
+func Ms(ms float64) string {
+	if Units == "raw" {
+		return strconv.FormatFloat(ms, 'f', 6, 64)
+	}
+	switch a := math.Abs(ms); {
+	case a == 0:
+		return "0"
+	case a < 1:
+		return significant(ms*1000) + " µs"
+	case a < 1000:
+		return significant(ms) + " ms"
+	case a < 60*1000:
+		return significant(ms/1000) + " s"
+	case a < 3600*1000:
+		return significant(ms/60000) + " min"
+	}
+	return significant(ms/3600000) + " h"
+}
+
+// Sec formats duration in seconds
+func Sec(s float64) string {
+	if Units == "raw" {
+		return strconv.FormatFloat(s, 'f', 6, 64)
+	}
+	return Ms(s * 1000)
+}
+
+// Bytes formats size, raw units print kilobytes as the reports always did
+func Bytes(b uint64) string {
+	if Units == "raw" {
+		return strconv.FormatUint(b/1024, 10)
+	}
+	return BytesF(float64(b))
+}
+
+// BytesF formats fractional size, i.e. an average per execution, raw units print bytes
+func BytesF(b float64) string {
+	if Units == "raw" {
+		return strconv.FormatFloat(b, 'f', 6, 64)
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for ; math.Abs(b) >= 1024 && i < len(units)-1; i++ {
+		b /= 1024
+	}
+	if i == 0 {
+		return Number(b, 0) + " B"
+	}
+	return significant(b) + " " + units[i]
+}
+
+// unit returns header suffix with unit of raw values, values of human units carry their own
+func unit(u string) string {
+	if Units == "raw" {
+		return " (" + u + ")"
+	}
+	return ""
+}
+
+// unitNoSpace is unit of headers which raw reports always printed without a space, i.e. "Ela Net(ms)"
+func unitNoSpace(u string) string {
+	if Units == "raw" {
+		return "(" + u + ")"
+	}
+	return ""
+}
+
+// sizeHeader is header of size columns, kb of raw units
+func sizeHeader() string {
+	if Units == "raw" {
+		return "kb"
+	}
+	return "Size"
+}
+
+// unitSuffix returns unit written after a raw value, values of human units carry their own
+func unitSuffix(u string) string {
+	if Units == "raw" {
+		return " " + u
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// whatIfRows is number of the best paying fixes printed
+const whatIfRows = 20
+
+// printWhatIfs prints projected savings of the best paying fixes, so they can be prioritized
+func printWhatIfs(rows []stats.SQLstatsJSON, sumAppMs float64) {
+	ws := stats.WhatIfs(rows)
+	if len(ws) == 0 {
+		return
+	}
+	fmt.Printf("\nWhat-if (fetch size %d->%d, hard parse %.2f ms with literals)\n", stats.FetchFrom, stats.FetchTo, stats.ParseMs)
+	fmt.Println("Scenario\tSQL ID / signature\tExec\tEla App" + unit("ms") + "\tSaved" + unit("ms") + "\t% SQL App\t% All App")
+	for i, w := range ws {
+		if i == whatIfRows {
+			break
+		}
+		sql, all := 0.0, 0.0
+		if w.ElaAppMs > 0 {
+			sql = 100 * w.SavedMs / w.ElaAppMs
+		}
+		if sumAppMs > 0 {
+			all = 100 * w.SavedMs / sumAppMs
+		}
+		fmt.Printf("%s\t%s\t%d\t%s\t%s\t%.1f\t\t%.1f\n", w.Scenario, w.SQLid, w.Executions, Ms(w.ElaAppMs), Ms(w.SavedMs), sql, all)
+	}
+}
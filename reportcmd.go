@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ora600pl/stado/report"
+	"github.com/ora600pl/stado/stats"
+)
+
+// ReportCmd prints report and renders charts of analysis saved with -save, without parsing the capture again
+func ReportCmd(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	in := fs.String("in", "", "analysis saved with -save")
+	chartsDir := fs.String("C", "", "<dir> directory path to write SQL Charts")
+	jsonOut := fs.Bool("json", false, "write analysis as a JSON line instead of text report and charts")
+	fs.StringVar(&stats.Center, "center", stats.Center, "per-execution elapsed time statistic: mean|trimmed|median")
+	fs.StringVar(&stats.Dispersion, "dispersion", stats.Dispersion, "elapsed time dispersion statistic: stddev|mad")
+	fs.StringVar(&stats.SortBy, "sort", stats.SortBy, "order of sqlids: "+strings.Join(stats.SortKeys, "|"))
+	scatter := fs.String("scatter", "", "<list> comma separated sqlids which net vs app time per execution is charted")
+	rulesFile := fs.String("rules", "", "<file> rules added to the built-in ones, findings are evaluated again")
+	whatifFetch := fs.String("whatif-fetch", "10:500", "<from:to> fetch size now and after the fix for the what-if section")
+	fs.Float64Var(&stats.ParseMs, "whatif-parse", stats.ParseMs, "hard parse time (ms) saved by each literal variant for the what-if section")
+	fs.BoolVar(&stats.ByClient, "by-client", false, "print each sqlid split by client IP")
+	fs.IntVar(&stats.TopSQLs, "top", stats.TopSQLs, "number of sqlids reported and charted, the rest is summed in an \"others\" line (0 - all)")
+	fs.IntVar(&report.MaxCharts, "max-charts", report.MaxCharts, "max number of per-sqlid charts rendered, in report order (0 - all)")
+	fs.IntVar(&report.ChartWorkers, "chart-workers", report.ChartWorkers, "number of charts rendered in parallel")
+	fs.StringVar(&report.Units, "units", report.Units, "durations and sizes in the text report: raw (plain ms, s and kb) or human (1.2 s, 34 ms, 5.6 MB)")
+	fs.StringVar(&report.Locale, "locale", report.Locale, "decimal and thousands separators of -units human: en|pl|de|fr|ch")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	if *in == "" {
+		fmt.Println("Usage: stado report -in analysis.json [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if err := stats.CheckSortBy(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := report.CheckUnits(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *scatter != "" {
+		report.ScatterSQLs = strings.Split(*scatter, ",")
+	}
+	if err := stats.ParseFetchSizes(*whatifFetch); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *rulesFile != "" {
+		if err := stats.LoadRules(*rulesFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	a, err := stats.LoadAnalysis(*in)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	a.Findings = stats.EvaluateRules(a)
+	a.Summary = stats.Summarize(a)
+	stats.SortSQLRows(a.SQLs)
+	for i := range a.Databases {
+		stats.SortSQLRows(a.Databases[i].SQLs)
+	}
+	if *jsonOut {
+		stats.WriteJSON(a, os.Stdout)
+		return
+	}
+	if *chartsDir, err = report.MakeChartsDir(*chartsDir); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	report.Report(a, *chartsDir)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// IsCaptureSet tells if -f names a directory or a glob of capture files (i.e. rotated by tcpdump -C)
+func IsCaptureSet(file string) bool {
+	if IsRemote(file) {
+		return false
+	}
+	if st, err := os.Stat(file); err == nil {
+		return st.IsDir()
+	}
+	return strings.ContainsAny(file, "*?[")
+}
+
+// captureSetFiles lists files of a directory (except hidden ones) or matching a glob
+func captureSetFiles(set string) ([]string, error) {
+	pattern := set
+	if st, err := os.Stat(set); err == nil && st.IsDir() {
+		pattern = filepath.Join(set, "*")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range matches {
+		if st, err := os.Stat(f); err == nil && st.Mode().IsRegular() && !strings.HasPrefix(filepath.Base(f), ".") {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no capture files", set)
+	}
+	return files, nil
+}
+
+// rotatedSource reads capture files one after another, ordered by timestamp of their first packet
+// (tcpdump -C names them cap, cap1, ... cap10, so names don't sort). It is one stream of packets for
+// the parser, so conversations and cursor slots of flows spanning a rotation go on in the next file
+type rotatedSource struct {
+	backend  string
+	files    []string
+	next     int //index of the next file to open
+	current  CaptureSource
+	linkType layers.LinkType
+	filter   string
+	noBPF    bool //some file is read by pcapgo, so the parser filters packets of all files
+}
+
+// OpenRotatedSource opens directory or glob of capture files as a single source
+func OpenRotatedSource(backend string, set string) (CaptureSource, error) {
+	files, err := captureSetFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	r := &rotatedSource{backend: backend}
+	first := make(map[string]time.Time)
+	for i, file := range files {
+		s, err := OpenCaptureSource(backend, file, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if i > 0 && s.LinkType() != r.linkType {
+			s.Close()
+			return nil, fmt.Errorf("%s: link type %v differs from %v of %s", file, s.LinkType(), r.linkType, files[0])
+		}
+		r.linkType = s.LinkType()
+		if _, ci, err := s.ReadPacketData(); err == nil {
+			first[file] = ci.Timestamp
+		} else if err != io.EOF {
+			s.Close()
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		s.Close()
+		r.noBPF = r.noBPF || backend == "pcapgo" || backend == "auto" && IsPcapng(file)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return first[files[i]].Before(first[files[j]]) })
+	r.files = files
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatedSource) open() error {
+	file := r.files[r.next]
+	r.next++
+	s, err := OpenCaptureSource(r.backend, file, "")
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	if r.filter != "" {
+		if err := s.SetBPFFilter(r.filter); err != nil {
+			s.Close()
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	log.Println("Reading capture file", file)
+	r.current = s
+	return nil
+}
+
+func (r *rotatedSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		data, ci, err := r.current.ReadPacketData()
+		if err != io.EOF || r.next == len(r.files) {
+			return data, ci, err
+		}
+		r.current.Close()
+		if err := r.open(); err != nil {
+			return nil, gopacket.CaptureInfo{}, err
+		}
+	}
+}
+
+func (r *rotatedSource) LinkType() layers.LinkType { return r.linkType }
+
+// SetBPFFilter sets filter on the current file and every next one. If any file can't filter,
+// none is filtered and the parser has to do it for all of them
+func (r *rotatedSource) SetBPFFilter(filter string) error {
+	if r.noBPF {
+		return ErrNoBPF
+	}
+	if err := r.current.SetBPFFilter(filter); err != nil {
+		return err
+	}
+	r.filter = filter
+	return nil
+}
+
+func (r *rotatedSource) Close() {
+	r.current.Close()
+}
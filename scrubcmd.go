@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// ScrubCmd writes a copy of capture with SQL literals, bind values and row data replaced by placeholders
+// and optionally anonymized IPs, i.e. to share it with support or attach to a bug report
+func ScrubCmd(args []string) {
+	fs := flag.NewFlagSet("scrub", flag.ExitOnError)
+	anonymize := fs.Bool("anonymize", false, "replace IP addresses with 10.0.0.0/8 (IPv4) and fd00::/8 (IPv6) addresses, non-IP frames are dropped")
+	backend := fs.String("capture", "auto", "capture backend used to read the file: "+strings.Join(CaptureBackends, "|"))
+	fs.Usage = func() {
+		fmt.Println("Usage: stado scrub [options] in.pcap out.pcap")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	src, err := OpenCaptureSource(*backend, fs.Arg(0), "")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defer src.Close()
+	f, err := os.Create(fs.Arg(1))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(262144, src.LinkType()); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	s := tnsparse.NewScrubber(*anonymize)
+	decoder := PacketDecoder(src.LinkType())
+	written := 0
+	for {
+		data, ci, err := src.ReadPacketData()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		frame := append([]byte(nil), data...)
+		packet := gopacket.NewPacket(frame, decoder, gopacket.NoCopy)
+		if !s.Scrub(packet, ci.CaptureLength < ci.Length) {
+			continue
+		}
+		if err := w.WritePacket(ci, frame); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		written++
+	}
+	if err := f.Close(); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	fmt.Printf("%s: %d packets written, %d scrubbed\n", fs.Arg(1), written, s.Scrubbed)
+	//Mapowanie zostaje u nas - potrzebne, zeby wiedziec jaki adres bazy podac w -i
+	ips := make([]string, 0, len(s.IPs))
+	for ip := range s.IPs {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool { return bytes.Compare(s.IPs[ips[i]], s.IPs[ips[j]]) < 0 })
+	for _, ip := range ips {
+		fmt.Printf("%s\t=> %s\n", ip, s.IPs[ip])
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// SimParams describe network and database the conversation is replayed against
+type SimParams struct {
+	RTT         time.Duration //Round trip time after the move
+	MeasuredRTT time.Duration //Round trip time in the capture, 0 estimates it for each conversation
+	ServerScale float64       //Server time is multiplied by it (i.e. 0.5 for twice faster database)
+	Side        string        //Where the capture was taken: app or db
+}
+
+// rttGap tells if time between prev and p includes a network round trip. Captured next to the app it is
+// in request -> response gaps, captured next to the database in response -> request gaps
+func (sp *SimParams) rttGap(prev, p *tnsparse.SQLtcp) bool {
+	if sp.Side == "db" {
+		return prev.Response && !p.Response
+	}
+	return !prev.Response && p.Response
+}
+
+// EstimateRTT returns the shortest gap including a round trip - the one with no server nor client time in it
+func (sp *SimParams) EstimateRTT(packets []tnsparse.SQLtcp) time.Duration {
+	rtt := time.Duration(0)
+	for i := 1; i < len(packets); i++ {
+		if !sp.rttGap(&packets[i-1], &packets[i]) {
+			continue
+		}
+		if g := packets[i].Timestamp.Sub(packets[i-1].Timestamp); g > 0 && (rtt == 0 || g < rtt) {
+			rtt = g
+		}
+	}
+	return rtt
+}
+
+// Simulate returns copy of packets of a conversation with timestamps replayed against sp. Every gap keeps
+// its client and transfer time, round trips take sp.RTT instead of the measured one and server time is scaled
+func (sp *SimParams) Simulate(packets []tnsparse.SQLtcp) ([]tnsparse.SQLtcp, int) {
+	measured := sp.MeasuredRTT
+	if measured == 0 {
+		measured = sp.EstimateRTT(packets)
+	}
+	sim := make([]tnsparse.SQLtcp, len(packets))
+	copy(sim, packets)
+	roundTrips := 0
+	for i := 1; i < len(sim); i++ {
+		prev, p := &packets[i-1], &packets[i]
+		gap := p.Timestamp.Sub(prev.Timestamp)
+		roundTrip := sp.rttGap(prev, p)
+		net := time.Duration(0)
+		if roundTrip {
+			roundTrips++
+			net = measured
+			if gap < net {
+				net = gap
+			}
+		}
+		rest := gap - net
+		if !prev.Response && p.Response { //WaitServer
+			rest = time.Duration(float64(rest) * sp.ServerScale)
+		}
+		if roundTrip {
+			rest += sp.RTT
+		}
+		sim[i].Timestamp = sim[i-1].Timestamp.Add(rest)
+		if sim[i].Response {
+			sim[i].RTT = rest.Nanoseconds() //Tak jak w appendPacket
+		}
+	}
+	return sim, roundTrips
+}
+
+// simSQL is measured and simulated app time of a sqlid
+type simSQL struct {
+	SQLid      string
+	Executions uint
+	AppMs      float64
+	SimAppMs   float64
+}
+
+// simConversation is measured and simulated duration of a conversation
+type simConversation struct {
+	Id          string
+	MeasuredRTT time.Duration
+	RoundTrips  int
+	Duration    time.Duration
+	SimDuration time.Duration
+}
+
+// SimulateCmd replays request timing of conversations in a capture against other RTT and server latency,
+// i.e. to estimate how the workload would behave with the app next to the database
+func SimulateCmd(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	file := fs.String("f", "", "path to PCAP file")
+	dbIP := fs.String("i", "", "IP address of database server")
+	dbPort := fs.String("p", "", "Listener port for database server")
+	backend := fs.String("capture", "auto", "capture backend used to read the file: "+strings.Join(CaptureBackends, "|"))
+	conversation := fs.String("conversation", "", "replay only this conversation (client ip:port as in the report), all by default")
+	sp := SimParams{}
+	fs.DurationVar(&sp.RTT, "rtt", 500*time.Microsecond, "<duration> round trip time after the move")
+	fs.DurationVar(&sp.MeasuredRTT, "measured-rtt", 0, "<duration> round trip time in the capture, estimated for each conversation by default")
+	fs.Float64Var(&sp.ServerScale, "server-scale", 1, "server time multiplier i.e. 0.5 for twice faster database")
+	fs.StringVar(&sp.Side, "side", "app", "where the capture was taken: app|db")
+	top := fs.Int("top", 20, "number of sqlids and conversations reported (0 - all)")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	if *file == "" || *dbIP == "" || *dbPort == "" || (sp.Side != "app" && sp.Side != "db") || sp.ServerScale < 0 {
+		fmt.Println("Usage: stado simulate -f file.pcap -i <db ip> -p <db port> -rtt 0.5ms [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	src, err := OpenCaptureSource(*backend, *file, "")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defer src.Close()
+	analyzer := tnsparse.NewAnalyzer(strings.Split(*dbIP, "or"), *dbPort, tnsparse.WithSoftFilter())
+	analyzer.Run(gopacket.NewPacketSource(src, PacketDecoder(src.LinkType())))
+
+	parser := analyzer.Parser
+	var ids []string
+	for c := range parser.Conversations {
+		if *conversation == "" || strings.Contains(c, *conversation) {
+			ids = append(ids, c)
+		}
+	}
+	if len(ids) == 0 {
+		fmt.Println("No conversations to replay")
+		os.Exit(2)
+	}
+	sort.Strings(ids)
+
+	sqls := make(map[string]*simSQL)
+	var convs []simConversation
+	for _, c := range ids {
+		packets := parser.Conversations[c]
+		if len(packets) < 2 {
+			continue
+		}
+		sim, roundTrips := sp.Simulate(packets)
+		convs = append(convs, simConversation{Id: c, MeasuredRTT: sp.EstimateRTT(packets), RoundTrips: roundTrips,
+			Duration:    packets[len(packets)-1].Timestamp.Sub(packets[0].Timestamp),
+			SimDuration: sim[len(sim)-1].Timestamp.Sub(sim[0].Timestamp)})
+		if sp.MeasuredRTT > 0 {
+			convs[len(convs)-1].MeasuredRTT = sp.MeasuredRTT
+		}
+
+		//WalkConversation czyta pakiety z parser.Conversations, wiec na chwile podmieniamy je symulowanymi
+		parser.WalkConversation(c, func(e *tnsparse.Execution) {
+			s, ok := sqls[e.SQLid]
+			if !ok {
+				s = &simSQL{SQLid: e.SQLid}
+				sqls[e.SQLid] = s
+			}
+			s.Executions++
+			s.AppMs += float64(e.AppNs) / 1000000
+		})
+		parser.Conversations[c] = sim
+		parser.WalkConversation(c, func(e *tnsparse.Execution) {
+			if s, ok := sqls[e.SQLid]; ok {
+				s.SimAppMs += float64(e.AppNs) / 1000000
+			}
+		})
+		parser.Conversations[c] = packets
+	}
+	printSimulation(&sp, convs, sqls, *top)
+}
+
+func printSimulation(sp *SimParams, convs []simConversation, sqls map[string]*simSQL, top int) {
+	var duration, simDuration time.Duration
+	for _, c := range convs {
+		duration += c.Duration
+		simDuration += c.SimDuration
+	}
+	fmt.Printf("Replayed %d conversations with RTT %v and server time x%.2f (captured at %s side)\n", len(convs), sp.RTT, sp.ServerScale, sp.Side)
+	fmt.Printf("Session time: measured %v, simulated %v (%.1f%%)\n", duration.Round(time.Millisecond),
+		simDuration.Round(time.Millisecond), 100*relChange(duration.Seconds(), simDuration.Seconds()))
+
+	rows := make([]*simSQL, 0, len(sqls))
+	for _, s := range sqls {
+		rows = append(rows, s)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if ri, rj := rows[i].AppMs-rows[i].SimAppMs, rows[j].AppMs-rows[j].SimAppMs; ri != rj {
+			return ri > rj
+		}
+		return rows[i].SQLid < rows[j].SQLid
+	})
+	if top > 0 && len(rows) > top {
+		rows = rows[:top]
+	}
+	fmt.Println("\nSQL ID\t\tExec\tEla App (ms)\tSim App (ms)\tApp/Exec\tSim App/Exec\tChange %")
+	for _, s := range rows {
+		fmt.Printf("%s\t%d\t%f\t%f\t%f\t%f\t%.1f\n", s.SQLid, s.Executions, s.AppMs, s.SimAppMs,
+			s.AppMs/float64(s.Executions), s.SimAppMs/float64(s.Executions), 100*relChange(s.AppMs, s.SimAppMs))
+	}
+
+	sort.Slice(convs, func(i, j int) bool {
+		if di, dj := convs[i].Duration-convs[i].SimDuration, convs[j].Duration-convs[j].SimDuration; di != dj {
+			return di > dj
+		}
+		return convs[i].Id < convs[j].Id
+	})
+	if top > 0 && len(convs) > top {
+		convs = convs[:top]
+	}
+	fmt.Println("\nConversation\t\tRound trips\tMeasured RTT\tDuration\tSimulated\tChange %")
+	for _, c := range convs {
+		fmt.Printf("%s\t%d\t\t%v\t%v\t%v\t%.1f\n", c.Id, c.RoundTrips, c.MeasuredRTT, c.Duration.Round(time.Millisecond),
+			c.SimDuration.Round(time.Millisecond), 100*relChange(c.Duration.Seconds(), c.SimDuration.Seconds()))
+	}
+}
+
+// relChange returns relative change from measured to simulated, -0.5 is twice faster
+func relChange(measured, simulated float64) float64 {
+	if measured == 0 {
+		return 0
+	}
+	return simulated/measured - 1
+}
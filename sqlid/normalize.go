@@ -0,0 +1,90 @@
+package sqlid
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Normalize returns SQL text in the form used for matching statements which differ only in literals,
+// like FORCE_MATCHING_SIGNATURE of Oracle: string and numeric literals are replaced with :"SYS_B_n"
+// binds, comments (except hints) are dropped, whitespace is collapsed and text outside quotes is uppercased
+func Normalize(sql string) string {
+	var b strings.Builder
+	n := 0
+	space := false
+	sql = strings.Trim(sql, "\x00")
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = b.Len() > 0
+			continue
+		case strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			space = b.Len() > 0
+			continue
+		case strings.HasPrefix(sql[i:], "/*") && !strings.HasPrefix(sql[i:], "/*+"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i - 4
+			}
+			i += end + 3
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		switch {
+		case c == '\'':
+			//Literal konczy sie na apostrofie, ktory nie jest podwojony
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteString(`:"SYS_B_` + strconv.Itoa(n) + `"`)
+			n++
+		case c == '"':
+			//Identyfikator w cudzyslowie zostaje jak jest
+			end := strings.IndexByte(sql[i+1:], '"')
+			if end < 0 {
+				end = len(sql) - i - 2
+			}
+			b.WriteString(sql[i : i+end+2])
+			i += end + 1
+		case isDigit(c) && (b.Len() == 0 || !isIdentByte(b.String()[b.Len()-1])):
+			for i+1 < len(sql) && (isDigit(sql[i+1]) || sql[i+1] == '.' || sql[i+1] == 'e' || sql[i+1] == 'E') {
+				i++
+			}
+			b.WriteString(`:"SYS_B_` + strconv.Itoa(n) + `"`)
+			n++
+		default:
+			if c >= 'a' && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Signature returns sqlid of normalized SQL text, the same for statements differing only in literals
+func Signature(sql string) string {
+	return Get(Normalize(sql))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || isDigit(c) || c == '_' || c == '$' || c == '#' || c == ':' || c == '"'
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema keeps results of many captures in one file, rows of each capture are tied by capture_id
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS captures (
+	id          INTEGER PRIMARY KEY,
+	source      TEXT,
+	db_port     TEXT,
+	time_begin  TEXT,
+	time_end    TEXT,
+	duration_s  REAL,
+	sum_app_s   REAL,
+	sum_net_s   REAL,
+	written     TEXT
+);
+CREATE TABLE IF NOT EXISTS conversations (
+	capture_id   INTEGER REFERENCES captures(id),
+	conversation TEXT,
+	client_ip    TEXT,
+	client_port  TEXT,
+	client_label TEXT,
+	db           TEXT,
+	executions   INTEGER,
+	failed       INTEGER,
+	bytes        INTEGER
+);
+CREATE TABLE IF NOT EXISTS executions (
+	capture_id        INTEGER REFERENCES captures(id),
+	start             TEXT,
+	start_unix_ns     INTEGER,
+	sql_id            TEXT,
+	conversation      TEXT,
+	app_ms            REAL,
+	net_ms            REAL,
+	packets           INTEGER,
+	bytes             INTEGER,
+	reused            INTEGER,
+	error             TEXT,
+	rows              INTEGER,
+	round_trips       INTEGER,
+	first_response_ms REAL,
+	streaming_ms      REAL
+);
+CREATE INDEX IF NOT EXISTS executions_sql_id ON executions(capture_id, sql_id);
+CREATE TABLE IF NOT EXISTS sqls (
+	capture_id      INTEGER REFERENCES captures(id),
+	sql_id          TEXT,
+	sql_text        TEXT,
+	signature       TEXT,
+	executions      INTEGER,
+	ela_app_ms      REAL,
+	ela_net_ms      REAL,
+	app_per_exec_ms REAL,
+	net_per_exec_ms REAL,
+	app_p50_ms      REAL,
+	app_p95_ms      REAL,
+	app_p99_ms      REAL,
+	packets         INTEGER,
+	sessions        INTEGER,
+	rows            INTEGER,
+	failed          INTEGER,
+	impact          REAL
+);
+CREATE TABLE IF NOT EXISTS findings (
+	capture_id INTEGER REFERENCES captures(id),
+	rule       TEXT,
+	severity   TEXT,
+	sql_id     TEXT,
+	value      REAL,
+	threshold  REAL,
+	message    TEXT
+);
+`
+
+// SQLiteExporter writes conversations, executions and aggregates of a capture into SQLite database
+// (-o sqlite:file), so results can be queried with SQL and joined with other captures
+type SQLiteExporter struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	exec    *sql.Stmt
+	capture int64
+	err     error //The first failed insert, executions are written from ExecutionHook which can't return it
+}
+
+// NewSQLiteExporter opens (or creates) database file and registers a new capture read from source
+func NewSQLiteExporter(file string, source string) (*SQLiteExporter, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+	e := &SQLiteExporter{db: db}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't create schema in %s: %v", file, err)
+	}
+	//Wszystko w jednej transakcji - insert po insercie z autocommitem trwalby godzinami
+	if e.tx, err = db.Begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	res, err := e.tx.Exec("INSERT INTO captures (source, written) VALUES (?, ?)", source, time.Now().Format(time.RFC3339))
+	if err == nil {
+		e.capture, err = res.LastInsertId()
+	}
+	if err == nil {
+		e.exec, err = e.tx.Prepare(`INSERT INTO executions (capture_id, start, start_unix_ns, sql_id, conversation, app_ms, net_ms,
+			packets, bytes, reused, error, rows, round_trips, first_response_ms, streaming_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	}
+	if err != nil {
+		e.tx.Rollback()
+		db.Close()
+		return nil, fmt.Errorf("can't write to %s: %v", file, err)
+	}
+	return e, nil
+}
+
+// Write is an ExecutionHook
+func (e *SQLiteExporter) Write(ex *tnsparse.Execution) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.exec.Exec(e.capture, ex.Start.Format(time.RFC3339Nano), ex.Start.UnixNano(), ex.SQLid, ex.Conversation,
+		float64(ex.AppNs)/1000000, float64(ex.NetNs)/1000000, ex.Packets, int64(ex.Bytes), ex.Reused, ex.Error, int64(ex.Rows),
+		ex.RoundTrips, float64(ex.FirstNs)/1000000, float64(ex.StreamNs())/1000000)
+}
+
+// Finish writes conversations of st and aggregates of analysis a and commits the capture
+func (e *SQLiteExporter) Finish(st *stats.Stats, a *stats.Analysis) error {
+	if e.err == nil {
+		e.err = e.writeAnalysis(st, a)
+	}
+	e.exec.Close()
+	if e.err != nil {
+		e.tx.Rollback()
+		e.db.Close()
+		return fmt.Errorf("can't write SQLite results: %v", e.err)
+	}
+	if err := e.tx.Commit(); err != nil {
+		e.db.Close()
+		return fmt.Errorf("can't write SQLite results: %v", err)
+	}
+	return e.db.Close()
+}
+
+func (e *SQLiteExporter) writeAnalysis(st *stats.Stats, a *stats.Analysis) error {
+	if _, err := e.tx.Exec(`UPDATE captures SET db_port = ?, time_begin = ?, time_end = ?, duration_s = ?, sum_app_s = ?, sum_net_s = ?
+		WHERE id = ?`, a.DBPort, a.TimeBegin.Format(time.RFC3339Nano), a.TimeEnd.Format(time.RFC3339Nano), a.DurationS,
+		a.SumAppS, a.SumNetS, e.capture); err != nil {
+		return err
+	}
+
+	conv, err := e.tx.Prepare(`INSERT INTO conversations (capture_id, conversation, client_ip, client_port, client_label, db,
+		executions, failed, bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer conv.Close()
+	//Konwersacje usuniete przez -evict zostaja w licznikach, wiec nie idziemy po Conversations
+	for _, c := range stats.SortedKeys(st.ConvBytes) {
+		failed := uint64(0)
+		for _, n := range st.ConvErrors[c] {
+			failed += n
+		}
+		ip := tnsparse.ClientIP(c)
+		if _, err := conv.Exec(e.capture, c, ip, tnsparse.ClientPort(c), stats.ClientLabel(ip), tnsparse.DBLabelOf(c), st.ConvExecutions[c],
+			int64(failed), int64(st.ConvBytes[c])); err != nil {
+			return err
+		}
+	}
+
+	sqls, err := e.tx.Prepare(`INSERT INTO sqls (capture_id, sql_id, sql_text, signature, executions, ela_app_ms, ela_net_ms,
+		app_per_exec_ms, net_per_exec_ms, app_p50_ms, app_p95_ms, app_p99_ms, packets, sessions, rows, failed, impact)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer sqls.Close()
+	for _, r := range a.SQLs {
+		if _, err := sqls.Exec(e.capture, r.SQLid, r.SQLtxt, r.Signature, r.Executions, r.ElaAppMs, r.ElaNetMs, r.AppPerExecMs,
+			r.NetPerExecMs, r.AppP50Ms, r.AppP95Ms, r.AppP99Ms, r.Packets, r.Sessions, int64(r.Rows), int64(r.Failed), r.Impact); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range a.Findings {
+		if _, err := e.tx.Exec(`INSERT INTO findings (capture_id, rule, severity, sql_id, value, threshold, message)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, e.capture, f.Rule, f.Severity, f.SQLid, f.Value, f.Threshold, f.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -23,124 +23,273 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
 	"os"
+	"os/signal"
 	"regexp"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
-	"github.com/ora600pl/stado/sqlid"
-	"github.com/wcharczuk/go-chart"
-	"github.com/wcharczuk/go-chart/drawing"
+	"github.com/ora600pl/stado/report"
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
 )
 
-func StdDev(x []float64) float64 {
-	var sum, mean, sd float64
-	for _, elem := range x {
-		sum += elem
-	}
-	mean = sum / float64(len(x))
-	for _, elem := range x {
-		sd += math.Pow(elem-mean, 2)
-	}
-
-	sd = math.Sqrt(sd / float64(len(x)))
-	return sd
-}
-
-type SQLtcp struct {
-	SQL_id       string
-	SQL          string
-	Conversation string
-	Payload      []byte
-	Seq          uint32
-	Ack          uint32
-	Timestamp    time.Time
-	IsReused     uint
-	RTT          int64
-}
-
-type SQLtcpSort []SQLtcp
-
-func (a SQLtcpSort) Len() int           { return len(a) }
-func (a SQLtcpSort) Less(i, j int) bool { return a[j].Seq == a[i].Ack }
-func (a SQLtcpSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-var Conversations map[string][]SQLtcp
-
-type SQLstats struct {
-	SQLtxt         string
-	Elapsed_ms_all []float64       //Elapsed time from net perspective for each packet (Each Request till following Fetch + DBTime)
-	Elapsed_ms_sum float64         //All elapsed times from net perspective per packet
-	Executions     uint            //Cumulative for all Conversattion
-	Packets        uint            //Cumulative for all Conversattion
-	Sessions       map[string]uint //Number of Converstations in which this sqlid exists
-	ReusedCursors  uint            //Cumulative , how many time this SQL was requested using cursor
-	Elapsed_ms_app float64         //SQLid Wallclock time: since Request till last Fetch (NetTime + AppTime + DBTime)
-	Ela_ms_app_all []float64       //Elapsed time from app perspective
-}
-
-func (s *SQLstats) Fill(sqlTxt string, sqlDuration int64, session string, packet_cnt uint, reusedCursors uint, sqlApp int64) {
-	s.SQLtxt = sqlTxt
-	s.Elapsed_ms_all = append(s.Elapsed_ms_all, float64(sqlDuration)/1000000)
-	s.Elapsed_ms_sum += float64(sqlDuration) / 1000000
-	s.Executions += 1
-	s.Packets += packet_cnt
-	s.Sessions[session] = 1
-	s.ReusedCursors += reusedCursors
-	s.Elapsed_ms_app += float64(sqlApp) / 1000000
-	s.Ela_ms_app_all = append(s.Ela_ms_app_all, float64(sqlApp)/1000000)
-}
-
-var SQLIdStats map[string]*SQLstats
+// Quiet is machine mode: no text report, charts or diagnostics, only the JSON summary on stdout
+var Quiet bool
 
 func banner() {
 	fmt.Println("STADO (SQL Tracedump Analyzer Doing Oracle) by Radoslaw Kut and Kamil Stawiarski")
 	fmt.Println("Pcap file analyzer for finding TOP SQLs from an APP perspective")
 }
 
+// subcommands are invoked as "stado <name> [flags]"
+var subcommands = map[string]func(args []string){
+	"archive":  ArchiveCmd,
+	"bench":    BenchCmd,
+	"capture":  CaptureCmd,
+	"compare":  CompareCmd,
+	"join":     JoinCmd,
+	"report":   ReportCmd,
+	"scrub":    ScrubCmd,
+	"simulate": SimulateCmd,
+	"topology": TopologyCmd,
+	"trend":    TrendCmd,
+}
+
 func main() {
-	pcapFile := flag.String("f", "", "path to PCAP file for analyzing")
+	var err error
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	pcapFile := flag.String("f", "", "path to PCAP file for analyzing, a directory or glob of rotated files (read in timestamp order), comma separated files from different hosts are merged into one timeline")
 	dbIP := flag.String("i", "", "IP address of database server")
 	dbPort := flag.String("p", "", "Listener port for database server")
 	debug := flag.Int("d", 0, "Debug flag")
 	chartsDir := flag.String("C", "", "<dir> directory path to write SQL Charts i.e. -C DevApp")
+	iface := flag.String("iface", "", "<dev> network interface for live capture instead of -f i.e. -iface eth0")
+	daemon := flag.Bool("daemon", false, "run as a service until SIGTERM, then flush the final report")
+	healthAddr := flag.String("health", "", "<addr> serve /healthz and /readyz in daemon mode i.e. -health :8080")
+	systemd := flag.Bool("systemd", false, "send READY/STOPPING notifications to systemd (Type=notify) in daemon mode")
+	stream := flag.Bool("stream", false, "streaming mode: read -f as fifo/stdin (-f -) and write only JSON lines to stdout, no charts")
+	backend := flag.String("capture", "auto", "capture backend: "+strings.Join(CaptureBackends, "|"))
+	noBPF := flag.Bool("no-bpf", false, "filter packets of the database in the parser instead of BPF, for encapsulations BPF can't see through (MPLS, 0x9100 QinQ tags)")
+	listIfaces := flag.Bool("list-interfaces", false, "list network interfaces available for -iface and exit")
+	interval := flag.Duration("interval", 0, "<duration> emit cumulative report every interval in daemon/streaming mode i.e. -interval 1m")
+	flag.DurationVar(&tnsparse.EvictAfter, "evict", 0, "<duration> drop packets and cursor state of conversations idle that long, keeping their executions (long live captures) i.e. -evict 15m")
+	flag.IntVar(&tnsparse.Workers, "workers", tnsparse.Workers, "number of goroutines finding executions in conversations")
+	flag.BoolVar(&tnsparse.LowMemory, "low-memory", false, "drop payload of each packet once it is decoded, fold ended executions out of live conversations and evict idle ones (-evict 15m unless given), for captures larger than RAM")
+	flag.IntVar(&tnsparse.MaxEvicted, "max-evicted", tnsparse.MaxEvicted, "max number of executions of evicted conversations kept for statistics, the earliest evicted are dropped first and the report is marked partial (0 - unlimited)")
+	flag.IntVar(&tnsparse.MaxConversations, "max-conversations", 0, "max number of conversations kept in memory, the least recently seen are dropped first (0 - unlimited)")
+
+	tnsFile := flag.String("tnsnames", "", "<file> tnsnames.ora or LDIF export used to label database endpoints with aliases")
+	hostsFile := flag.String("hosts", "", "<file> hosts file used to name client and database IPs")
+	flag.BoolVar(&tnsparse.ResolveDNS, "resolve", false, "resolve client and database IPs with reverse DNS")
+	flag.BoolVar(&tnsparse.Offline, "offline", false, "never query DNS (i.e. in secure environments), use only -hosts file")
+	labelsFile := flag.String("labels", "", "<file> YAML map of client IP or subnet to application label i.e. \"10.4.2.17: billing-batch-prod\"")
+	tags := flag.Bool("tags", false, "group executions by application tags found in SQL comments i.e. /* module:checkout */")
+	tagRe := flag.String("tag-re", stats.DefaultTagPattern, "<regexp> tag in SQL comment, \"key:value\" for two groups, the group for one, otherwise the whole match")
+	subnetsFile := flag.String("subnets", "", "<file> client subnets mapping with lines \"CIDR name\" i.e. \"10.20.0.0/16 VPN\"")
+	flag.IntVar(&stats.SubnetBits, "subnet-bits", stats.SubnetBits, "prefix length grouping clients not covered by -subnets")
+	flag.UintVar(&stats.ShortSessionExecs, "short-session", stats.ShortSessionExecs, "report sessions closed after fewer executions than this (broken connection pooling)")
+	flag.DurationVar(&stats.ShortLifetime, "short-lifetime", stats.ShortLifetime, "<duration> sessions living shorter are counted as short-lived")
+	flag.DurationVar(&stats.IdleThreshold, "idle", stats.IdleThreshold, "<duration> gaps without TNS traffic at least that long are reported as idle")
+	flag.DurationVar(&stats.IdleKillThreshold, "idle-kill", stats.IdleKillThreshold, "<duration> RST after idle that long is reported as suspected firewall idle timeout kill")
+	from := flag.String("from", "", "<time> analyze only packets captured since, i.e. \"2024-03-01 14:30:00\", \"14:30:00\" (on the day of the capture start) or \"+1h30m\" (since the capture start)")
+	to := flag.String("to", "", "<time> analyze only packets captured till, the same format as -from")
+	dedup := flag.Duration("dedup", tnsparse.DedupWindow, "<duration> drop frames seen twice within the window (SPAN/bond duplicates), 0 disables")
+	mirror := flag.Duration("mirror", 0, "<duration> analyze once sessions captured on both legs (inline tap before and after proxy/NAT) which requests are that much apart at most, i.e. -mirror 1s")
+	timeOffsets := flag.String("offsets", "", "<list> time offset of each -f file merged from different hosts i.e. -f app.pcap,db.pcap -offsets 0,-350ms (auto estimates it)")
+	saveFile := flag.String("save", "", "<file> save the analysis, it can be reported later with \"stado report -in <file>\"")
+	sqlIDs := flag.String("sqlid", "", "<list> analyze only executions of these comma separated sqlids (signatures with -by-signature)")
+	debugConvs := flag.Int("debug-conversations", 0, "<n> write the first n conversations packet by packet with decoded fields and payload hex dump into -debug-dir")
+	debugDir := flag.String("debug-dir", "stado_debug", "<dir> directory of -debug-conversations dumps")
+	dumpFile := flag.String("dump", "", "<file> write every packet of each execution, i.e. with -sqlid for a deep dive into a few statements")
+	csvFile := flag.String("csv", "", "<file> export every execution as a CSV row i.e. -csv executions.csv")
+	flag.DurationVar(&stats.ApdexThreshold, "apdex", 0, "<duration> target app time T of Apdex scores per sqlid and overall (satisfied up to T, tolerating up to 4T) i.e. -apdex 100ms")
+	flag.DurationVar(&stats.SLAThreshold, "sla", 0, "<duration> app time of an execution breaching SLA, charts the fraction of breaching executions per -sla-interval i.e. -sla 200ms")
+	flag.DurationVar(&stats.SLAInterval, "sla-interval", stats.SLAInterval, "<duration> interval of the SLA burn chart")
+	flag.Float64Var(&stats.SLABudget, "sla-budget", stats.SLABudget, "fraction of executions allowed to breach -sla in an interval, intervals above it are reported as degraded")
+	flag.DurationVar(&stats.ProfileInterval, "load-profile", 0, "<duration> report executions, app and net time and bytes per interval, overall and for the top sqlids, to tell a constant slowdown from a spike i.e. -load-profile 10s")
+	keepPrograms := flag.String("program", "", "<names> count only sessions which PROGRAM from TNS CONNECT contains one of comma separated names i.e. -program \"JDBC Thin Client\"")
+	excludePrograms := flag.String("exclude-program", "", "<names> leave out sessions which PROGRAM from TNS CONNECT contains one of comma separated names i.e. -exclude-program \"SQL Developer,sqlplus\"")
+	flag.StringVar(&tnsparse.Protocol, "protocol", tnsparse.Protocol, "wire protocol of the database: "+strings.Join(tnsparse.Protocols, "|"))
+	flag.StringVar(&tnsparse.TTCProfileName, "ttc", tnsparse.TTCProfileName, "TTC field layout: auto (detected per session at connect and logon)|11g|12c|23ai")
+	flag.StringVar(&stats.Center, "center", stats.Center, "per-execution elapsed time statistic: mean|trimmed|median")
+	flag.StringVar(&stats.Dispersion, "dispersion", stats.Dispersion, "elapsed time dispersion statistic: stddev|mad")
+	flag.BoolVar(&stats.BySignature, "by-signature", false, "aggregate statements differing only in literals into one row per force matching signature instead of sqlid")
+	flag.StringVar(&stats.SortBy, "sort", stats.SortBy, "order of sqlids in the report and rank prefix of their charts: "+strings.Join(stats.SortKeys, "|"))
+	scatter := flag.String("scatter", "", "<list> comma separated sqlids which net vs app time per execution is charted into scatter_<sqlid>.png")
+	metricsFile := flag.String("metrics", "", "<file> custom per-execution metrics, lines \"name request|response|any regexp\" counting matches in payloads")
+	flowRulesFile := flag.String("flow-rules", "", "<file> rules checked before the built-in ones, lines \"name marker|packet|response|off regexp\" choosing what ends executions of SQL matching regexp")
+	rulesFile := flag.String("rules", "", "<file> rules added to the built-in ones (a rule with the same name replaces it), lines \"name sql|analysis metric op threshold severity message\"")
+	whatifFetch := flag.String("whatif-fetch", "10:500", "<from:to> fetch size now and after the fix for the what-if section")
+	flag.Float64Var(&stats.ParseMs, "whatif-parse", stats.ParseMs, "hard parse time (ms) saved by each literal variant for the what-if section")
+	flag.BoolVar(&stats.ByClient, "by-client", false, "print each sqlid split by client IP executing it")
+	flag.IntVar(&stats.TopSQLs, "top", stats.TopSQLs, "number of sqlids reported and charted, the rest is summed in an \"others\" line (0 - all)")
+	flag.IntVar(&report.MaxCharts, "max-charts", report.MaxCharts, "max number of per-sqlid charts rendered, in report order (0 - all)")
+	flag.IntVar(&report.ChartWorkers, "chart-workers", report.ChartWorkers, "number of charts rendered in parallel")
+	flag.StringVar(&report.Units, "units", report.Units, "durations and sizes in the text report: raw (plain ms, s and kb) or human (1.2 s, 34 ms, 5.6 MB)")
+	flag.StringVar(&report.Locale, "locale", report.Locale, "decimal and thousands separators of -units human: en|pl|de|fr|ch")
+	flag.Float64Var(&stats.TrimFraction, "trim", stats.TrimFraction, "fraction of the fastest and of the slowest executions dropped by -center trimmed")
+	flag.UintVar(&stats.PollMinExecs, "poll-execs", stats.PollMinExecs, "sessions executing sqlid at regular intervals at least that many times are reported as polling")
+	flag.Float64Var(&stats.PlanRatio, "plan-ratio", stats.PlanRatio, "sqlids which app time shifts or splits into two groups with medians differing that many times are reported as suspected plan changes")
+	flag.IntVar(&stats.TopSlowest, "slowest", stats.TopSlowest, "number of the slowest executions reported for each sqlid (0 - none)")
+	flag.DurationVar(&stats.IntervalResolution, "resolution", stats.IntervalResolution, "<duration> interval of per-sqlid summaries kept in saved analyses for \"stado archive\"")
+	flag.IntVar(&stats.MaxSamples, "samples", stats.MaxSamples, "max number of per-execution samples kept per sqlid for charts and dispersion (0 - unlimited)")
+	flag.BoolVar(&Quiet, "quiet", false, "print only a single JSON summary document, no text report, charts or diagnostics (for other tools and cron jobs)")
+	output := flag.String("o", "text", "report format: text|json (full statistics with per-execution elapsed times and sessions of each sqlid on stdout, no charts)|sqlite:<file> (conversations, executions and aggregates appended to SQLite database)")
+	progressEvery := flag.Duration("progress", 0, "<duration> print progress of reading -f (percent, packets/s, time remaining) to stderr every duration i.e. -progress 5s")
+	pprofAddr := flag.String("pprof", "", "<addr> serve Go profiling endpoints (/debug/pprof/) i.e. -pprof :6060")
 
 	flag.Parse()
+	start := time.Now()
 
-	if *pcapFile == "" || *dbIP == "" || *dbPort == "" {
+	if *listIfaces {
+		if err := ListInterfaces(); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
+	if (*pcapFile == "" && *iface == "") || *dbIP == "" || *dbPort == "" {
 		banner()
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
+	sqliteFile := ""
+	if strings.HasPrefix(*output, "sqlite:") {
+		sqliteFile = strings.TrimPrefix(*output, "sqlite:")
+	} else if *output != "text" && *output != "json" {
+		fmt.Println("Unknown -o report format", *output)
+		os.Exit(1)
+	}
+	if *output == "sqlite:" {
+		fmt.Println("-o sqlite:<file> needs a database file")
+		os.Exit(1)
+	}
+	fullJSON := *output == "json"
+	if fullJSON {
+		Quiet = true
+	}
+
+	if (stats.Center != "mean" && stats.Center != "trimmed" && stats.Center != "median") || (stats.Dispersion != "stddev" && stats.Dispersion != "mad") {
+		fmt.Println("Unknown -center or -dispersion statistic")
+		os.Exit(1)
+	}
+	if stats.TrimFraction < 0 || stats.TrimFraction >= 0.5 {
+		fmt.Println("-trim has to be at least 0 and below 0.5")
+		os.Exit(1)
+	}
+
+	if err := stats.CheckSortBy(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := report.CheckUnits(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := tnsparse.CheckProtocol(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if tnsparse.LowMemory && tnsparse.EvictAfter == 0 {
+		tnsparse.EvictAfter = tnsparse.LowMemoryEvictAfter
+	}
+
+	if tnsparse.TTCProfileName != "auto" {
+		if _, err := tnsparse.TTCProfileByName(tnsparse.TTCProfileName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *hostsFile != "" {
+		if err := tnsparse.LoadHostsFile(*hostsFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	if *tnsFile != "" {
+		if err := tnsparse.LoadTNSNames(*tnsFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	if *labelsFile != "" {
+		if err := stats.LoadClientLabels(*labelsFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	stats.SQLidFilter = stats.ParseSQLidFilter(*sqlIDs)
+	stats.KeepPrograms, stats.ExcludePrograms = stats.ParsePrograms(*keepPrograms), stats.ParsePrograms(*excludePrograms)
+
+	if err := stats.ParseFetchSizes(*whatifFetch); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *scatter != "" {
+		report.ScatterSQLs = strings.Split(*scatter, ",")
+	}
+
+	if *tags {
+		if stats.TagPattern, err = regexp.Compile(*tagRe); err != nil {
+			fmt.Println("-tag-re:", err)
+			os.Exit(2)
+		}
+	}
+
+	if *metricsFile != "" {
+		if err := tnsparse.LoadMetrics(*metricsFile); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *flowRulesFile != "" {
+		if err := tnsparse.LoadFlowRules(*flowRulesFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+	if *rulesFile != "" {
+		if err := stats.LoadRules(*rulesFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
+	if *subnetsFile != "" {
+		if err := stats.LoadSubnets(*subnetsFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+	}
+
 	if *debug == 0 {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	if *chartsDir == "" {
-		*chartsDir = "./SQLCharts"
-		if _, err := os.Stat(*chartsDir); os.IsNotExist(err) {
-			err = os.Mkdir(*chartsDir, 0755)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(2)
-			}
-			fmt.Println("All SQL Charts will be saved into " + *chartsDir + " dierectory\n")
-		}
-	} else if _, err := os.Stat(*chartsDir); os.IsNotExist(err) {
-		err = os.Mkdir(*chartsDir, 0755)
-		if err != nil {
+	if *stream {
+		*daemon = true
+	} else if !Quiet {
+		if *chartsDir, err = report.MakeChartsDir(*chartsDir); err != nil {
 			fmt.Println(err)
 			os.Exit(2)
 		}
@@ -148,399 +297,176 @@ func main() {
 
 	dbIPs := strings.Split(*dbIP, "or")
 	log.Println("dB IPs for check: ", dbIPs)
+	stats.MultiDB = len(dbIPs) > 1
 
-	Conversations = make(map[string][]SQLtcp)
-	SQLIdStats = make(map[string]*SQLstats)
-
-	SQLslot := make(map[string]string)
-	//reqTimestamp := make(map[string] time.Time)
-	//resTimestamp := make(map[string] time.Time)
-	ipTnsBytes := make(map[string]uint64)
-
-	handle, err := pcap.OpenOffline(*pcapFile)
+	window, err := tnsparse.NewTimeWindow(*from, *to)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
-
-	log.Println("Opened pcap file")
+	opts := []tnsparse.Option{tnsparse.WithDedup(*dedup), tnsparse.WithMirror(*mirror), tnsparse.WithWindow(window)}
+	var sampler *ConversationSampler
+	if *debugConvs > 0 {
+		if sampler, err = NewConversationSampler(*debugDir, *debugConvs); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		opts = append(opts, WithConversationSampler(sampler))
+	}
+	analyzer := tnsparse.NewAnalyzer(dbIPs, *dbPort, opts...)
+	parser := analyzer.Parser
+
+	var handle CaptureSource
+	if files := SplitFiles(*pcapFile); len(files) > 1 && *iface == "" {
+		var offsets []string
+		if *timeOffsets != "" {
+			offsets = strings.Split(*timeOffsets, ",")
+		}
+		handle, err = OpenMergedSource(*backend, files, offsets, *dbPort)
+	} else {
+		handle, err = OpenCaptureSource(*backend, *pcapFile, *iface)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	log.Println("Opened capture source", *backend, *pcapFile, *iface)
 	defer handle.Close()
 
-	filter := "host " + *dbIP + " and port " + *dbPort
-	err = handle.SetBPFFilter(filter)
-	if err != nil {
+	filter := CaptureFilter(*dbIP, *dbPort)
+	if *noBPF {
+		err = ErrNoBPF
+	} else {
+		err = handle.SetBPFFilter(filter)
+	}
+	if err == ErrNoBPF {
+		log.Println("Capture source can't use BPF, filtering packets in parser")
+		parser.SoftFilter = true
+	} else if err != nil {
 		log.Fatal(err)
 	}
 
 	log.Println("Created BPF Filter", filter)
 
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	rSQL := regexp.MustCompile("(?i)SELECT|update|insert|with|delete|commit|alter")
-	log.Println("Created regular expression for SQLs")
-
-	var appPort, appIp, sqlTxt, found_dbIp, found_dbPort string
-
-	littleEndianFlag := byte(254)
-	bigEndianFlag := byte(0)
-	oneByteSizeFlag := byte(1)
-	uncertainSqlSize := 65279                 // 0xFEFF at the beginning of SQL
-	usedCursorFlag := []byte{29, 6}           //Packet length 29 and type DATA (0x06)
-	usedCursorFlagAfterError := []byte{48, 6} //Packet length 48 and type DATA (0x06)
-	endOfDataFlag := []byte{123, 5}           //Flag in ResonseData 0x7b05 before ORA-01403 at the end of fetch
-	retOpiParam := byte(8)                    //TNS Header at @10
-	retStatus := byte(4)                      //TNS Header at @10
-	tnsPacketData := byte(6)                  //TNS Header at@4
-
-	sqlTxtFlow := make(map[string]string) //mapa wykonanych polecen sql w danej konwersacji z przypisaniem do slotu otwartego kursora
-
-	var tBegin, tEnd time.Time //liczenie horyzontu czasu od: do: z pliku pcap
-	reusedCursor := uint(0)    //Licznik uzytych ponownie kursorow z klienta
-
-	for packet := range packetSource.Packets() {
-		log.Println("Started packets loop") //Tylko pakiety z wartstwa aplikacyjna (TNS) beda parsowane
-		if app := packet.ApplicationLayer(); app != nil {
-			tcpLayer := packet.Layer(layers.LayerTypeTCP)
-			ipv4Layer := packet.Layer(layers.LayerTypeIPv4)
-			log.Println("Created tcp and ipv4 layers from packet")
-			tcp := tcpLayer.(*layers.TCP)
-			ipv4 := ipv4Layer.(*layers.IPv4)
-			sqlTxt = "_"
-			//log.Println(packet)
-			log.Println("Created tcp and ipv4 fields based on layers")
-			foundValidPacket := true //flag to filter out packets for testing purposes
-			responsePacket := false
-			/*Petla ma na celu ustalenie adresow IP bazy i klienta w badanym pakiecie.
-			  Odbywa sie to na podstawie porownania zrodlowych i docelowych portow z zadeklarowanym
-			  portem z flagi "-p" */
-			for _, checkIP := range dbIPs {
-				log.Println("Checking if " + ipv4.SrcIP.String() +
-					" or " + ipv4.DstIP.String() + " contains " + string(checkIP))
-
-				if strings.Contains(ipv4.SrcIP.String(), strings.TrimSpace(checkIP)) {
-					log.Println("Database ip: " + string(checkIP) + " found in source")
-					appPort = tcp.DstPort.String()
-					appIp = ipv4.DstIP.String()
-					found_dbIp = ipv4.SrcIP.String()
-					found_dbPort = tcp.SrcPort.String()
-				} else if strings.Contains(ipv4.DstIP.String(), strings.TrimSpace(checkIP)) {
-					log.Println("Database ip: " + string(checkIP) + " found in destination")
-					appPort = tcp.SrcPort.String()
-					appIp = ipv4.SrcIP.String()
-					found_dbIp = ipv4.DstIP.String()
-					found_dbPort = tcp.DstPort.String()
-				}
-
-			}
-			log.Println("Defined app and db ports")
-			conversationId := found_dbIp + ":" + found_dbPort + "<->" + appIp + ":" + appPort //ID konwersjacji jest kluczem wiekszosci map
-			log.Println("Created conversation id", conversationId, tcp.Seq, tcp.Ack)
-
-			ipTnsBytes[found_dbIp] += uint64(len(app.Payload())) //zliczenie ilosci przetransferowanych pakietow TNS dla IP bazy
-			log.Println("TNS bytes sent over IP address: ", ipTnsBytes)
-
-			if strings.Contains(tcp.DstPort.String(), *dbPort) { //Pakiet typu request
-				//Sprawdzenie czy request zawiera tresc polecenia SQL z wyrazenia regularnego
-				// i nie jest jednoczesnie przeslaniem deskryptora polaczenia
-				if mi := rSQL.FindStringIndex(string(app.Payload())); mi != nil &&
-					!strings.Contains(string(app.Payload()), "DESCRIPTION") {
-
-					//W niektorych przypadkach dlugosc zapytania jest podawana w formie malego
-					//a w innych wielkiego indianina - jest flaga, ktora o tym mowi
-					sqlLen := 0
-					endianFlag := app.Payload()[mi[0]-5 : mi[0]-4]
-					log.Println("Endian flag is: ", endianFlag)
-					sqlLenB := app.Payload()[mi[0]-4 : mi[0]]
-					log.Println("SQL len is: ", sqlLenB)
-					log.Println(packet)
-
-					if endianFlag[0] == littleEndianFlag {
-						sqlLen = int(binary.LittleEndian.Uint32(sqlLenB))
-					} else if endianFlag[0] == bigEndianFlag {
-						sqlLen = int(binary.BigEndian.Uint32(sqlLenB))
-					} else if endianFlag[0] == oneByteSizeFlag {
-						sqlLen = int(sqlLenB[3])
-					}
-					//Ale czasem kartofelki i wuj wielki - wtedy trzeba okreslic dlugosc SQL bardziej manualnie.
-					//I to ssie - przydaloby sie znalezc na to lepsza regule
-					if sqlLen == uncertainSqlSize || sqlLen >= len(app.Payload()[mi[0]-4:]) {
-						log.Println("Can't determine sqlLen size")
-						sqlBufStart := app.Payload()[mi[0]:]
-						sqlTxtEnd := len(sqlBufStart) - 1
-						for i, v := range sqlBufStart {
-							if int(v) == 0 {
-								sqlTxtEnd = i
-								break
-							}
-						}
-						sqlTxt = string(sqlBufStart[0:sqlTxtEnd])
-					} else {
-						sqlTxt = string(app.Payload()[mi[0] : mi[0]+sqlLen])
-					}
-					sqlTxtFlow[conversationId] = sqlTxt //W tej konwersjacji ostatnio wykonanym zapytaniem jest powyzej znalezione
-
-					log.Println("SQLFlow for conversation ",
-						conversationId, sqlTxtFlow[conversationId], sqlid.Get(sqlTxt))
-
-					log.Println("Found SQL Text based on regular expression")
-					foundValidPacket = true
-
-				} else if len(app.Payload()) > 13 && (bytes.Equal(app.Payload()[3:5], usedCursorFlag) ||
-					bytes.Equal(app.Payload()[3:5], usedCursorFlagAfterError)) {
-					//Jesli w pakiecie request nie ma tresci zapytania, to znaczy ze uzywam otwartego kursora
-					log.Printf("Used: % 02x => %s, %d\n", app.Payload()[3:5], appPort, tcp.Seq)
-
-					//Na @13 jest 1B z ID slotu, na ktorym po stronie serwera jest zapamietany ten kursor
-					//klient prosi o wykonanie tego kursora ze slotu, wiec ja sobie sprytnie ten slot biere i zapmietuje
-					cursorSlot := strconv.Itoa(int(app.Payload()[13]))
-					//No i go pobieram. Zapamietanie jest na poziomie rozkminy pakietu response -
-					//bo wtedy ony serwer to zwraca
-					sqlTxt = SQLslot[conversationId+"_"+cursorSlot]
-
-					log.Println("Called SQL text from reused cursor: ",
-						sqlTxt, appPort, tcp.Seq, tcp.Ack, conversationId+"_"+cursorSlot)
-
-					reusedCursor = 1 //Oznaczam sobie, ze to taki sprytny otwarty kursorek
-					foundValidPacket = true
-				}
-			} else { //A tu juz zachodzi parsowanie pakietu response
-				responsePacket = true //mhm
-				if strings.Contains(string(app.Payload()), "ORA-01403") {
-					//Jesli pojawia sie, ze danych brak, to znaczy, ze ony pakiet ostatnim jest w pobraniu z serwera danych
-
-					sqlTxt = "SQL_END"
-					endOfDataI := bytes.Index(app.Payload(), endOfDataFlag) //Jest flaga, na koniec danych w pakiecie endOfDataFlag(0x7b05)
-					log.Println("End Of Data Byte is: ", endOfDataI)
-					cursorSlot := strconv.Itoa(int(app.Payload()[endOfDataI+6])) //I @+6 jest slocik, pod ktorym Pan Serwer kurson ony zapamietal
-					log.Println("Cursor Slot is: ", cursorSlot)
-
-					SQLslot[conversationId+"_"+cursorSlot] = sqlTxtFlow[conversationId] //To i ja dla tej konwersacyji tresc SQL pamietam
-					foundValidPacket = true
-
-				} else if len(app.Payload()) > 20 &&
-					!strings.Contains(string(app.Payload()), "AUTH") &&
-					app.Payload()[4] == tnsPacketData {
-					//Ale nie zawsze jest tak pieknie, ze reponse ma koniec danych, oj nie zawsze!
-					//Czasem to pakiet po DML a wtedy nic ino flagi retOpiParam albo retStatus
-					//Ale i tam numery slotow znalezn sposobna
-					if app.Payload()[10] == retOpiParam {
-						cursorSlot := strconv.Itoa(int(app.Payload()[21]))
-						log.Println("Cursor Slot in RetOpiParam is: ", cursorSlot, appPort, tcp.Seq)
-
-						SQLslot[conversationId+"_"+cursorSlot] = sqlTxtFlow[conversationId]
-						foundValidPacket = true
-
-					} else if app.Payload()[10] == retStatus {
-
-						cursorSlot := strconv.Itoa(int(app.Payload()[28]))
-						log.Println("Cursor Slot in RetStatus is: ", cursorSlot, appPort, tcp.Seq)
-
-						SQLslot[conversationId+"_"+cursorSlot] = sqlTxtFlow[conversationId]
-						foundValidPacket = true
-
-					}
-				}
-			}
-
-			if foundValidPacket {
-				if len(sqlTxt) == 0 {
-					sqlTxt = "_" //A to taki placeholderek dla pakietow posrednich - tam gdzie tresci nie lza
-				}
-				//O a tu, to sobie ogarniamy od kiedy, do kiedy ten PCAP trwal
-				if tBegin.IsZero() {
-					tBegin = packet.Metadata().Timestamp //No bo pierwsza date ustawiamy ino roz
-				}
-				tEnd = packet.Metadata().Timestamp //A te ostatnio to ciungle w gore i w gore
-
-				rtt := int64(0) //To ze Round Trip Time, ze zerem inicjowany a potem liczony
-				//Ale tylko jesli pakiet jest pakietem response, od ktorego ostatni timestamp trza odjac, hej!
-				if responsePacket && len(Conversations[conversationId]) >= 1 {
-					lastIdx := len(Conversations[conversationId]) - 1
-					//No to biere ostatni zarejestrowany timestamp pakietu tej konwersacji i se odejmuje
-					rtt = packet.Metadata().Timestamp.Sub(Conversations[conversationId][lastIdx].Timestamp).Nanoseconds()
-				}
-
-				Conversations[conversationId] = append(Conversations[conversationId], SQLtcp{SQL: sqlTxt,
-					SQL_id:       sqlid.Get(sqlTxt),
-					Conversation: conversationId,
-					Payload:      app.Payload(),
-					Seq:          tcp.Seq,
-					Ack:          tcp.Ack,
-					Timestamp:    packet.Metadata().Timestamp,
-					IsReused:     reusedCursor,
-					RTT:          rtt,
-				})
-				log.Println("Added packaet to conversation ID: "+
-					conversationId, sqlTxt, sqlid.Get(sqlTxt), len(sqlTxt), reusedCursor, rtt)
-				reusedCursor = 0
-			}
+	var progress *ProgressSource
+	if *progressEvery > 0 && !*daemon && !Quiet {
+		total := int64(0)
+		if *iface == "" {
+			total = CaptureSize(*pcapFile)
 		}
+		progress = NewProgressSource(handle, total, *progressEvery)
+		handle = progress
+	}
+	packetSource := gopacket.NewPacketSource(handle, PacketDecoder(handle.LinkType()))
+
+	partial := false
+	if *pprofAddr != "" {
+		StartPprof(*pprofAddr)
 	}
+	parseStart := time.Now()
 
-	for c := range Conversations {
-		log.Println(c)
-		//sort.Sort(SQLtcpSort(Conversations[c]))
-		var tB, tE, tPrev time.Time
-		var sqlDuration, packetDuration time.Duration
-		sqlTxt := "+"
-		sqlId := "+"
-		pcktCnt := uint(0)
-		RTT := int64(0)
-		reusedCursors := uint(0)
-
-		//Dla kazdej konwersjacji jade po wszystkich jej pakietach
-		for _, p := range Conversations[c] {
-			if tPrev.IsZero() { //Dla pierwszego pakietu timestamp zapamietuje
-				tPrev = p.Timestamp
-				packetDuration = p.Timestamp.Sub(tPrev) //Tu bedzie oczywiscie 0, ale milo to wyswietlic w logach
+	st := stats.New(analyzer.Parser)
+	if *daemon {
+		health := &DaemonHealth{}
+		if *healthAddr != "" {
+			StartHealthServer(*healthAddr, health)
+		}
+		onInterval := func() {
+			st.Count()
+			if *stream || Quiet {
+				stats.WriteJSON(st.Analyze(fullJSON), os.Stdout)
 			} else {
-				packetDuration = p.Timestamp.Sub(tPrev) //A tu sie caly czas od obecnego czasu ten pierwszy odejmuje
-			}
-			pcktCnt += 1 //Licze pakiety sobie, licze
-
-			//No jesli to nie jest bylejaki pakiet, to ma tresc zapytania, a wtedy to poczatek jest flow
-			//To mozna ustalic kiedy sie to zaczelo i jaka tresc zapytania przyjac i sqlid itp
-			if p.SQL != "_" && p.SQL != "SQL_END" {
-				tB = p.Timestamp
-				sqlTxt = p.SQL
-				sqlId = p.SQL_id
-				reusedCursors += p.IsReused
-			} else if sqlId != "+" { //count RTT minus first packet from first response => avoid counting DB Time from first SQL execution
-				RTT += p.RTT //RTT to ja dodaje, zeby czas sieciowy ogarnac.
-				//Bo pierwszy pakiet z poczatku flow pomijam calkiem - zeby nie liczyc czasu na DBTime poswieconego
-				//No i pominac trzeba wszelkie niezdefiniowane sqlid, bo to sa pakiety nieobslugiwane
+				report.Report(st.Analyze(true), *chartsDir)
 			}
-			shortSQL := string(sqlTxt[0])
-			if len(sqlTxt) > 5 {
-				shortSQL = string(sqlTxt[0:5])
-			}
-			log.Println(sqlId, p.Seq, p.Ack, p.RTT, RTT, p.Timestamp, shortSQL, "...")
-
-			//A to wszystko znaczy, ze to koniec FLOW
-			//Bo dla SELECT to bedzie oczywiscie SQL_END jako flaga, a dla DML to juz po prostu kolejny pakiet
-			//Wiec dla ustalonego SQLID, jesli mamy znacznik konca, lub tresc zapytania jest ustalona we flow
-			//i jest to kolejny pakiet po prostu, ale tresc zapytania to nie SELECT lub WITH
-			//bo w tych flow jest dlugi i musze miec znacznik konca (SQL_END) to wtedy ogarniaj statystyki
-			if sqlId != "+" && (p.SQL == "SQL_END" || (len(sqlTxt) > 1 && p.SQL == "_" && strings.ToUpper(sqlTxt)[0] != 'S' && strings.ToUpper(sqlTxt)[0] != 'W')) {
-				tE = p.Timestamp
-				//sqlDuration = tE.Sub(tB)
-				sqlDuration = packetDuration //Valid SQL duration from app perspective (wallclock)
-				log.Println("\tsummary: ", sqlDuration.Nanoseconds(), tE.Sub(tB).Nanoseconds(), tB, tE, RTT, sqlId)
-
-				//Jesli mapa statystyk nie jest zainicjowana dla tego sqlid to trzeba ja zainicjowac najpierw
-				//no zerami oczywiscie na start
-				if _, ok := SQLIdStats[sqlId]; !ok {
-					SQLIdStats[sqlId] = &SQLstats{SQLtxt: "",
-						Elapsed_ms_sum: 0, Executions: 0, Packets: 0,
-						Sessions: make(map[string]uint), ReusedCursors: 0,
-						Elapsed_ms_app: 0}
-				}
-
-				//Bo tu dopiero uzupelniam statsy, jesli RTT policzone zostalo - znaczy jesli zliczanie przebieglo dobrze
-				if RTT >= 0 { // Checking if RTT is calculated properly
-					SQLIdStats[sqlId].Fill(sqlTxt, RTT, c, pcktCnt, reusedCursors, sqlDuration.Nanoseconds())
-				} else {
-					//Jesli nie, to glosno o tym krzycze
-					log.Println("Something went wrong with counting, casuse rtt is mniej niz zero!", RTT, sqlTxt, c, sqlId)
-				}
-				//No i na koniec takiego podliczenia statsow to to wszystko sobie ladnie zeruje.
-				//To dzialac ma prawo tylko, jesli pakiety sa w dobrej kolejnosci,
-				//jesli natomiast by SEQ i ACK kompletnie sie nie zgadzaly w kolejnosci to dupa
-				sqlTxt = "+"
-				sqlId = "+"
-				pcktCnt = 0
-				RTT = 0
-				tPrev = time.Time{}
-				tB = time.Time{}
-				tE = time.Time{}
-				reusedCursors = 0
+		}
+		RunDaemon(analyzer, packetSource, health, *systemd, *interval, onInterval)
+	} else {
+		//Po Ctrl-C raportujemy to co juz sparsowane zamiast tracic godzine parsowania
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+		go func() {
+			sig := <-sigs
+			signal.Stop(sigs) //Drugi Ctrl-C zabija proces od razu
+			if !Quiet {
+				fmt.Fprintln(os.Stderr, "Received", sig, "- stopping analysis and reporting packets parsed so far")
 			}
+			analyzer.Stop()
+		}()
+		partial = !analyzer.Run(packetSource)
+		signal.Stop(sigs)
+	}
+	parsing := time.Since(parseStart)
+	if progress != nil {
+		progress.Finish(!partial)
+	}
+	if sampler != nil {
+		if err := sampler.Close(); err != nil {
+			fmt.Println(err)
 		}
 	}
-	log.Println("Starting to disaplay SQLstats - len: ", len(SQLIdStats))
-	fmt.Println("SQL ID\t\tEla App (ms)\tEla Net(ms)\tExec\tEla Stddev App\tEla App/Exec\tEla Stddev Net\tEla Net/Exec\tP\tS\tRC")
-	fmt.Println("--------------------------------------------------------------------------------------------------------------------------------------------------\n")
-	var graphVal []chart.Value
-	var sumApp, sumNet float64
-	for sqlid := range SQLIdStats {
-		fmt.Printf("%s\t%f\t%f\t%d\t%f\t%f\t%f\t%f\t%d\t%d\t%d\n", sqlid,
-			SQLIdStats[sqlid].Elapsed_ms_app,
-			SQLIdStats[sqlid].Elapsed_ms_sum,
-			SQLIdStats[sqlid].Executions,
-			StdDev(SQLIdStats[sqlid].Ela_ms_app_all),
-			SQLIdStats[sqlid].Elapsed_ms_app/float64(SQLIdStats[sqlid].Executions),
-			StdDev(SQLIdStats[sqlid].Elapsed_ms_all),
-			SQLIdStats[sqlid].Elapsed_ms_sum/float64(SQLIdStats[sqlid].Executions),
-			SQLIdStats[sqlid].Packets,
-			len(SQLIdStats[sqlid].Sessions),
-			SQLIdStats[sqlid].ReusedCursors)
-
-		sumApp += SQLIdStats[sqlid].Elapsed_ms_app
-		sumNet += SQLIdStats[sqlid].Elapsed_ms_sum
-
-		graphVal = append(graphVal, chart.Value{Value: SQLIdStats[sqlid].Elapsed_ms_sum /
-			float64(SQLIdStats[sqlid].Executions), Label: sqlid})
-
-		var execs []float64
-		for exec := 0; exec < int(SQLIdStats[sqlid].Executions); exec++ {
-			execs = append(execs, float64(exec))
+
+	var csvExp *CSVExporter
+	if *csvFile != "" {
+		if csvExp, err = NewCSVExporter(*csvFile); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
 		}
-		SQLgraph := chart.Chart{
-			Title: sqlid + " elapsed time per execution (ms)",
-			Background: chart.Style{
-				Padding: chart.Box{
-					Top:    40,
-					Bottom: 10,
-				},
-			},
-			Series: []chart.Series{
-				chart.ContinuousSeries{
-					Style: chart.Style{
-						StrokeColor: drawing.ColorRed,               // will supercede defaults
-						FillColor:   drawing.ColorRed.WithAlpha(64), // will supercede defaults
-					},
-					XValues: execs,
-					YValues: SQLIdStats[sqlid].Elapsed_ms_all,
-				},
-			},
+		st.ExecutionHooks = append(st.ExecutionHooks, csvExp.Write)
+	}
+	var sqliteExp *SQLiteExporter
+	if sqliteFile != "" {
+		source := *pcapFile
+		if source == "" {
+			source = *iface
 		}
-
-		f, err := os.Create(*chartsDir + "/" + sqlid + ".png")
-		if err != nil {
-			log.Println(err)
+		if sqliteExp, err = NewSQLiteExporter(sqliteFile, source); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
 		}
-		SQLgraph.Render(chart.PNG, f)
-		f.Close()
+		st.ExecutionHooks = append(st.ExecutionHooks, sqliteExp.Write)
 	}
-
-	fmt.Println("\nSum App Time(s):", sumApp/1000)
-	fmt.Println("Sum Net Time(s):", sumNet/1000, "\n")
-
-	for ip := range ipTnsBytes {
-		fmt.Println(ip, ipTnsBytes[ip]/1024, "kb")
+	var dumper *stats.PacketDumper
+	if *dumpFile != "" {
+		if dumper, err = stats.NewPacketDumper(*dumpFile, analyzer.Parser); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		st.ExecutionHooks = append(st.ExecutionHooks, dumper.Write)
 	}
 
-	fmt.Println("\n\n\tTime frame: ", tBegin, " <=> ", tEnd)
-	fmt.Println("\tTime frame duration (s): ", tEnd.Sub(tBegin).Seconds(), "\n")
-
-	graph := chart.BarChart{
-		Title: "SQLid Elapsed Time Summary (ms)",
-		Background: chart.Style{
-			Padding: chart.Box{
-				Top:    100,
-				Bottom: 70,
-			},
-		},
-		Height:   1024,
-		Width:    2000,
-		BarWidth: 7,
-		XAxis:    chart.Style{TextRotationDegrees: 90.0},
-		Bars:     graphVal, //[]chart.Value of Value: Label:
+	st.Count()
+	analysis := st.Analyze(!(*stream || Quiet) || *saveFile != "" || fullJSON)
+	if csvExp != nil {
+		if err := csvExp.Close(); err != nil {
+			fmt.Println(err)
+		}
 	}
-
-	f, err := os.Create(*chartsDir + "/" + "_sql_ela_exec.png")
-	if err != nil {
-		log.Println(err)
+	if dumper != nil {
+		if err := dumper.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	analysis.Partial = partial
+	if *saveFile != "" {
+		if err := stats.SaveAnalysis(analysis, *saveFile); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if sqliteExp != nil {
+		if err := sqliteExp.Finish(st, analysis); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if !Quiet {
+			fmt.Println("Results written to", sqliteFile)
+		}
+	} else if *stream || Quiet {
+		stats.WriteJSON(analysis, os.Stdout)
+	} else {
+		report.Report(analysis, *chartsDir)
+	}
+	if !Quiet {
+		//Na stderr, zeby nie psuc JSONa w trybie -stream
+		MeasureSelf(parser.Packets, start, parsing).Print(os.Stderr)
 	}
-	graph.Render(chart.PNG, f)
-	f.Close()
-
 }
@@ -0,0 +1,432 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// FormatVersion is the version of Analysis format written by this stado
+const FormatVersion = 1
+
+// SQLstatsJSON is a single sqlid row of Analysis
+type SQLstatsJSON struct {
+	SQLid         string             `json:"sql_id"`
+	SQLtxt        string             `json:"sql_text"`
+	Signature     string             `json:"force_matching_signature"` //sqlid of text with literals replaced by binds
+	Variants      int                `json:"sql_ids"`                  //Number of sqlids aggregated in the row, more than one with -by-signature
+	ElaAppMs      float64            `json:"ela_app_ms"`
+	ElaNetMs      float64            `json:"ela_net_ms"`
+	Executions    uint               `json:"executions"`
+	StddevAppMs   float64            `json:"stddev_app_ms"`
+	AppPerExecMs  float64            `json:"app_per_exec_ms"`
+	StddevNetMs   float64            `json:"stddev_net_ms"`
+	NetPerExecMs  float64            `json:"net_per_exec_ms"`
+	Packets       uint               `json:"packets"`
+	Sessions      int                `json:"sessions"`
+	ReusedCursors uint               `json:"reused_cursors"`
+	AppP50Ms      float64            `json:"app_p50_ms"`
+	AppP90Ms      float64            `json:"app_p90_ms"`
+	AppP95Ms      float64            `json:"app_p95_ms"`
+	AppP99Ms      float64            `json:"app_p99_ms"`
+	NetP50Ms      float64            `json:"net_p50_ms"`
+	NetP90Ms      float64            `json:"net_p90_ms"`
+	NetP95Ms      float64            `json:"net_p95_ms"`
+	NetP99Ms      float64            `json:"net_p99_ms"`
+	AppTrimmedMs  float64            `json:"app_trimmed_mean_ms"`
+	AppMedianMs   float64            `json:"app_median_ms"`
+	AppMADMs      float64            `json:"app_mad_ms"`
+	NetTrimmedMs  float64            `json:"net_trimmed_mean_ms"`
+	NetMedianMs   float64            `json:"net_median_ms"`
+	NetMADMs      float64            `json:"net_mad_ms"`
+	Impact        float64            `json:"impact"`
+	TimeModelMs   map[string]float64 `json:"time_model_ms"`
+	FirstSeen     time.Time          `json:"first_seen"`
+	LastSeen      time.Time          `json:"last_seen"`
+	Slowest       []SlowExecution    `json:"slowest,omitempty"`
+	Rows          uint64             `json:"rows_processed"` //Rows affected by DML or fetched by queries
+	RoundTrips    uint64             `json:"round_trips"`
+	RowsPerExec   float64            `json:"rows_per_exec"`
+	RowsPerRT     float64            `json:"rows_per_round_trip"` //Low for queries means a small fetch size
+	Gaps          *GapsJSON          `json:"reexecution_gaps,omitempty"`
+	Polling       *PollingJSON       `json:"polling,omitempty"`
+	PlanChange    *PlanChangeJSON    `json:"plan_change,omitempty"`
+	Clients       []ClientGroupJSON  `json:"clients"`                    //Executions from each client IP
+	MaxSessions   int                `json:"max_concurrency"`            //Most sessions executing sqlid at the same time
+	AvgSessions   float64            `json:"avg_concurrency"`            //Average sessions executing it while it was executed at all
+	FirstPerExec  float64            `json:"first_response_per_exec_ms"` //Initial server latency
+	StreamPerExec float64            `json:"streaming_per_exec_ms"`      //Fetch round trips after the first response
+	Failed        uint64             `json:"failed_executions"`          //Executions which returned an ORA- error
+	Metrics       map[string]float64 `json:"metrics,omitempty"`          //Sums of custom metrics (-metrics)
+	Errors        map[string]uint64  `json:"errors,omitempty"`           //Failed executions by ORA- error
+	Apdex         *Apdex             `json:"apdex,omitempty"`            //Apdex of executions (-apdex)
+	Samples       *SamplesJSON       `json:"samples,omitempty"`
+	Intervals     []IntervalJSON     `json:"intervals,omitempty"`   //Summaries of executions per IntervalResolution, kept with samples
+	SessionIds    []string           `json:"session_ids,omitempty"` //Conversations executing sqlid, kept with samples
+}
+
+// GapsJSON is distribution of time between consecutive executions of sqlid within a session
+type GapsJSON struct {
+	Count   uint    `json:"count"`
+	MinMs   float64 `json:"min_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P90Ms   float64 `json:"p90_ms"`
+	MaxMs   float64 `json:"max_ms"`
+	CV      float64 `json:"cv"`      //Stddev / mean, close to 0 for polling loops
+	Pattern string  `json:"pattern"` //periodic or irregular
+}
+
+// SamplesJSON are per-execution samples of a sqlid kept for charts
+type SamplesJSON struct {
+	ExecNo []float64 `json:"exec_no"`
+	NetMs  []float64 `json:"net_ms"`
+	AppMs  []float64 `json:"app_ms"`
+	Errors []string  `json:"errors,omitempty"` //ORA- error of each execution, empty if it succeeded
+}
+
+// Center returns per-execution elapsed time statistic selected with -center
+func (r *SQLstatsJSON) Center(app bool) float64 {
+	switch Center {
+	case "trimmed":
+		return pick(app, r.AppTrimmedMs, r.NetTrimmedMs)
+	case "median":
+		return pick(app, r.AppMedianMs, r.NetMedianMs)
+	}
+	return pick(app, r.AppPerExecMs, r.NetPerExecMs)
+}
+
+// Dispersion returns elapsed time dispersion selected with -dispersion
+func (r *SQLstatsJSON) Dispersion(app bool) float64 {
+	if Dispersion == "mad" {
+		return pick(app, r.AppMADMs, r.NetMADMs)
+	}
+	return pick(app, r.StddevAppMs, r.StddevNetMs)
+}
+
+func pick(app bool, appValue, netValue float64) float64 {
+	if app {
+		return appValue
+	}
+	return netValue
+}
+
+// ClientGroupJSON is a client subnet or label row of Analysis
+type ClientGroupJSON struct {
+	Name         string  `json:"name"`
+	Clients      int     `json:"clients"`
+	Sessions     int     `json:"sessions"`
+	Executions   uint    `json:"executions"`
+	ElaAppMs     float64 `json:"ela_app_ms"`
+	ElaNetMs     float64 `json:"ela_net_ms"`
+	AppPerExecMs float64 `json:"app_per_exec_ms"`
+	AppP95Ms     float64 `json:"app_p95_ms"`
+	Bytes        uint64  `json:"bytes"`
+}
+
+// Analysis is the result of the analysis phase. Text report, charts, JSON output and saved analyses
+// are all produced from it, so a new output format doesn't need to touch the parser nor the statistics.
+// Field names are stable, incompatible changes bump FormatVersion
+type Analysis struct {
+	FormatVersion int                    `json:"format_version"`
+	Partial       bool                   `json:"partial,omitempty"` //Analysis was interrupted, only packets till TimeEnd were parsed
+	DBPort        string                 `json:"db_port"`
+	TimeBegin     time.Time              `json:"time_begin"`
+	TimeEnd       time.Time              `json:"time_end"`
+	DurationS     float64                `json:"duration_s"`
+	SumAppS       float64                `json:"sum_app_s"`
+	SumNetS       float64                `json:"sum_net_s"`
+	TimeModel     map[string]float64     `json:"time_model_ms"` //App time of all executions split into wait classes
+	TnsBytes      map[string]uint64      `json:"tns_bytes"`
+	DBNames       map[string]string      `json:"db_names"` //tnsnames label of each database IP
+	Hosts         map[string]string      `json:"hosts"`    //Resolved names of database and client IPs
+	SQLs          []SQLstatsJSON         `json:"sqls"`
+	Subnets       []ClientGroupJSON      `json:"subnets"`
+	Labels        []ClientGroupJSON      `json:"client_labels"`
+	Tags          []ClientGroupJSON      `json:"sql_tags"`   //Executions per application tag from SQL comments (-tags)
+	Frameworks    []FrameworkJSON        `json:"frameworks"` //Workload per framework which generated the SQL (Hibernate, jOOQ, EF, PL/SQL)
+	Churn         *ChurnStats            `json:"connections"`
+	Logons        *LogonStats            `json:"logon_latency"`
+	Connects      *ConnectStats          `json:"connect_phase"`
+	Durations     *SessionDurationStats  `json:"session_durations"`
+	Compression   *CompressionStats      `json:"compression,omitempty"`
+	Encryption    *EncryptionStats       `json:"encryption,omitempty"` //Sessions encrypted with Native Network Encryption
+	Idle          []IdleClient           `json:"idle_clients"`
+	IdleKills     []IdleKill             `json:"idle_kills"`
+	MTU           []MTUFinding           `json:"mtu_findings"`
+	Dups          uint64                 `json:"duplicate_frames"`
+	Mirrors       *MirrorStats           `json:"mirrors,omitempty"`        //Sessions captured on both legs (-mirror)
+	OutsideWindow uint64                 `json:"outside_window,omitempty"` //Packets skipped by -from/-to
+	EvictedDrops  *tnsparse.EvictedDrops `json:"evicted_drops,omitempty"`  //Evicted conversations dropped above -max-evicted
+	OraErrors     []OraErrorJSON         `json:"ora_errors"`               //ORA- errors returned to executions, the most frequent first
+	ErrorSessions []SessionErrorsJSON    `json:"error_sessions"`           //Conversations with failed executions, the most failing first
+	Programs      []ProgramJSON          `json:"programs"`                 //Sessions per PROGRAM of TNS CONNECT, also those skipped by -program/-exclude-program
+	Apdex         *Apdex                 `json:"apdex,omitempty"`          //Apdex of all executions (-apdex)
+	SLA           *SLABurn               `json:"sla,omitempty"`            //Executions breaching -sla per interval
+	LoadProfile   *LoadProfileJSON       `json:"load_profile,omitempty"`   //Executions, app/net time and bytes per -load-profile interval
+	Timing        TimingStats            `json:"timing_issues"`            //Executions affected by capture timestamp problems
+	Databases     []DatabaseJSON         `json:"databases,omitempty"`      //Per database breakdown if more than one -i was given
+	Findings      []Finding              `json:"findings"`                 //Rules crossed, the most severe first
+	Summary       *Summary               `json:"summary"`                  //Executive summary: capture span, totals, top offenders and findings
+}
+
+// DatabaseJSON is a per database summary of Analysis
+type DatabaseJSON struct {
+	ClientGroupJSON
+	SQLs []SQLstatsJSON `json:"sqls"`
+}
+
+// Analyze builds Analysis from current statistics, per-execution samples (needed only for charts) are
+// included if withSamples is set
+func (s *Stats) Analyze(withSamples bool) *Analysis {
+	t := s.Parser
+	r := &Analysis{
+		FormatVersion: FormatVersion,
+		DBPort:        t.DBPort,
+		TimeBegin:     t.TBegin,
+		TimeEnd:       t.TEnd,
+		DurationS:     t.TEnd.Sub(t.TBegin).Seconds(),
+		TnsBytes:      t.IPTnsBytes,
+		DBNames:       make(map[string]string),
+		Hosts:         make(map[string]string),
+		SQLs:          sqlStatsJSON(s.SQLIdStats, withSamples),
+		Subnets:       clientGroupsJSON(s.ClientSubnets),
+		Labels:        clientGroupsJSON(s.ClientLabels),
+		Tags:          clientGroupsJSON(s.SQLTags),
+		Frameworks:    s.Frameworks(),
+		TimeModel:     s.TimeModel.Map(),
+		Churn:         s.Churn(),
+		Logons:        s.Logons(),
+		Connects:      s.Connects(),
+		Durations:     s.SessionDurations(),
+		Compression:   s.Compression(),
+		Idle:          s.IdleClients(),
+		IdleKills:     s.IdleKills(),
+		MTU:           s.MTUFindings(),
+		OraErrors:     s.OraErrors(),
+		ErrorSessions: s.SessionErrors(),
+		Programs:      s.Programs(),
+		Mirrors:       s.MirrorsJSON(),
+		EvictedDrops:  t.EvictedDroppedJSON(),
+		Apdex:         s.ApdexTotal.copy(),
+		SLA:           s.SLABurnOf(),
+		Timing:        s.Timing,
+	}
+	if t.Dedup != nil {
+		r.Dups = t.Dedup.Duplicates
+	}
+	if t.Window != nil {
+		r.OutsideWindow = t.Window.Outside
+	}
+	for _, st := range s.SQLIdStats {
+		r.SumAppS += st.Elapsed_ms_app / 1000
+		r.SumNetS += st.Elapsed_ms_sum / 1000
+	}
+	if MultiDB {
+		for _, db := range clientGroupsJSON(s.DBSummary) {
+			r.Databases = append(r.Databases, DatabaseJSON{ClientGroupJSON: db, SQLs: sqlStatsJSON(s.DBSQLStats[db.Name], false)})
+		}
+	}
+	for ip := range t.IPTnsBytes {
+		r.DBNames[ip] = tnsparse.DBLabel(ip, t.DBPort)
+		if name := tnsparse.HostName(ip); name != "" {
+			r.Hosts[ip] = name
+		}
+	}
+	for c := range t.Conversations {
+		if name := tnsparse.HostName(tnsparse.ClientIP(c)); name != "" {
+			r.Hosts[tnsparse.ClientIP(c)] = name
+		}
+	}
+	//Krotkie sesje i resety dotycza tez konwersacji juz wyrzuconych przez -evict
+	for c := range t.Connections {
+		if _, ok := r.Hosts[tnsparse.ClientIP(c)]; !ok {
+			if name := tnsparse.HostName(tnsparse.ClientIP(c)); name != "" {
+				r.Hosts[tnsparse.ClientIP(c)] = name
+			}
+		}
+	}
+	r.Encryption = s.Encryption(len(r.SQLs))
+	r.LoadProfile = s.LoadProfile(r.SQLs)
+	r.Findings = EvaluateRules(r)
+	r.Summary = Summarize(r)
+	return r
+}
+
+// WriteJSON writes analysis as a single line, so consecutive reports can be read as JSON lines
+func WriteJSON(a *Analysis, w io.Writer) {
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		log.Println("Can't write JSON report:", err)
+	}
+}
+
+// SaveAnalysis writes analysis into file, to be reported later with "stado report"
+func SaveAnalysis(a *Analysis, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(a); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadAnalysis reads analysis saved with -save
+func LoadAnalysis(file string) (*Analysis, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &Analysis{}
+	if err := json.NewDecoder(f).Decode(a); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if a.FormatVersion < 1 || a.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%s: unsupported analysis format version %d, this stado reads up to %d", file, a.FormatVersion, FormatVersion)
+	}
+	return a, nil
+}
+
+// HostLabel returns "name(ip)" if ip was resolved during analysis
+func (a *Analysis) HostLabel(ip string) string {
+	if name := a.Hosts[ip]; name != "" {
+		return name + "(" + ip + ")"
+	}
+	return ip
+}
+
+// ConversationLabel returns conversation id "dbip:dbport<->appip:appport" with HostLabel of both addresses
+func (a *Analysis) ConversationLabel(conversationId string) string {
+	ends := strings.SplitN(conversationId, "<->", 2)
+	for i, end := range ends {
+		if j := strings.LastIndex(end, ":"); j > 0 {
+			ends[i] = a.HostLabel(end[:j]) + end[j:]
+		}
+	}
+	return strings.Join(ends, "<->")
+}
+
+// SubnetLabel returns HostLabel of subnet of a single host (i.e. -subnet-bits 32), other subnets as they are
+func (a *Analysis) SubnetLabel(subnet string) string {
+	ip, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return subnet
+	}
+	if ones, bits := ipNet.Mask.Size(); ones != bits {
+		return subnet
+	}
+	return a.HostLabel(ip.String())
+}
+
+func sqlStatsJSON(stats map[string]*SQLstats, withSamples bool) []SQLstatsJSON {
+	rows := []SQLstatsJSON{}
+	for sqlid, s := range stats {
+		rows = append(rows, SQLstatsJSON{
+			SQLid:         sqlid,
+			SQLtxt:        s.SQLtxt,
+			Signature:     Normalized(s.SQLtxt).Signature,
+			Variants:      len(s.variants),
+			ElaAppMs:      s.Elapsed_ms_app,
+			ElaNetMs:      s.Elapsed_ms_sum,
+			Executions:    s.Executions,
+			StddevAppMs:   s.App.StdDev(),
+			AppPerExecMs:  s.App.Mean,
+			StddevNetMs:   s.Net.StdDev(),
+			NetPerExecMs:  s.Net.Mean,
+			Packets:       s.Packets,
+			Sessions:      len(s.Sessions),
+			ReusedCursors: s.ReusedCursors,
+			AppP50Ms:      s.AppDigest.Quantile(0.5),
+			AppP90Ms:      s.AppDigest.Quantile(0.9),
+			AppP95Ms:      s.AppDigest.Quantile(0.95),
+			AppP99Ms:      s.AppDigest.Quantile(0.99),
+			NetP50Ms:      s.NetDigest.Quantile(0.5),
+			NetP90Ms:      s.NetDigest.Quantile(0.9),
+			NetP95Ms:      s.NetDigest.Quantile(0.95),
+			NetP99Ms:      s.NetDigest.Quantile(0.99),
+			AppTrimmedMs:  TrimmedMean(s.Ela_ms_app_all, TrimFraction),
+			AppMedianMs:   Median(s.Ela_ms_app_all),
+			AppMADMs:      MAD(s.Ela_ms_app_all),
+			NetTrimmedMs:  TrimmedMean(s.Elapsed_ms_all, TrimFraction),
+			NetMedianMs:   Median(s.Elapsed_ms_all),
+			NetMADMs:      MAD(s.Elapsed_ms_all),
+			Impact:        s.Impact(),
+			TimeModelMs:   s.Waits.Map(),
+			FirstSeen:     s.FirstSeen,
+			LastSeen:      s.LastSeen,
+			Slowest:       s.Slowest,
+			Rows:          s.Rows,
+			RoundTrips:    s.RoundTrips,
+			RowsPerExec:   float64(s.Rows) / float64(s.Executions),
+			RowsPerRT:     Ratio(float64(s.Rows), float64(s.RoundTrips)),
+			Polling:       s.Polling(),
+			PlanChange:    s.PlanChange(),
+			Clients:       clientGroupsJSON(s.clients),
+			FirstPerExec:  s.First_ms_sum / float64(s.Executions),
+			StreamPerExec: s.Stream_ms_sum / float64(s.Executions),
+			Failed:        s.failed(),
+			Errors:        s.oraErrors,
+			Metrics:       s.metricsJSON(),
+			Apdex:         s.apdex.copy(),
+		})
+		rows[len(rows)-1].MaxSessions, rows[len(rows)-1].AvgSessions = s.Concurrency()
+		if s.Gap.N > 0 {
+			rows[len(rows)-1].Gaps = &GapsJSON{
+				Count:   s.Gap.N,
+				MinMs:   s.GapDigest.Quantile(0),
+				P50Ms:   s.GapDigest.Quantile(0.5),
+				P90Ms:   s.GapDigest.Quantile(0.9),
+				MaxMs:   s.GapDigest.Quantile(1),
+				Pattern: s.GapPattern(),
+			}
+			if s.Gap.Mean > 0 {
+				rows[len(rows)-1].Gaps.CV = s.Gap.StdDev() / s.Gap.Mean
+			}
+		}
+		if withSamples {
+			execs, net, app, errs := s.Samples()
+			rows[len(rows)-1].Samples = &SamplesJSON{ExecNo: execs, NetMs: net, AppMs: app, Errors: errs}
+			rows[len(rows)-1].Intervals = s.Intervals()
+			for session := range s.Sessions {
+				rows[len(rows)-1].SessionIds = append(rows[len(rows)-1].SessionIds, session)
+			}
+			sort.Strings(rows[len(rows)-1].SessionIds)
+		}
+	}
+	SortSQLRows(rows)
+	return rows
+}
+
+func clientGroupsJSON(groups map[string]*ClientGroupStats) []ClientGroupJSON {
+	rows := []ClientGroupJSON{}
+	for name, st := range groups {
+		rows = append(rows, ClientGroupJSON{
+			Name:         name,
+			Clients:      len(st.Clients),
+			Sessions:     len(st.Sessions),
+			Executions:   st.Executions,
+			ElaAppMs:     st.Elapsed_ms_app,
+			ElaNetMs:     st.Elapsed_ms_sum,
+			AppPerExecMs: st.Elapsed_ms_app / float64(st.Executions),
+			AppP95Ms:     st.AppDigest.Quantile(0.95),
+			Bytes:        st.Bytes,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].ElaAppMs != rows[j].ElaAppMs {
+			return rows[i].ElaAppMs > rows[j].ElaAppMs
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// ApdexThreshold is target app time T of Apdex scores (-apdex), 0 disables them. Executions taking at most T
+// are satisfied, at most 4T tolerating, slower or failed ones frustrated
+var ApdexThreshold time.Duration
+
+// Apdex is application performance index: (satisfied + tolerating/2) / executions, from 0 (all frustrated) to 1
+type Apdex struct {
+	ThresholdMs float64 `json:"threshold_ms"`
+	Score       float64 `json:"score"`
+	Satisfied   uint64  `json:"satisfied"`
+	Tolerating  uint64  `json:"tolerating"`
+	Frustrated  uint64  `json:"frustrated"`
+}
+
+// NewApdex returns empty Apdex for ApdexThreshold, nil if scoring is disabled
+func NewApdex() *Apdex {
+	if ApdexThreshold <= 0 {
+		return nil
+	}
+	return &Apdex{ThresholdMs: float64(ApdexThreshold.Nanoseconds()) / 1000000}
+}
+
+// add scores execution and updates Score
+func (a *Apdex) add(e *tnsparse.Execution) {
+	if a == nil {
+		return
+	}
+	t := ApdexThreshold.Nanoseconds()
+	switch {
+	case e.Error != "" || e.AppNs > 4*t:
+		a.Frustrated++
+	case e.AppNs > t:
+		a.Tolerating++
+	default:
+		a.Satisfied++
+	}
+	a.Score = (float64(a.Satisfied) + float64(a.Tolerating)/2) / float64(a.Satisfied+a.Tolerating+a.Frustrated)
+}
+
+// copy returns a copy for JSON, so rows don't share counters with SQLstats
+func (a *Apdex) copy() *Apdex {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	return &c
+}
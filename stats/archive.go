@@ -0,0 +1,153 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// IntervalResolution is length of per-interval summaries of each sqlid kept with samples (-resolution)
+var IntervalResolution = 5 * time.Minute
+
+// IntervalJSON summarizes executions of a sqlid started within one interval. Sums and maximum, unlike
+// averages and percentiles, can be merged into coarser intervals without per-execution data
+type IntervalJSON struct {
+	Start      time.Time `json:"start"`
+	Executions uint      `json:"executions"`
+	AppMs      float64   `json:"ela_app_ms"`
+	NetMs      float64   `json:"ela_net_ms"`
+	MaxAppMs   float64   `json:"max_app_ms"`
+	Errors     uint      `json:"errors"`
+	Bytes      uint64    `json:"bytes"`
+}
+
+func (iv *IntervalJSON) merge(o IntervalJSON) {
+	iv.Executions += o.Executions
+	iv.AppMs += o.AppMs
+	iv.NetMs += o.NetMs
+	iv.Errors += o.Errors
+	iv.Bytes += o.Bytes
+	if o.MaxAppMs > iv.MaxAppMs {
+		iv.MaxAppMs = o.MaxAppMs
+	}
+}
+
+// addBucket adds execution to summary of interval it started in
+func (s *SQLstats) addBucket(e *tnsparse.Execution) {
+	if IntervalResolution <= 0 {
+		return
+	}
+	start := e.Start.Truncate(IntervalResolution)
+	b, ok := s.buckets[start.UnixNano()]
+	if !ok {
+		b = &IntervalJSON{Start: start}
+		s.buckets[start.UnixNano()] = b
+	}
+	app := float64(e.AppNs) / 1000000
+	b.merge(IntervalJSON{Executions: 1, AppMs: app, NetMs: float64(e.NetNs) / 1000000, MaxAppMs: app, Bytes: e.Bytes})
+	if e.Error != "" {
+		b.Errors++
+	}
+}
+
+// Intervals returns per-interval summaries ordered by time
+func (s *SQLstats) Intervals() []IntervalJSON {
+	var rows []IntervalJSON
+	for _, b := range s.buckets {
+		rows = append(rows, *b)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Start.Before(rows[j].Start) })
+	return rows
+}
+
+// downsample merges intervals into intervals of resolution
+func downsample(intervals []IntervalJSON, resolution time.Duration) []IntervalJSON {
+	byStart := make(map[int64]*IntervalJSON)
+	for _, iv := range intervals {
+		start := iv.Start.Truncate(resolution)
+		b, ok := byStart[start.UnixNano()]
+		if !ok {
+			b = &IntervalJSON{Start: start}
+			byStart[start.UnixNano()] = b
+		}
+		b.merge(iv)
+	}
+	rows := make([]IntervalJSON, 0, len(byStart))
+	for _, b := range byStart {
+		rows = append(rows, *b)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Start.Before(rows[j].Start) })
+	return rows
+}
+
+// ArchiveFormatVersion is the version of Archive format written by this stado
+const ArchiveFormatVersion = 1
+
+// Archive is long term history of many captures: per-interval summaries of each sqlid without samples
+type Archive struct {
+	FormatVersion int              `json:"format_version"`
+	ResolutionS   float64          `json:"resolution_s"`
+	Captures      []ArchiveCapture `json:"captures"`
+	SQLs          []ArchiveSQL     `json:"sqls"`
+}
+
+// ArchiveCapture is an analysis merged into archive
+type ArchiveCapture struct {
+	File      string    `json:"file"`
+	TimeBegin time.Time `json:"time_begin"`
+	TimeEnd   time.Time `json:"time_end"`
+}
+
+// ArchiveSQL is history of a sqlid in archive
+type ArchiveSQL struct {
+	SQLid     string         `json:"sql_id"`
+	SQLtxt    string         `json:"sql_text"`
+	Intervals []IntervalJSON `json:"intervals"`
+}
+
+// Merge adds analysis to archive. Analyses saved by older stado have no intervals, their totals
+// make a single interval at the beginning of the capture
+func (ar *Archive) Merge(a *Analysis, file string) {
+	resolution := time.Duration(ar.ResolutionS * float64(time.Second))
+	ar.Captures = append(ar.Captures, ArchiveCapture{File: file, TimeBegin: a.TimeBegin, TimeEnd: a.TimeEnd})
+	bySQL := make(map[string]int)
+	for i, s := range ar.SQLs {
+		bySQL[s.SQLid] = i
+	}
+	for _, r := range a.SQLs {
+		i, ok := bySQL[r.SQLid]
+		if !ok {
+			ar.SQLs = append(ar.SQLs, ArchiveSQL{SQLid: r.SQLid, SQLtxt: r.SQLtxt})
+			i = len(ar.SQLs) - 1
+			bySQL[r.SQLid] = i
+		}
+		intervals := r.Intervals
+		if len(intervals) == 0 {
+			intervals = []IntervalJSON{{Start: a.TimeBegin, Executions: r.Executions, AppMs: r.ElaAppMs, NetMs: r.ElaNetMs}}
+		}
+		ar.SQLs[i].Intervals = downsample(append(ar.SQLs[i].Intervals, intervals...), resolution)
+	}
+	sort.Slice(ar.Captures, func(i, j int) bool { return ar.Captures[i].TimeBegin.Before(ar.Captures[j].TimeBegin) })
+	sort.Slice(ar.SQLs, func(i, j int) bool { return ar.SQLs[i].SQLid < ar.SQLs[j].SQLid })
+}
+
+// LoadArchive reads archive written by "stado archive"
+func LoadArchive(file string) (*Archive, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ar := &Archive{}
+	if err := json.NewDecoder(f).Decode(ar); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if ar.FormatVersion < 1 || ar.FormatVersion > ArchiveFormatVersion {
+		return nil, fmt.Errorf("%s: unsupported archive format version %d, this stado reads up to %d", file, ar.FormatVersion, ArchiveFormatVersion)
+	}
+	return ar, nil
+}
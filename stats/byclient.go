@@ -0,0 +1,13 @@
+package stats
+
+import "github.com/ora600pl/stado/tnsparse"
+
+// ByClient prints each sqlid split by client IP executing it (-by-client)
+var ByClient bool
+
+// addClient adds execution to statistics of the client IP it came from
+func (s *SQLstats) addClient(e *tnsparse.Execution) {
+	ip := tnsparse.ClientIP(e.Conversation)
+	fillClientGroup(s.clients, ip, e.Conversation, e.NetNs, e.AppNs)
+	s.clients[ip].Bytes += e.Bytes
+}
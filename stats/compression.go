@@ -0,0 +1,47 @@
+package stats
+
+// CompressionGroup is traffic of sessions with or without SQL*Net compression
+type CompressionGroup struct {
+	Sessions        int     `json:"sessions"`
+	Executions      uint    `json:"executions"`
+	Bytes           uint64  `json:"bytes"`
+	BytesPerExec    float64 `json:"bytes_per_exec"`
+	BytesPerSession float64 `json:"bytes_per_session"`
+}
+
+// CompressionStats compares wire bytes of compressed and uncompressed sessions. Byte statistics elsewhere
+// are wire bytes, so compressed sessions look cheaper there - per execution ratio shows by how much
+type CompressionStats struct {
+	Compressed   CompressionGroup `json:"compressed"`
+	Uncompressed CompressionGroup `json:"uncompressed"`
+	Ratio        float64          `json:"ratio,omitempty"` //Uncompressed bytes per execution / compressed bytes per execution
+}
+
+// Compression splits bytes and executions of conversations by negotiated compression, nil if no session compresses
+func (s *Stats) Compression() *CompressionStats {
+	cs := &CompressionStats{}
+	for conv, c := range s.Parser.Connections {
+		g := &cs.Uncompressed
+		if c.Compressed {
+			g = &cs.Compressed
+		}
+		g.Sessions++
+		g.Executions += s.ConvExecutions[conv]
+		g.Bytes += s.ConvBytes[conv]
+	}
+	if cs.Compressed.Sessions == 0 {
+		return nil
+	}
+	for _, g := range []*CompressionGroup{&cs.Compressed, &cs.Uncompressed} {
+		if g.Executions > 0 {
+			g.BytesPerExec = float64(g.Bytes) / float64(g.Executions)
+		}
+		if g.Sessions > 0 {
+			g.BytesPerSession = float64(g.Bytes) / float64(g.Sessions)
+		}
+	}
+	if cs.Compressed.BytesPerExec > 0 {
+		cs.Ratio = cs.Uncompressed.BytesPerExec / cs.Compressed.BytesPerExec
+	}
+	return cs
+}
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"sort"
+	"time"
+)
+
+// addInterval remembers when an execution of sqlid was running, for session concurrency
+func (s *SQLstats) addInterval(start time.Time, appNs int64) {
+	s.intervals = append(s.intervals, [2]int64{start.UnixNano(), start.UnixNano() + appNs})
+}
+
+// Concurrency returns maximum number of sessions executing sqlid at the same time and average number
+// of them over time when at least one was executing it. A session executes one call at a time, so
+// overlapping executions are different sessions
+func (s *SQLstats) Concurrency() (max int, avg float64) {
+	type event struct {
+		at    int64
+		delta int
+	}
+	events := make([]event, 0, 2*len(s.intervals))
+	for _, iv := range s.intervals {
+		events = append(events, event{iv[0], 1}, event{iv[1], -1})
+	}
+	//Koniec przed poczatkiem w tej samej chwili - wykonania jedno po drugim nie sa wspolbiezne
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].at < events[j].at || (events[i].at == events[j].at && events[i].delta < events[j].delta)
+	})
+	var busy, active int64 //Sum of execution time and time with at least one execution
+	running := 0
+	for i, e := range events {
+		if i > 0 && running > 0 {
+			span := e.at - events[i-1].at
+			busy += span * int64(running)
+			active += span
+		}
+		running += e.delta
+		if running > max {
+			max = running
+		}
+	}
+	if active > 0 {
+		avg = float64(busy) / float64(active)
+	} else if max > 0 {
+		avg = 1
+	}
+	return max, avg
+}
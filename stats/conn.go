@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tdigest"
+)
+
+// ShortSessionExecs - closed sessions with fewer executions are reported as short-lived (broken pooling)
+var ShortSessionExecs uint = 2
+
+// ShortLifetime - sessions living shorter are counted as short-lived in session duration report
+var ShortLifetime = time.Second
+
+// durationBuckets are upper bounds of session duration histogram
+var durationBuckets = []struct {
+	Label string
+	Max   time.Duration
+}{
+	{"<1s", time.Second},
+	{"1-10s", 10 * time.Second},
+	{"10-60s", time.Minute},
+	{"1-10min", 10 * time.Minute},
+	{"10-60min", time.Hour},
+	{">1h", time.Duration(math.MaxInt64)},
+}
+
+// DurationBucket is a single bar of session duration histogram
+type DurationBucket struct {
+	Label    string `json:"label"`
+	Sessions int    `json:"sessions"`
+}
+
+// SessionDurationStats is a lifecycle view of all conversations
+type SessionDurationStats struct {
+	Sessions   int              `json:"sessions"`
+	MinS       float64          `json:"min_s"`
+	MedianS    float64          `json:"median_s"`
+	P95S       float64          `json:"p95_s"`
+	MaxS       float64          `json:"max_s"`
+	ShortLived int              `json:"short_lived"` //Sessions shorter than ShortLifetime
+	Histogram  []DurationBucket `json:"histogram"`
+}
+
+// SessionDurations computes distribution of durations of all conversations
+func (s *Stats) SessionDurations() *SessionDurationStats {
+	sd := &SessionDurationStats{}
+	for _, b := range durationBuckets {
+		sd.Histogram = append(sd.Histogram, DurationBucket{Label: b.Label})
+	}
+	digest := tdigest.New(DigestCompression)
+	for _, c := range s.Parser.Connections {
+		d := c.Duration()
+		digest.Add(d.Seconds())
+		sd.Sessions++
+		if d < ShortLifetime {
+			sd.ShortLived++
+		}
+		for i, b := range durationBuckets {
+			if d < b.Max {
+				sd.Histogram[i].Sessions++
+				break
+			}
+		}
+	}
+	if sd.Sessions > 0 {
+		sd.MinS = digest.Quantile(0)
+		sd.MedianS = digest.Quantile(0.5)
+		sd.P95S = digest.Quantile(0.95)
+		sd.MaxS = digest.Quantile(1)
+	}
+	return sd
+}
+
+// ChurnMinute is number of connections opened and closed in one minute of capture
+type ChurnMinute struct {
+	Minute time.Time `json:"minute"`
+	Opened int       `json:"opened"`
+	Closed int       `json:"closed"`
+}
+
+// ShortSession is a session opened and closed within capture, which executed fewer than ShortSessionExecs statements
+type ShortSession struct {
+	Conversation string  `json:"conversation"`
+	Executions   uint    `json:"executions"`
+	LifetimeS    float64 `json:"lifetime_s"`
+}
+
+// ChurnStats summarizes connection churn of the capture
+type ChurnStats struct {
+	Opened        int            `json:"opened"`
+	Closed        int            `json:"closed"`
+	ClosedByRST   int            `json:"closed_by_rst"`
+	PerMinute     []ChurnMinute  `json:"per_minute"`
+	LifetimeMinS  float64        `json:"lifetime_min_s"`
+	LifetimeP50S  float64        `json:"lifetime_p50_s"`
+	LifetimeP90S  float64        `json:"lifetime_p90_s"`
+	LifetimeP99S  float64        `json:"lifetime_p99_s"`
+	LifetimeMaxS  float64        `json:"lifetime_max_s"`
+	ShortSessions []ShortSession `json:"short_sessions"`
+}
+
+// Churn computes connection churn from connections and executions of each conversation
+func (s *Stats) Churn() *ChurnStats {
+	ch := &ChurnStats{ShortSessions: []ShortSession{}}
+	minutes := make(map[time.Time]*ChurnMinute)
+	minute := func(ts time.Time) *ChurnMinute {
+		m := ts.Truncate(time.Minute)
+		if _, ok := minutes[m]; !ok {
+			minutes[m] = &ChurnMinute{Minute: m}
+		}
+		return minutes[m]
+	}
+	lifetimes := tdigest.New(DigestCompression)
+	for conv, c := range s.Parser.Connections {
+		if !c.Opened.IsZero() {
+			ch.Opened++
+			minute(c.Opened).Opened++
+		}
+		if c.Closed.IsZero() {
+			continue
+		}
+		ch.Closed++
+		minute(c.Closed).Closed++
+		if c.CloseFlag == "RST" {
+			ch.ClosedByRST++
+		}
+		if l, ok := c.Lifetime(); ok {
+			lifetimes.Add(l.Seconds())
+			if s.ConvExecutions[conv] < ShortSessionExecs {
+				ch.ShortSessions = append(ch.ShortSessions, ShortSession{Conversation: conv, Executions: s.ConvExecutions[conv], LifetimeS: l.Seconds()})
+			}
+		}
+	}
+	for _, m := range minutes {
+		ch.PerMinute = append(ch.PerMinute, *m)
+	}
+	sort.Slice(ch.PerMinute, func(i, j int) bool { return ch.PerMinute[i].Minute.Before(ch.PerMinute[j].Minute) })
+	sort.Slice(ch.ShortSessions, func(i, j int) bool { return ch.ShortSessions[i].Conversation < ch.ShortSessions[j].Conversation })
+	if lifetimes.Count() > 0 {
+		ch.LifetimeMinS = lifetimes.Quantile(0)
+		ch.LifetimeP50S = lifetimes.Quantile(0.5)
+		ch.LifetimeP90S = lifetimes.Quantile(0.9)
+		ch.LifetimeP99S = lifetimes.Quantile(0.99)
+		ch.LifetimeMaxS = lifetimes.Quantile(1)
+	}
+	return ch
+}
@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// IdleThreshold - gaps without TNS traffic at least that long are counted as idle
+var IdleThreshold = 30 * time.Second
+
+// IdleTime returns total and longest idle stretch of a conversation, the stretch before FIN/RST included.
+// Only packets with TNS payload count as activity, so TCP keepalives don't hide idleness
+func (s *Stats) IdleTime(conversationId string) (total time.Duration, longest time.Duration) {
+	var last time.Time
+	if c, ok := s.Parser.Connections[conversationId]; ok && !c.Opened.IsZero() {
+		last = c.Opened
+	}
+	add := func(ts time.Time) {
+		if !last.IsZero() {
+			if gap := ts.Sub(last); gap >= IdleThreshold {
+				total += gap
+				if gap > longest {
+					longest = gap
+				}
+			}
+		}
+		last = ts
+	}
+	for _, ts := range s.packetTimes(conversationId) {
+		add(ts)
+	}
+	if c, ok := s.Parser.Connections[conversationId]; ok && !c.Closed.IsZero() {
+		add(c.Closed)
+	}
+	return total, longest
+}
+
+// IdleClient is idle time of all sessions of a single client
+type IdleClient struct {
+	Client       string  `json:"client"`
+	Sessions     int     `json:"sessions"`
+	IdleSessions int     `json:"idle_sessions"`
+	IdleS        float64 `json:"idle_s"`
+	LongestS     float64 `json:"longest_idle_s"`
+}
+
+// IdleClients returns clients with idle sessions, the most idle first
+func (s *Stats) IdleClients() []IdleClient {
+	clients := make(map[string]*IdleClient)
+	for conv := range s.Parser.Connections {
+		ip := tnsparse.ClientIP(conv)
+		if _, ok := clients[ip]; !ok {
+			clients[ip] = &IdleClient{Client: ip}
+		}
+		ic := clients[ip]
+		ic.Sessions++
+		total, longest := s.IdleTime(conv)
+		if total == 0 {
+			continue
+		}
+		ic.IdleSessions++
+		ic.IdleS += total.Seconds()
+		if longest.Seconds() > ic.LongestS {
+			ic.LongestS = longest.Seconds()
+		}
+	}
+	rows := []IdleClient{}
+	for _, ic := range clients {
+		if ic.IdleSessions > 0 {
+			rows = append(rows, *ic)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].IdleS != rows[j].IdleS {
+			return rows[i].IdleS > rows[j].IdleS
+		}
+		return rows[i].Client < rows[j].Client
+	})
+	return rows
+}
+
+// IdleKillThreshold - RST after idle stretch at least that long is suspected to be a firewall idle timeout kill
+var IdleKillThreshold = 5 * time.Minute
+
+// idleKillWindow is how soon after the idle stretch the RST has to come, the first request after idle
+// usually triggers it, because the firewall has already dropped the connection state
+const idleKillWindow = 10 * time.Second
+
+// IdleKill is a conversation reset after a long idle period
+type IdleKill struct {
+	Conversation string    `json:"conversation"`
+	Subnet       string    `json:"subnet"`
+	IdleS        float64   `json:"idle_s"`
+	Reset        time.Time `json:"reset"`
+	ResetByDB    bool      `json:"reset_by_db"` //RST came from the database side of the firewall
+}
+
+// IdleKills returns conversations terminated by RST shortly after an idle stretch of at least IdleKillThreshold
+func (s *Stats) IdleKills() []IdleKill {
+	kills := []IdleKill{}
+	for conv, c := range s.Parser.Connections {
+		if c.CloseFlag != "RST" {
+			continue
+		}
+		var last time.Time
+		if !c.Opened.IsZero() {
+			last = c.Opened
+		}
+		var idle time.Duration
+		var idleEnd time.Time
+		for _, ts := range append(s.packetTimes(conv), c.Closed) {
+			if !last.IsZero() && ts.Sub(last) >= IdleKillThreshold {
+				idle = ts.Sub(last)
+				idleEnd = ts
+			}
+			last = ts
+		}
+		if idle > 0 && c.Closed.Sub(idleEnd) <= idleKillWindow {
+			kills = append(kills, IdleKill{Conversation: conv, Subnet: SubnetOf(tnsparse.ClientIP(conv)),
+				IdleS: idle.Seconds(), Reset: c.Closed, ResetByDB: c.ClosedByDB})
+		}
+	}
+	sort.Slice(kills, func(i, j int) bool { return kills[i].Reset.Before(kills[j].Reset) })
+	return kills
+}
+
+func (s *Stats) packetTimes(conversationId string) []time.Time {
+	times := make([]time.Time, 0, len(s.Parser.Conversations[conversationId]))
+	for _, p := range s.Parser.Conversations[conversationId] {
+		times = append(times, p.Timestamp)
+	}
+	return times
+}
@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	labelByIP     = make(map[string]string)
+	labelBySubnet []namedSubnet
+)
+
+// LoadClientLabels reads YAML map of client IP or subnet to label. Supported are scalars
+// and nested app/env keys which are joined to "app-env":
+//
+//	10.4.2.17: billing-batch-prod
+//	10.4.3.0/24:
+//	  app: billing
+//	  env: prod
+func LoadClientLabels(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	labels := make(map[string]map[string]string)
+	var keys []string
+	key := ""
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		raw := strings.SplitN(scanner.Text(), " #", 2)[0]
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return fmt.Errorf("%s:%d: expected \"key: value\"", file, lineNo)
+		}
+		//IPv6 ma dwukropki, wiec klucz moze byc w cudzyslowie albo konczy sie na ": "
+		if j := strings.Index(line, ": "); j >= 0 {
+			i = j
+		} else if strings.HasSuffix(line, ":") {
+			i = len(line) - 1
+		}
+		k, v := unquoteYAML(line[:i]), unquoteYAML(line[i+1:])
+		if raw[0] == ' ' || raw[0] == '\t' {
+			if key == "" {
+				return fmt.Errorf("%s:%d: nested key without parent", file, lineNo)
+			}
+			labels[key][strings.ToLower(k)] = v
+			continue
+		}
+		key = k
+		keys = append(keys, key)
+		labels[key] = make(map[string]string)
+		if v != "" {
+			labels[key]["label"] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		l := labels[k]
+		label := l["label"]
+		if label == "" {
+			var parts []string
+			for _, part := range []string{l["app"], l["env"]} {
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			label = strings.Join(parts, "-")
+		}
+		if label == "" {
+			return fmt.Errorf("%s: no label for %s", file, k)
+		}
+		if _, ipNet, err := net.ParseCIDR(k); err == nil {
+			labelBySubnet = append(labelBySubnet, namedSubnet{ipNet: ipNet, name: label})
+		} else if ip := net.ParseIP(k); ip != nil {
+			labelByIP[ip.String()] = label
+		} else {
+			return fmt.Errorf("%s: %s is neither IP nor subnet", file, k)
+		}
+	}
+	sort.SliceStable(labelBySubnet, func(i, j int) bool {
+		mi, _ := labelBySubnet[i].ipNet.Mask.Size()
+		mj, _ := labelBySubnet[j].ipNet.Mask.Size()
+		return mi > mj
+	})
+	return nil
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ClientLabel returns label of client ip from -labels map or empty string
+func ClientLabel(ip string) string {
+	if label, ok := labelByIP[ip]; ok {
+		return label
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	for _, s := range labelBySubnet {
+		if s.ipNet.Contains(addr) {
+			return s.name
+		}
+	}
+	return ""
+}
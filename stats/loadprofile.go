@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// ProfileInterval is length of buckets of the load profile (-load-profile), 0 disables it
+var ProfileInterval time.Duration
+
+// profileTop is number of sqlids profiled separately, in report order
+const profileTop = 5
+
+// SQLProfileJSON is load profile of one sqlid
+type SQLProfileJSON struct {
+	SQLid   string         `json:"sql_id"`
+	Buckets []IntervalJSON `json:"buckets"`
+}
+
+// LoadProfileJSON is load of the capture per ProfileInterval, every bucket from the first to the last
+// execution (also empty ones), overall and for the top sqlids
+type LoadProfileJSON struct {
+	IntervalS float64          `json:"interval_s"`
+	Buckets   []IntervalJSON   `json:"buckets"`
+	SQLs      []SQLProfileJSON `json:"sqls"`
+}
+
+// addProfile adds execution to its bucket of all sqlids and of sqlid st
+func (s *Stats) addProfile(st *SQLstats, e *tnsparse.Execution) {
+	if ProfileInterval <= 0 {
+		return
+	}
+	start := e.Start.Truncate(ProfileInterval)
+	app := float64(e.AppNs) / 1000000
+	iv := IntervalJSON{Executions: 1, AppMs: app, NetMs: float64(e.NetNs) / 1000000, MaxAppMs: app, Bytes: e.Bytes}
+	if e.Error != "" {
+		iv.Errors = 1
+	}
+	for _, buckets := range []map[int64]*IntervalJSON{s.LoadBuckets, st.profile} {
+		b, ok := buckets[start.UnixNano()]
+		if !ok {
+			b = &IntervalJSON{Start: start}
+			buckets[start.UnixNano()] = b
+		}
+		b.merge(iv)
+	}
+}
+
+// profileBuckets returns buckets from first to last, filling gaps with empty ones
+func profileBuckets(buckets map[int64]*IntervalJSON, first, last int64) []IntervalJSON {
+	rows := []IntervalJSON{}
+	for s := first; s <= last; s += ProfileInterval.Nanoseconds() {
+		if b, ok := buckets[s]; ok {
+			rows = append(rows, *b)
+		} else {
+			rows = append(rows, IntervalJSON{Start: time.Unix(0, s)})
+		}
+	}
+	return rows
+}
+
+// LoadProfile builds load profile of all sqlids and of the first profileTop of rows, nil without -load-profile
+func (s *Stats) LoadProfile(rows []SQLstatsJSON) *LoadProfileJSON {
+	if ProfileInterval <= 0 || len(s.LoadBuckets) == 0 {
+		return nil
+	}
+	first, last := int64(0), int64(0)
+	for b := range s.LoadBuckets {
+		if first == 0 || b < first {
+			first = b
+		}
+		if b > last {
+			last = b
+		}
+	}
+	lp := &LoadProfileJSON{IntervalS: ProfileInterval.Seconds(), Buckets: profileBuckets(s.LoadBuckets, first, last), SQLs: []SQLProfileJSON{}}
+	for i, r := range rows {
+		if i == profileTop {
+			break
+		}
+		if st, ok := s.SQLIdStats[r.SQLid]; ok {
+			lp.SQLs = append(lp.SQLs, SQLProfileJSON{SQLid: r.SQLid, Buckets: profileBuckets(st.profile, first, last)})
+		}
+	}
+	return lp
+}
@@ -0,0 +1,113 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tdigest"
+)
+
+// LogonStats is a distribution of logon latency of sessions which logged on during capture
+type LogonStats struct {
+	Sessions int     `json:"sessions"`
+	MinMs    float64 `json:"min_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	MaxMs    float64 `json:"max_ms"`
+	AvgMs    float64 `json:"avg_ms"`
+
+	//Average logon split into CONNECT -> ACCEPT, authentication exchange and the rest (session setup)
+	ConnectAvgMs float64           `json:"connect_avg_ms"`
+	AuthAvgMs    float64           `json:"auth_avg_ms"`
+	SetupAvgMs   float64           `json:"setup_avg_ms"`
+	AuthMethods  []AuthMethodStats `json:"auth_methods"`
+}
+
+// AuthMethodStats is authentication exchange time of sessions using one method, also of TCPS
+// sessions which first SQL can't be seen
+type AuthMethodStats struct {
+	Method    string  `json:"method"`
+	Sessions  int     `json:"sessions"`
+	AvgAuthMs float64 `json:"avg_auth_ms"`
+}
+
+// Logons computes logon latency distribution of all connections
+func (s *Stats) Logons() *LogonStats {
+	ls := &LogonStats{AuthMethods: []AuthMethodStats{}}
+	digest := tdigest.New(DigestCompression)
+	sum := 0.0
+	var connect, auth time.Duration
+	methods := make(map[string]*AuthMethodStats)
+	for _, c := range s.Parser.Connections {
+		a, authOk := c.Auth()
+		if authOk && c.AuthMethod != "" {
+			if _, ok := methods[c.AuthMethod]; !ok {
+				methods[c.AuthMethod] = &AuthMethodStats{Method: c.AuthMethod}
+			}
+			methods[c.AuthMethod].Sessions++
+			methods[c.AuthMethod].AvgAuthMs += float64(a.Nanoseconds()) / 1000000
+		}
+		if l, ok := c.Logon(); ok {
+			ms := float64(l.Nanoseconds()) / 1000000
+			digest.Add(ms)
+			sum += ms
+			ls.Sessions++
+			if !c.Accept.IsZero() {
+				connect += c.Accept.Sub(c.Connect)
+			}
+			if authOk {
+				auth += a
+			}
+		}
+	}
+	for _, m := range methods {
+		m.AvgAuthMs /= float64(m.Sessions)
+		ls.AuthMethods = append(ls.AuthMethods, *m)
+	}
+	sort.Slice(ls.AuthMethods, func(i, j int) bool { return ls.AuthMethods[i].Method < ls.AuthMethods[j].Method })
+	if ls.Sessions > 0 {
+		ls.ConnectAvgMs = float64(connect.Nanoseconds()) / 1000000 / float64(ls.Sessions)
+		ls.AuthAvgMs = float64(auth.Nanoseconds()) / 1000000 / float64(ls.Sessions)
+		ls.SetupAvgMs = math.Max(0, sum/float64(ls.Sessions)-ls.ConnectAvgMs-ls.AuthAvgMs)
+		ls.MinMs = digest.Quantile(0)
+		ls.P50Ms = digest.Quantile(0.5)
+		ls.P90Ms = digest.Quantile(0.9)
+		ls.P99Ms = digest.Quantile(0.99)
+		ls.MaxMs = digest.Quantile(1)
+		ls.AvgMs = sum / float64(ls.Sessions)
+	}
+	return ls
+}
+
+// RefusedConnection is a connection refused by the listener
+type RefusedConnection struct {
+	Conversation string    `json:"conversation"`
+	Service      string    `json:"service"`
+	Error        string    `json:"error"`
+	At           time.Time `json:"at"`
+}
+
+// ConnectStats summarizes TNS connect phase problems of the capture
+type ConnectStats struct {
+	Resends        uint                `json:"resends"`
+	ResendSessions int                 `json:"resend_sessions"`
+	Refused        []RefusedConnection `json:"refused"`
+}
+
+// Connects returns refused connections and RESEND counts of all connections
+func (s *Stats) Connects() *ConnectStats {
+	cs := &ConnectStats{Refused: []RefusedConnection{}}
+	for conv, c := range s.Parser.Connections {
+		if c.Resends > 0 {
+			cs.Resends += c.Resends
+			cs.ResendSessions++
+		}
+		if c.Refused != "" {
+			cs.Refused = append(cs.Refused, RefusedConnection{Conversation: conv, Service: c.Service, Error: c.Refused, At: c.RefusedAt})
+		}
+	}
+	sort.Slice(cs.Refused, func(i, j int) bool { return cs.Refused[i].At.Before(cs.Refused[j].At) })
+	return cs
+}
@@ -0,0 +1,31 @@
+package stats
+
+import "github.com/ora600pl/stado/tnsparse"
+
+// addCustomMetrics sums custom metrics of execution for its sqlid
+func (s *SQLstats) addCustomMetrics(e *tnsparse.Execution) {
+	if e.Metrics == nil {
+		return
+	}
+	if s.metrics == nil {
+		s.metrics = make([]float64, len(tnsparse.CustomMetrics))
+	}
+	for i, v := range e.Metrics {
+		s.metrics[i] += v
+	}
+}
+
+// metricsJSON returns sums of custom metrics by name, nil if there are none
+func (s *SQLstats) metricsJSON() map[string]float64 {
+	if len(tnsparse.CustomMetrics) == 0 {
+		return nil
+	}
+	m := make(map[string]float64, len(tnsparse.CustomMetrics))
+	for i, cm := range tnsparse.CustomMetrics {
+		m[cm.Name] = 0
+		if s.metrics != nil {
+			m[cm.Name] = s.metrics[i]
+		}
+	}
+	return m
+}
@@ -0,0 +1,30 @@
+package stats
+
+import "github.com/ora600pl/stado/tnsparse"
+
+// MirrorStats summarizes sessions captured on both legs
+type MirrorStats struct {
+	Sessions int     `json:"sessions"`   //Pairs of legs, each analyzed once
+	Refined  uint64  `json:"refined"`    //Executions which network time was refined with the server side leg
+	HopAvgMs float64 `json:"hop_avg_ms"` //Time added between the legs per refined execution
+	hopSumNs int64
+}
+
+// add counts execution of a client side leg
+func (ms *MirrorStats) add(e *tnsparse.Execution) {
+	if e.HopNs > 0 {
+		ms.Refined++
+		ms.hopSumNs += e.HopNs
+		ms.HopAvgMs = float64(ms.hopSumNs) / 1000000 / float64(ms.Refined)
+	}
+}
+
+// MirrorsJSON returns Mirrors for Analysis, nil if no session was seen twice
+func (s *Stats) MirrorsJSON() *MirrorStats {
+	if len(s.Parser.MirrorLegs) == 0 {
+		return nil
+	}
+	ms := s.Mirrors
+	ms.Sessions = len(s.Parser.MirrorLegs)
+	return &ms
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ethernetMSS is MSS of a clean path with 1500 MTU, smaller MSS means tunnel, VPN or MSS clamping on the path
+const ethernetMSS = 1460
+
+// MTUFinding is a path MTU or fragmentation issue found on database traffic
+type MTUFinding struct {
+	Where   string `json:"where"` //Conversation or database<->peer pair
+	Finding string `json:"finding"`
+}
+
+// MTUFindings returns path MTU and fragmentation issues of all conversations
+func (s *Stats) MTUFindings() []MTUFinding {
+	findings := []MTUFinding{}
+	side := [2]string{"client", "database"}
+	for conv, c := range s.Parser.Connections {
+		if c.Fragments > 0 {
+			findings = append(findings, MTUFinding{conv, fmt.Sprintf("%d fragmented TCP segments", c.Fragments)})
+		}
+		for dir := 0; dir < 2; dir++ {
+			if c.MSS[dir] > 0 && c.MSS[dir] < ethernetMSS {
+				findings = append(findings, MTUFinding{conv,
+					fmt.Sprintf("%s advertised MSS %d, path MTU is likely %d (tunnel/VPN/clamping)", side[dir], c.MSS[dir], c.MSS[dir]+40)})
+			}
+			//Segment wiekszy niz MSS drugiej strony nie mogl tak isc kablem - to offload karty przy capture
+			if peer := c.MSS[1-dir]; peer > 0 && c.MaxSegment[dir] > int(peer) {
+				findings = append(findings, MTUFinding{conv,
+					fmt.Sprintf("%s sent %d bytes segments above peer MSS %d (TSO/GRO offload at capture point)", side[dir], c.MaxSegment[dir], peer)})
+			}
+		}
+	}
+	for pair, n := range s.Parser.FragmentsByPeer {
+		findings = append(findings, MTUFinding{pair, fmt.Sprintf("%d IP fragments", n)})
+	}
+	for pair, mtu := range s.Parser.FragNeeded {
+		findings = append(findings, MTUFinding{pair, fmt.Sprintf("ICMP fragmentation needed, next-hop MTU %d", mtu)})
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Where != findings[j].Where {
+			return findings[i].Where < findings[j].Where
+		}
+		return findings[i].Finding < findings[j].Finding
+	})
+	return findings
+}
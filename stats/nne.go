@@ -0,0 +1,81 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// EncryptionStats is traffic of sessions encrypted with Native Network Encryption. Without NNEDecryptor
+// their SQL is not decoded, so only bytes and round trips are known
+type EncryptionStats struct {
+	Sessions     int            `json:"sessions"`
+	Algorithms   map[string]int `json:"algorithms"` //Sessions per encryption algorithm
+	Bytes        uint64         `json:"bytes"`
+	Packets      int            `json:"packets"`
+	RoundTrips   int            `json:"round_trips"` //Requests followed by a response
+	RTTAvgMs     float64        `json:"rtt_avg_ms"`  //From the last request packet to the first response packet
+	RTTMaxMs     float64        `json:"rtt_max_ms"`
+	Executions   uint           `json:"executions"` //Decoded with NNEDecryptor
+	Decrypted    bool           `json:"decrypted"`  //At least one packet was decrypted
+	DecSessions  int            `json:"decrypted_sessions"`
+	DecPackets   uint           `json:"decrypted_packets"`
+	Undetected   bool           `json:"undetected"`    //No SQL was decoded although TNS data was seen and no negotiation was captured
+	DataSessions int            `json:"data_sessions"` //Sessions with TNS data not negotiating encryption
+}
+
+// Encryption counts sessions which negotiated encryption, nil if there are none and sqls (number of sqlids) were decoded
+func (s *Stats) Encryption(sqls int) *EncryptionStats {
+	if tnsparse.Protocol != tnsparse.ProtocolOracle {
+		return nil
+	}
+	es := &EncryptionStats{Algorithms: make(map[string]int)}
+	var rttSum time.Duration
+	for conv, c := range s.Parser.Connections {
+		if c.Encryption == "" {
+			if len(s.Parser.Conversations[conv]) > 0 {
+				es.DataSessions++
+			}
+			continue
+		}
+		es.Sessions++
+		es.Algorithms[c.Encryption]++
+		es.Executions += s.ConvExecutions[conv]
+		if c.Decrypted > 0 {
+			es.DecSessions++
+			es.DecPackets += c.Decrypted
+		}
+		var lastRequest time.Time
+		for _, p := range s.Parser.Conversations[conv] {
+			es.Packets++
+			es.Bytes += uint64(p.Size)
+			if !p.Response {
+				lastRequest = p.Timestamp
+				continue
+			}
+			if lastRequest.IsZero() {
+				continue
+			}
+			rtt := p.Timestamp.Sub(lastRequest)
+			es.RoundTrips++
+			rttSum += rtt
+			if ms := float64(rtt.Nanoseconds()) / 1000000; ms > es.RTTMaxMs {
+				es.RTTMaxMs = ms
+			}
+			lastRequest = time.Time{}
+		}
+	}
+	if es.Sessions == 0 {
+		if sqls > 0 || es.DataSessions == 0 {
+			return nil
+		}
+		//Capture zaczety po zestawieniu sesji - negocjacji nie widac, ale SQL tez nie
+		es.Undetected = true
+		return es
+	}
+	es.Decrypted = es.DecPackets > 0
+	if es.RoundTrips > 0 {
+		es.RTTAvgMs = float64(rttSum.Nanoseconds()) / 1000000 / float64(es.RoundTrips)
+	}
+	return es
+}
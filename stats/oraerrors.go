@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"sort"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// oraMessages are short descriptions of errors often seen on the wire
+var oraMessages = map[string]string{
+	"ORA-00001": "unique constraint violated",
+	"ORA-00028": "session killed",
+	"ORA-00054": "resource busy, NOWAIT",
+	"ORA-00060": "deadlock detected",
+	"ORA-00904": "invalid identifier",
+	"ORA-00942": "table or view does not exist",
+	"ORA-01013": "user requested cancel",
+	"ORA-01400": "cannot insert NULL",
+	"ORA-01555": "snapshot too old",
+	"ORA-01722": "invalid number",
+	"ORA-02291": "parent key not found",
+	"ORA-02292": "child record found",
+	"ORA-03113": "end-of-file on communication channel",
+	"ORA-04068": "package state discarded",
+	"ORA-06502": "numeric or value error",
+	"ORA-08177": "can't serialize access",
+	"ORA-12899": "value too large for column",
+	//-protocol mysql
+	"MySQL-1062": "duplicate entry",
+	"MySQL-1205": "lock wait timeout exceeded",
+	"MySQL-1213": "deadlock found",
+	"MySQL-1146": "table doesn't exist",
+	"MySQL-1317": "query execution interrupted",
+	"MySQL-3024": "max_execution_time exceeded",
+	//-protocol postgres (SQLSTATE)
+	"PG-23505": "unique violation",
+	"PG-40001": "serialization failure",
+	"PG-40P01": "deadlock detected",
+	"PG-55P03": "lock not available",
+	"PG-57014": "query canceled",
+	//-protocol tds
+	"MSSQL-547":  "constraint conflict",
+	"MSSQL-1205": "deadlock victim",
+	"MSSQL-1222": "lock request timeout",
+	"MSSQL-2601": "duplicate key",
+	"MSSQL-2627": "primary key or unique constraint violated",
+}
+
+// addError counts ORA- error of execution for its sqlid
+func (s *SQLstats) addError(e *tnsparse.Execution) {
+	if e.Error != "" {
+		s.oraErrors[e.Error]++
+	}
+}
+
+// addError counts ORA- error of execution for its conversation
+func (s *Stats) addError(e *tnsparse.Execution) {
+	if e.Error == "" {
+		return
+	}
+	if _, ok := s.ConvErrors[e.Conversation]; !ok {
+		s.ConvErrors[e.Conversation] = make(map[string]uint64)
+	}
+	s.ConvErrors[e.Conversation][e.Error]++
+}
+
+// failed returns number of executions which returned an error
+func (s *SQLstats) failed() uint64 {
+	n := uint64(0)
+	for _, c := range s.oraErrors {
+		n += c
+	}
+	return n
+}
+
+// OraErrorJSON is an ORA- error code with executions which returned it
+type OraErrorJSON struct {
+	Code       string `json:"code"`
+	Message    string `json:"message,omitempty"`
+	Executions uint64 `json:"executions"`
+	SQLids     int    `json:"sql_ids"`
+	Sessions   int    `json:"sessions"`
+	TopSQLid   string `json:"top_sql_id"` //sqlid with the most executions returning the error
+}
+
+// SessionErrorsJSON are ORA- errors of executions in a conversation
+type SessionErrorsJSON struct {
+	Conversation string            `json:"conversation"`
+	Executions   uint64            `json:"executions"` //Executions which returned an error
+	Errors       map[string]uint64 `json:"errors"`
+}
+
+// OraErrors sums errors of all sqlids by code, the most frequent first
+func (s *Stats) OraErrors() []OraErrorJSON {
+	byCode := make(map[string]*OraErrorJSON)
+	top := make(map[string]uint64)
+	for sqlid, st := range s.SQLIdStats {
+		for code, n := range st.oraErrors {
+			e, ok := byCode[code]
+			if !ok {
+				e = &OraErrorJSON{Code: code, Message: oraMessages[code]}
+				byCode[code] = e
+			}
+			e.Executions += n
+			e.SQLids++
+			if n > top[code] || (n == top[code] && sqlid < e.TopSQLid) {
+				top[code], e.TopSQLid = n, sqlid
+			}
+		}
+	}
+	for _, errs := range s.ConvErrors {
+		for code := range errs {
+			byCode[code].Sessions++
+		}
+	}
+	rows := []OraErrorJSON{}
+	for _, e := range byCode {
+		rows = append(rows, *e)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Executions != rows[j].Executions {
+			return rows[i].Executions > rows[j].Executions
+		}
+		return rows[i].Code < rows[j].Code
+	})
+	return rows
+}
+
+// SessionErrors returns conversations with errors, the most failing first
+func (s *Stats) SessionErrors() []SessionErrorsJSON {
+	rows := []SessionErrorsJSON{}
+	for c, errs := range s.ConvErrors {
+		row := SessionErrorsJSON{Conversation: c, Errors: errs}
+		for _, n := range errs {
+			row.Executions += n
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Executions != rows[j].Executions {
+			return rows[i].Executions > rows[j].Executions
+		}
+		return rows[i].Conversation < rows[j].Conversation
+	})
+	return rows
+}
@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortBy selects order of sqlid rows in reports and rank of their charts (-sort)
+var SortBy = "impact"
+
+// SortKeys lists values accepted by -sort
+var SortKeys = []string{"impact", "ela_app", "ela_net", "exec", "ela_per_exec", "packets", "sqlid"}
+
+// sortAliases are former -sort values, still accepted
+var sortAliases = map[string]string{"app": "ela_app", "net": "ela_net"}
+
+// CheckSortBy fails for unknown -sort value
+func CheckSortBy() error {
+	if k, ok := sortAliases[SortBy]; ok {
+		SortBy = k
+	}
+	for _, k := range SortKeys {
+		if SortBy == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown -sort %q, expected %s", SortBy, strings.Join(SortKeys, "|"))
+}
+
+// SortSQLRows orders rows by SortBy from the highest value. Ties are broken by sqlid, so successive
+// runs over the same capture print the same report and can be diffed
+func SortSQLRows(rows []SQLstatsJSON) {
+	key := func(r *SQLstatsJSON) float64 {
+		switch SortBy {
+		case "ela_app":
+			return r.ElaAppMs
+		case "ela_net":
+			return r.ElaNetMs
+		case "exec":
+			return float64(r.Executions)
+		case "ela_per_exec":
+			return r.AppPerExecMs
+		case "packets":
+			return float64(r.Packets)
+		}
+		return r.Impact
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if SortBy != "sqlid" {
+			if ki, kj := key(&rows[i]), key(&rows[j]); ki != kj {
+				return ki > kj
+			}
+		}
+		return rows[i].SQLid < rows[j].SQLid
+	})
+}
+
+// TopSQLs is number of sqlids reported, the rest is rolled up into a single "others" line (-top, 0 - all)
+var TopSQLs = 0
+
+// SQLRollup sums sqlids left out of the report by TopSQLs
+type SQLRollup struct {
+	SQLids        int
+	ElaAppMs      float64
+	ElaNetMs      float64
+	Executions    uint
+	Packets       uint
+	ReusedCursors uint
+	Impact        float64
+}
+
+// TopRows returns the first TopSQLs of sorted rows and the rest rolled up, nil if nothing was left out
+func TopRows(rows []SQLstatsJSON) ([]SQLstatsJSON, *SQLRollup) {
+	if TopSQLs <= 0 || len(rows) <= TopSQLs {
+		return rows, nil
+	}
+	others := &SQLRollup{}
+	for _, r := range rows[TopSQLs:] {
+		others.SQLids++
+		others.ElaAppMs += r.ElaAppMs
+		others.ElaNetMs += r.ElaNetMs
+		others.Executions += r.Executions
+		others.Packets += r.Packets
+		others.ReusedCursors += r.ReusedCursors
+		others.Impact += r.Impact
+	}
+	return rows[:TopSQLs], others
+}
+
+// SortedKeys returns keys of map with string keys in ascending order
+func SortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
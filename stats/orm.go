@@ -0,0 +1,129 @@
+package stats
+
+import (
+	"regexp"
+	"sort"
+)
+
+// frameworkRule recognizes SQL generated by a framework by its aliases, bind names or statement form
+type frameworkRule struct {
+	Name string
+	re   *regexp.Regexp
+}
+
+var frameworkRules = []frameworkRule{
+	{"PL/SQL", regexp.MustCompile(`(?is)^\s*(begin|declare|call)\b`)},
+	{"Entity Framework", regexp.MustCompile(`"(Extent|Project|Filter|GroupBy|Join|Limit)\d+"|:p__linq__\d+`)},
+	{"Hibernate", regexp.MustCompile(`(?i)\b(this_|generatedAlias\d+|col_\d+_\d+_|[a-z]\w*\d+_(\d+_)?)\b`)},
+	{"jOOQ", regexp.MustCompile(`"alias_\d+"|"v\d+"|"[A-Z_$#0-9]+"\."[A-Z_$#0-9]+"\."[A-Z_$#0-9]+"`)},
+}
+
+// UnknownFramework is the group of SQLs which can't be attributed to any framework
+const UnknownFramework = "unknown"
+
+// FrameworkOf returns framework which generated sqlTxt recognized by its text, empty if there are no traces
+func FrameworkOf(sqlTxt string) string {
+	for _, r := range frameworkRules {
+		if r.re.MatchString(sqlTxt) {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// FrameworkJSON is workload generated by one framework
+type FrameworkJSON struct {
+	Name       string  `json:"name"`
+	SQLs       int     `json:"sqls"`
+	Sessions   int     `json:"sessions"`
+	Executions uint    `json:"executions"`
+	ElaAppMs   float64 `json:"ela_app_ms"`
+	ElaNetMs   float64 `json:"ela_net_ms"`
+	TopSQLid   string  `json:"top_sqlid"`   //sqlid with the longest app time
+	ByBehavior int     `json:"by_behavior"` //SQLs without traces in text, attributed by sessions executing them
+}
+
+// Frameworks attributes each sqlid to a framework by its text, or if the text has no traces (plain
+// "select * from t where id = :1" looks the same from every ORM), by the framework dominating in
+// sessions which executed it - a connection pool is used by one application
+func (s *Stats) Frameworks() []FrameworkJSON {
+	bySQL := make(map[string]string)
+	bySession := make(map[string]map[string]uint) //executions of each framework in session
+	for sqlid, st := range s.SQLIdStats {
+		fw := FrameworkOf(st.SQLtxt)
+		bySQL[sqlid] = fw
+		if fw == "" || fw == "PL/SQL" {
+			continue //Bloki PL/SQL wola kazda aplikacja, nie mowia nic o sesji
+		}
+		for c, run := range st.runs {
+			if bySession[c] == nil {
+				bySession[c] = make(map[string]uint)
+			}
+			bySession[c][fw] += run.Executions
+		}
+	}
+
+	groups := make(map[string]*FrameworkJSON)
+	topApp := make(map[string]float64)
+	sessions := make(map[string]map[string]bool)
+	for sqlid, st := range s.SQLIdStats {
+		fw, behavior := bySQL[sqlid], false
+		if fw == "" {
+			votes := make(map[string]uint)
+			for c, run := range st.runs {
+				for f, n := range bySession[c] {
+					votes[f] += n * run.Executions
+				}
+			}
+			fw = majority(votes)
+			behavior = fw != ""
+		}
+		if fw == "" {
+			fw = UnknownFramework
+		}
+		g, ok := groups[fw]
+		if !ok {
+			g = &FrameworkJSON{Name: fw}
+			groups[fw] = g
+			sessions[fw] = make(map[string]bool)
+		}
+		g.SQLs++
+		if behavior {
+			g.ByBehavior++
+		}
+		g.Executions += st.Executions
+		g.ElaAppMs += st.Elapsed_ms_app
+		g.ElaNetMs += st.Elapsed_ms_sum
+		if st.Elapsed_ms_app >= topApp[fw] {
+			topApp[fw] = st.Elapsed_ms_app
+			g.TopSQLid = sqlid
+		}
+		for c := range st.Sessions {
+			sessions[fw][c] = true
+		}
+	}
+
+	rows := []FrameworkJSON{}
+	for fw, g := range groups {
+		g.Sessions = len(sessions[fw])
+		rows = append(rows, *g)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].ElaAppMs != rows[j].ElaAppMs {
+			return rows[i].ElaAppMs > rows[j].ElaAppMs
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+// majority returns key with the most votes, empty if there are none
+func majority(votes map[string]uint) string {
+	best, max := "", uint(0)
+	for k, n := range votes {
+		if n > max || n == max && k < best {
+			best, max = k, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,136 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// PlanRatio - medians of app time of two groups of executions differing at least that many times suggest
+// two execution plans (-plan-ratio)
+var PlanRatio = 3.0
+
+// PlanMinExecs - sqlids need at least that many samples to be checked for plan change
+const PlanMinExecs = 20
+
+// PlanChangeJSON is suspected execution plan change of a sqlid
+type PlanChangeJSON struct {
+	Kind     string    `json:"kind"`      //shift - app time changed at Switch and stayed, bimodal - two latencies interleaved
+	Switch   time.Time `json:"switch"`    //First execution after the shift, for bimodal the first one in the slow mode
+	BeforeMs float64   `json:"before_ms"` //Median app time before the shift, for bimodal of the fast mode
+	AfterMs  float64   `json:"after_ms"`  //Median app time after the shift, for bimodal of the slow mode
+	Share    float64   `json:"share"`     //Fraction of executions after the shift or in the slow mode
+}
+
+// sse returns sum of squared deviations from mean of x[i:j] using prefix sums of x and x^2
+func sse(sum, sum2 []float64, i, j int) float64 {
+	n := float64(j - i)
+	s := sum[j] - sum[i]
+	return sum2[j] - sum2[i] - s*s/n
+}
+
+// bestSplit returns k splitting x into x[:k] and x[k:] with the smallest sum of squared deviations within
+// both parts, each part has at least minPart values, and the fraction of variance explained by the split
+func bestSplit(x []float64, minPart int) (int, float64) {
+	sum := make([]float64, len(x)+1)
+	sum2 := make([]float64, len(x)+1)
+	for i, v := range x {
+		sum[i+1] = sum[i] + v
+		sum2[i+1] = sum2[i] + v*v
+	}
+	total := sse(sum, sum2, 0, len(x))
+	best, bestSSE := 0, math.Inf(1)
+	for k := minPart; k <= len(x)-minPart; k++ {
+		if within := sse(sum, sum2, 0, k) + sse(sum, sum2, k, len(x)); within < bestSSE {
+			best, bestSSE = k, within
+		}
+	}
+	if best == 0 || total <= 0 {
+		return 0, 0
+	}
+	return best, 1 - bestSSE/total
+}
+
+// medianRatio returns the larger median of a and b divided by the smaller one
+func medianRatio(a, b []float64) float64 {
+	ma, mb := Median(a), Median(b)
+	if math.Min(ma, mb) <= 0 {
+		return 0
+	}
+	return math.Max(ma, mb) / math.Min(ma, mb)
+}
+
+// PlanChange checks app time of kept samples for an abrupt shift during the capture or for two
+// interleaved latencies (i.e. plan flipping with bind peeking or adaptive plans), nil if there is neither.
+// Log of app time is used, so a few very slow executions don't make a shift
+func (s *SQLstats) PlanChange() *PlanChangeJSON {
+	n := len(s.Ela_ms_app_all)
+	if n < PlanMinExecs {
+		return nil
+	}
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return s.Sample_start[idx[a]].Before(s.Sample_start[idx[b]]) })
+	app := make([]float64, n)
+	logApp := make([]float64, n)
+	for i, j := range idx {
+		app[i] = s.Ela_ms_app_all[j]
+		logApp[i] = math.Log(app[i] + 0.001)
+	}
+	minPart := n / 10
+	if minPart < 5 {
+		minPart = 5
+	}
+
+	//Przesuniecie w czasie: podzial osi czasu, ktory tlumaczy wiekszosc zmiennosci
+	if k, explained := bestSplit(logApp, minPart); k > 0 && explained >= 0.5 && medianRatio(app[:k], app[k:]) >= PlanRatio {
+		return &PlanChangeJSON{Kind: "shift", Switch: s.Sample_start[idx[k]], BeforeMs: Median(app[:k]),
+			AfterMs: Median(app[k:]), Share: float64(n-k) / float64(n)}
+	}
+
+	//Dwa przeplatajace sie czasy: podzial posortowanych wartosci (Otsu) i rozdzielenie grup (Ashman D)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return logApp[order[a]] < logApp[order[b]] })
+	sorted := make([]float64, n)
+	for i, j := range order {
+		sorted[i] = logApp[j]
+	}
+	k, _ := bestSplit(sorted, minPart)
+	if k == 0 {
+		return nil
+	}
+	var fast, slow Welford
+	for _, v := range sorted[:k] {
+		fast.Add(v)
+	}
+	for _, v := range sorted[k:] {
+		slow.Add(v)
+	}
+	spread := math.Sqrt(fast.StdDev()*fast.StdDev() + slow.StdDev()*slow.StdDev())
+	if spread == 0 || math.Sqrt2*(slow.Mean-fast.Mean)/spread < 2 {
+		return nil
+	}
+	fastApp := make([]float64, 0, k)
+	slowApp := make([]float64, 0, n-k)
+	first := n
+	for i, j := range order {
+		if i < k {
+			fastApp = append(fastApp, app[j])
+			continue
+		}
+		slowApp = append(slowApp, app[j])
+		if j < first {
+			first = j
+		}
+	}
+	if medianRatio(fastApp, slowApp) < PlanRatio {
+		return nil
+	}
+	return &PlanChangeJSON{Kind: "bimodal", Switch: s.Sample_start[idx[first]], BeforeMs: Median(fastApp),
+		AfterMs: Median(slowApp), Share: float64(n-k) / float64(n)}
+}
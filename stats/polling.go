@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// PollMinExecs - sessions need at least that many executions of sqlid to be checked for polling
+var PollMinExecs uint = 5
+
+// sessionRun is what a single session did with a sqlid
+type sessionRun struct {
+	Last       time.Time //Start of the last execution
+	Gap        Welford   //Time (ms) between consecutive executions
+	Executions uint
+	AppMs      float64
+	Bytes      uint64
+}
+
+func (r *sessionRun) add(e *tnsparse.Execution) {
+	r.Last = e.Start
+	r.Executions++
+	r.AppMs += float64(e.AppNs) / 1000000
+	r.Bytes += e.Bytes
+}
+
+// polling tells if the session executes sqlid at regular intervals
+func (r *sessionRun) polling() bool {
+	return r.Executions >= PollMinExecs && r.Gap.Mean > 0 && r.Gap.StdDev()/r.Gap.Mean < PeriodicCV
+}
+
+// PollingJSON is workload of sessions executing sqlid in a polling loop
+type PollingJSON struct {
+	Sessions   int     `json:"sessions"`
+	IntervalMs float64 `json:"interval_ms"` //Mean time between executions in polling sessions
+	Executions uint    `json:"executions"`
+	AppMs      float64 `json:"app_ms"`
+	Bytes      uint64  `json:"bytes"`
+}
+
+// Polling sums executions of sessions which execute sqlid at regular intervals, nil if there are none
+func (s *SQLstats) Polling() *PollingJSON {
+	var p PollingJSON
+	intervals, gaps := 0.0, uint(0)
+	for _, run := range s.runs {
+		if !run.polling() {
+			continue
+		}
+		p.Sessions++
+		p.Executions += run.Executions
+		p.AppMs += run.AppMs
+		p.Bytes += run.Bytes
+		intervals += run.Gap.Mean * float64(run.Gap.N)
+		gaps += run.Gap.N
+	}
+	if p.Sessions == 0 {
+		return nil
+	}
+	p.IntervalMs = intervals / float64(gaps)
+	return &p
+}
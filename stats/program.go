@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+)
+
+// KeepPrograms and ExcludePrograms select sessions by PROGRAM from CONNECT_DATA of their TNS CONNECT
+// (-program, -exclude-program). Names are matched case insensitive as substrings, nil matches all
+var (
+	KeepPrograms    []string
+	ExcludePrograms []string
+)
+
+// ParsePrograms parses comma separated list of program names
+func ParsePrograms(list string) []string {
+	var programs []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			programs = append(programs, p)
+		}
+	}
+	return programs
+}
+
+func matchProgram(program string, programs []string) bool {
+	program = strings.ToLower(program)
+	for _, p := range programs {
+		if strings.Contains(program, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProgramOf returns PROGRAM of conversation, empty if its CONNECT was not captured
+func (s *Stats) ProgramOf(conversationId string) string {
+	if c, ok := s.Parser.Connections[conversationId]; ok {
+		return c.Program
+	}
+	return ""
+}
+
+// ProgramWanted tells if executions of a session with program are counted. With -program sessions
+// which CONNECT was not captured are skipped, as it is unknown what program they belong to
+func ProgramWanted(program string) bool {
+	if KeepPrograms != nil && !matchProgram(program, KeepPrograms) {
+		return false
+	}
+	return ExcludePrograms == nil || program == "" || !matchProgram(program, ExcludePrograms)
+}
+
+// SessionWanted tells if conversation passes -program and -exclude-program
+func (s *Stats) SessionWanted(conversationId string) bool {
+	return ProgramWanted(s.ProgramOf(conversationId))
+}
+
+// ProgramJSON is a program sessions were opened by
+type ProgramJSON struct {
+	Program    string `json:"program"` //empty if CONNECT was not captured
+	Sessions   uint   `json:"sessions"`
+	Executions uint   `json:"executions"` //0 for skipped sessions, they aren't walked
+	Skipped    bool   `json:"skipped"`    //sessions were left out of statistics by -program or -exclude-program
+}
+
+// Programs counts sessions and executions per program, the most executing first
+func (s *Stats) Programs() []ProgramJSON {
+	byProgram := make(map[string]*ProgramJSON)
+	for c, conn := range s.Parser.Connections {
+		p, ok := byProgram[conn.Program]
+		if !ok {
+			p = &ProgramJSON{Program: conn.Program, Skipped: !ProgramWanted(conn.Program)}
+			byProgram[conn.Program] = p
+		}
+		p.Sessions++
+		p.Executions += s.ConvExecutions[c]
+	}
+	rows := []ProgramJSON{}
+	for _, p := range byProgram {
+		rows = append(rows, *p)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Executions != rows[j].Executions {
+			return rows[i].Executions > rows[j].Executions
+		}
+		return rows[i].Program < rows[j].Program
+	})
+	return rows
+}
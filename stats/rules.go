@@ -0,0 +1,241 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Rule turns a statistic into a finding when it crosses Threshold. Metric is a JSON field of a sqlid row
+// (scope sql) or of the whole analysis (scope analysis), nested fields are joined with dots and a ratio
+// of two fields is written as a/b, i.e. ela_net_ms/ela_app_ms
+type Rule struct {
+	Name      string
+	Scope     string //sql|analysis
+	Metric    string
+	Op        string //>|>=|<|<=
+	Threshold float64
+	Severity  string //critical|warning|info, off disables a built-in rule
+	Message   *template.Template
+	text      string
+}
+
+// Finding is a rule crossed by a sqlid or by the whole analysis
+type Finding struct {
+	Rule      string  `json:"rule"`
+	Severity  string  `json:"severity"`
+	SQLid     string  `json:"sql_id,omitempty"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Message   string  `json:"message"`
+}
+
+// severities rank findings, the most severe first
+var severities = map[string]int{"critical": 3, "warning": 2, "info": 1, "off": 0}
+
+// builtinRules are in the same format as -rules file. Message templates get .SQLid, .SQLtxt, .Value and .Threshold
+const builtinRules = `
+slow_sql        sql       app_per_exec_ms                    >  1000  warning   {{.SQLid}} takes {{printf "%.1f" .Value}} ms per execution
+net_bound       sql       ela_net_ms/ela_app_ms              >  0.5   warning   {{.SQLid}} spends {{printf "%.0f" (pct .Value)}}% of app time in round trips, check fetch size and array DML
+long_tail       sql       app_p99_ms/app_p50_ms              >  20    info      {{.SQLid}} p99 is {{printf "%.0f" .Value}}x its median, some executions are far slower than usual
+plan_change     sql       plan_change.after_ms/plan_change.before_ms  >  3  critical  {{.SQLid}} got {{printf "%.1f" .Value}}x slower during the capture, suspected plan change
+literals        sql       sql_ids                            >  10    warning   {{.SQLid}} is {{printf "%.0f" .Value}} sqlids differing only in literals, use binds
+streaming       sql       streaming_per_exec_ms/app_per_exec_ms  >  0.8  info  {{.SQLid}} spends {{printf "%.0f" (pct .Value)}}% of app time fetching the result
+polling         sql       polling.app_ms                     >  10000 info      {{.SQLid}} is polled, {{printf "%.0f" .Value}} ms spent in polling loops
+ora_errors      sql       failed_executions/executions       >  0.05  warning   {{.SQLid}} fails in {{printf "%.1f" (pct .Value)}}% of executions, see top ORA- errors
+apdex           sql       apdex.score                        <  0.5   warning   {{.SQLid}} has Apdex {{printf "%.2f" .Value}}, most of its executions are slower than the target
+net_share       analysis  sum_net_s/sum_app_s                >  0.3   warning   {{printf "%.0f" (pct .Value)}}% of all app time is spent in round trips
+apdex_total     analysis  apdex.score                        <  0.7   warning   Apdex of all executions is {{printf "%.2f" .Value}}
+duplicates      analysis  duplicate_frames                   >  0     info      {{printf "%.0f" .Value}} duplicate frames dropped, the capture is taken from a SPAN or bond
+`
+
+// Rules are evaluated by EvaluateRules, built-in ones and those loaded with -rules
+var Rules []*Rule
+
+var ruleFuncs = template.FuncMap{"pct": func(v float64) float64 { return 100 * v }}
+
+func init() {
+	if err := parseRules(builtinRules, "built-in rules"); err != nil {
+		panic(err)
+	}
+}
+
+// LoadRules reads rules file with lines "name scope metric op threshold severity message template",
+// # starts a comment. A rule named as a built-in one replaces it
+func LoadRules(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return parseRules(string(b), file)
+}
+
+func parseRules(text string, source string) error {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			return fmt.Errorf("%s:%d: expected \"name scope metric op threshold severity message\"", source, lineNo)
+		}
+		r := &Rule{Name: fields[0], Scope: fields[1], Metric: fields[2], Op: fields[3], Severity: fields[5]}
+		if r.Scope != "sql" && r.Scope != "analysis" {
+			return fmt.Errorf("%s:%d: unknown scope %q, expected sql|analysis", source, lineNo, r.Scope)
+		}
+		if r.Op != ">" && r.Op != ">=" && r.Op != "<" && r.Op != "<=" {
+			return fmt.Errorf("%s:%d: unknown operator %q", source, lineNo, r.Op)
+		}
+		if _, ok := severities[r.Severity]; !ok {
+			return fmt.Errorf("%s:%d: unknown severity %q, expected critical|warning|info|off", source, lineNo, r.Severity)
+		}
+		var err error
+		if r.Threshold, err = strconv.ParseFloat(fields[4], 64); err != nil {
+			return fmt.Errorf("%s:%d: threshold: %v", source, lineNo, err)
+		}
+		//Komunikat to reszta linii za polem severity, razem ze spacjami
+		r.text = line
+		for _, f := range fields[:6] {
+			r.text = strings.TrimSpace(r.text[strings.Index(r.text, f)+len(f):])
+		}
+		if r.Message, err = template.New(r.Name).Funcs(ruleFuncs).Parse(r.text); err != nil {
+			return fmt.Errorf("%s:%d: %v", source, lineNo, err)
+		}
+		addRule(r)
+	}
+	return scanner.Err()
+}
+
+func addRule(r *Rule) {
+	for i, old := range Rules {
+		if old.Name == r.Name {
+			Rules[i] = r
+			return
+		}
+	}
+	Rules = append(Rules, r)
+}
+
+// metric returns value of a dotted JSON field or a ratio of two of them, false if it is missing or divides by 0
+func metric(doc map[string]interface{}, name string) (float64, bool) {
+	if i := strings.Index(name, "/"); i >= 0 {
+		num, ok1 := metric(doc, name[:i])
+		den, ok2 := metric(doc, name[i+1:])
+		if !ok1 || !ok2 || den == 0 {
+			return 0, false
+		}
+		return num / den, true
+	}
+	var v interface{} = doc
+	for _, key := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		v = m[key]
+	}
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// toDoc converts v to generic JSON document, so rules can refer to fields by their JSON names
+func toDoc(v interface{}) map[string]interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	doc := make(map[string]interface{})
+	json.Unmarshal(b, &doc)
+	return doc
+}
+
+func (r *Rule) crossed(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	}
+	return value <= r.Threshold
+}
+
+func (r *Rule) finding(doc map[string]interface{}, sqlid string, sqlTxt string) (Finding, bool) {
+	value, ok := metric(doc, r.Metric)
+	if !ok || !r.crossed(value) {
+		return Finding{}, false
+	}
+	var msg bytes.Buffer
+	if err := r.Message.Execute(&msg, struct {
+		SQLid, SQLtxt    string
+		Value, Threshold float64
+	}{sqlid, sqlTxt, value, r.Threshold}); err != nil {
+		msg.Reset()
+		fmt.Fprintf(&msg, "%s: %v", r.Name, err)
+	}
+	return Finding{Rule: r.Name, Severity: r.Severity, SQLid: sqlid, Value: value, Threshold: r.Threshold, Message: msg.String()}, true
+}
+
+// EvaluateRules returns findings of analysis ranked by severity, then by how far the value is past
+// the threshold. Rules of sql scope are evaluated for each sqlid
+func EvaluateRules(a *Analysis) []Finding {
+	findings := []Finding{}
+	whole := *a
+	whole.SQLs, whole.Databases = nil, nil
+	wholeDoc := toDoc(&whole)
+	var rowDocs []map[string]interface{}
+	for _, r := range a.SQLs {
+		r.Samples, r.Intervals, r.SessionIds = nil, nil, nil //Tylko kopia, nie sa potrzebne regulom
+		rowDocs = append(rowDocs, toDoc(&r))
+	}
+	for _, rule := range Rules {
+		if rule.Severity == "off" {
+			continue
+		}
+		if rule.Scope == "analysis" {
+			if f, ok := rule.finding(wholeDoc, "", ""); ok {
+				findings = append(findings, f)
+			}
+			continue
+		}
+		for i, doc := range rowDocs {
+			if f, ok := rule.finding(doc, a.SQLs[i].SQLid, a.SQLs[i].SQLtxt); ok {
+				findings = append(findings, f)
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		fi, fj := &findings[i], &findings[j]
+		if si, sj := severities[fi.Severity], severities[fj.Severity]; si != sj {
+			return si > sj
+		}
+		if ei, ej := excess(fi), excess(fj); ei != ej {
+			return ei > ej
+		}
+		if fi.Rule != fj.Rule {
+			return fi.Rule < fj.Rule
+		}
+		return fi.SQLid < fj.SQLid
+	})
+	return findings
+}
+
+// excess is how many times the value is past the threshold
+func excess(f *Finding) float64 {
+	if f.Threshold == 0 || f.Value == 0 {
+		return f.Value - f.Threshold
+	}
+	if f.Value > f.Threshold {
+		return f.Value / f.Threshold
+	}
+	return f.Threshold / f.Value
+}
@@ -0,0 +1,38 @@
+package stats
+
+import (
+	"github.com/ora600pl/stado/sqlid"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// BySignature aggregates statistics by force matching signature instead of sqlid (-by-signature), so
+// statements built by concatenating literals are reported as one row
+var BySignature bool
+
+// normalizedSQL is SQL text with literals replaced by binds and its signature
+type normalizedSQL struct {
+	Signature string
+	SQLtxt    string
+}
+
+var normalizedCache = make(map[string]normalizedSQL) //Normalizacja jest droga, a tekstow jest tyle co sqlidow
+
+// Normalized returns normalized text and force matching signature of sqlTxt
+func Normalized(sqlTxt string) normalizedSQL {
+	n, ok := normalizedCache[sqlTxt]
+	if !ok {
+		n.SQLtxt = sqlid.Normalize(sqlTxt)
+		n.Signature = sqlid.Get(n.SQLtxt)
+		normalizedCache[sqlTxt] = n
+	}
+	return n
+}
+
+// StatsKey returns key and SQL text under which execution is aggregated in SQLIdStats
+func StatsKey(e *tnsparse.Execution) (string, string) {
+	if BySignature {
+		n := Normalized(e.SQLtxt)
+		return n.Signature, n.SQLtxt
+	}
+	return e.SQLid, e.SQLtxt
+}
@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// SLA burn settings (-sla, -sla-interval, -sla-budget). Executions which app time exceeds SLAThreshold breach
+// the SLA, SLABudget is the fraction of breaching executions tolerated in an interval. 0 threshold disables it
+var (
+	SLAThreshold time.Duration
+	SLAInterval  = time.Minute
+	SLABudget    = 0.05
+)
+
+// SLAPoint is number of executions started in one interval and how many of them breached the SLA
+type SLAPoint struct {
+	Start       time.Time `json:"start"`
+	Executions  uint64    `json:"executions"`
+	Breached    uint64    `json:"breached"`
+	BreachedPct float64   `json:"breached_pct"`
+	BurnRate    float64   `json:"burn_rate"` //BreachedPct / budget, above 1 the interval degraded the service
+}
+
+// SLADegradation is a run of consecutive intervals burning more than the budget
+type SLADegradation struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"` //End of the last degraded interval, the service recovered then
+	PeakPct    float64   `json:"peak_pct"`
+	Executions uint64    `json:"executions"`
+	Breached   uint64    `json:"breached"`
+}
+
+// SLABurn is the SLA burn over the capture. BreachedPct is weighted by executions of intervals, busy
+// intervals count more than quiet ones
+type SLABurn struct {
+	ThresholdMs  float64          `json:"threshold_ms"`
+	IntervalS    float64          `json:"interval_s"`
+	BudgetPct    float64          `json:"budget_pct"`
+	Executions   uint64           `json:"executions"`
+	Breached     uint64           `json:"breached"`
+	BreachedPct  float64          `json:"breached_pct"`
+	Points       []SLAPoint       `json:"points"` //Every interval from the first to the last execution, also empty ones
+	Degradations []SLADegradation `json:"degradations"`
+}
+
+// addSLA counts execution into its interval
+func (s *Stats) addSLA(e *tnsparse.Execution) {
+	if SLAThreshold <= 0 || SLAInterval <= 0 {
+		return
+	}
+	start := e.Start.Truncate(SLAInterval)
+	p, ok := s.SLABuckets[start.UnixNano()]
+	if !ok {
+		p = &SLAPoint{Start: start}
+		s.SLABuckets[start.UnixNano()] = p
+	}
+	p.Executions++
+	if e.AppNs > SLAThreshold.Nanoseconds() {
+		p.Breached++
+	}
+}
+
+// SLABurnOf builds SLABurn from SLABuckets, nil if -sla is not set
+func (s *Stats) SLABurnOf() *SLABurn {
+	if SLAThreshold <= 0 || SLAInterval <= 0 || len(s.SLABuckets) == 0 {
+		return nil
+	}
+	b := &SLABurn{ThresholdMs: float64(SLAThreshold.Nanoseconds()) / 1000000, IntervalS: SLAInterval.Seconds(),
+		BudgetPct: 100 * SLABudget, Points: []SLAPoint{}, Degradations: []SLADegradation{}}
+	starts := make([]int64, 0, len(s.SLABuckets))
+	for start := range s.SLABuckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	var d *SLADegradation
+	for start := starts[0]; start <= starts[len(starts)-1]; start += SLAInterval.Nanoseconds() {
+		p := SLAPoint{Start: time.Unix(0, start)}
+		if q, ok := s.SLABuckets[start]; ok {
+			p = *q
+			p.BreachedPct = 100 * float64(p.Breached) / float64(p.Executions)
+			if SLABudget > 0 {
+				p.BurnRate = p.BreachedPct / b.BudgetPct
+			}
+		}
+		b.Points = append(b.Points, p)
+		b.Executions += p.Executions
+		b.Breached += p.Breached
+
+		//Przedzial bez wykonan nie konczy degradacji - nie wiadomo czy serwis wrocil
+		if p.Executions == 0 {
+			continue
+		}
+		if p.BurnRate <= 1 {
+			d = nil
+			continue
+		}
+		if d == nil {
+			b.Degradations = append(b.Degradations, SLADegradation{Start: p.Start})
+			d = &b.Degradations[len(b.Degradations)-1]
+		}
+		d.End = p.Start.Add(SLAInterval)
+		d.Executions += p.Executions
+		d.Breached += p.Breached
+		if p.BreachedPct > d.PeakPct {
+			d.PeakPct = p.BreachedPct
+		}
+	}
+	b.BreachedPct = 100 * float64(b.Breached) / float64(b.Executions)
+	return b
+}
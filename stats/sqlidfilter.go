@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// SQLidFilter keeps only executions of these sqlids (or force matching signatures with -by-signature)
+// in statistics, charts and exports (-sqlid), nil keeps all
+var SQLidFilter map[string]bool
+
+// ParseSQLidFilter parses comma separated list of sqlids
+func ParseSQLidFilter(list string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+	filter := make(map[string]bool)
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			filter[id] = true
+		}
+	}
+	return filter
+}
+
+// SQLidWanted tells if execution passes SQLidFilter
+func SQLidWanted(e *tnsparse.Execution) bool {
+	if SQLidFilter == nil || SQLidFilter[e.SQLid] {
+		return true
+	}
+	key, _ := StatsKey(e)
+	return SQLidFilter[key]
+}
+
+// PacketDumper writes every packet of each execution, for a deep dive into a few statements (-dump)
+type PacketDumper struct {
+	f      *os.File
+	w      *bufio.Writer
+	parser *tnsparse.Parser
+}
+
+// NewPacketDumper creates file for packet dump of executions from conversations kept by p
+func NewPacketDumper(file string, p *tnsparse.Parser) (*PacketDumper, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketDumper{f: f, w: bufio.NewWriter(f), parser: p}, nil
+}
+
+// Write is an ExecutionHook
+func (d *PacketDumper) Write(e *tnsparse.Execution) {
+	fmt.Fprintf(d.w, "\n%s\t%s\t%s\tapp %f ms\tnet %f ms\t%d packets\t%d bytes\t%s\n", e.SQLid, e.Conversation,
+		e.Start.Format("2006-01-02 15:04:05.000000"), float64(e.AppNs)/1000000, float64(e.NetNs)/1000000, e.Packets, e.Bytes, e.Error)
+	fmt.Fprintln(d.w, "Offset (ms)\tDir\tBytes\tSeq\t\tAck\t\tRTT (ms)\tGap\tSQL")
+	packets := d.parser.Conversations[e.Conversation]
+	if e.Last >= len(packets) || packets[e.First].Timestamp.After(e.Start) {
+		fmt.Fprintln(d.w, "packets dropped by -evict, -max-conversations or -low-memory")
+		return
+	}
+	for i := e.First; i <= e.Last; i++ {
+		p := &packets[i]
+		dir, gap := "->", ""
+		if p.Response {
+			dir = "<-"
+		}
+		if i > e.First {
+			gap = tnsparse.WaitClassNames[tnsparse.WaitClass(&packets[i-1], p, true, false)]
+		}
+		sql := p.SQL
+		if len(sql) > 60 {
+			sql = sql[:60] + "..."
+		}
+		fmt.Fprintf(d.w, "%f\t%s\t%d\t%d\t%d\t%f\t%s\t%s\n", float64(p.Timestamp.Sub(packets[e.First].Timestamp).Nanoseconds())/1000000,
+			dir, p.Size, p.Seq, p.Ack, float64(p.RTT)/1000000, gap, sql)
+	}
+}
+
+func (d *PacketDumper) Close() error {
+	if err := d.w.Flush(); err != nil {
+		d.f.Close()
+		return fmt.Errorf("can't write packet dump: %v", err)
+	}
+	return d.f.Close()
+}
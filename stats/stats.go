@@ -0,0 +1,446 @@
+// Package stats aggregates executions of conversations kept by tnsparse.Parser into SQLstats of each sqlid
+// and statistics of sessions, clients and errors. New and Count fill Stats, Analyze turns them into
+// Analysis - the document saved with -save, written by -o json and printed by package report
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ora600pl/stado/tdigest"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// Welford computes mean and standard deviation online, without keeping samples
+type Welford struct {
+	N    uint
+	Mean float64
+	M2   float64 //Sum of squares of differences from the current mean
+}
+
+func (w *Welford) Add(x float64) {
+	w.N++
+	delta := x - w.Mean
+	w.Mean += delta / float64(w.N)
+	w.M2 += delta * (x - w.Mean)
+}
+
+// StdDev returns population standard deviation, 0 until there are at least two values
+func (w *Welford) StdDev() float64 {
+	if w.N < 2 {
+		return 0
+	}
+	return math.Sqrt(w.M2 / float64(w.N))
+}
+
+type SQLstats struct {
+	SQLtxt         string
+	Elapsed_ms_all []float64          //Elapsed time from net perspective for each packet (Each Request till following Fetch + DBTime)
+	Elapsed_ms_sum float64            //All elapsed times from net perspective per packet
+	Executions     uint               //Cumulative for all Conversattion
+	Packets        uint               //Cumulative for all Conversattion
+	Sessions       map[string]uint    //Number of Converstations in which this sqlid exists
+	ReusedCursors  uint               //Cumulative , how many time this SQL was requested using cursor
+	Elapsed_ms_app float64            //SQLid Wallclock time: since Request till last Fetch (NetTime + AppTime + DBTime)
+	Ela_ms_app_all []float64          //Elapsed time from app perspective
+	Sample_no      []uint             //Execution number of each sample kept in Elapsed_ms_all and Ela_ms_app_all
+	Sample_err     []string           //ORA- error of each sample, empty if the execution succeeded
+	Sample_start   []time.Time        //Start of each sample execution
+	Net            Welford            //Running mean and stddev of net elapsed time
+	App            Welford            //Running mean and stddev of app elapsed time
+	NetDigest      *tdigest.TDigest   //Quantile sketch of net elapsed time
+	AppDigest      *tdigest.TDigest   //Quantile sketch of app elapsed time
+	Waits          tnsparse.WaitTimes //App elapsed time split into wait classes
+	FirstSeen      time.Time          //Start of the first execution
+	LastSeen       time.Time          //End of the last execution
+	Slowest        []SlowExecution    //TopSlowest executions with the longest app time, the slowest first
+	Rows           uint64             //Rows affected by DML executions or fetched by queries
+	RoundTrips     uint64             //Request -> response round trips of all executions
+	GapDigest      *tdigest.TDigest   //Quantile sketch of time (ms) between consecutive executions in a session
+	Gap            Welford            //Running mean and stddev of the same gaps
+	First_ms_sum   float64            //Time till the first response of all executions
+	Stream_ms_sum  float64            //Time of fetches after the first response of all executions
+
+	runs      map[string]*sessionRun       //Executions of sqlid in each session, for gaps and polling
+	intervals [][2]int64                   //Start and end (unix ns) of each execution, for session concurrency
+	variants  map[string]bool              //sqlids aggregated into these statistics, more than one with -by-signature
+	buckets   map[int64]*IntervalJSON      //Summary of executions started in each IntervalResolution
+	clients   map[string]*ClientGroupStats //Executions from each client IP
+	metrics   []float64                    //Sums of CustomMetrics
+	oraErrors map[string]uint64            //Executions which returned each ORA- error
+	apdex     *Apdex                       //Apdex of executions, nil without -apdex
+	profile   map[int64]*IntervalJSON      //Summary of executions started in each ProfileInterval (-load-profile)
+}
+
+// PeriodicCV - gaps between re-executions with coefficient of variation below it are periodic (polling loop)
+const PeriodicCV = 0.2
+
+// addGap measures time since the previous execution of sqlid in the same session
+func (s *SQLstats) addGap(e *tnsparse.Execution) {
+	run, ok := s.runs[e.Conversation]
+	if !ok {
+		run = &sessionRun{}
+		s.runs[e.Conversation] = run
+	}
+	if !run.Last.IsZero() && !e.Start.Before(run.Last) {
+		ms := float64(e.Start.Sub(run.Last).Nanoseconds()) / 1000000
+		s.GapDigest.Add(ms)
+		s.Gap.Add(ms)
+		run.Gap.Add(ms)
+	}
+	run.add(e)
+}
+
+// GapPattern tells if sqlid is re-executed periodically (polling loop) or irregularly (user driven)
+func (s *SQLstats) GapPattern() string {
+	switch {
+	case s.Gap.N < 3 || s.Gap.Mean == 0:
+		return ""
+	case s.Gap.StdDev()/s.Gap.Mean < PeriodicCV:
+		return "periodic"
+	default:
+		return "irregular"
+	}
+}
+
+// TopSlowest is number of the slowest executions kept for each sqlid as concrete examples
+var TopSlowest = 5
+
+// SlowExecution is a single execution kept as an example of slow sqlid
+type SlowExecution struct {
+	Start        time.Time `json:"start"`
+	Conversation string    `json:"conversation"`
+	AppMs        float64   `json:"app_ms"`
+	NetMs        float64   `json:"net_ms"`
+	Packets      uint      `json:"packets"`
+	Bytes        uint64    `json:"bytes"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// addSlowest keeps execution if it is one of TopSlowest executions with the longest app time
+func (s *SQLstats) addSlowest(e *tnsparse.Execution) {
+	app := float64(e.AppNs) / 1000000
+	if TopSlowest == 0 || (len(s.Slowest) == TopSlowest && app <= s.Slowest[TopSlowest-1].AppMs) {
+		return
+	}
+	i := sort.Search(len(s.Slowest), func(i int) bool { return s.Slowest[i].AppMs < app })
+	if len(s.Slowest) < TopSlowest {
+		s.Slowest = append(s.Slowest, SlowExecution{})
+	}
+	copy(s.Slowest[i+1:], s.Slowest[i:])
+	s.Slowest[i] = SlowExecution{Start: e.Start, Conversation: e.Conversation, AppMs: app,
+		NetMs: float64(e.NetNs) / 1000000, Packets: e.Packets, Bytes: e.Bytes, Error: e.Error}
+}
+
+// MaxSamples caps number of per-execution samples kept for each sqlid (0 means keep all)
+var MaxSamples = 100000
+
+// DigestCompression is t-digest compression used for latency percentiles
+var DigestCompression = 100.0
+
+// sampleRand has a fixed seed, so the same capture always gives the same samples
+var sampleRand = rand.New(rand.NewSource(1))
+
+func (s *SQLstats) Fill(sqlTxt string, sqlDuration int64, session string, packet_cnt uint, reusedCursors uint, sqlApp int64, oraErr string, start time.Time) {
+	s.SQLtxt = sqlTxt
+	s.Elapsed_ms_sum += float64(sqlDuration) / 1000000
+	s.Executions += 1
+	s.Packets += packet_cnt
+	s.Sessions[session] = 1
+	s.ReusedCursors += reusedCursors
+	s.Elapsed_ms_app += float64(sqlApp) / 1000000
+	s.Net.Add(float64(sqlDuration) / 1000000)
+	s.App.Add(float64(sqlApp) / 1000000)
+	s.NetDigest.Add(float64(sqlDuration) / 1000000)
+	s.AppDigest.Add(float64(sqlApp) / 1000000)
+	s.addSample(float64(sqlDuration)/1000000, float64(sqlApp)/1000000, oraErr, start)
+}
+
+// Seen extends first and last seen time of sqlid with an execution from start lasting appNs
+func (s *SQLstats) Seen(start time.Time, appNs int64) {
+	end := start.Add(time.Duration(appNs))
+	if s.FirstSeen.IsZero() || start.Before(s.FirstSeen) {
+		s.FirstSeen = start
+	}
+	if end.After(s.LastSeen) {
+		s.LastSeen = end
+	}
+}
+
+// addSample keeps net and app elapsed time of current execution using reservoir sampling,
+// so after MaxSamples executions every execution has the same chance to stay in the sample
+func (s *SQLstats) addSample(net, app float64, oraErr string, start time.Time) {
+	if MaxSamples == 0 || len(s.Elapsed_ms_all) < MaxSamples {
+		s.Elapsed_ms_all = append(s.Elapsed_ms_all, net)
+		s.Ela_ms_app_all = append(s.Ela_ms_app_all, app)
+		s.Sample_no = append(s.Sample_no, s.Executions-1)
+		s.Sample_err = append(s.Sample_err, oraErr)
+		s.Sample_start = append(s.Sample_start, start)
+		return
+	}
+	if j := sampleRand.Intn(int(s.Executions)); j < MaxSamples {
+		s.Elapsed_ms_all[j] = net
+		s.Ela_ms_app_all[j] = app
+		s.Sample_no[j] = s.Executions - 1
+		s.Sample_err[j] = oraErr
+		s.Sample_start[j] = start
+	}
+}
+
+// Impact is executions x avg app time (i.e. total app time) weighted by 1+ln(sessions),
+// so a statement hurting many sessions ranks above equally expensive one from a single batch session
+func (s *SQLstats) Impact() float64 {
+	return s.Elapsed_ms_app * (1 + math.Log(float64(len(s.Sessions))))
+}
+
+// Samples returns kept samples ordered by execution number
+func (s *SQLstats) Samples() (execNo []float64, net []float64, app []float64, errs []string) {
+	idx := make([]int, len(s.Sample_no))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return s.Sample_no[idx[a]] < s.Sample_no[idx[b]] })
+	for _, i := range idx {
+		execNo = append(execNo, float64(s.Sample_no[i]))
+		net = append(net, s.Elapsed_ms_all[i])
+		app = append(app, s.Ela_ms_app_all[i])
+		errs = append(errs, s.Sample_err[i])
+	}
+	return execNo, net, app, errs
+}
+
+func NewSQLstats() *SQLstats {
+	return &SQLstats{SQLtxt: "",
+		Elapsed_ms_sum: 0, Executions: 0, Packets: 0,
+		Sessions: make(map[string]uint), ReusedCursors: 0,
+		Elapsed_ms_app: 0,
+		NetDigest:      tdigest.New(DigestCompression),
+		AppDigest:      tdigest.New(DigestCompression),
+		GapDigest:      tdigest.New(DigestCompression),
+		runs:           make(map[string]*sessionRun),
+		variants:       make(map[string]bool),
+		buckets:        make(map[int64]*IntervalJSON),
+		clients:        make(map[string]*ClientGroupStats),
+		oraErrors:      make(map[string]uint64),
+		profile:        make(map[int64]*IntervalJSON),
+		apdex:          NewApdex()}
+}
+
+// MultiDB is set when more than one database IP was given with -i, statistics are then kept also per database
+var MultiDB bool
+
+// Stats aggregates executions of conversations kept by Parser. Count rebuilds all of it from scratch,
+// so it can be called again after more packets were fed to the parser
+type Stats struct {
+	Parser         *tnsparse.Parser
+	SQLIdStats     map[string]*SQLstats            //Statistics of each sqlid (or signature with -by-signature)
+	DBSQLStats     map[string]map[string]*SQLstats //SQLIdStats of each database (DBLabel)
+	DBSummary      map[string]*ClientGroupStats    //All executions of each database
+	ClientSubnets  map[string]*ClientGroupStats    //Executions per client subnet (-subnet)
+	ClientLabels   map[string]*ClientGroupStats    //Executions per application label from -labels map
+	SQLTags        map[string]*ClientGroupStats    //Executions per tag found in SQL comments
+	TimeModel      tnsparse.WaitTimes              //Wait classification of all executions in the capture
+	ConvExecutions map[string]uint                 //Number of executions found in each conversation
+	ConvBytes      map[string]uint64               //TNS bytes of each conversation, as seen on the wire (compressed if the session compresses)
+	ConvErrors     map[string]map[string]uint64    //ORA- errors of executions in each conversation by error code
+	Timing         TimingStats                     //Timing issues of all executions
+	ApdexTotal     *Apdex                          //Apdex of all executions, nil if scoring is disabled
+	SLABuckets     map[int64]*SLAPoint             //Executions and breaches per SLAInterval, by interval start (unix ns)
+	LoadBuckets    map[int64]*IntervalJSON         //Executions of all sqlids per ProfileInterval, by bucket start (unix ns)
+	Mirrors        MirrorStats                     //Executions of mirrored conversations by leg
+
+	ExecutionHooks []func(e *tnsparse.Execution) //Called for every execution added to statistics, i.e. by exporters
+}
+
+// New returns empty statistics of conversations kept by p
+func New(p *tnsparse.Parser) *Stats {
+	return &Stats{Parser: p}
+}
+
+// AddExecution fills statistics with a single execution
+func (s *Stats) AddExecution(e *tnsparse.Execution) {
+	if !SQLidWanted(e) {
+		return
+	}
+	key, sqlTxt := StatsKey(e)
+	//Jesli mapa statystyk nie jest zainicjowana dla tego sqlid to trzeba ja zainicjowac najpierw
+	if _, ok := s.SQLIdStats[key]; !ok {
+		s.SQLIdStats[key] = NewSQLstats()
+	}
+	st := s.SQLIdStats[key]
+	st.Fill(sqlTxt, e.NetNs, e.Conversation, e.Packets, e.Reused, e.AppNs, e.Error, e.Start)
+	st.Waits.Add(e.Waits)
+	st.Seen(e.Start, e.AppNs)
+	st.addSlowest(e)
+	st.Rows += e.Rows
+	st.RoundTrips += uint64(e.RoundTrips)
+	st.addGap(e)
+	st.addInterval(e.Start, e.AppNs)
+	st.First_ms_sum += float64(e.FirstNs) / 1000000
+	st.Stream_ms_sum += float64(e.StreamNs()) / 1000000
+	st.variants[e.SQLid] = true
+	st.addBucket(e)
+	st.addClient(e)
+	st.addError(e)
+	s.addError(e)
+	st.addCustomMetrics(e)
+	st.apdex.add(e)
+	s.ApdexTotal.add(e)
+	s.addSLA(e)
+	s.addProfile(st, e)
+	if _, ok := s.Parser.MirrorLegs[e.Conversation]; ok {
+		s.Mirrors.add(e)
+	}
+	s.TimeModel.Add(e.Waits)
+	s.ConvExecutions[e.Conversation]++
+	s.Timing.count(e.Timing)
+	s.FillClientGroups(e.Conversation, e.NetNs, e.AppNs)
+	s.FillSQLTags(e)
+	if MultiDB {
+		db := tnsparse.DBLabelOf(e.Conversation)
+		if _, ok := s.DBSQLStats[db]; !ok {
+			s.DBSQLStats[db] = make(map[string]*SQLstats)
+		}
+		if _, ok := s.DBSQLStats[db][key]; !ok {
+			s.DBSQLStats[db][key] = NewSQLstats()
+		}
+		s.DBSQLStats[db][key].Fill(sqlTxt, e.NetNs, e.Conversation, e.Packets, e.Reused, e.AppNs, e.Error, e.Start)
+		s.DBSQLStats[db][key].Waits.Add(e.Waits)
+		s.DBSQLStats[db][key].Seen(e.Start, e.AppNs)
+		fillClientGroup(s.DBSummary, db, e.Conversation, e.NetNs, e.AppNs)
+	}
+	for _, hook := range s.ExecutionHooks {
+		hook(e)
+	}
+}
+
+// Count walks through all conversations of the parser and rebuilds statistics from scratch
+func (s *Stats) Count() {
+	s.SQLIdStats = make(map[string]*SQLstats)
+	s.ClientSubnets = make(map[string]*ClientGroupStats)
+	s.ClientLabels = make(map[string]*ClientGroupStats)
+	s.SQLTags = make(map[string]*ClientGroupStats)
+	s.DBSQLStats = make(map[string]map[string]*SQLstats)
+	s.DBSummary = make(map[string]*ClientGroupStats)
+	s.TimeModel = tnsparse.WaitTimes{}
+	s.ConvExecutions = make(map[string]uint)
+	s.ConvBytes = make(map[string]uint64)
+	s.ConvErrors = make(map[string]map[string]uint64)
+	s.Timing = TimingStats{ClockSteps: s.Parser.ClockSteps}
+	s.ApdexTotal = NewApdex()
+	s.SLABuckets = make(map[int64]*SLAPoint)
+	s.LoadBuckets = make(map[int64]*IntervalJSON)
+	s.Mirrors = MirrorStats{}
+
+	ids := make([]string, 0, len(s.Parser.Conversations))
+	for c := range s.Parser.Conversations {
+		if s.SessionWanted(c) && s.Parser.MirroredLegs[c] == "" {
+			ids = append(ids, c)
+		}
+	}
+	sort.Strings(ids)
+	s.Parser.WalkConversations(ids, func(c string, executions []tnsparse.Execution, convBytes uint64, dropped uint) {
+		for i := range executions {
+			s.AddExecution(&executions[i])
+		}
+		s.Timing.NegativeRTT += dropped
+		s.AddClientBytes(c, convBytes)
+		s.ConvBytes[c] += convBytes
+		if st, ok := s.DBSummary[tnsparse.DBLabelOf(c)]; ok {
+			st.Bytes += convBytes
+		}
+	})
+	s.countEvicted()
+}
+
+// countEvicted adds executions and bytes of evicted conversations to statistics
+func (s *Stats) countEvicted() {
+	for i := range s.Parser.Evicted {
+		ev := &s.Parser.Evicted[i]
+		if len(ev.Executions) == 0 && ev.Bytes == 0 {
+			continue //Samo polaczenie, zostaje tylko w Connections
+		}
+		if !s.SessionWanted(ev.Conversation) || s.Parser.MirroredLegs[ev.Conversation] != "" {
+			continue
+		}
+		for j := range ev.Executions {
+			s.AddExecution(&ev.Executions[j])
+		}
+		s.Timing.NegativeRTT += ev.Dropped
+		s.AddClientBytes(ev.Conversation, ev.Bytes)
+		s.ConvBytes[ev.Conversation] += ev.Bytes
+		if st, ok := s.DBSummary[tnsparse.DBLabelOf(ev.Conversation)]; ok {
+			st.Bytes += ev.Bytes
+		}
+	}
+}
+
+// Center and Dispersion select statistics of the per-execution columns in reports (-center, -dispersion)
+var (
+	Center       = "mean"   //mean|trimmed|median
+	Dispersion   = "stddev" //stddev|mad
+	TrimFraction = 0.1      //Fraction of the smallest and of the largest samples dropped by trimmed mean
+)
+
+// TrimmedMean returns mean of x without trim fraction of the smallest and the largest values
+func TrimmedMean(x []float64, trim float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), x...)
+	sort.Float64s(sorted)
+	cut := int(float64(len(sorted)) * trim)
+	if cut < 0 {
+		cut = 0
+	} else if 2*cut > len(sorted) {
+		cut = len(sorted) / 2
+	}
+	sorted = sorted[cut : len(sorted)-cut]
+	if len(sorted) == 0 {
+		return Median(x)
+	}
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return sum / float64(len(sorted))
+}
+
+func Median(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), x...)
+	sort.Float64s(sorted)
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+	return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+}
+
+// MAD returns median absolute deviation from the median - unlike stddev a few outliers don't change it
+func MAD(x []float64) float64 {
+	m := Median(x)
+	dev := make([]float64, len(x))
+	for i, v := range x {
+		dev[i] = math.Abs(v - m)
+	}
+	return Median(dev)
+}
+
+// StatLabels returns column labels for -center and -dispersion
+func StatLabels() (center string, dispersion string) {
+	center, dispersion = "/Exec", "Stddev"
+	switch Center {
+	case "trimmed":
+		center = " TrimMean"
+	case "median":
+		center = " Median"
+	}
+	if Dispersion == "mad" {
+		dispersion = "MAD"
+	}
+	return center, dispersion
+}
@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ora600pl/stado/tdigest"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// ClientGroupStats aggregates executions of all clients from one group (network segment or labeled application)
+type ClientGroupStats struct {
+	Sessions       map[string]uint //Conversations from this group
+	Clients        map[string]uint //Client IPs from this group
+	Executions     uint
+	Elapsed_ms_app float64
+	Elapsed_ms_sum float64
+	Bytes          uint64
+	AppDigest      *tdigest.TDigest
+}
+
+type namedSubnet struct {
+	ipNet *net.IPNet
+	name  string
+}
+
+// Subnets is a mapping loaded with -subnets, sorted from the most specific network
+var Subnets []namedSubnet
+
+// SubnetBits is a prefix length used to group clients not covered by Subnets
+var SubnetBits = 24
+
+// LoadSubnets reads file with lines "CIDR [name]" i.e. "10.20.0.0/16 VPN", # starts a comment
+func LoadSubnets(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(strings.SplitN(scanner.Text(), "#", 2)[0])
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		_, ipNet, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", file, lineNo, err)
+		}
+		name := ipNet.String()
+		if len(fields) > 1 {
+			name = strings.Join(fields[1:], " ")
+		}
+		Subnets = append(Subnets, namedSubnet{ipNet: ipNet, name: name})
+	}
+	sort.SliceStable(Subnets, func(i, j int) bool {
+		mi, _ := Subnets[i].ipNet.Mask.Size()
+		mj, _ := Subnets[j].ipNet.Mask.Size()
+		return mi > mj
+	})
+	return scanner.Err()
+}
+
+// SubnetOf returns name of the network segment of ip
+func SubnetOf(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	for _, s := range Subnets {
+		if s.ipNet.Contains(addr) {
+			return s.name
+		}
+	}
+	bits := 8 * net.IPv6len
+	if addr.To4() != nil {
+		addr = addr.To4()
+		bits = 8 * net.IPv4len
+	}
+	mask := net.CIDRMask(SubnetBits, bits)
+	if mask == nil {
+		return ip
+	}
+	return (&net.IPNet{IP: addr.Mask(mask), Mask: mask}).String()
+}
+
+// FillClientGroups adds execution from conversation to its client subnet and label stats
+func (s *Stats) FillClientGroups(conversationId string, sqlDuration int64, sqlApp int64) {
+	fillClientGroup(s.ClientSubnets, SubnetOf(tnsparse.ClientIP(conversationId)), conversationId, sqlDuration, sqlApp)
+	if label := ClientLabel(tnsparse.ClientIP(conversationId)); label != "" {
+		fillClientGroup(s.ClientLabels, label, conversationId, sqlDuration, sqlApp)
+	}
+}
+
+func fillClientGroup(groups map[string]*ClientGroupStats, group string, conversationId string, sqlDuration int64, sqlApp int64) {
+	s, ok := groups[group]
+	if !ok {
+		s = &ClientGroupStats{Sessions: make(map[string]uint), Clients: make(map[string]uint),
+			AppDigest: tdigest.New(DigestCompression)}
+		groups[group] = s
+	}
+	s.Sessions[conversationId] = 1
+	s.Clients[tnsparse.ClientIP(conversationId)] = 1
+	s.Executions += 1
+	s.Elapsed_ms_sum += float64(sqlDuration) / 1000000
+	s.Elapsed_ms_app += float64(sqlApp) / 1000000
+	s.AppDigest.Add(float64(sqlApp) / 1000000)
+}
+
+// AddClientBytes accounts TNS bytes of conversation to its client subnet and label
+func (s *Stats) AddClientBytes(conversationId string, bytes uint64) {
+	if g, ok := s.ClientSubnets[SubnetOf(tnsparse.ClientIP(conversationId))]; ok {
+		g.Bytes += bytes
+	}
+	if g, ok := s.ClientLabels[ClientLabel(tnsparse.ClientIP(conversationId))]; ok {
+		g.Bytes += bytes
+	}
+}
@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryTop is number of offenders and findings in the executive summary
+const summaryTop = 3
+
+// Offender is a sqlid with the most app time
+type Offender struct {
+	SQLid        string  `json:"sql_id"`
+	ElaAppMs     float64 `json:"ela_app_ms"`
+	AppShare     float64 `json:"app_share"` //Share of app time of all sqlids
+	Executions   uint    `json:"executions"`
+	AppPerExecMs float64 `json:"app_per_exec_ms"`
+	NetShare     float64 `json:"net_share"` //Share of its app time spent in round trips
+}
+
+// Summary is a short executive summary of analysis, Text is the same in prose
+type Summary struct {
+	TimeBegin time.Time  `json:"time_begin"`
+	TimeEnd   time.Time  `json:"time_end"`
+	DurationS float64    `json:"duration_s"`
+	SumAppS   float64    `json:"sum_app_s"`
+	SumNetS   float64    `json:"sum_net_s"`
+	Apdex     *Apdex     `json:"apdex,omitempty"`
+	Offenders []Offender `json:"offenders"`
+	Findings  []Finding  `json:"findings"` //The most severe findings
+	Text      string     `json:"text"`
+}
+
+// Summarize builds executive summary of analysis, its findings have to be evaluated already
+func Summarize(a *Analysis) *Summary {
+	s := &Summary{TimeBegin: a.TimeBegin, TimeEnd: a.TimeEnd, DurationS: a.DurationS, SumAppS: a.SumAppS, SumNetS: a.SumNetS,
+		Apdex: a.Apdex, Offenders: []Offender{}, Findings: []Finding{}}
+	rows := make([]SQLstatsJSON, len(a.SQLs))
+	copy(rows, a.SQLs)
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].ElaAppMs != rows[j].ElaAppMs {
+			return rows[i].ElaAppMs > rows[j].ElaAppMs
+		}
+		return rows[i].SQLid < rows[j].SQLid
+	})
+	for i := 0; i < len(rows) && i < summaryTop; i++ {
+		o := Offender{SQLid: rows[i].SQLid, ElaAppMs: rows[i].ElaAppMs, Executions: rows[i].Executions, AppPerExecMs: rows[i].AppPerExecMs}
+		if a.SumAppS > 0 {
+			o.AppShare = rows[i].ElaAppMs / (a.SumAppS * 1000)
+		}
+		if rows[i].ElaAppMs > 0 {
+			o.NetShare = rows[i].ElaNetMs / rows[i].ElaAppMs
+		}
+		s.Offenders = append(s.Offenders, o)
+	}
+	//Findings sa juz posortowane od najpowazniejszych, info pomijamy
+	for _, f := range a.Findings {
+		if len(s.Findings) == summaryTop || severities[f.Severity] < severities["warning"] {
+			break
+		}
+		s.Findings = append(s.Findings, f)
+	}
+	s.Text = s.text()
+	return s
+}
+
+func (s *Summary) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The capture spans %v (%s - %s). Executions took %.1f s of app time in total, %.1f s (%.0f%%) of it in network round trips.",
+		time.Duration(s.DurationS*float64(time.Second)).Round(time.Second), s.TimeBegin.Format("2006-01-02 15:04:05"),
+		s.TimeEnd.Format("2006-01-02 15:04:05"), s.SumAppS, s.SumNetS, 100*Ratio(s.SumNetS, s.SumAppS))
+	if s.Apdex != nil {
+		fmt.Fprintf(&b, " Apdex is %.2f at target %.0f ms (%d satisfied, %d tolerating, %d frustrated executions).",
+			s.Apdex.Score, s.Apdex.ThresholdMs, s.Apdex.Satisfied, s.Apdex.Tolerating, s.Apdex.Frustrated)
+	}
+	if len(s.Offenders) > 0 {
+		var top []string
+		share := 0.0
+		for _, o := range s.Offenders {
+			top = append(top, fmt.Sprintf("%s (%.1f s, %.0f%% of app time, %d executions at %.1f ms, %.0f%% network)",
+				o.SQLid, o.ElaAppMs/1000, 100*o.AppShare, o.Executions, o.AppPerExecMs, 100*o.NetShare))
+			share += o.AppShare
+		}
+		fmt.Fprintf(&b, " The top %d sqlids take %.0f%% of app time: %s.", len(s.Offenders), 100*share, strings.Join(top, ", "))
+	}
+	if len(s.Findings) == 0 {
+		b.WriteString(" No critical or warning findings.")
+	}
+	for _, f := range s.Findings {
+		fmt.Fprintf(&b, " %s: %s.", strings.ToUpper(f.Severity), strings.TrimSuffix(f.Message, "."))
+	}
+	return b.String()
+}
+
+// Ratio returns a/b, 0 if b is 0
+func Ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
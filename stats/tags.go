@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// TagPattern extracts application tags from SQL comments (-tags), nil disables tagging. With two groups
+// a match is tagged "key:value", with one group by the group and otherwise by the whole match
+var TagPattern *regexp.Regexp
+
+// DefaultTagPattern matches key:value and key=value pairs i.e. /* module:checkout action=pay */
+const DefaultTagPattern = `(\w+)[:=]([\w.\-/]+)`
+
+var rSQLComment = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+
+var tagsOfSQL = make(map[string][]string) //Tresc SQL jest stala dla sqlid, wiec tagi liczymy raz
+
+// SQLTagsOf returns tags found in comments of sqlTxt
+func SQLTagsOf(sqlTxt string) []string {
+	if TagPattern == nil {
+		return nil
+	}
+	if tags, ok := tagsOfSQL[sqlTxt]; ok {
+		return tags
+	}
+	var tags []string
+	seen := make(map[string]bool)
+	for _, comment := range rSQLComment.FindAllString(sqlTxt, -1) {
+		if strings.HasPrefix(comment, "/*+") {
+			continue //Hint optymalizatora to nie tag aplikacji
+		}
+		for _, m := range TagPattern.FindAllStringSubmatch(comment, -1) {
+			tag := m[0]
+			switch len(m) {
+			case 2:
+				tag = m[1]
+			case 3:
+				tag = m[1] + ":" + m[2]
+			}
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	tagsOfSQL[sqlTxt] = tags
+	return tags
+}
+
+// FillSQLTags adds execution to stats of every tag of its SQL text
+func (s *Stats) FillSQLTags(e *tnsparse.Execution) {
+	for _, tag := range SQLTagsOf(e.SQLtxt) {
+		fillClientGroup(s.SQLTags, tag, e.Conversation, e.NetNs, e.AppNs)
+		s.SQLTags[tag].Bytes += e.Bytes
+	}
+}
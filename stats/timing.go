@@ -0,0 +1,23 @@
+package stats
+
+import "github.com/ora600pl/stado/tnsparse"
+
+// TimingStats counts executions affected by capture timestamp problems
+type TimingStats struct {
+	ClockSteps    []tnsparse.ClockStep `json:"clock_steps"`
+	ClockStep     uint                 `json:"clock_step"`
+	Reordered     uint                 `json:"reordered"`
+	SameTimestamp uint                 `json:"same_timestamp"`
+	NegativeRTT   uint                 `json:"negative_rtt"` //still negative after corrections, dropped
+}
+
+func (t *TimingStats) count(issue string) {
+	switch issue {
+	case tnsparse.TimingClockStep:
+		t.ClockStep++
+	case tnsparse.TimingReordered:
+		t.Reordered++
+	case tnsparse.TimingSameTimestamp:
+		t.SameTimestamp++
+	}
+}
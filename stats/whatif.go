@@ -0,0 +1,88 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// What-if assumptions (-whatif-fetch, -whatif-parse)
+var (
+	FetchFrom = 10  //Fetch size used by the application now (JDBC default)
+	FetchTo   = 500 //Fetch size after the fix
+	ParseMs   = 1.0 //Hard parse time saved by each execution of a statement with binds instead of literals
+)
+
+// ParseFetchSizes parses "from:to" fetch sizes of -whatif-fetch
+func ParseFetchSizes(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("-whatif-fetch %q, expected from:to i.e. 10:500", s)
+	}
+	from, err1 := strconv.Atoi(parts[0])
+	to, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || from < 1 || to < from {
+		return fmt.Errorf("-whatif-fetch %q, expected from:to i.e. 10:500", s)
+	}
+	FetchFrom, FetchTo = from, to
+	return nil
+}
+
+// WhatIf is projected saving of app time of a sqlid (or a group of literal variants) after a fix
+type WhatIf struct {
+	Scenario   string
+	SQLid      string
+	Executions uint
+	ElaAppMs   float64 //App time now
+	SavedMs    float64
+}
+
+// WhatIfs projects savings of fixes cutting round trips and parses, ordered from the best payoff:
+//
+// fetch - round trips after the first response (net time of queries) shrink FetchTo/FetchFrom times,
+// binds - literal variants of the same statement (one force matching signature) are hard parsed once
+// instead of once per variant
+func WhatIfs(rows []SQLstatsJSON) []WhatIf {
+	var ws []WhatIf
+	groups := make(map[string]*WhatIf)
+	variants := make(map[string]int)
+	for _, r := range rows {
+		if tnsparse.IsQuery(r.SQLtxt) && r.ElaNetMs > 0 && FetchTo > FetchFrom {
+			ws = append(ws, WhatIf{Scenario: fmt.Sprintf("fetch %d->%d", FetchFrom, FetchTo), SQLid: r.SQLid, Executions: r.Executions,
+				ElaAppMs: r.ElaAppMs, SavedMs: r.ElaNetMs * (1 - float64(FetchFrom)/float64(FetchTo))})
+		}
+		if r.Signature == "" {
+			continue //Analiza zapisana przez starsze stado
+		}
+		g, ok := groups[r.Signature]
+		if !ok {
+			g = &WhatIf{Scenario: "binds", SQLid: r.Signature}
+			groups[r.Signature] = g
+		}
+		g.Executions += r.Executions
+		g.ElaAppMs += r.ElaAppMs
+		variants[r.Signature] += r.Variants
+	}
+	for signature, g := range groups {
+		if n := variants[signature]; n > 1 {
+			g.SavedMs = float64(n-1) * ParseMs
+			if g.SavedMs > g.ElaAppMs {
+				g.SavedMs = g.ElaAppMs
+			}
+			ws = append(ws, *g)
+		}
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		if ws[i].SavedMs != ws[j].SavedMs {
+			return ws[i].SavedMs > ws[j].SavedMs
+		}
+		if ws[i].Scenario != ws[j].Scenario {
+			return ws[i].Scenario < ws[j].Scenario
+		}
+		return ws[i].SQLid < ws[j].SQLid
+	})
+	return ws
+}
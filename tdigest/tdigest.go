@@ -0,0 +1,141 @@
+package tdigest
+
+import (
+	"math"
+	"sort"
+)
+
+// Centroid is a cluster of values summarized by their mean and count
+type Centroid struct {
+	Mean  float64
+	Count float64
+}
+
+// TDigest is a merging t-digest (Dunning) - a sketch for quantiles of arbitrarily large streams,
+// accurate especially for the tails (p95, p99) and taking O(compression) memory
+type TDigest struct {
+	Compression float64
+	centroids   []Centroid //merged centroids sorted by mean
+	buffer      []Centroid //values added since last merge
+	count       float64
+	min         float64
+	max         float64
+}
+
+// New returns an empty t-digest, compression 100 gives ~1% error for middle quantiles and much less in tails
+func New(compression float64) *TDigest {
+	return &TDigest{Compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Add adds single value to the digest
+func (t *TDigest) Add(x float64) {
+	t.addCentroid(Centroid{Mean: x, Count: 1})
+}
+
+func (t *TDigest) addCentroid(c Centroid) {
+	if c.Count <= 0 {
+		return
+	}
+	t.buffer = append(t.buffer, c)
+	t.count += c.Count
+	if c.Mean < t.min {
+		t.min = c.Mean
+	}
+	if c.Mean > t.max {
+		t.max = c.Mean
+	}
+	if len(t.buffer) >= int(t.Compression)*5 {
+		t.merge()
+	}
+}
+
+// Merge adds all values summarized by other digest
+func (t *TDigest) Merge(other *TDigest) {
+	for _, c := range other.Centroids() {
+		t.addCentroid(c)
+	}
+}
+
+// Count returns number of values added to the digest
+func (t *TDigest) Count() float64 {
+	return t.count
+}
+
+// Centroids returns merged centroids sorted by mean
+func (t *TDigest) Centroids() []Centroid {
+	t.merge()
+	return t.centroids
+}
+
+// k is the k1 scale function - it keeps centroids small near q=0 and q=1
+func (t *TDigest) k(q float64) float64 {
+	return t.Compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// qLimit returns the biggest quantile a centroid starting at q0 may reach
+func (t *TDigest) qLimit(q0 float64) float64 {
+	k := t.k(q0) + 1
+	if k >= t.Compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.Compression) + 1) / 2
+}
+
+func (t *TDigest) merge() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	t.buffer = t.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	merged := make([]Centroid, 0, len(all))
+	cur := all[0]
+	soFar := 0.0
+	limit := t.qLimit(0)
+	for _, c := range all[1:] {
+		if (soFar+cur.Count+c.Count)/t.count <= limit {
+			cur.Count += c.Count
+			cur.Mean += (c.Mean - cur.Mean) * c.Count / cur.Count
+		} else {
+			soFar += cur.Count
+			merged = append(merged, cur)
+			limit = t.qLimit(soFar / t.count)
+			cur = c
+		}
+	}
+	t.centroids = append(merged, cur)
+}
+
+// Quantile returns estimated value at quantile q (0..1), interpolating between centroid centers
+func (t *TDigest) Quantile(q float64) float64 {
+	t.merge()
+	n := len(t.centroids)
+	if n == 0 {
+		return 0
+	}
+	if q <= 0 || n == 1 && t.centroids[0].Count == 1 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+
+	target := q * t.count
+	cum := 0.0
+	for i, c := range t.centroids {
+		center := cum + c.Count/2
+		if target < center {
+			if i == 0 {
+				return t.min + (c.Mean-t.min)*target/center
+			}
+			prev := t.centroids[i-1]
+			prevCenter := cum - prev.Count/2
+			return prev.Mean + (c.Mean-prev.Mean)*(target-prevCenter)/(center-prevCenter)
+		}
+		cum += c.Count
+	}
+	last := t.centroids[n-1]
+	lastCenter := t.count - last.Count/2
+	return last.Mean + (t.max-last.Mean)*(target-lastCenter)/(t.count-lastCenter)
+}
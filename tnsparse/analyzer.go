@@ -0,0 +1,169 @@
+// Package tnsparse decodes database wire protocols (Oracle TNS/TTC, MySQL, PostgreSQL and SQL Server TDS) of
+// captured packets into conversations and executions. Analyzer is the entry point: packets are fed into it
+// with Feed or Run, executions are passed to OnExecution callbacks as soon as their conversations end and
+// parsed packets stay in Analyzer.Parser, so statistics of them can be counted with package stats
+package tnsparse
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// Analyzer is the programmatic entry point of stado: packets are fed into it and executions are passed
+// to callbacks as soon as their conversation ends, so they can be streamed into other systems without
+// going through files. Its Parser keeps all packets fed so far, statistics of them are counted by stats.New
+type Analyzer struct {
+	Parser *Parser
+
+	onExecution       []func(e *Execution)
+	onConversationEnd []func(conversationId string, c *ConnStats)
+	onError           []func(err error)
+	walked            map[string]bool //conversations which executions were already passed to callbacks
+	stop              chan struct{}
+	stopOnce          sync.Once
+}
+
+// Option configures Analyzer
+type Option func(a *Analyzer)
+
+// WithDedup drops frames seen twice within window (SPAN/bond duplicates)
+func WithDedup(window time.Duration) Option {
+	return func(a *Analyzer) {
+		if window > 0 {
+			a.Parser.Dedup = NewDeduper(window)
+		}
+	}
+}
+
+// WithMirror pairs legs of sessions captured twice within window (-mirror), each session is analyzed once
+func WithMirror(window time.Duration) Option {
+	return func(a *Analyzer) {
+		if window > 0 {
+			a.Parser.Mirror = NewMirrorDetector(window)
+		}
+	}
+}
+
+// WithWindow analyzes only packets captured within window, nil analyzes all
+func WithWindow(window *TimeWindow) Option {
+	return func(a *Analyzer) { a.Parser.Window = window }
+}
+
+// WithDecryptor decrypts sessions encrypted with Native Network Encryption
+func WithDecryptor(d Decryptor) Option {
+	return func(a *Analyzer) { a.Parser.NNEDecryptor = d }
+}
+
+// WithSoftFilter makes the parser skip packets of other hosts and ports, for sources without BPF
+func WithSoftFilter() Option {
+	return func(a *Analyzer) { a.Parser.SoftFilter = true }
+}
+
+// OnExecution is called once for every execution, when its conversation ends or on Flush
+func OnExecution(f func(e *Execution)) Option {
+	return func(a *Analyzer) { a.onExecution = append(a.onExecution, f) }
+}
+
+// OnConversationEnd is called when a conversation is closed with FIN or RST, once data of both directions
+// sent till the close was parsed
+func OnConversationEnd(f func(conversationId string, c *ConnStats)) Option {
+	return func(a *Analyzer) { a.onConversationEnd = append(a.onConversationEnd, f) }
+}
+
+// OnError is called for packets which can't be decoded and flows which can't be counted
+func OnError(f func(err error)) Option {
+	return func(a *Analyzer) { a.onError = append(a.onError, f) }
+}
+
+// NewAnalyzer returns analyzer of database listening on dbPort at any of dbIPs
+func NewAnalyzer(dbIPs []string, dbPort string, opts ...Option) *Analyzer {
+	a := &Analyzer{Parser: NewParser(dbIPs, dbPort), walked: make(map[string]bool), stop: make(chan struct{})}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.Parser.ConversationEndHooks = append(a.Parser.ConversationEndHooks, a.conversationEnd)
+	a.Parser.EvictionHooks = append(a.Parser.EvictionHooks, a.evicted)
+	a.Parser.ErrorHooks = append(a.Parser.ErrorHooks, a.error)
+	return a
+}
+
+// Feed parses a single packet
+func (a *Analyzer) Feed(packet gopacket.Packet) {
+	if el := packet.ErrorLayer(); el != nil {
+		a.error(fmt.Errorf("can't decode packet from %v: %v", packet.Metadata().Timestamp, el.Error()))
+	}
+	a.Parser.Parse(packet)
+}
+
+// Run feeds all packets of the source and flushes executions of conversations left open.
+// It returns false if it was interrupted with Stop before the source was exhausted
+func (a *Analyzer) Run(ps *gopacket.PacketSource) bool {
+	completed := true
+	packets := ps.Packets()
+loop:
+	for {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				break loop
+			}
+			a.Feed(packet)
+		case <-a.stop:
+			completed = false
+			break loop
+		}
+	}
+	a.Flush()
+	return completed
+}
+
+// Stop makes Run return after the packet being parsed, it is safe to call it from other goroutines
+func (a *Analyzer) Stop() {
+	a.stopOnce.Do(func() { close(a.stop) })
+}
+
+// Flush passes executions of conversations still open to OnExecution callbacks
+func (a *Analyzer) Flush() {
+	a.Parser.FlushStreams()
+	for c := range a.Parser.Conversations {
+		a.walk(c)
+	}
+}
+
+func (a *Analyzer) walk(conversationId string) {
+	if a.walked[conversationId] || len(a.onExecution) == 0 || a.Parser.MirroredLegs[conversationId] != "" {
+		return
+	}
+	a.walked[conversationId] = true
+	var executions []Execution
+	a.Parser.WalkConversation(conversationId, func(e *Execution) { executions = append(executions, *e) })
+	a.Parser.refineMirrored(conversationId, executions)
+	for i := range executions {
+		for _, f := range a.onExecution {
+			f(&executions[i])
+		}
+	}
+}
+
+func (a *Analyzer) conversationEnd(conversationId string) {
+	a.walk(conversationId)
+	for _, f := range a.onConversationEnd {
+		f(conversationId, a.Parser.Connections[conversationId])
+	}
+}
+
+// evicted passes executions of a conversation before its packets are dropped. The same conversation id
+// seen again later is a new flow of packets, so it is walked again
+func (a *Analyzer) evicted(conversationId string) {
+	a.walk(conversationId)
+	delete(a.walked, conversationId)
+}
+
+func (a *Analyzer) error(err error) {
+	for _, f := range a.onError {
+		f(err)
+	}
+}
@@ -0,0 +1,115 @@
+package tnsparse
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// ConnStats is a TCP connection state of a conversation, tracked also from packets without TNS payload
+type ConnStats struct {
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Opened     time.Time //SYN from client, zero if connection was opened before capture
+	Closed     time.Time //First FIN or RST, zero if connection was still open at the end of capture
+	CloseFlag  string    //FIN or RST
+	ClosedByDB bool      //FIN or RST was sent by the database
+	Connect    time.Time //First TNS CONNECT of the session
+	FirstSQL   time.Time //First application SQL of the session
+	Service    string    //SERVICE_NAME or SID from the last TNS CONNECT
+	Program    string    //PROGRAM from CONNECT_DATA of the last TNS CONNECT
+	Resends    uint      //TNS RESEND packets - listener asked the client to send CONNECT again
+	Refused    string    //ORA- error from TNS REFUSE, empty if the connection was not refused
+	RefusedAt  time.Time
+	MSS        [2]uint16 //MSS from SYN options sent by client [0] and database [1]
+	MaxSegment [2]int    //The biggest TCP payload sent by client [0] and database [1]
+	Fragments  uint      //TCP segments sent in IP fragments
+	Compressed bool      //SQL*Net data compression requested in TNS CONNECT
+	Accept     time.Time //TNS ACCEPT from the database
+	AuthMethod string    //password, kerberos, radius, token or tcps
+	Encryption string    //Native Network Encryption algorithm chosen in ANO negotiation, i.e. AES256
+	Decrypted  uint      //Packets decrypted with NNEDecryptor
+	AuthStart  time.Time //First packet of authentication exchange
+	AuthEnd    time.Time //Last packet of authentication exchange
+
+	evicted bool //Packets were dropped by Evict, what is left is in Evicted
+	folded  bool //Ended executions were moved to Evicted by -low-memory, packets after them are still kept
+	ended   bool //Streams of both directions completed after close, ConversationEndHooks were called
+}
+
+// Lifetime returns connection lifetime if both open and close were captured
+func (c *ConnStats) Lifetime() (time.Duration, bool) {
+	if c.Opened.IsZero() || c.Closed.IsZero() {
+		return 0, false
+	}
+	return c.Closed.Sub(c.Opened), true
+}
+
+// TrackConnection updates connection state of conversation with TCP flags of a packet
+func (t *Parser) TrackConnection(conversationId string, tcp *layers.TCP, ts time.Time, fromDB bool, fragment bool) {
+	c, ok := t.Connections[conversationId]
+	if !ok {
+		c = &ConnStats{FirstSeen: ts}
+		t.Connections[conversationId] = c
+	}
+	c.LastSeen = ts
+	trackSegment(c, tcp, fromDB, fragment)
+	if tcp.SYN && !tcp.ACK && !fromDB {
+		//Port klienta moze zostac uzyty ponownie - nowy SYN to nowe polaczenie
+		c.Opened = ts
+		c.Closed = time.Time{}
+		c.CloseFlag = ""
+		c.Connect = time.Time{}
+		c.FirstSQL = time.Time{}
+		c.Service = ""
+		c.Program = ""
+		c.Resends = 0
+		c.Refused = ""
+		c.Compressed = false
+		c.Accept = time.Time{}
+		c.AuthMethod = ""
+		c.AuthStart = time.Time{}
+		c.AuthEnd = time.Time{}
+		c.evicted = false
+		c.ended = false
+	}
+	if c.Closed.IsZero() && (tcp.FIN || tcp.RST) {
+		c.Closed = ts
+		c.ClosedByDB = fromDB
+		c.CloseFlag = "FIN"
+		if tcp.RST {
+			c.CloseFlag = "RST"
+		}
+	}
+}
+
+// Duration returns how long the conversation was seen - from SYN (or first packet) till FIN/RST (or last packet)
+func (c *ConnStats) Duration() time.Duration {
+	begin, end := c.FirstSeen, c.LastSeen
+	if !c.Opened.IsZero() {
+		begin = c.Opened
+	}
+	if !c.Closed.IsZero() {
+		end = c.Closed
+	}
+	return end.Sub(begin)
+}
+
+// ClientIP extracts client address from conversation id "dbip:dbport<->appip:appport"
+func ClientIP(conversationId string) string {
+	client := conversationId[strings.Index(conversationId, "<->")+3:]
+	if i := strings.LastIndex(client, ":"); i >= 0 {
+		client = client[:i]
+	}
+	return client
+}
+
+// ClientPort extracts client (ephemeral) port from conversation id
+func ClientPort(conversationId string) string {
+	port := conversationId[strings.LastIndex(conversationId, ":")+1:]
+	if i := strings.Index(port, "("); i >= 0 {
+		port = port[:i]
+	}
+	return port
+}
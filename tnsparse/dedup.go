@@ -0,0 +1,57 @@
+package tnsparse
+
+import (
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// DedupWindow - the same frame seen again within the window is a duplicate from SPAN mirroring both
+// directions or from both slaves of a bond. Real retransmissions come after RTO (>=200ms) and usually
+// with a new IP ID, so they are not dropped
+var DedupWindow = 10 * time.Millisecond
+
+type frameKey struct {
+	src, dst     [16]byte
+	id           uint16
+	sport, dport layers.TCPPort
+	seq, ack     uint32
+	length       int
+}
+
+type seenFrame struct {
+	key frameKey
+	ts  time.Time
+}
+
+// Deduper drops frames captured twice
+type Deduper struct {
+	Window     time.Duration
+	Duplicates uint64
+	seen       map[frameKey]time.Time
+	queue      []seenFrame //seen frames in capture order, for eviction of frames older than Window
+}
+
+func NewDeduper(window time.Duration) *Deduper {
+	return &Deduper{Window: window, seen: make(map[frameKey]time.Time)}
+}
+
+// Duplicate tells if the frame was already seen within Window and remembers it otherwise
+func (d *Deduper) Duplicate(ip ipHeader, tcp *layers.TCP, ts time.Time) bool {
+	for len(d.queue) > 0 && ts.Sub(d.queue[0].ts) > d.Window {
+		if d.seen[d.queue[0].key] == d.queue[0].ts {
+			delete(d.seen, d.queue[0].key)
+		}
+		d.queue = d.queue[1:]
+	}
+	k := frameKey{id: ip.Id, sport: tcp.SrcPort, dport: tcp.DstPort, seq: tcp.Seq, ack: tcp.Ack, length: len(tcp.Payload)}
+	copy(k.src[:], ip.SrcIP.To16())
+	copy(k.dst[:], ip.DstIP.To16())
+	if prev, ok := d.seen[k]; ok && ts.Sub(prev) <= d.Window {
+		d.Duplicates++
+		return true
+	}
+	d.seen[k] = ts
+	d.queue = append(d.queue, seenFrame{k, ts})
+	return false
+}
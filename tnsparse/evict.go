@@ -0,0 +1,188 @@
+package tnsparse
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EvictAfter - packets and cursor state of conversations idle that long are dropped, executions found
+// in them are kept for statistics (0 disables). Closed conversations are dropped after evictClosedAfter
+var EvictAfter time.Duration
+
+// LowMemory drops payload of each packet once it is decoded (-low-memory), only its size and ORA- error
+// are kept. Payloads are most of the memory taken by a capture, the rest are packets of long sessions,
+// so executions which ended are also folded out of live conversations at every eviction check
+var LowMemory bool
+
+// LowMemoryEvictAfter is EvictAfter of -low-memory if -evict is not given
+const LowMemoryEvictAfter = 15 * time.Minute
+
+// MaxConversations caps number of conversations which packets are kept, the least recently seen are dropped first (0 - unlimited)
+var MaxConversations int
+
+const (
+	evictClosedAfter = 10 * time.Second //Po FIN/RST moga jeszcze dojsc spoznione pakiety
+	evictEvery       = 10000            //Packets parsed between eviction checks
+)
+
+// EvictedConversation is what is left of a dropped conversation for statistics
+type EvictedConversation struct {
+	Conversation string
+	Bytes        uint64
+	Dropped      uint //Executions dropped because of negative RTT
+	Executions   []Execution
+}
+
+// MaxEvicted caps executions of evicted conversations kept for statistics, each conversation counts as one
+// more. Above it the earliest evicted conversations are dropped together with their Connections (0 - unlimited)
+var MaxEvicted = 2000000
+
+// EvictedDrops counts conversations and executions dropped because of MaxEvicted
+type EvictedDrops struct {
+	Sessions   int    `json:"sessions"`
+	Executions uint64 `json:"executions"`
+}
+
+// Evict drops state of conversations closed or idle at capture time now and, if there are still more
+// than MaxConversations, of the least recently seen ones. Connections are kept for session reports
+func (t *Parser) Evict(now time.Time) {
+	if EvictAfter == 0 && MaxConversations == 0 {
+		return
+	}
+	victims := make(map[string]bool)
+	var alive []string
+	for c := range t.Conversations {
+		conn, ok := t.Connections[c]
+		switch {
+		case !ok:
+			alive = append(alive, c)
+		case conn.ended && now.Sub(conn.LastSeen) >= evictClosedAfter:
+			victims[c] = true
+		case EvictAfter > 0 && now.Sub(conn.LastSeen) >= EvictAfter:
+			victims[c] = true
+		default:
+			alive = append(alive, c)
+		}
+	}
+	if MaxConversations > 0 && len(alive) > MaxConversations {
+		sort.Slice(alive, func(i, j int) bool { return t.lastSeen(alive[i]).Before(t.lastSeen(alive[j])) })
+		for _, c := range alive[:len(alive)-MaxConversations] {
+			victims[c] = true
+		}
+	}
+	if LowMemory {
+		for _, c := range alive {
+			if !victims[c] {
+				t.fold(c)
+			}
+		}
+	}
+	//Polaczenia bez danych (health checki, odrzucone) nie maja konwersacji - zamkniete tez ida do Evicted
+	for c, conn := range t.Connections {
+		if _, ok := t.Conversations[c]; !ok && !conn.evicted && !conn.Closed.IsZero() && now.Sub(conn.LastSeen) >= evictClosedAfter {
+			conn.evicted = true
+			t.addEvicted(EvictedConversation{Conversation: c})
+		}
+	}
+	if len(victims) == 0 {
+		return
+	}
+
+	for c := range victims {
+		for _, hook := range t.EvictionHooks {
+			hook(c)
+		}
+		ev := EvictedConversation{Conversation: c}
+		ev.Bytes, ev.Dropped = t.WalkConversation(c, func(e *Execution) { ev.Executions = append(ev.Executions, *e) })
+		t.refineMirrored(c, ev.Executions)
+		if t.Mirror != nil {
+			t.Mirror.forget(c)
+		}
+		if conn, ok := t.Connections[c]; ok {
+			conn.evicted = true
+		}
+		t.addEvicted(ev)
+		delete(t.Conversations, c)
+		delete(t.sqlTxtFlow, c)
+		delete(t.profiles, c)
+		delete(t.mysql, c)
+		delete(t.postgres, c)
+		delete(t.tds, c)
+		delete(t.started, c+"|true")
+		delete(t.started, c+"|false")
+	}
+	for k := range t.SQLslot {
+		if i := strings.LastIndex(k, "_"); i > 0 && victims[k[:i]] {
+			delete(t.SQLslot, k)
+		}
+	}
+	log.Println("Evicted conversations:", len(victims), "kept:", len(t.Conversations))
+}
+
+// fold moves executions which already ended in live conversation c to Evicted and drops their packets.
+// Packets from the one after the last ended flow are kept, so RTT of the next response is already known
+func (t *Parser) fold(c string) {
+	packets := t.Conversations[c]
+	ev := EvictedConversation{Conversation: c}
+	_, dropped, end := t.walkPackets(c, packets, func(e *Execution) { ev.Executions = append(ev.Executions, *e) })
+	if end == 0 || end >= len(packets) {
+		return
+	}
+	for _, hook := range t.EvictionHooks {
+		hook(c)
+	}
+	for _, p := range packets[:end] {
+		ev.Bytes += uint64(p.Size)
+	}
+	ev.Dropped = dropped
+	t.refineMirrored(c, ev.Executions)
+	t.addEvicted(ev)
+	//Kopia, zeby stara tablica pakietow mogla byc zwolniona
+	t.Conversations[c] = append([]SQLtcp(nil), packets[end:]...)
+	if conn, ok := t.Connections[c]; ok {
+		conn.folded = true
+	}
+}
+
+// addEvicted keeps evicted conversation for statistics and drops the earliest ones above MaxEvicted
+func (t *Parser) addEvicted(ev EvictedConversation) {
+	t.Evicted = append(t.Evicted, ev)
+	t.evictedSize += len(ev.Executions) + 1
+	drop := 0
+	for MaxEvicted > 0 && t.evictedSize > MaxEvicted && drop < len(t.Evicted)-1 {
+		old := &t.Evicted[drop]
+		t.evictedSize -= len(old.Executions) + 1
+		if len(old.Executions) > 0 || old.Bytes > 0 {
+			t.EvictedDropped.Sessions++
+			t.EvictedDropped.Executions += uint64(len(old.Executions))
+		}
+		//Port klienta mogl zostac uzyty ponownie przez zywa konwersacje
+		if conn, ok := t.Connections[old.Conversation]; ok && conn.evicted {
+			if _, live := t.Conversations[old.Conversation]; !live {
+				delete(t.Connections, old.Conversation)
+			}
+		}
+		drop++
+	}
+	if drop > 0 {
+		t.Evicted = append([]EvictedConversation(nil), t.Evicted[drop:]...)
+	}
+}
+
+// EvictedDroppedJSON returns EvictedDropped for Analysis, nil if nothing was dropped
+func (t *Parser) EvictedDroppedJSON() *EvictedDrops {
+	if t.EvictedDropped.Sessions == 0 {
+		return nil
+	}
+	d := t.EvictedDropped
+	return &d
+}
+
+func (t *Parser) lastSeen(conversationId string) time.Time {
+	if c, ok := t.Connections[conversationId]; ok {
+		return c.LastSeen
+	}
+	return time.Time{}
+}
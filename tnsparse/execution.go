@@ -0,0 +1,232 @@
+package tnsparse
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Execution is a single SQL execution found in a conversation - from request till the end of flow
+type Execution struct {
+	Start        time.Time
+	SQLid        string
+	SQLtxt       string
+	Conversation string
+	AppNs        int64 //Wallclock time from app perspective
+	NetNs        int64 //Time spent in round trips
+	Packets      uint
+	Bytes        uint64
+	Reused       uint   //1 if executed with reused cursor
+	Error        string //ORA- error returned in this flow (other than ORA-01403)
+	Waits        WaitTimes
+	Timing       string    //Capture timestamp issue affecting this execution, see TimingClockStep
+	Rows         uint64    //Rows affected by DML or fetched by query
+	RoundTrips   uint      //Request -> response round trips, the first one and each fetch
+	FirstNs      int64     //From request till the first response, the rest of AppNs is streaming of the result
+	First, Last  int       //Index of the first and the last packet of the execution in its conversation
+	Metrics      []float64 //Values of CustomMetrics summed over packets of the execution
+	HopNs        int64     //App time added between the legs of a session captured twice (-mirror), 0 if unknown
+}
+
+// StreamNs returns time spent in fetch round trips after the first response
+func (e *Execution) StreamNs() int64 {
+	return e.AppNs - e.FirstNs
+}
+
+var rOraError = regexp.MustCompile(`ORA-(\d{5})`)
+
+// OraError returns ORA- error code found in payload, ORA-01403 (no data found) is not an error
+func OraError(payload []byte) string {
+	if !bytes.Contains(payload, []byte("ORA-")) {
+		return ""
+	}
+	for _, m := range rOraError.FindAllSubmatch(payload, -1) {
+		if string(m[1]) != "01403" {
+			return "ORA-" + string(m[1])
+		}
+	}
+	return ""
+}
+
+// IsDML tells if statement modifies rows, its RetStatus row count is then number of rows affected
+func IsDML(sqlTxt string) bool {
+	s := strings.ToUpper(strings.TrimSpace(sqlTxt))
+	return strings.HasPrefix(s, "UPDATE") || strings.HasPrefix(s, "DELETE") ||
+		strings.HasPrefix(s, "INSERT") || strings.HasPrefix(s, "MERGE")
+}
+
+// IsQuery tells if statement returns rows, its row count at the end of fetch is then number of rows fetched
+func IsQuery(sqlTxt string) bool {
+	s := strings.ToUpper(strings.TrimSpace(sqlTxt))
+	return strings.HasPrefix(s, "SELECT") || strings.HasPrefix(s, "WITH")
+}
+
+// reportError passes a problem found while parsing or walking conversations to ErrorHooks
+func (t *Parser) reportError(err error) {
+	log.Println(err)
+	t.errorMu.Lock()
+	defer t.errorMu.Unlock()
+	for _, hook := range t.ErrorHooks {
+		hook(err)
+	}
+}
+
+// WalkConversation finds executions in packets of conversation c, calls emit for each of them
+// and returns number of TNS bytes of the conversation and number of executions dropped because of negative RTT
+func (t *Parser) WalkConversation(c string, emit func(e *Execution)) (uint64, uint) {
+	bytes, dropped, _ := t.walkPackets(c, t.Conversations[c], emit)
+	return bytes, dropped
+}
+
+// walkPackets finds executions in packets of conversation c like WalkConversation, it returns also
+// index of the packet after the last flow which ended (counted or dropped), 0 if none did
+func (t *Parser) walkPackets(c string, packets []SQLtcp, emit func(e *Execution)) (uint64, uint, int) {
+	log.Println(c)
+	//sort.Sort(SQLtcpSort(Conversations[c]))
+	var tB, tE, tPrev, tFirstResp time.Time
+	var sqlDuration, packetDuration time.Duration
+	sqlTxt := "+"
+	sqlId := "+"
+	pcktCnt := uint(0)
+	RTT := int64(0)
+	reusedCursors := uint(0)
+	convBytes := uint64(0)
+	flowBytes := uint64(0)
+	flowErr := ""
+	flowRows := uint64(0)
+	roundTrips := uint(0)
+	var flowMetrics []float64
+	var waits WaitTimes
+	var prev *SQLtcp //previous packet of the measured flow
+	firstFlow := true
+	if conn, ok := t.Connections[c]; ok && conn.folded {
+		firstFlow = false //Logowanie bylo w pakietach juz zwinietych przez -low-memory
+	}
+	flowStart := 0
+	dropped := uint(0)
+	flowEnd := FlowEndMarker
+	end := 0
+
+	//Dla kazdej konwersjacji jade po wszystkich jej pakietach
+	for i := range packets {
+		p := packets[i]
+		if prev != nil {
+			waits[WaitClass(prev, &p, sqlId != "+", firstFlow)] += float64(p.Timestamp.Sub(prev.Timestamp).Nanoseconds()) / 1000000
+		}
+		prev = &packets[i]
+		if tPrev.IsZero() { //Dla pierwszego pakietu timestamp zapamietuje
+			tPrev = p.Timestamp
+			flowStart = i
+			packetDuration = p.Timestamp.Sub(tPrev) //Tu bedzie oczywiscie 0, ale milo to wyswietlic w logach
+		} else {
+			packetDuration = p.Timestamp.Sub(tPrev) //A tu sie caly czas od obecnego czasu ten pierwszy odejmuje
+		}
+		pcktCnt += 1 //Licze pakiety sobie, licze
+		convBytes += uint64(p.Size)
+		flowBytes += uint64(p.Size)
+		flowMetrics = addMetrics(flowMetrics, &p)
+		if p.OraErr != "" && sqlId != "+" {
+			flowErr = p.OraErr
+		}
+		if p.Rows > 0 && sqlId != "+" && (IsDML(sqlTxt) || IsQuery(sqlTxt)) {
+			flowRows = uint64(p.Rows) //Licznik wierszy w RetStatus i na koncu fetcha jest narastajacy dla wywolania
+		}
+		if p.Response && sqlId != "+" && i > flowStart && !packets[i-1].Response {
+			roundTrips++
+		}
+		if p.Response && sqlId != "+" && tFirstResp.IsZero() {
+			tFirstResp = p.Timestamp //Dalej juz tylko kolejne fetche - strumieniowanie wyniku
+		}
+
+		//No jesli to nie jest bylejaki pakiet, to ma tresc zapytania, a wtedy to poczatek jest flow
+		//To mozna ustalic kiedy sie to zaczelo i jaka tresc zapytania przyjac i sqlid itp
+		if p.SQL != "_" && p.SQL != "SQL_END" {
+			tB = p.Timestamp
+			sqlTxt = p.SQL
+			sqlId = p.SQL_id
+			reusedCursors += p.IsReused
+			flowEnd = FlowEndOf(sqlTxt) //Zdarzenie konczace wykonanie wg -flow-rules
+		} else if sqlId != "+" { //count RTT minus first packet from first response => avoid counting DB Time from first SQL execution
+			RTT += p.RTT //RTT to ja dodaje, zeby czas sieciowy ogarnac.
+			//Bo pierwszy pakiet z poczatku flow pomijam calkiem - zeby nie liczyc czasu na DBTime poswieconego
+			//No i pominac trzeba wszelkie niezdefiniowane sqlid, bo to sa pakiety nieobslugiwane
+		}
+		shortSQL := string(sqlTxt[0])
+		if len(sqlTxt) > 5 {
+			shortSQL = string(sqlTxt[0:5])
+		}
+		log.Println(sqlId, p.Seq, p.Ack, p.RTT, RTT, p.Timestamp, shortSQL, "...")
+
+		//A to wszystko znaczy, ze to koniec FLOW
+		//Bo dla SELECT to bedzie oczywiscie SQL_END jako flaga, a dla DML to juz po prostu kolejny pakiet
+		//Wiec dla ustalonego SQLID, jesli mamy znacznik konca, lub tresc zapytania jest ustalona we flow
+		//i jest to kolejny pakiet po prostu, ale tresc zapytania to nie SELECT lub WITH
+		//bo w tych flow jest dlugi i musze miec znacznik konca (SQL_END) to wtedy ogarniaj statystyki
+		//Te reguly sa wbudowanymi FlowRules, -flow-rules pozwala je zmienic dla innych typow polecen
+		if sqlId != "+" && flowEnded(flowEnd, &p) {
+			tE = p.Timestamp
+			//sqlDuration = tE.Sub(tB)
+			sqlDuration = packetDuration //Valid SQL duration from app perspective (wallclock)
+			log.Println("\tsummary: ", sqlDuration.Nanoseconds(), tE.Sub(tB).Nanoseconds(), tB, tE, RTT, sqlId)
+
+			//Bo tu dopiero uzupelniam statsy, jesli RTT policzone zostalo - znaczy jesli zliczanie przebieglo dobrze
+			if RTT >= 0 { // Checking if RTT is calculated properly
+				waits.Cancelled(flowErr)
+				firstNs := sqlDuration.Nanoseconds()
+				if !tFirstResp.IsZero() {
+					firstNs = tFirstResp.Sub(tPrev).Nanoseconds()
+				}
+				timing := t.timingIssue(packets[flowStart:i+1], sqlDuration.Nanoseconds())
+				emit(&Execution{
+					Start:        tB,
+					SQLid:        sqlId,
+					SQLtxt:       sqlTxt,
+					Conversation: c,
+					AppNs:        sqlDuration.Nanoseconds(),
+					NetNs:        RTT,
+					Packets:      pcktCnt,
+					Bytes:        flowBytes,
+					Reused:       reusedCursors,
+					Error:        flowErr,
+					Waits:        waits,
+					Timing:       timing,
+					Rows:         flowRows,
+					RoundTrips:   roundTrips,
+					Metrics:      flowMetrics,
+					FirstNs:      firstNs,
+					First:        flowStart,
+					Last:         i,
+				})
+			} else {
+				//Zegar i kolejnosc pakietow sa juz poprawione w parserze, wiec to cos innego - glosno o tym krzycze
+				dropped++
+				t.reportError(fmt.Errorf("negative RTT %d ns of %s in %s after timestamp corrections, execution dropped", RTT, sqlId, c))
+			}
+			//No i na koniec takiego podliczenia statsow to to wszystko sobie ladnie zeruje.
+			//To dzialac ma prawo tylko, jesli pakiety sa w dobrej kolejnosci,
+			//jesli natomiast by SEQ i ACK kompletnie sie nie zgadzaly w kolejnosci to dupa
+			sqlTxt = "+"
+			sqlId = "+"
+			pcktCnt = 0
+			RTT = 0
+			tPrev = time.Time{}
+			tFirstResp = time.Time{}
+			tB = time.Time{}
+			tE = time.Time{}
+			reusedCursors = 0
+			flowBytes = 0
+			flowErr = ""
+			flowRows = 0
+			roundTrips = 0
+			flowMetrics = nil
+			waits = WaitTimes{}
+			prev = nil
+			firstFlow = false
+			end = i + 1
+		}
+	}
+	return convBytes, dropped, end
+}
@@ -0,0 +1,138 @@
+package tnsparse
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Events ending an execution. A conversation is idle until a packet with SQL starts an execution, which lasts
+// until the end event of the first flow rule matching its SQL text, then the conversation is idle again.
+// SQL_END set by the parser (end of fetch, ReadyForQuery, the last response of MySQL and SQL Server) ends
+// any execution
+const (
+	FlowEndMarker   = "marker"   //only SQL_END
+	FlowEndPacket   = "packet"   //the first packet without SQL after the request, i.e. TTC response of DML
+	FlowEndResponse = "response" //the first response packet without SQL, later requests without SQL don't end it
+)
+
+// FlowRule picks end event of executions which SQL text matches Pattern
+type FlowRule struct {
+	Name    string
+	End     string
+	Pattern *regexp.Regexp
+	builtin bool
+}
+
+// builtinFlowRules are in the same format as -flow-rules file. TTC responses of DML have no end marker,
+// so for Oracle only queries wait for the end of fetch. Other protocols mark the end of every execution,
+// built-in rules don't apply to them
+const builtinFlowRules = `
+query    marker   (?i)^[sw]
+other    packet   (?s)^..
+`
+
+// FlowRules are checked in order, the first one matching SQL text of an execution gives its end event.
+// Without a matching rule the execution ends with SQL_END
+var FlowRules []*FlowRule
+
+func init() {
+	if err := parseFlowRules(builtinFlowRules, "built-in flow rules", true); err != nil {
+		panic(err)
+	}
+}
+
+// LoadFlowRules reads flow rules file with lines "name marker|packet|response|off regexp", # starts a comment.
+// Rules of the file are checked before the built-in ones, a rule named as a built-in one replaces it in place
+// (off drops it)
+func LoadFlowRules(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return parseFlowRules(string(b), file, false)
+}
+
+func parseFlowRules(text string, source string, builtin bool) error {
+	var added []*FlowRule
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected \"name marker|packet|response|off regexp\"", source, lineNo)
+		}
+		end := fields[1]
+		if end != FlowEndMarker && end != FlowEndPacket && end != FlowEndResponse && end != "off" {
+			return fmt.Errorf("%s:%d: unknown end %q, expected marker|packet|response|off", source, lineNo, end)
+		}
+		//Wyrazenie to reszta linii za polem end, moze zawierac spacje - pola zjadane po kolei, bo nazwa moze zawierac end
+		pattern := line
+		for _, f := range fields[:2] {
+			pattern = strings.TrimSpace(pattern[strings.Index(pattern, f)+len(f):])
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", source, lineNo, err)
+		}
+		r := &FlowRule{Name: fields[0], End: end, Pattern: re, builtin: builtin}
+		if !replaceFlowRule(r) {
+			added = append(added, r)
+		}
+	}
+	if builtin {
+		FlowRules = append(FlowRules, added...)
+	} else {
+		FlowRules = append(added, FlowRules...)
+	}
+	return scanner.Err()
+}
+
+// replaceFlowRule replaces rule of the same name, false if there is none
+func replaceFlowRule(r *FlowRule) bool {
+	for i, old := range FlowRules {
+		if old.Name != r.Name {
+			continue
+		}
+		if r.End == "off" {
+			FlowRules = append(FlowRules[:i:i], FlowRules[i+1:]...)
+		} else {
+			FlowRules[i] = r
+		}
+		return true
+	}
+	return false
+}
+
+// FlowEndOf returns end event of execution of sqlTxt
+func FlowEndOf(sqlTxt string) string {
+	for _, r := range FlowRules {
+		if r.builtin && endMarked() {
+			continue
+		}
+		if r.End != "off" && r.Pattern.MatchString(sqlTxt) {
+			return r.End
+		}
+	}
+	return FlowEndMarker
+}
+
+// flowEnded tells if packet p ends execution waiting for event end
+func flowEnded(end string, p *SQLtcp) bool {
+	switch {
+	case p.SQL == "SQL_END":
+		return true
+	case p.SQL != "_":
+		return false
+	case end == FlowEndPacket:
+		return true
+	case end == FlowEndResponse:
+		return p.Response
+	}
+	return false
+}
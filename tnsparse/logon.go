@@ -0,0 +1,148 @@
+package tnsparse
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rSessionSetup matches statements issued by drivers while setting up a session, they are part of logon
+var rSessionSetup = regexp.MustCompile(`(?i)^\s*(alter[\s_]+session|begin\s+dbms_application_info|commit)`)
+
+// rCompression matches SQL*Net data compression requested in CONNECT descriptor, i.e. (COMPRESSION=on)
+var rCompression = regexp.MustCompile(`(?i)\(COMPRESSION\s*=\s*(on|yes|true)\)`)
+
+var (
+	rConnectService = regexp.MustCompile(`(?i)\((?:SERVICE_NAME|SID)\s*=\s*([^)]*)\)`)
+	rConnectProgram = regexp.MustCompile(`(?i)\(PROGRAM\s*=\s*([^)]*)\)`)
+	rRefuseError    = regexp.MustCompile(`(?i)\((?:ERR|CODE)\s*=\s*(\d+)\)`)
+	rTokenAuth      = regexp.MustCompile(`(?i)\(TOKEN_AUTH\s*=\s*[^)]+\)`)
+)
+
+var (
+	anoMagic   = []byte{0xde, 0xad, 0xbe, 0xef} //Advanced Networking Option negotiation - Kerberos and RADIUS authenticate in it
+	authPrefix = []byte("AUTH_")                //O5LOGON keys i.e. AUTH_SESSKEY, also sent after external authentication
+)
+
+const (
+	tlsHandshake    = byte(0x16) //TLS record type
+	tlsChangeCipher = byte(0x14)
+	tlsClientHello  = byte(0x01)
+)
+
+// TrackConnect follows TNS connect phase of a session: CONNECT from client, RESEND and REFUSE from listener.
+// After RESEND the client sends CONNECT again, so its descriptor is parsed again and the first CONNECT is kept as logon start
+func (t *Parser) TrackConnect(conversationId string, payload []byte, toDB bool, ts time.Time) {
+	c, ok := t.Connections[conversationId]
+	if !ok {
+		return
+	}
+	switch {
+	case payload[4] == tnsPacketConnect && toDB:
+		t.MarkConnect(conversationId, ts)
+		if m := rConnectService.FindSubmatch(payload); m != nil {
+			c.Service = string(m[1])
+		}
+		if m := rConnectProgram.FindSubmatch(payload); m != nil {
+			c.Program = strings.TrimSpace(string(m[1]))
+		}
+		if rCompression.Match(payload) {
+			c.Compressed = true
+		}
+		if rTokenAuth.Match(payload) {
+			c.AuthMethod = "token" //IAM/Entra ID token niesiony w deskryptorze
+		}
+	case payload[4] == tnsPacketAccept && !toDB:
+		if c.Accept.IsZero() {
+			c.Accept = ts
+		}
+	case payload[4] == tnsPacketResend && !toDB:
+		c.Resends++
+	case payload[4] == tnsPacketRefuse && !toDB:
+		//REFUSE niesie opis bledu w stylu (DESCRIPTION=(ERR=12514)(ERROR_STACK=...))
+		c.Refused = "ORA-?"
+		if m := rRefuseError.FindSubmatch(payload); m != nil {
+			if code, err := strconv.Atoi(string(m[1])); err == nil {
+				c.Refused = fmt.Sprintf("ORA-%05d", code)
+			}
+		}
+		c.RefusedAt = ts
+	}
+}
+
+// TrackAuth times authentication exchange of logon: TLS handshake of TCPS, ANO negotiation of Kerberos
+// and RADIUS, and AUTH_ keys of O5LOGON, which follow external authentication too
+func (t *Parser) TrackAuth(conversationId string, payload []byte, toDB bool, ts time.Time) {
+	c, ok := t.Connections[conversationId]
+	if !ok || len(payload) < 6 || !c.FirstSQL.IsZero() {
+		return
+	}
+	method := ""
+	switch {
+	case (payload[0] == tlsHandshake || payload[0] == tlsChangeCipher) && payload[1] == 3:
+		if payload[0] == tlsHandshake && payload[5] == tlsClientHello && toDB {
+			//Przy TCPS CONNECT jest juz zaszyfrowany, wiec logon zaczyna sie od ClientHello
+			t.MarkConnect(conversationId, ts)
+		}
+		method = "tcps"
+	case payload[4] != tnsPacketData:
+		return
+	case bytes.Contains(payload, anoMagic):
+		switch {
+		case bytes.Contains(payload, []byte("KERBEROS5")):
+			method = "kerberos"
+		case bytes.Contains(payload, []byte("RADIUS")):
+			method = "radius"
+		}
+		if method == "" && c.AuthStart.IsZero() {
+			return //Negocjacja samego szyfrowania/checksum, bez uwierzytelnienia
+		}
+	case bytes.Contains(payload, authPrefix):
+		method = "password"
+	default:
+		return
+	}
+	if c.AuthMethod == "" || (c.AuthMethod == "password" && method != "password") {
+		c.AuthMethod = method
+	}
+	if c.AuthStart.IsZero() {
+		c.AuthStart = ts
+	}
+	c.AuthEnd = ts
+}
+
+// MarkConnect remembers the first TNS CONNECT of a session
+func (t *Parser) MarkConnect(conversationId string, ts time.Time) {
+	if c, ok := t.Connections[conversationId]; ok && c.Connect.IsZero() {
+		c.Connect = ts
+	}
+}
+
+// MarkFirstSQL remembers when a session sent its first application SQL
+func (t *Parser) MarkFirstSQL(conversationId string, sqlTxt string, ts time.Time) {
+	if rSessionSetup.MatchString(sqlTxt) {
+		return
+	}
+	if c, ok := t.Connections[conversationId]; ok && c.FirstSQL.IsZero() {
+		c.FirstSQL = ts
+	}
+}
+
+// Logon returns time from TNS CONNECT till first application SQL (accept, auth and session setup round trips)
+func (c *ConnStats) Logon() (time.Duration, bool) {
+	if c.Connect.IsZero() || c.FirstSQL.IsZero() {
+		return 0, false
+	}
+	return c.FirstSQL.Sub(c.Connect), true
+}
+
+// Auth returns duration of authentication exchange
+func (c *ConnStats) Auth() (time.Duration, bool) {
+	if c.AuthStart.IsZero() {
+		return 0, false
+	}
+	return c.AuthEnd.Sub(c.AuthStart), true
+}
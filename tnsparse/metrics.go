@@ -0,0 +1,101 @@
+package tnsparse
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// CustomMetric is a per-execution metric added by the user: Packet returns value of a single packet while
+// its payload is still there and the execution value is the sum over its packets. Values are summed per
+// sqlid, are in "metrics" of JSON rows (so rules can use metrics.<name>), in the report and in -csv
+type CustomMetric struct {
+	Name        string
+	Description string
+	Packet      func(p *SQLtcp) float64
+}
+
+// CustomMetrics are registered with RegisterMetric or loaded with -metrics, in order of registration
+var CustomMetrics []*CustomMetric
+
+// RegisterMetric adds a custom metric, it has to be called before packets are parsed
+func RegisterMetric(name, description string, packet func(p *SQLtcp) float64) error {
+	for _, m := range CustomMetrics {
+		if m.Name == name {
+			return fmt.Errorf("metric %s is already registered", name)
+		}
+	}
+	CustomMetrics = append(CustomMetrics, &CustomMetric{Name: name, Description: description, Packet: packet})
+	return nil
+}
+
+// LoadMetrics reads metrics file with lines "name request|response|any regexp" - each metric counts
+// matches of regexp in payloads sent in that direction, # starts a comment
+func LoadMetrics(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(b)))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected \"name request|response|any regexp\"", file, lineNo)
+		}
+		dir := fields[1]
+		if dir != "request" && dir != "response" && dir != "any" {
+			return fmt.Errorf("%s:%d: unknown direction %q, expected request|response|any", file, lineNo, dir)
+		}
+		//Wyrazenie to reszta linii, moze zawierac spacje
+		pattern := strings.TrimSpace(line[strings.Index(line, dir)+len(dir):])
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", file, lineNo, err)
+		}
+		if err := RegisterMetric(fields[0], dir+" "+pattern, patternMetric(re, dir)); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// patternMetric counts matches of re in payloads sent in dir
+func patternMetric(re *regexp.Regexp, dir string) func(p *SQLtcp) float64 {
+	return func(p *SQLtcp) float64 {
+		if (dir == "request" && p.Response) || (dir == "response" && !p.Response) {
+			return 0
+		}
+		return float64(len(re.FindAllIndex(p.Payload, -1)))
+	}
+}
+
+// measurePacket fills custom metrics of packet, before -low-memory drops its payload
+func measurePacket(p *SQLtcp) {
+	if len(CustomMetrics) == 0 {
+		return
+	}
+	p.Metrics = make([]float64, len(CustomMetrics))
+	for i, m := range CustomMetrics {
+		p.Metrics[i] = m.Packet(p)
+	}
+}
+
+// addMetrics sums custom metrics of packet into values of its execution
+func addMetrics(values []float64, p *SQLtcp) []float64 {
+	if p.Metrics == nil {
+		return values
+	}
+	if values == nil {
+		values = make([]float64, len(CustomMetrics))
+	}
+	for i, v := range p.Metrics {
+		values[i] += v
+	}
+	return values
+}
@@ -0,0 +1,134 @@
+package tnsparse
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// mirrorRequests is number of the first requests with SQL compared to find the other leg of a session
+const mirrorRequests = 3
+
+type mirrorPrint struct {
+	hash     uint64
+	requests []time.Time //Timestamps of the first requests with SQL
+}
+
+// MirrorDetector finds the second leg of a session while packets are parsed: both legs carry the same
+// requests, the server side one delayed by the hop between them. Legs seen twice by an inline tap
+// (client->proxy and proxy->database, or before and after NAT) are paired in Parser.MirrorLegs: the client
+// side leg is analyzed, the server side leg only refines its network time and is left out of statistics
+type MirrorDetector struct {
+	Window  time.Duration //The second leg carries its requests at most that much later (-mirror)
+	prints  map[string]*mirrorPrint
+	byPrint map[uint64][]string //Unpaired conversations with all mirrorRequests seen, by hash of them
+}
+
+func NewMirrorDetector(window time.Duration) *MirrorDetector {
+	return &MirrorDetector{Window: window, prints: make(map[string]*mirrorPrint), byPrint: make(map[uint64][]string)}
+}
+
+// observeMirror adds request of conversation to its fingerprint and pairs the conversation with its other leg
+// once mirrorRequests were seen
+func (t *Parser) observeMirror(conversationId string, p *SQLtcp) {
+	m := t.Mirror
+	if p.Response || p.SQL == "_" || p.SQL == "SQL_END" || t.MirrorLegs[conversationId] != "" || t.MirroredLegs[conversationId] != "" {
+		return
+	}
+	fp, ok := m.prints[conversationId]
+	if !ok {
+		fp = &mirrorPrint{}
+		m.prints[conversationId] = fp
+	}
+	if len(fp.requests) == mirrorRequests {
+		return
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%s|", fp.hash, p.SQL_id)
+	h.Write(p.Payload) //Binds roznia sesje puli wykonujace te same polecenia
+	fp.hash = h.Sum64()
+	fp.requests = append(fp.requests, p.Timestamp)
+	if len(fp.requests) < mirrorRequests {
+		return
+	}
+
+	candidates := m.byPrint[fp.hash]
+	for i, other := range candidates {
+		client, server, ok := m.legs(other, conversationId)
+		if !ok {
+			continue
+		}
+		t.MirrorLegs[client], t.MirroredLegs[server] = server, client
+		delete(m.prints, client)
+		delete(m.prints, server)
+		m.byPrint[fp.hash] = append(candidates[:i:i], candidates[i+1:]...)
+		return
+	}
+	m.byPrint[fp.hash] = append(candidates, conversationId)
+}
+
+// legs tells which of two conversations with the same requests is the client side leg. They are legs of one
+// session if each request reached the second one later by at most Window and their endpoints differ - sessions
+// of a pool opened at once by the same client run the same statements too
+func (m *MirrorDetector) legs(a, b string) (client, server string, ok bool) {
+	if ClientIP(a) == ClientIP(b) && DBLabelOf(a) == DBLabelOf(b) {
+		return "", "", false
+	}
+	pa, pb := m.prints[a], m.prints[b]
+	if pa.requests[0].After(pb.requests[0]) {
+		a, b, pa, pb = b, a, pb, pa
+	}
+	for i := range pa.requests {
+		if d := pb.requests[i].Sub(pa.requests[i]); d < 0 || d > m.Window {
+			return "", "", false
+		}
+	}
+	return a, b, true
+}
+
+// forget drops fingerprint of evicted conversation, its pairing is kept for statistics
+func (m *MirrorDetector) forget(conversationId string) {
+	fp, ok := m.prints[conversationId]
+	if !ok {
+		return
+	}
+	delete(m.prints, conversationId)
+	candidates := m.byPrint[fp.hash]
+	for i, c := range candidates {
+		if c == conversationId {
+			m.byPrint[fp.hash] = append(candidates[:i:i], candidates[i+1:]...)
+			break
+		}
+	}
+	if len(m.byPrint[fp.hash]) == 0 {
+		delete(m.byPrint, fp.hash)
+	}
+}
+
+// refineMirrored corrects network time of executions of client side leg c with its server side leg: app
+// time stays as the client saw it, database time is taken from the leg closer to the database, the rest
+// (network on both hops and the proxy) is network time. Executions are matched in order by sqlid
+func (t *Parser) refineMirrored(c string, executions []Execution) {
+	server, ok := t.MirrorLegs[c]
+	if !ok || len(executions) == 0 {
+		return
+	}
+	var legExecs []Execution
+	t.WalkConversation(server, func(e *Execution) { legExecs = append(legExecs, *e) })
+	j := 0
+	for i := range executions {
+		e := &executions[i]
+		for k := j; k < len(legExecs); k++ {
+			s := &legExecs[k]
+			if d := s.Start.Sub(e.Start); s.SQLid != e.SQLid || d < 0 || d > t.Mirror.Window {
+				continue
+			}
+			if hop := e.AppNs - s.AppNs; hop >= 0 {
+				e.NetNs = s.NetNs + hop
+				e.HopNs = hop
+			}
+			j = k + 1
+			break
+		}
+	}
+}
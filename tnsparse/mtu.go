@@ -0,0 +1,57 @@
+package tnsparse
+
+import (
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// TrackFragment counts IP fragments and ICMP fragmentation needed messages exchanged with the database
+func (t *Parser) TrackFragment(ipv4 *layers.IPv4, icmp *layers.ICMPv4, dbIP string, peerIP string) {
+	pair := dbIP + "<->" + peerIP
+	if ipv4.FragOffset > 0 {
+		t.FragmentsByPeer[pair]++
+	}
+	if icmp != nil && icmp.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded) {
+		t.FragNeeded[pair] = icmp.Seq //Next-hop MTU jest w miejscu numeru sekwencji
+	}
+}
+
+// trackSegment remembers MSS from SYN options, the biggest segment and IP fragments of conversation
+func trackSegment(c *ConnStats, tcp *layers.TCP, fromDB bool, fragment bool) {
+	dir := 0
+	if fromDB {
+		dir = 1
+	}
+	if tcp.SYN {
+		for _, opt := range tcp.Options {
+			if opt.OptionType == layers.TCPOptionKindMSS && len(opt.OptionData) == 2 {
+				c.MSS[dir] = uint16(opt.OptionData[0])<<8 | uint16(opt.OptionData[1])
+			}
+		}
+	}
+	if len(tcp.Payload) > c.MaxSegment[dir] {
+		c.MaxSegment[dir] = len(tcp.Payload)
+	}
+	if fragment {
+		c.Fragments++
+	}
+}
+
+// parseFragment handles IPv4 packets without TCP layer - non-first fragments and ICMP
+func (t *Parser) parseFragment(ipv4 *layers.IPv4, packet gopacket.Packet) {
+	var icmp *layers.ICMPv4
+	if l := packet.Layer(layers.LayerTypeICMPv4); l != nil {
+		icmp = l.(*layers.ICMPv4)
+	}
+	for _, checkIP := range t.DBIPs {
+		if strings.Contains(ipv4.SrcIP.String(), strings.TrimSpace(checkIP)) {
+			t.TrackFragment(ipv4, icmp, ipv4.SrcIP.String(), ipv4.DstIP.String())
+			return
+		} else if strings.Contains(ipv4.DstIP.String(), strings.TrimSpace(checkIP)) {
+			t.TrackFragment(ipv4, icmp, ipv4.DstIP.String(), ipv4.SrcIP.String())
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package tnsparse
+
+import (
+	"encoding/binary"
+	"log"
+	"strconv"
+)
+
+// MySQL client/server protocol: every packet has 3 bytes of length (little endian) and sequence id
+const (
+	mysqlHeaderLen = 4
+
+	mysqlComQuery       = byte(0x03)
+	mysqlComStmtPrepare = byte(0x16)
+	mysqlComStmtExecute = byte(0x17)
+	mysqlComStmtClose   = byte(0x19)
+
+	mysqlOK     = byte(0x00)
+	mysqlEOF    = byte(0xfe)
+	mysqlErr    = byte(0xff)
+	mysqlInfile = byte(0xfb)
+
+	mysqlClientSSL          = uint32(0x00000800)
+	mysqlClientDeprecateEOF = uint32(0x01000000)
+	mysqlClientQueryAttrs   = uint32(0x08000000)
+	mysqlServerMoreResults  = uint16(0x0008)
+
+	mysqlMaxEOFLen    = 9        //Shorter 0xfe packets are EOF, longer ones are rows starting with 8-byte length
+	mysqlMaxOKEOFLen  = 0xffffff //With CLIENT_DEPRECATE_EOF result sets end with OK packet with 0xfe header
+	mysqlPrepareOKLen = 12       //0x00, statement id (4), columns (2), params (2), filler, warnings (2)
+)
+
+// Phases of a response the parser waits for in a MySQL conversation
+const (
+	mysqlIdle       = iota
+	mysqlFirst      //OK, ERR or column count of result set
+	mysqlColumns    //column definitions
+	mysqlColumnsEOF //EOF after column definitions (without CLIENT_DEPRECATE_EOF)
+	mysqlRows       //rows until EOF/OK
+	mysqlPrepared   //COM_STMT_PREPARE_OK or ERR
+	mysqlSkip       //parameter and column definitions of prepared statement
+)
+
+// mysqlConn is state of a MySQL conversation: prepared statements by id (like cursor slots of TTC)
+// and phase of the response being read
+type mysqlConn struct {
+	stmts        map[uint32]string
+	preparing    string //SQL of COM_STMT_PREPARE waiting for its statement id
+	phase        int
+	left         int //column definitions (or definitions to skip) left
+	rows         uint32
+	commands     bool //a command was seen, so sequence id 1 is no more the handshake response
+	deprecateEOF bool
+	queryAttrs   bool
+	tls          bool
+}
+
+func (t *Parser) mysqlConn(conversationId string) *mysqlConn {
+	c, ok := t.mysql[conversationId]
+	if !ok {
+		c = &mysqlConn{stmts: make(map[uint32]string)}
+		t.mysql[conversationId] = c
+	}
+	return c
+}
+
+// mysqlPacketsLen returns length of complete MySQL packets at the beginning of b. Packets which arrived
+// together are parsed as one, so result sets aren't kept row by row
+func mysqlPacketsLen(b []byte) int {
+	n := 0
+	for len(b)-n >= mysqlHeaderLen {
+		size := mysqlHeaderLen + int(uint32(b[n])|uint32(b[n+1])<<8|uint32(b[n+2])<<16)
+		if size > len(b)-n {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// mysqlLenEnc decodes length encoded integer, it returns its value and size, 0 if b is too short
+func mysqlLenEnc(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch b[0] {
+	case 0xfc:
+		if len(b) >= 3 {
+			return uint64(binary.LittleEndian.Uint16(b[1:3])), 3
+		}
+	case 0xfd:
+		if len(b) >= 4 {
+			return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+		}
+	case 0xfe:
+		if len(b) >= 9 {
+			return binary.LittleEndian.Uint64(b[1:9]), 9
+		}
+	default:
+		return uint64(b[0]), 1
+	}
+	return 0, 0
+}
+
+// mysqlStatus returns rows affected and status flags of OK packet (or EOF packet if eof is set)
+func mysqlStatus(body []byte, eof bool) (uint64, uint16) {
+	if eof {
+		if len(body) >= 5 {
+			return 0, binary.LittleEndian.Uint16(body[3:5])
+		}
+		return 0, 0
+	}
+	affected, n := mysqlLenEnc(body[1:])
+	if n == 0 {
+		return 0, 0
+	}
+	_, m := mysqlLenEnc(body[1+n:])
+	if m == 0 || len(body) < 1+n+m+2 {
+		return affected, 0
+	}
+	return affected, binary.LittleEndian.Uint16(body[1+n+m:])
+}
+
+// mysqlQueryText returns SQL of COM_QUERY, skipping query attributes sent by clients with CLIENT_QUERY_ATTRIBUTES
+func mysqlQueryText(body []byte, queryAttrs bool) string {
+	text := body[1:]
+	if queryAttrs {
+		params, n := mysqlLenEnc(text)
+		_, m := mysqlLenEnc(text[n:])
+		if params != 0 || n == 0 || m == 0 {
+			//Atrybuty z wartosciami - tekst zaczyna sie tam gdzie pierwsze slowo kluczowe SQL
+			if mi := rSQL.FindIndex(text); mi != nil {
+				return string(text[mi[0]:])
+			}
+			return ""
+		}
+		text = text[n+m:]
+	}
+	return string(text)
+}
+
+// parseMySQL classifies MySQL packets which arrived together and adds them to their conversation as one packet.
+// COM_QUERY and COM_STMT_EXECUTE start executions, the last packet of their response (OK, ERR or EOF
+// of the last result set) ends them with SQL_END
+func (t *Parser) parseMySQL(seg tnsSegment, payload []byte) {
+	conversationId := seg.Conversation
+	c := t.mysqlConn(conversationId)
+	if c.tls {
+		return
+	}
+	p := SQLtcp{SQL: "_", Payload: payload, Response: !seg.ToDB, Timestamp: seg.Timestamp}
+	for b := payload; len(b) >= mysqlHeaderLen; {
+		size := mysqlHeaderLen + int(uint32(b[0])|uint32(b[1])<<8|uint32(b[2])<<16)
+		if size > len(b) {
+			size = len(b)
+		}
+		seq, body := b[3], b[mysqlHeaderLen:size]
+		b = b[size:]
+		if len(body) == 0 {
+			continue
+		}
+		if seg.ToDB {
+			c.request(t, conversationId, seq, body, &p)
+		} else {
+			c.response(body, &p)
+		}
+	}
+	t.addPacket(seg, p)
+}
+
+func (c *mysqlConn) request(t *Parser, conversationId string, seq byte, body []byte, p *SQLtcp) {
+	if seq == 1 && !c.commands && len(body) >= 4 {
+		caps := binary.LittleEndian.Uint32(body[0:4])
+		c.deprecateEOF = caps&mysqlClientDeprecateEOF != 0
+		c.queryAttrs = caps&mysqlClientQueryAttrs != 0
+		c.tls = caps&mysqlClientSSL != 0 && len(body) == 32 //SSLRequest - dalej juz TLS
+		if c.tls {
+			log.Println("MySQL conversation switched to TLS, skipping it", conversationId)
+		}
+		return
+	}
+	if seq != 0 {
+		return //LOCAL INFILE data, auth switch responses
+	}
+	c.commands = true
+	switch body[0] {
+	case mysqlComQuery:
+		p.SQL = mysqlQueryText(body, c.queryAttrs)
+		c.phase = mysqlFirst
+		t.MarkFirstSQL(conversationId, p.SQL, p.Timestamp)
+	case mysqlComStmtPrepare:
+		c.preparing = string(body[1:])
+		c.phase = mysqlPrepared
+	case mysqlComStmtExecute:
+		if len(body) >= 5 {
+			//Jak wykonanie otwartego kursora w TTC - tresc jest z przygotowania pod tym id
+			id := binary.LittleEndian.Uint32(body[1:5])
+			p.SQL = c.stmts[id]
+			p.IsReused = 1
+			log.Println("Called SQL text from prepared statement: ", p.SQL, conversationId+"_"+strconv.FormatUint(uint64(id), 10))
+		}
+		c.phase = mysqlFirst
+	case mysqlComStmtClose:
+		if len(body) >= 5 {
+			delete(c.stmts, binary.LittleEndian.Uint32(body[1:5]))
+		}
+	default:
+		c.phase = mysqlIdle
+	}
+}
+
+func (c *mysqlConn) response(body []byte, p *SQLtcp) {
+	isEOF := body[0] == mysqlEOF && len(body) < mysqlMaxEOFLen
+	if c.deprecateEOF {
+		isEOF = body[0] == mysqlEOF && len(body) < mysqlMaxOKEOFLen
+	}
+	if body[0] == mysqlErr && c.phase != mysqlIdle && c.phase != mysqlSkip {
+		if len(body) >= 3 {
+			p.OraErr = "MySQL-" + strconv.Itoa(int(binary.LittleEndian.Uint16(body[1:3])))
+		}
+		if c.phase != mysqlPrepared {
+			p.SQL = "SQL_END"
+		}
+		c.phase = mysqlIdle
+		return
+	}
+	switch c.phase {
+	case mysqlFirst:
+		switch body[0] {
+		case mysqlOK:
+			affected, status := mysqlStatus(body, false)
+			c.end(p, uint32(affected), status)
+		case mysqlInfile:
+			//Klient wysle plik, po nim serwer odpowie OK
+		default:
+			columns, _ := mysqlLenEnc(body)
+			c.phase, c.left, c.rows = mysqlColumns, int(columns), 0
+		}
+	case mysqlColumns:
+		if c.left--; c.left <= 0 {
+			c.phase = mysqlRows
+			if !c.deprecateEOF {
+				c.phase = mysqlColumnsEOF
+			}
+		}
+	case mysqlColumnsEOF:
+		c.phase = mysqlRows
+	case mysqlRows:
+		if !isEOF {
+			c.rows++
+			return
+		}
+		_, status := mysqlStatus(body, !c.deprecateEOF)
+		c.end(p, c.rows, status)
+	case mysqlPrepared:
+		c.phase = mysqlIdle
+		if body[0] != mysqlOK || len(body) < mysqlPrepareOKLen {
+			return
+		}
+		c.stmts[binary.LittleEndian.Uint32(body[1:5])] = c.preparing
+		columns := int(binary.LittleEndian.Uint16(body[5:7]))
+		params := int(binary.LittleEndian.Uint16(body[7:9]))
+		c.left = columns + params
+		if !c.deprecateEOF {
+			for _, n := range []int{columns, params} {
+				if n > 0 {
+					c.left++
+				}
+			}
+		}
+		if c.left > 0 {
+			c.phase = mysqlSkip
+		}
+	case mysqlSkip:
+		if c.left--; c.left <= 0 {
+			c.phase = mysqlIdle
+		}
+	}
+}
+
+// end finishes response with rows, unless more result sets (i.e. of a stored procedure) follow
+func (c *mysqlConn) end(p *SQLtcp, rows uint32, status uint16) {
+	p.Rows += rows
+	if status&mysqlServerMoreResults != 0 {
+		c.phase = mysqlFirst
+		return
+	}
+	p.SQL = "SQL_END"
+	c.phase = mysqlIdle
+}
@@ -0,0 +1,108 @@
+package tnsparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// ANO (Advanced Networking Option) negotiation: header of 13 bytes (magic, length, version, number of services,
+// error flags), then each service as type, number of subpackets and error, and its subpackets as length, type, value
+const (
+	anoHeaderLen        = 13
+	anoServiceHeaderLen = 8
+	anoSubpacketLen     = 4
+
+	anoServiceEncryption = 2
+	anoTypeUB1           = 2 //Subpacket with single byte value - the algorithm chosen by the server
+)
+
+// nneAlgorithms names encryption algorithms of Native Network Encryption by ANO ids
+var nneAlgorithms = map[byte]string{
+	1:  "RC4_40",
+	2:  "DES56C",
+	3:  "DES40C",
+	6:  "RC4_256",
+	8:  "RC4_56",
+	10: "RC4_128",
+	11: "3DES112",
+	12: "3DES168",
+	15: "AES128",
+	16: "AES192",
+	17: "AES256",
+}
+
+// Decryptor decrypts TNS data packets of sessions encrypted with Native Network Encryption, for environments
+// where session keys can legally be obtained (i.e. from the database or the client). Decrypt gets a whole
+// TNS packet and returns it with plain data (checksum of data integrity removed), stado can't derive keys itself
+type Decryptor interface {
+	Decrypt(conversationId string, toDB bool, packet []byte) ([]byte, error)
+}
+
+// anoEncryption returns encryption algorithm chosen by the server in ANO response, false if payload
+// has no ANO negotiation or the encryption service is missing
+func anoEncryption(payload []byte) (byte, bool) {
+	i := bytes.Index(payload, anoMagic)
+	if i < 0 || len(payload)-i < anoHeaderLen {
+		return 0, false
+	}
+	b := payload[i:]
+	services := int(binary.BigEndian.Uint16(b[10:]))
+	b = b[anoHeaderLen:]
+	for s := 0; s < services && len(b) >= anoServiceHeaderLen; s++ {
+		service, subpackets := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		b = b[anoServiceHeaderLen:]
+		algorithm, found := byte(0), false
+		for p := 0; p < subpackets && len(b) >= anoSubpacketLen; p++ {
+			size, typ := int(binary.BigEndian.Uint16(b)), binary.BigEndian.Uint16(b[2:])
+			if len(b) < anoSubpacketLen+size {
+				return 0, false
+			}
+			if typ == anoTypeUB1 && size == 1 {
+				algorithm, found = b[anoSubpacketLen], true
+			}
+			b = b[anoSubpacketLen+size:]
+		}
+		if service == anoServiceEncryption {
+			return algorithm, found
+		}
+	}
+	return 0, false
+}
+
+// TrackEncryption remembers encryption algorithm the database chose in ANO negotiation of a session
+func (t *Parser) TrackEncryption(conversationId string, payload []byte, toDB bool) {
+	c, ok := t.Connections[conversationId]
+	if !ok || toDB || payload[4] != tnsPacketData {
+		return
+	}
+	if algorithm, ok := anoEncryption(payload); ok && algorithm != 0 {
+		c.Encryption = nneAlgorithms[algorithm]
+		if c.Encryption == "" {
+			c.Encryption = "algorithm " + strconv.Itoa(int(algorithm))
+		}
+	}
+}
+
+// sessionEncrypted tells if conversation negotiated Native Network Encryption
+func (t *Parser) sessionEncrypted(conversationId string) bool {
+	c, ok := t.Connections[conversationId]
+	return ok && c.Encryption != ""
+}
+
+// decrypt returns plain TNS packet of encrypted session, nil if there is no NNEDecryptor or it failed
+func (t *Parser) decrypt(seg tnsSegment, payload []byte) []byte {
+	if t.NNEDecryptor == nil {
+		return nil
+	}
+	plain, err := t.NNEDecryptor.Decrypt(seg.Conversation, seg.ToDB, payload)
+	if err != nil {
+		t.reportError(fmt.Errorf("can't decrypt packet of %s at %v: %v", seg.Conversation, seg.Timestamp, err))
+		return nil
+	}
+	if c, ok := t.Connections[seg.Conversation]; ok {
+		c.Decrypted++
+	}
+	return plain
+}
@@ -0,0 +1,65 @@
+package tnsparse
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers is number of goroutines finding executions in conversations (-workers)
+var Workers = runtime.NumCPU()
+
+// walkAhead is how many conversations per worker may wait walked for the aggregating goroutine,
+// so memory taken by their executions stays bounded
+const walkAhead = 4
+
+// walkedConversation is what WalkConversation found in a conversation
+type walkedConversation struct {
+	executions []Execution
+	bytes      uint64
+	dropped    uint
+	done       chan struct{}
+}
+
+// WalkConversations walks conversations ids on Workers goroutines and passes executions of each of them
+// to add in order of ids from the calling goroutine, so statistics are aggregated without locks and
+// in the same order on every run
+func (t *Parser) WalkConversations(ids []string, add func(c string, executions []Execution, bytes uint64, dropped uint)) {
+	workers := Workers
+	if workers < 1 {
+		workers = 1
+	}
+	walked := make([]walkedConversation, len(ids))
+	for i := range walked {
+		walked[i].done = make(chan struct{})
+	}
+	next := make(chan int)
+	ahead := make(chan struct{}, workers*walkAhead)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				wc := &walked[i]
+				wc.bytes, wc.dropped = t.WalkConversation(ids[i], func(e *Execution) { wc.executions = append(wc.executions, *e) })
+				t.refineMirrored(ids[i], wc.executions)
+				close(wc.done)
+			}
+		}()
+	}
+	go func() {
+		for i := range ids {
+			ahead <- struct{}{}
+			next <- i
+		}
+		close(next)
+	}()
+	for i := range ids {
+		wc := &walked[i]
+		<-wc.done
+		add(ids[i], wc.executions, wc.bytes, wc.dropped)
+		wc.executions = nil
+		<-ahead
+	}
+	wg.Wait()
+}
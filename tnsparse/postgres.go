@@ -0,0 +1,291 @@
+package tnsparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// PostgreSQL frontend/backend protocol: every message but the first ones of a connection has 1 byte of type
+// and 4 bytes of length (big endian, with itself)
+const (
+	pgHeaderLen = 5
+
+	pgQuery    = byte('Q')
+	pgParse    = byte('P')
+	pgBind     = byte('B')
+	pgExecute  = byte('E')
+	pgClose    = byte('C')
+	pgDataRow  = byte('D')
+	pgComplete = byte('C')
+	pgError    = byte('E')
+	pgReady    = byte('Z')
+	pgSuspend  = byte('s')
+
+	pgSSLRequest = uint32(80877103)
+	pgGSSRequest = uint32(80877104)
+
+	pgMaxMessageLen = 1 << 30 //MaxAllocSize of PostgreSQL, a longer length is not a header
+	pgResyncLen     = 1 << 20 //The first message found by resync has to be shorter
+)
+
+// Message types sent by the client and by the server, bytes of other types are not a header
+const (
+	pgFrontendTypes = "BCcdDEfFHpPQSX"
+	pgBackendTypes  = "123AcCdDEGHIKnNRsStTvVWZ"
+)
+
+// pgConn is state of a PostgreSQL conversation: named prepared statements and portals (like cursor slots
+// of TTC) and the execution waiting for ReadyForQuery
+type pgConn struct {
+	started    bool //startup message was sent, the next client messages have type
+	encRequest bool //SSLRequest or GSSENCRequest waits for single byte answer
+	tls        bool
+	stmts      map[string]string //SQL of prepared statements by name, "" is the unnamed one
+	portals    map[string]string //SQL of bound portals by name
+	executing  bool              //an execution waits for ReadyForQuery
+	suspended  bool              //the last Execute returned PortalSuspended, next Execute of the portal fetches more rows
+	rows       uint32            //rows of the execution so far
+	dataRows   bool              //rows were counted from DataRow messages, not from command tag
+}
+
+func (t *Parser) pgConn(conversationId string) *pgConn {
+	c, ok := t.postgres[conversationId]
+	if !ok {
+		c = &pgConn{stmts: make(map[string]string), portals: make(map[string]string)}
+		t.postgres[conversationId] = c
+	}
+	return c
+}
+
+// pgPacketsLen returns length of complete messages sent in direction toDB which follow skip bytes at the
+// beginning of b, following startup and encryption requests of the connection which are sent without type.
+// Bytes before the first header (capture started in the middle of a message, lost segments) are skipped
+func pgPacketsLen(b []byte, c *pgConn, toDB bool) (skip, n int) {
+	if c.tls {
+		return 0, len(b)
+	}
+	for len(b)-n > 0 {
+		if !toDB && c.encRequest {
+			//Serwer odpowiada na SSLRequest jednym bajtem: S - dalej TLS, N - dalej otwartym tekstem
+			c.encRequest, c.tls = false, b[n] == 'S'
+			n++
+			if c.tls {
+				return 0, len(b)
+			}
+			continue
+		}
+		if toDB && !c.started && b[n] != 0 {
+			c.started = true //Capture zaczety w trakcie sesji - komunikaty maja juz typ
+		}
+		if toDB && !c.started {
+			if len(b)-n < 8 {
+				break
+			}
+			size := int(binary.BigEndian.Uint32(b[n:]))
+			if size < 8 || size > len(b)-n {
+				break
+			}
+			code := binary.BigEndian.Uint32(b[n+4:])
+			c.encRequest = code == pgSSLRequest || code == pgGSSRequest
+			c.started = !c.encRequest
+			n += size
+			continue
+		}
+		if len(b)-n < pgHeaderLen {
+			break
+		}
+		if !pgHeader(b[n:], toDB, pgMaxMessageLen) {
+			if n > skip {
+				break //Najpierw kompletne komunikaty, od smieci zaczniemy w kolejnym wywolaniu
+			}
+			skip = n + pgResync(b[n:], toDB)
+			n = skip
+			continue
+		}
+		size := 1 + int(binary.BigEndian.Uint32(b[n+1:]))
+		if size > len(b)-n {
+			break
+		}
+		n += size
+	}
+	return skip, n - skip
+}
+
+// pgHeader tells if b starts with a header of message sent in direction toDB not longer than maxLen
+func pgHeader(b []byte, toDB bool, maxLen int) bool {
+	types := pgBackendTypes
+	if toDB {
+		types = pgFrontendTypes
+	}
+	size := binary.BigEndian.Uint32(b[1:])
+	return strings.IndexByte(types, b[0]) >= 0 && size >= pgHeaderLen-1 && size <= uint32(maxLen)
+}
+
+// pgResync returns number of bytes at the beginning of b before the first plausible message: its header
+// is followed by another header or by the end of b. Without one all but the last bytes are skipped,
+// they may start a header completed by the next segment
+func pgResync(b []byte, toDB bool) int {
+	for i := 1; i+pgHeaderLen <= len(b); i++ {
+		if !pgHeader(b[i:], toDB, pgResyncLen) {
+			continue
+		}
+		next := i + 1 + int(binary.BigEndian.Uint32(b[i+1:]))
+		if next >= len(b) || (next+pgHeaderLen <= len(b) && pgHeader(b[next:], toDB, pgMaxMessageLen)) {
+			return i //Za komunikatem koniec bufora - reszta moze dopiero przyjsc
+		}
+	}
+	if len(b) < pgHeaderLen {
+		return 0
+	}
+	return len(b) - pgHeaderLen + 1
+}
+
+// pgString returns null terminated string at the beginning of b and the rest after it
+func pgString(b []byte) (string, []byte) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return string(b), nil
+	}
+	return string(b[:i]), b[i+1:]
+}
+
+// pgTagRows returns rows of CommandComplete tag (the last number of i.e. "SELECT 5", "INSERT 0 1", "UPDATE 3")
+func pgTagRows(tag string) uint32 {
+	i := len(tag)
+	for i > 0 && tag[i-1] >= '0' && tag[i-1] <= '9' {
+		i--
+	}
+	rows, _ := strconv.ParseUint(tag[i:], 10, 32)
+	return uint32(rows)
+}
+
+// pgErrorCode returns SQLSTATE of ErrorResponse
+func pgErrorCode(body []byte) string {
+	for len(body) > 1 && body[0] != 0 {
+		field := body[0]
+		var value string
+		value, body = pgString(body[1:])
+		if field == 'C' {
+			return value
+		}
+	}
+	return ""
+}
+
+// parsePostgres classifies PostgreSQL messages which arrived together and adds them to their conversation
+// as one packet. Simple Query and Execute start executions (Execute of a suspended portal continues
+// the previous one), ReadyForQuery after them ends them with SQL_END
+func (t *Parser) parsePostgres(seg tnsSegment, payload []byte) {
+	c := t.pgConn(seg.Conversation)
+	if c.tls {
+		return
+	}
+	p := SQLtcp{SQL: "_", Payload: payload, Response: !seg.ToDB, Timestamp: seg.Timestamp}
+	if seg.ToDB {
+		c.request(t, seg.Conversation, payload, &p)
+	} else {
+		c.response(payload, &p)
+	}
+	t.addPacket(seg, p)
+}
+
+// pgMessages calls f with type and body of each typed message in b
+func pgMessages(b []byte, f func(typ byte, body []byte)) {
+	for len(b) >= pgHeaderLen {
+		size := 1 + int(binary.BigEndian.Uint32(b[1:]))
+		if size < pgHeaderLen || size > len(b) {
+			return //Komunikaty startowe bez typu
+		}
+		f(b[0], b[pgHeaderLen:size])
+		b = b[size:]
+	}
+}
+
+func (c *pgConn) request(t *Parser, conversationId string, payload []byte, p *SQLtcp) {
+	parsed := make(map[string]bool) //Statements parsed in this request, binding them is not a reuse
+	bound := make(map[string]bool)
+	reused := uint(0)
+	pgMessages(payload, func(typ byte, body []byte) {
+		switch typ {
+		case pgQuery:
+			sqlTxt, _ := pgString(body)
+			if p.SQL == "_" {
+				p.SQL = sqlTxt
+				c.start()
+				t.MarkFirstSQL(conversationId, sqlTxt, p.Timestamp)
+			}
+		case pgParse:
+			name, rest := pgString(body)
+			sqlTxt, _ := pgString(rest)
+			c.stmts[name] = sqlTxt
+			parsed[name] = true
+		case pgBind:
+			portal, rest := pgString(body)
+			stmt, _ := pgString(rest)
+			c.portals[portal] = c.stmts[stmt]
+			bound[portal] = true
+			if stmt != "" && !parsed[stmt] {
+				reused = 1 //Jak wykonanie otwartego kursora w TTC - tresc jest z wczesniejszego Parse
+			}
+		case pgExecute:
+			portal, _ := pgString(body)
+			if p.SQL != "_" {
+				return //Kolejne wykonania w tym samym requescie (batch) naleza do pierwszego
+			}
+			if c.suspended && !bound[portal] {
+				c.executing = true //Dalszy fetch z zawieszonego portalu - ciag dalszy wykonania
+				return
+			}
+			p.SQL = c.portals[portal]
+			p.IsReused = reused
+			c.start()
+			log.Println("Called SQL text from portal: ", p.SQL, conversationId+"_"+portal)
+			t.MarkFirstSQL(conversationId, p.SQL, p.Timestamp)
+		case pgClose:
+			if len(body) > 1 {
+				name, _ := pgString(body[1:])
+				if body[0] == 'S' {
+					delete(c.stmts, name)
+				} else {
+					delete(c.portals, name)
+				}
+			}
+		}
+	})
+}
+
+// start begins an execution waiting for ReadyForQuery
+func (c *pgConn) start() {
+	c.executing, c.suspended, c.rows, c.dataRows = true, false, 0, false
+}
+
+func (c *pgConn) response(payload []byte, p *SQLtcp) {
+	pgMessages(payload, func(typ byte, body []byte) {
+		switch typ {
+		case pgDataRow:
+			c.rows++
+			c.dataRows = true
+		case pgComplete:
+			if tag, _ := pgString(body); !c.dataRows {
+				c.rows += pgTagRows(tag)
+			}
+		case pgError:
+			if code := pgErrorCode(body); code != "" {
+				p.OraErr = "PG-" + code
+			}
+		case pgSuspend:
+			c.suspended = true
+		case pgReady:
+			if c.executing && !c.suspended {
+				p.SQL = "SQL_END"
+			}
+			c.executing = false
+		}
+	})
+	if c.executing || p.SQL == "SQL_END" {
+		p.Rows = c.rows //Narastajaco dla wykonania, jak licznik wierszy TTC
+	}
+}
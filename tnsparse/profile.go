@@ -0,0 +1,126 @@
+package tnsparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TTCProfile is a layout of TTC fields, which positions differ between client/server versions
+type TTCProfile struct {
+	Name            string
+	MinRelease      int      //Lowest database release (from AUTH_VERSION_NO) using this layout
+	MaxTNSVersion   uint16   //Highest TNS version negotiated in ACCEPT using this layout, 0 if it is not chosen by TNS version
+	MsgType         int      //TTC message type, function code follows it
+	UsedCursorFlags [][]byte //Packet length and type @3 of request executing already open cursor
+	UsedCursorSlot  int      //Cursor id in request executing already open cursor
+	EndOfDataFlag   []byte   //Flag before ORA-01403 at the end of fetch
+	EndOfDataSlot   int      //Cursor id after EndOfDataFlag
+	RetOpiParamSlot int      //Cursor id in RetOpiParam response
+	RetStatusSlot   int      //Cursor id in RetStatus response
+}
+
+var defaultTTCProfile = &TTCProfile{Name: "12c", MinRelease: 12, MsgType: 10,
+	UsedCursorFlags: [][]byte{usedCursorFlag, usedCursorFlagAfterError}, UsedCursorSlot: 13,
+	EndOfDataFlag: endOfDataFlag, EndOfDataSlot: 6, RetOpiParamSlot: 21, RetStatusSlot: 28}
+
+// TTCProfiles is the compatibility matrix, ordered by MinRelease
+var TTCProfiles = []*TTCProfile{
+	//Klienci OCI 10g/11g nie wysylaja pol dodanych w 12c - wykonanie otwartego kursora jest krotsze
+	{Name: "11g", MinRelease: 10, MaxTNSVersion: 314, MsgType: 10,
+		UsedCursorFlags: [][]byte{{26, 6}, {45, 6}}, UsedCursorSlot: 13,
+		EndOfDataFlag: []byte{123, 4}, EndOfDataSlot: 5, RetOpiParamSlot: 21, RetStatusSlot: 28},
+	defaultTTCProfile,
+	//23ai wysyla rozszerzone parametry powrotne - numer kursora w odpowiedziach jest dalej
+	{Name: "23ai", MinRelease: 23, MsgType: 10,
+		UsedCursorFlags: [][]byte{usedCursorFlag, usedCursorFlagAfterError}, UsedCursorSlot: 13,
+		EndOfDataFlag: endOfDataFlag, EndOfDataSlot: 6, RetOpiParamSlot: 22, RetStatusSlot: 30},
+}
+
+// TTCProfileName forces layout of all sessions (-ttc), "auto" detects it per session from logon
+var TTCProfileName = "auto"
+
+// rAuthVersion matches database version sent in logon response, i.e. AUTH_VERSION_NO 385875968 (0x17000000 - 23.0)
+var rAuthVersion = regexp.MustCompile(`AUTH_VERSION_NO[^0-9]{1,16}(\d{6,10})`)
+
+// TTCProfileByName returns profile of the compatibility matrix
+func TTCProfileByName(name string) (*TTCProfile, error) {
+	var names []string
+	for _, p := range TTCProfiles {
+		if p.Name == name {
+			return p, nil
+		}
+		names = append(names, p.Name)
+	}
+	return nil, fmt.Errorf("unknown TTC profile %s, use auto|%s", name, strings.Join(names, "|"))
+}
+
+// ttcProfileOf returns profile used by the newest release not newer than release
+func ttcProfileOf(release int) *TTCProfile {
+	profile := defaultTTCProfile
+	for _, p := range TTCProfiles {
+		if release >= p.MinRelease {
+			profile = p
+		}
+	}
+	return profile
+}
+
+// ttcProfileOfTNS returns profile of old clients chosen by TNS version negotiated in ACCEPT, nil for newer ones
+func ttcProfileOfTNS(version uint16) *TTCProfile {
+	for _, p := range TTCProfiles {
+		if version <= p.MaxTNSVersion {
+			return p
+		}
+	}
+	return nil
+}
+
+// detectProfile picks layout of a session from TNS version in ACCEPT and then from database version
+// in its logon response, which is more precise
+func (t *Parser) detectProfile(conversationId string, payload []byte) {
+	if len(payload) >= 10 && payload[4] == tnsPacketAccept {
+		if p := ttcProfileOfTNS(binary.BigEndian.Uint16(payload[8:10])); p != nil {
+			t.profiles[conversationId] = p
+			log.Println("TTC profile of", conversationId, "is", p.Name, "TNS version", binary.BigEndian.Uint16(payload[8:10]))
+		}
+		return
+	}
+	m := rAuthVersion.FindSubmatch(payload)
+	if m == nil {
+		return
+	}
+	version, err := strconv.ParseUint(string(m[1]), 10, 32)
+	if err != nil {
+		return
+	}
+	t.profiles[conversationId] = ttcProfileOf(int(version >> 24))
+	log.Println("TTC profile of", conversationId, "is", t.profiles[conversationId].Name, "release", version>>24)
+}
+
+// Profile returns layout of TTC fields of conversation
+func (t *Parser) Profile(conversationId string) *TTCProfile {
+	if TTCProfileName != "auto" {
+		if p, err := TTCProfileByName(TTCProfileName); err == nil {
+			return p
+		}
+	}
+	if p, ok := t.profiles[conversationId]; ok {
+		return p
+	}
+	return defaultTTCProfile
+}
+
+// usedCursor tells if request executes already open cursor without SQL text
+func (p *TTCProfile) usedCursor(payload []byte) bool {
+	for _, flag := range p.UsedCursorFlags {
+		if bytes.Equal(payload[3:5], flag) {
+			return true
+		}
+	}
+	return false
+}
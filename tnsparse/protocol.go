@@ -0,0 +1,35 @@
+package tnsparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Wire protocols of databases decoded by the parser (-protocol)
+const (
+	ProtocolOracle   = "oracle"
+	ProtocolMySQL    = "mysql"
+	ProtocolPostgres = "postgres"
+	ProtocolTDS      = "tds"
+)
+
+// Protocols lists values accepted by -protocol
+var Protocols = []string{ProtocolOracle, ProtocolMySQL, ProtocolPostgres, ProtocolTDS}
+
+// Protocol is the wire protocol of the analyzed databases, Oracle SQL*Net (TNS/TTC) by default
+var Protocol = ProtocolOracle
+
+func CheckProtocol() error {
+	for _, p := range Protocols {
+		if Protocol == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown -protocol %q, expected %s", Protocol, strings.Join(Protocols, "|"))
+}
+
+// endMarked tells if the parser marks the last response of every execution with SQL_END. TTC responses
+// of DML have no end marker, so for Oracle an execution not being a query ends with its first response
+func endMarked() bool {
+	return Protocol != ProtocolOracle
+}
@@ -0,0 +1,94 @@
+package tnsparse
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ResolveDNS bool //-resolve: reverse DNS lookups of client and server IPs
+	Offline    bool //-offline: no DNS queries at all, only -hosts file is used
+
+	hostsByIP   = make(map[string]string)
+	ipsByHost   = make(map[string][]string)
+	nameCache   = make(map[string]string)
+	nameCacheMu sync.Mutex
+)
+
+const dnsTimeout = 2 * time.Second
+
+// LoadHostsFile reads /etc/hosts formatted file: "ip name [aliases...]"
+func LoadHostsFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.SplitN(scanner.Text(), "#", 2)[0])
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			continue
+		}
+		if _, ok := hostsByIP[fields[0]]; !ok {
+			hostsByIP[fields[0]] = fields[1]
+		}
+		for _, name := range fields[1:] {
+			ipsByHost[strings.ToLower(name)] = append(ipsByHost[strings.ToLower(name)], fields[0])
+		}
+	}
+	return scanner.Err()
+}
+
+// HostName returns name of ip from -hosts file or reverse DNS (if enabled), or empty string
+func HostName(ip string) string {
+	if name, ok := hostsByIP[ip]; ok {
+		return name
+	}
+	if !ResolveDNS || Offline {
+		return ""
+	}
+	nameCacheMu.Lock()
+	defer nameCacheMu.Unlock()
+	if name, ok := nameCache[ip]; ok {
+		return name
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	name := ""
+	if names, err := net.DefaultResolver.LookupAddr(ctx, ip); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	nameCache[ip] = name //Negatywne odpowiedzi tez pamietam, zeby nie pytac DNS w kolko
+	return name
+}
+
+// HostLabel returns "name(ip)" if ip can be resolved, ip otherwise
+func HostLabel(ip string) string {
+	if name := HostName(ip); name != "" {
+		return name + "(" + ip + ")"
+	}
+	return ip
+}
+
+// LookupHost resolves host name to IPs using -hosts file and DNS unless -offline
+func LookupHost(host string) []string {
+	if ips, ok := ipsByHost[strings.ToLower(host)]; ok {
+		return ips
+	}
+	if Offline {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
@@ -0,0 +1,511 @@
+package tnsparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"regexp"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// scrubMinRun - shorter printable runs in binary TTC fields of logon and negotiation are mostly accidental and are
+// left alone. Bind values and row data are masked whole
+const scrubMinRun = 4
+
+var (
+	rScrubSQL = regexp.MustCompile(`(?i)\b(select|insert|update|delete|merge|with|begin|declare|call|commit|rollback|alter|create|drop|truncate|lock|savepoint)\b`)
+	//Czego stado potrzebuje poza SQL: kody bledow, klucze logowania, metody uwierzytelnienia i deskryptor CONNECT bez adresow i uzytkownikow
+	rScrubKeep = []*regexp.Regexp{
+		rOraError,
+		rAuthVersion,
+		rCompression,
+		rConnectService,
+		rRefuseError,
+		regexp.MustCompile(`AUTH_[A-Z_]+|KERBEROS5|RADIUS`),
+		regexp.MustCompile(`(?i)\(\s*[A-Z_]+\s*=|\(\s*(?:PROTOCOL|PORT|SDU)\s*=\s*\w+\s*\)|[()=]`),
+	}
+)
+
+// sqlState is where TNS packet and SQL text of a TCP direction ended in the previous segment
+type sqlState struct {
+	open  bool //segment ended in SQL text found in printable runs, the next one continues it
+	quote bool //inside string literal
+	rest  int  //bytes of the last TNS packet still to come in the next segments
+	sql   int  //bytes of SQL text of the last TNS packet still to come, sqlToZero if it ends with zero byte
+	mask  bool //the rest of the last TNS packet is bind values or row data, masked whole
+	next  uint32
+}
+
+const sqlToZero = -1
+
+// Scrubber rewrites TNS payloads of a capture in place, keeping their length so TNS and TCP stay consistent.
+// SQL literals are replaced by placeholders ('xxx', 000), all other text (bind values, row data, connect
+// strings, ORA- messages) is masked except for what stado needs to analyze the capture
+type Scrubber struct {
+	Anonymize bool //replace IP addresses with 10.0.0.0/8 and fd00::/8 addresses and MAC addresses with local ones
+	Packets   uint64
+	Scrubbed  uint64            //packets which payload was changed
+	IPs       map[string]net.IP //anonymized address of each original one
+	flows     map[string]*sqlState
+	macs      map[string]net.HardwareAddr
+}
+
+func NewScrubber(anonymize bool) *Scrubber {
+	return &Scrubber{Anonymize: anonymize, flows: make(map[string]*sqlState), IPs: make(map[string]net.IP),
+		macs: make(map[string]net.HardwareAddr)}
+}
+
+// Scrub rewrites frame decoded as packet (with NoCopy, so layers point into the frame). Frames which can't
+// be anonymized (ARP and other non-IP traffic) are dropped if Anonymize is set
+func (s *Scrubber) Scrub(packet gopacket.Packet, truncated bool) bool {
+	s.Packets++
+	nl := packet.NetworkLayer()
+	if nl == nil {
+		return !s.Anonymize
+	}
+	changed := false
+	if tcp, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP); ok && len(tcp.Payload) > 0 {
+		flow := nl.NetworkFlow().String() + " " + tcp.TransportFlow().String()
+		st := s.flows[flow]
+		if st == nil {
+			st = &sqlState{next: tcp.Seq}
+			s.flows[flow] = st
+		}
+		if tcp.Seq != st.next {
+			//Retransmisja albo zgubiony segment - granice pakietow TNS trzeba znalezc od nowa
+			st.rest, st.sql, st.mask, st.open = 0, 0, false, false
+		}
+		changed = scrubPayload(tcp.Payload, st)
+		st.next = tcp.Seq + uint32(len(tcp.Payload))
+		if ipv4, ok := nl.(*layers.IPv4); ok && ipv4.Flags&layers.IPv4MoreFragments != 0 {
+			st.next = 0 //Reszta segmentu idzie w dalszych fragmentach
+		}
+		if tcp.FIN || tcp.RST {
+			delete(s.flows, flow)
+		}
+	} else if ipv4, ok := nl.(*layers.IPv4); ok && ipv4.FragOffset > 0 {
+		changed = scrubPayload(ipv4.Payload, &sqlState{}) //Dalsze fragmenty nie maja TCP, maskujemy calosc
+	}
+	if s.Anonymize {
+		switch ip := nl.(type) {
+		case *layers.IPv4:
+			copy(ip.Contents[12:16], s.anonymize(ip.SrcIP))
+			copy(ip.Contents[16:20], s.anonymize(ip.DstIP))
+		case *layers.IPv6:
+			copy(ip.Contents[8:24], s.anonymize(ip.SrcIP))
+			copy(ip.Contents[24:40], s.anonymize(ip.DstIP))
+		}
+		s.anonymizeLinks(packet)
+		s.anonymizeICMP(packet)
+		changed = true
+	}
+	if !changed {
+		return true
+	}
+	s.Scrubbed++
+	if !truncated {
+		fixChecksums(packet)
+	}
+	return true
+}
+
+// anonymize returns address replacing ip, the same for the whole capture
+func (s *Scrubber) anonymize(ip net.IP) net.IP {
+	if a, ok := s.IPs[ip.String()]; ok {
+		return a
+	}
+	n := len(s.IPs) + 1
+	var a net.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		a = net.IPv4(10, byte(n>>16), byte(n>>8), byte(n)).To4()
+	} else {
+		a = make(net.IP, net.IPv6len)
+		a[0] = 0xfd
+		binary.BigEndian.PutUint32(a[12:], uint32(n))
+	}
+	s.IPs[ip.String()] = a
+	return a
+}
+
+// anonymizeLinks replaces MAC addresses of Ethernet frames (also carried by MPLS pseudowires) and of Linux
+// cooked capture with locally administered ones, the same for the whole capture
+func (s *Scrubber) anonymizeLinks(packet gopacket.Packet) {
+	for _, l := range packet.Layers() {
+		switch link := l.(type) {
+		case *layers.Ethernet:
+			copy(link.Contents[0:6], s.anonymizeMAC(link.DstMAC))
+			copy(link.Contents[6:12], s.anonymizeMAC(link.SrcMAC))
+		case *layers.LinuxSLL:
+			if link.AddrLen == 6 {
+				copy(link.Contents[6:12], s.anonymizeMAC(link.Addr))
+			}
+		}
+	}
+}
+
+func (s *Scrubber) anonymizeMAC(mac net.HardwareAddr) net.HardwareAddr {
+	if a, ok := s.macs[mac.String()]; ok {
+		return a
+	}
+	n := len(s.macs) + 1
+	a := net.HardwareAddr{0x02, 0, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	s.macs[mac.String()] = a
+	return a
+}
+
+// anonymizeICMP replaces addresses of the original packet quoted by ICMP errors (fragmentation needed,
+// unreachable), their payloads would reveal the real addresses otherwise
+func (s *Scrubber) anonymizeICMP(packet gopacket.Packet) {
+	var quoted []byte
+	if icmp, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		quoted = icmp.Payload
+	} else if icmp, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok && icmp.TypeCode.Type() < 128 {
+		quoted = icmp.Payload
+		if len(quoted) > 4 {
+			quoted = quoted[4:] //Za polem MTU/wskaznika bledu
+		}
+	}
+	switch {
+	case len(quoted) >= 20 && quoted[0]>>4 == 4:
+		copy(quoted[12:16], s.anonymize(net.IP(quoted[12:16])))
+		copy(quoted[16:20], s.anonymize(net.IP(quoted[16:20])))
+		if hl := int(quoted[0]&0x0f) * 4; hl >= 20 && hl <= len(quoted) {
+			quoted[10], quoted[11] = 0, 0
+			binary.BigEndian.PutUint16(quoted[10:12], inetChecksum(0, quoted[:hl]))
+		}
+	case len(quoted) >= 40 && quoted[0]>>4 == 6:
+		copy(quoted[8:24], s.anonymize(append(net.IP(nil), quoted[8:24]...)))
+		copy(quoted[24:40], s.anonymize(append(net.IP(nil), quoted[24:40]...)))
+	}
+}
+
+// scrubPayload masks payload in place, true if anything was changed. TNS packets are followed across
+// segments: DATA packets of calls and results have bind values and row data after the fields stado reads,
+// which are masked whole, also binary values. Other packets and bytes without TNS header are masked by printable runs
+func scrubPayload(b []byte, st *sqlState) bool {
+	changed, off := false, 0
+	if st.rest > 0 {
+		off = st.rest
+		if off > len(b) {
+			off = len(b)
+		}
+		st.rest -= off
+		changed = scrubBody(b[:off], st)
+	}
+	for off < len(b) {
+		size, ok := 0, false
+		if len(b)-off >= tnsHeaderLen {
+			size, ok = tnsPacketLen(b[off:])
+		}
+		if !ok {
+			//Bez naglowka TNS (zgubiony segment, dalszy fragment IP) - nie wiadomo gdzie sa dane
+			st.rest, st.sql, st.mask = 0, 0, false
+			return scrubRuns(b[off:], st) || changed
+		}
+		end := off + size
+		if end > len(b) {
+			st.rest, end = end-len(b), len(b)
+		}
+		changed = scrubTNS(b[off:end], size, st) || changed
+		off = end
+	}
+	return changed
+}
+
+// scrubTNS masks TNS packet p of size bytes, p is shorter if the packet continues in the next segments
+func scrubTNS(p []byte, size int, st *sqlState) bool {
+	st.sql, st.mask = 0, false
+	m := defaultTTCProfile.MsgType
+	if p[4] != tnsPacketData || len(p) <= m+ttcCallHeader {
+		return scrubRuns(p, st)
+	}
+	head, withSQL, ok := ttcHead(p)
+	if !ok {
+		return scrubRuns(p, st)
+	}
+	mi := rSQL.FindIndex(p)
+	if withSQL && mi == nil && len(p) < size {
+		return scrubRuns(p, st) //SQL moze zaczynac sie dopiero w nastepnym segmencie
+	}
+	st.mask = true
+	if !withSQL || mi == nil || mi[0] < 5 || bytes.Contains(p, []byte("DESCRIPTION")) {
+		if head > len(p) {
+			head = len(p)
+		}
+		return maskData(p[head:]) //Za numerem kursora i licznikami sa juz tylko bindy albo wiersze
+	}
+	//Pola wywolania przed SQL zostaja (parser czyta z nich dlugosc SQL), za SQL sa bindy
+	st.quote = false
+	st.sql = sqlTextLen(p, mi[0], size)
+	return scrubBody(p[mi[0]:], st)
+}
+
+// scrubBody masks continuation of the last TNS packet: the rest of its SQL text and then bind values
+// or row data, or printable runs of other packets
+func scrubBody(b []byte, st *sqlState) bool {
+	if !st.mask {
+		return scrubRuns(b, st)
+	}
+	n := 0
+	switch {
+	case st.sql == sqlToZero:
+		for n < len(b) && b[n] != 0 {
+			n++
+		}
+		if n < len(b) {
+			st.sql = 0
+		}
+	case st.sql > 0:
+		n = st.sql
+		if n > len(b) {
+			n = len(b)
+		}
+		st.sql -= n
+	}
+	changed := scrubSQL(b[:n], st)
+	return maskData(b[n:]) || changed
+}
+
+// sqlTextLen returns length of SQL text at at of TNS packet p of size bytes the way parser reads it,
+// sqlToZero if it ends with the first zero byte
+func sqlTextLen(p []byte, at int, size int) int {
+	n := 0
+	switch p[at-5] {
+	case littleEndianFlag:
+		n = int(binary.LittleEndian.Uint32(p[at-4 : at]))
+	case bigEndianFlag:
+		n = int(binary.BigEndian.Uint32(p[at-4 : at]))
+	case oneByteSizeFlag:
+		n = int(p[at-1])
+	}
+	if n == uncertainSqlSize || n >= size-(at-4) {
+		return sqlToZero
+	}
+	return n
+}
+
+// ttcHead returns how many bytes at the beginning of TNS DATA packet p stado reads to follow cursors and
+// rows of calls and their results, and if the call may carry SQL text. False for logon, negotiation and
+// calls which carry no values
+func ttcHead(p []byte) (head int, withSQL bool, ok bool) {
+	m := defaultTTCProfile.MsgType
+	if bytes.Contains(p, anoMagic) || bytes.Contains(p, []byte("AUTH")) {
+		return 0, false, false
+	}
+	switch p[m] {
+	case retStatus:
+		return 31, false, true //Numer kursora i wiersze (RetStatusSlot, rowsProcessed) we wszystkich ukladach
+	case retOpiParam:
+		return 23, false, true
+	case ttcProtocolNegotiation, ttcDataTypes:
+		return 0, false, false
+	}
+	for _, profile := range TTCProfiles {
+		if profile.usedCursor(p) {
+			return profile.UsedCursorSlot + 1, false, true
+		}
+	}
+	switch p[m] {
+	case ttcFunctionCall:
+		switch p[m+1] {
+		case ttcFuncOALL8:
+			return m + ttcCallHeader + 12, true, true //Opcje, kursor i pusty wskaznik SQL (executeCursor)
+		case ttcFuncOCLOSE:
+			return m + ttcCallHeader + 5, false, true
+		}
+		return 0, false, false
+	case ttcPiggyback:
+		if p[m+1] != ttcFuncOCCA {
+			return 0, false, false
+		}
+		count, off, ok := readUB4(p, m+ttcCallHeader+1)
+		for i := uint32(0); ok && i < count; i++ {
+			_, off, ok = readUB4(p, off)
+		}
+		return off, true, ok
+	}
+	return m + 1, false, true //Wiersze, opis kolumn i inne wyniki
+}
+
+// maskData zeroes bind values and row data, keeping ORA- codes and the end of fetch block (row count
+// and cursor id before and after EndOfDataFlag)
+func maskData(b []byte) bool {
+	keep := make([]bool, len(b))
+	for _, m := range rOraError.FindAllIndex(b, -1) {
+		for i := m[0]; i < m[1]; i++ {
+			keep[i] = true
+		}
+	}
+	for i := 2; i+1 < len(b); i++ {
+		if b[i-2] == 2 && b[i-1] == 5 && b[i] == endOfDataFlag[0] && (b[i+1] == 4 || b[i+1] == 5) {
+			for j := i - 8; j < i+8 && j < len(b); j++ {
+				if j >= 0 {
+					keep[j] = true
+				}
+			}
+		}
+	}
+	changed := false
+	for i := range b {
+		if !keep[i] && b[i] != 0 {
+			b[i] = 0
+			changed = true
+		}
+	}
+	return changed
+}
+
+// scrubRuns masks printable runs of b, SQL text found in them is scrubbed
+func scrubRuns(b []byte, st *sqlState) bool {
+	keep := make([]bool, len(b))
+	for _, re := range rScrubKeep {
+		for _, m := range re.FindAllIndex(b, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				keep[i] = true
+			}
+		}
+	}
+	if !st.open {
+		st.quote = false
+	}
+	changed, open := false, false
+	for i := 0; i < len(b); {
+		if !isPrintable(b[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(b) && isPrintable(b[j]) {
+			j++
+		}
+		sqlAt := -1
+		if i == 0 && st.open {
+			sqlAt = 0
+		} else if m := rScrubSQL.FindIndex(b[i:j]); m != nil {
+			sqlAt = i + m[0]
+			st.quote = false
+		}
+		if sqlAt >= 0 {
+			changed = maskRun(b[i:sqlAt], keep[i:sqlAt]) || changed
+			changed = scrubSQL(b[sqlAt:j], st) || changed
+			open = j == len(b)
+		} else if j-i >= scrubMinRun {
+			changed = maskRun(b[i:j], keep[i:j]) || changed
+		}
+		i = j
+	}
+	st.open = open
+	return changed
+}
+
+// scrubSQL replaces string and numeric literals of SQL text with placeholders of the same length.
+// Bind placeholders (:1, :name), identifiers and comments are kept, so sqlid of scrubbed text is stable
+func scrubSQL(b []byte, st *sqlState) bool {
+	changed := false
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case st.quote:
+			if c == '\'' {
+				st.quote = false
+			} else if c != 'x' {
+				b[i] = 'x'
+				changed = true
+			}
+		case c == '\'':
+			st.quote = true
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentChar(b[i-1])):
+			for ; i < len(b) && (b[i] >= '0' && b[i] <= '9' || b[i] == '.'); i++ {
+				if b[i] != '0' && b[i] != '.' {
+					b[i] = '0'
+					changed = true
+				}
+			}
+			i--
+		}
+	}
+	return changed
+}
+
+// maskRun replaces characters of text not marked to keep with x, spaces are kept
+func maskRun(b []byte, keep []bool) bool {
+	changed := false
+	for i := range b {
+		if !keep[i] && b[i] != 'x' && b[i] != ' ' {
+			b[i] = 'x'
+			changed = true
+		}
+	}
+	return changed
+}
+
+func isPrintable(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c == '#' || c == ':' || c == '"'
+}
+
+// fixChecksums recomputes IPv4 header and TCP checksums after the frame was changed
+func fixChecksums(packet gopacket.Packet) {
+	tcp, _ := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if icmp, ok := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		icmp.Contents[2], icmp.Contents[3] = 0, 0
+		binary.BigEndian.PutUint16(icmp.Contents[2:4], foldSum(inetSum(inetSum(0, icmp.Contents), icmp.Payload)))
+	}
+	icmp6, _ := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6)
+	var pseudo []byte
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		ip.Contents[10], ip.Contents[11] = 0, 0
+		binary.BigEndian.PutUint16(ip.Contents[10:12], inetChecksum(0, ip.Contents))
+		if tcp != nil {
+			pseudo = append(append([]byte{}, ip.Contents[12:20]...), 0, byte(layers.IPProtocolTCP), 0, 0)
+			binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp.Contents)+len(tcp.Payload)))
+		}
+	case *layers.IPv6:
+		if tcp != nil {
+			pseudo = append(append([]byte{}, ip.Contents[8:40]...), 0, 0, 0, 0, 0, 0, 0, byte(layers.IPProtocolTCP))
+			binary.BigEndian.PutUint32(pseudo[32:], uint32(len(tcp.Contents)+len(tcp.Payload)))
+		} else if icmp6 != nil {
+			//Suma ICMPv6 obejmuje adresy z pseudo naglowka, wiec zmienia sie juz przez -anonymize
+			pseudo = append(append([]byte{}, ip.Contents[8:40]...), 0, 0, 0, 0, 0, 0, 0, byte(layers.IPProtocolICMPv6))
+			binary.BigEndian.PutUint32(pseudo[32:], uint32(len(icmp6.Contents)+len(icmp6.Payload)))
+			icmp6.Contents[2], icmp6.Contents[3] = 0, 0
+			sum := inetSum(inetSum(inetSum(0, pseudo), icmp6.Contents), icmp6.Payload)
+			binary.BigEndian.PutUint16(icmp6.Contents[2:4], foldSum(sum))
+			return
+		}
+	}
+	if pseudo == nil {
+		return
+	}
+	tcp.Contents[16], tcp.Contents[17] = 0, 0
+	sum := inetSum(inetSum(inetSum(0, pseudo), tcp.Contents), tcp.Payload)
+	binary.BigEndian.PutUint16(tcp.Contents[16:18], foldSum(sum))
+}
+
+func inetChecksum(sum uint32, b []byte) uint16 {
+	return foldSum(inetSum(sum, b))
+}
+
+// inetSum adds b to one's complement sum, b has to be of even length except the last one
+func inetSum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func foldSum(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,162 @@
+package tnsparse
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// StreamTimeout - data waiting that long for a lost segment is pushed through without it
+var StreamTimeout = 2 * time.Minute
+
+// tnsSegment describes where a TNS packet was sent and the TCP segment which completed it
+type tnsSegment struct {
+	Conversation string
+	AppPort      string
+	ToDB         bool
+	Timestamp    time.Time
+	Seq, Ack     uint32
+}
+
+// tnsStreamFactory creates stream of TNS packets for each direction of a TCP connection. Assembler
+// calls it while a packet is assembled, so the stream takes conversation of the current packet
+type tnsStreamFactory struct {
+	t *Parser
+}
+
+func (f *tnsStreamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	return &tnsStream{t: f.t, seg: f.t.cur}
+}
+
+// tnsStream cuts reassembled bytes of one direction into TNS packets using length from TNS header,
+// so SQL text and responses spanning many segments (and many TNS packets in one GRO segment) are parsed whole
+type tnsStream struct {
+	t   *Parser
+	seg tnsSegment
+	buf []byte
+}
+
+func (s *tnsStream) Reassembled(rs []tcpassembly.Reassembly) {
+	if cur := s.t.cur; cur.Conversation == s.seg.Conversation && cur.ToDB == s.seg.ToDB {
+		s.seg.Seq, s.seg.Ack = cur.Seq, cur.Ack
+	}
+	//Zalegle segmenty (czekajace na zgubiony albo po flush) przychodza razem - kazdy pakiet
+	//musi dostac czas segmentu z jego ostatnim bajtem, a nie ostatniego segmentu paczki
+	for _, r := range rs {
+		if r.Skip != 0 {
+			//Zgubione bajty - zaczynamy od nowa od nastepnego segmentu, byle nie nadpisac oddanych pakietow
+			s.flush()
+		}
+		s.buf = append(s.buf, r.Bytes...)
+		s.seg.Timestamp = r.Seen
+		s.cut()
+	}
+}
+
+// cut parses complete packets at the beginning of buf
+func (s *tnsStream) cut() {
+	if Protocol != ProtocolOracle {
+		//Pakiety MySQL, PostgreSQL i TDS ktore przyszly razem sa parsowane jako jeden
+		skip, n := s.t.packetsLen(s.seg, s.buf)
+		s.buf = s.buf[skip:]
+		if n > 0 {
+			s.t.handleTNS(s.seg, s.buf[:n:n])
+			s.buf = s.buf[n:]
+		}
+		return
+	}
+	for len(s.buf) >= tnsHeaderLen {
+		size, ok := tnsPacketLen(s.buf)
+		if !ok {
+			s.flush() //To nie naglowek TNS (TLS, dane po zgubionym segmencie) - calosc jak dawniej per segment
+			return
+		}
+		if size > len(s.buf) {
+			return //Reszta pakietu przyjdzie w kolejnych segmentach
+		}
+		s.t.handleTNS(s.seg, s.buf[:size:size])
+		s.buf = s.buf[size:]
+	}
+}
+
+// ReassemblyComplete parses bytes left when the connection is closed or flushed. Data of the same
+// direction seen later is a new stream, which has to be started again
+func (s *tnsStream) ReassemblyComplete() {
+	s.flush()
+	delete(s.t.started, s.seg.Conversation+"|"+strconv.FormatBool(s.seg.ToDB))
+	s.t.endConversation(s.seg.Conversation)
+}
+
+func (s *tnsStream) flush() {
+	if len(s.buf) > 0 {
+		s.t.handleTNS(s.seg, s.buf)
+	}
+	s.buf = nil
+}
+
+// tnsPacketLen returns length of TNS packet from its header. Length is 2 bytes or, for large SDU of newer
+// versions, 4 bytes. It fails for bytes which don't look like TNS header
+func tnsPacketLen(b []byte) (int, bool) {
+	size := int(binary.BigEndian.Uint16(b[0:2]))
+	if size == 0 {
+		size = int(binary.BigEndian.Uint32(b[0:4]))
+	}
+	if size < tnsHeaderLen || b[4] == 0 || b[4] > tnsMaxPacketType {
+		return 0, false
+	}
+	return size, true
+}
+
+// packetsLen returns length of complete packets of Protocol other than Oracle which follow skip bytes
+// at the beginning of b that can't be parsed
+func (t *Parser) packetsLen(seg tnsSegment, b []byte) (skip, n int) {
+	switch Protocol {
+	case ProtocolPostgres:
+		return pgPacketsLen(b, t.pgConn(seg.Conversation), seg.ToDB)
+	case ProtocolTDS:
+		return 0, tdsPacketsLen(b)
+	}
+	return 0, mysqlPacketsLen(b)
+}
+
+// startStream makes the assembler start stream of tcp's direction at this segment if its SYN wasn't seen.
+// tcpassembly waits for SYN and holds data of such streams (most pooled sessions of a capture) until
+// it gives up on them, so a SYN without data just before the segment is assembled first
+func (t *Parser) startStream(flow gopacket.Flow, tcp *layers.TCP, timestamp time.Time) {
+	key := t.cur.Conversation + "|" + strconv.FormatBool(t.cur.ToDB)
+	//Czyste ACK nie trafia do assemblera, start ustawi pierwszy segment z danymi.
+	//TCP keepalive po bezczynnosci niesie 1 bajt juz wyslany - strumien od niego bylby przesuniety
+	if t.started[key] || (!tcp.SYN && len(tcp.Payload) <= 1) {
+		return
+	}
+	t.started[key] = true
+	if tcp.SYN {
+		return
+	}
+	syn := *tcp //Kopia zachowuje porty przeplywu ustawione przy dekodowaniu
+	syn.BaseLayer = layers.BaseLayer{Contents: tcp.Contents}
+	syn.Seq, syn.SYN, syn.FIN, syn.RST = tcp.Seq-1, true, false, false
+	t.assembler.AssembleWithTimestamp(flow, &syn, timestamp)
+}
+
+// endConversation calls ConversationEndHooks once conversation is closed and streams of both directions
+// completed, so data sent with FIN and by the other side after it is already parsed
+func (t *Parser) endConversation(conversationId string) {
+	c, ok := t.Connections[conversationId]
+	if !ok || c.Closed.IsZero() || c.ended || t.started[conversationId+"|true"] || t.started[conversationId+"|false"] {
+		return
+	}
+	c.ended = true
+	for _, hook := range t.ConversationEndHooks {
+		hook(conversationId)
+	}
+}
+
+// FlushStreams parses TNS packets still waiting in reassembly, i.e. at the end of capture
+func (t *Parser) FlushStreams() {
+	t.assembler.FlushAll()
+}
@@ -0,0 +1,395 @@
+package tnsparse
+
+import (
+	"encoding/binary"
+	"log"
+	"strconv"
+	"unicode/utf16"
+)
+
+// SQL Server TDS protocol: messages are split into packets with 8 byte header (type, status, length
+// big endian with the header, spid, packet id, window), the last packet of a message has EOM status
+const (
+	tdsHeaderLen  = 8
+	tdsEOM        = byte(0x01)
+	tdsMaxRequest = 1 << 20 //Longer requests (bulk loads) are cut, SQL text is at their beginning
+
+	tdsSQLBatch  = byte(0x01)
+	tdsRPC       = byte(0x03)
+	tdsResponse  = byte(0x04)
+	tdsAttention = byte(0x06)
+	tdsBulkLoad  = byte(0x07)
+	tdsTransMgr  = byte(0x0e)
+	tdsLogin7    = byte(0x10)
+	tdsSSPI      = byte(0x11)
+	tdsPrelogin  = byte(0x12)
+
+	tdsTokenError       = byte(0xaa)
+	tdsTokenReturnValue = byte(0xac)
+	tdsTokenDone        = byte(0xfd)
+	tdsTokenDoneProc    = byte(0xfe)
+	tdsTokenDoneInProc  = byte(0xff)
+	tdsDoneCount        = uint16(0x0010)
+	tdsDoneLen          = 13 //token, status (2), current command (2), row count (8)
+
+	tdsTypeIntN     = byte(0x26)
+	tdsTypeInt4     = byte(0x38)
+	tdsTypeVarChar  = byte(0xa7)
+	tdsTypeChar     = byte(0xaf)
+	tdsTypeNVarChar = byte(0xe7)
+	tdsTypeNChar    = byte(0xef)
+	tdsPLP          = uint16(0xffff) //Max length of varchar(max)/nvarchar(max), value is sent in chunks
+)
+
+// Well known stored procedures called by id in RPC requests
+const (
+	tdsSpExecuteSQL = 10
+	tdsSpPrepare    = 11
+	tdsSpExecute    = 12
+	tdsSpPrepExec   = 13
+	tdsSpUnprepare  = 15
+)
+
+var tdsProcNames = map[uint16]string{1: "sp_cursor", 2: "sp_cursoropen", 3: "sp_cursorprepare", 4: "sp_cursorexecute",
+	5: "sp_cursorprepexec", 6: "sp_cursorunprepare", 7: "sp_cursorfetch", 8: "sp_cursoroption", 9: "sp_cursorclose",
+	10: "sp_executesql", 11: "sp_prepare", 12: "sp_execute", 13: "sp_prepexec", 14: "sp_prepexecrpc", 15: "sp_unprepare"}
+
+// tdsConn is state of a TDS conversation: statements prepared with sp_prepare/sp_prepexec by handle
+// (like cursor slots of TTC), request being reassembled and the execution waiting for its response
+type tdsConn struct {
+	handles   map[int32]string
+	request   []byte //data of request message so far
+	reqType   byte
+	preparing string //SQL of sp_prepare/sp_prepexec waiting for its handle in RETURNVALUE
+	executing bool
+}
+
+func (t *Parser) tdsConn(conversationId string) *tdsConn {
+	c, ok := t.tds[conversationId]
+	if !ok {
+		c = &tdsConn{handles: make(map[int32]string)}
+		t.tds[conversationId] = c
+	}
+	return c
+}
+
+// tdsPacket tells if b starts with TDS packet header
+func tdsPacket(b []byte) bool {
+	if len(b) < tdsHeaderLen || int(binary.BigEndian.Uint16(b[2:4])) < tdsHeaderLen {
+		return false
+	}
+	switch b[0] {
+	case tdsSQLBatch, tdsRPC, tdsResponse, tdsAttention, tdsBulkLoad, tdsTransMgr, tdsLogin7, tdsSSPI, tdsPrelogin:
+		return true
+	}
+	return false
+}
+
+// tdsPacketsLen returns length of complete TDS packets at the beginning of b. Bytes which aren't TDS
+// (TLS after PRELOGIN negotiated encryption of the whole session) are taken at once and skipped by the parser
+func tdsPacketsLen(b []byte) int {
+	n := 0
+	for len(b)-n >= tdsHeaderLen {
+		if !tdsPacket(b[n:]) {
+			if n == 0 {
+				return len(b)
+			}
+			break
+		}
+		size := int(binary.BigEndian.Uint16(b[n+2 : n+4]))
+		if size > len(b)-n {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// ucs2 decodes UTF-16LE text
+func ucs2(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// tdsSkipHeaders skips ALL_HEADERS of SQL batch and RPC requests (TDS 7.2+), older clients don't send them
+func tdsSkipHeaders(b []byte) []byte {
+	if len(b) < 4 {
+		return b
+	}
+	//Tekst UCS-2 nie zaczyna sie od malej liczby, wiec pomylka z dlugoscia naglowkow nie grozi
+	if total := int(binary.LittleEndian.Uint32(b)); total >= 4 && total <= len(b) && total < 1024 {
+		return b[total:]
+	}
+	return b
+}
+
+// tdsParam decodes RPC parameter of integer or character type, ok is false for other types
+func tdsParam(b []byte) (value []byte, typ byte, rest []byte, ok bool) {
+	if len(b) < 1 {
+		return nil, 0, nil, false
+	}
+	nameEnd := 1 + 2*int(b[0]) + 1 //Nazwa B_VARCHAR i bajt statusu
+	if len(b) < nameEnd+1 {
+		return nil, 0, nil, false
+	}
+	typ, b = b[nameEnd], b[nameEnd+1:]
+	switch typ {
+	case tdsTypeInt4:
+		if len(b) < 4 {
+			return nil, typ, nil, false
+		}
+		return b[:4], typ, b[4:], true
+	case tdsTypeIntN:
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, typ, nil, false
+		}
+		return b[2 : 2+int(b[1])], typ, b[2+int(b[1]):], true
+	case tdsTypeVarChar, tdsTypeChar, tdsTypeNVarChar, tdsTypeNChar:
+		if len(b) < 7 {
+			return nil, typ, nil, false
+		}
+		maxLen := binary.LittleEndian.Uint16(b)
+		b = b[7:] //Max length i collation
+		if maxLen != tdsPLP {
+			if len(b) < 2 {
+				return nil, typ, nil, false
+			}
+			size := int(binary.LittleEndian.Uint16(b))
+			if size == 0xffff {
+				return nil, typ, b[2:], true //NULL
+			}
+			if len(b) < 2+size {
+				return nil, typ, nil, false
+			}
+			return b[2 : 2+size], typ, b[2+size:], true
+		}
+		//PLP: dlugosc calosci, potem kawalki z dlugoscia, zakonczone zerowym
+		if len(b) < 8 {
+			return nil, typ, nil, false
+		}
+		if binary.LittleEndian.Uint64(b) == ^uint64(0) {
+			return nil, typ, b[8:], true //NULL
+		}
+		b = b[8:]
+		for len(b) >= 4 {
+			size := int(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+			if size == 0 {
+				return value, typ, b, true
+			}
+			if len(b) < size {
+				return nil, typ, nil, false
+			}
+			value = append(value, b[:size]...)
+			b = b[size:]
+		}
+	}
+	return nil, typ, nil, false
+}
+
+// tdsText returns parameter value as text
+func tdsText(value []byte, typ byte) string {
+	if typ == tdsTypeNVarChar || typ == tdsTypeNChar {
+		return ucs2(value)
+	}
+	return string(value)
+}
+
+// tdsInt returns parameter value as integer
+func tdsInt(value []byte) (int32, bool) {
+	if len(value) != 4 {
+		return 0, false
+	}
+	return int32(binary.LittleEndian.Uint32(value)), true
+}
+
+// parseTDS classifies TDS packets which arrived together and adds them to their conversation as one packet.
+// SQL batches and RPC calls start executions, the last packet of their response ends them with SQL_END
+func (t *Parser) parseTDS(seg tnsSegment, payload []byte) {
+	if !tdsPacket(payload) {
+		return //TLS
+	}
+	c := t.tdsConn(seg.Conversation)
+	p := SQLtcp{SQL: "_", Payload: payload, Response: !seg.ToDB, Timestamp: seg.Timestamp}
+	for b := payload; tdsPacket(b); {
+		size := int(binary.BigEndian.Uint16(b[2:4]))
+		if size > len(b) {
+			size = len(b)
+		}
+		typ, eom, data := b[0], b[1]&tdsEOM != 0, b[tdsHeaderLen:size]
+		b = b[size:]
+		if seg.ToDB {
+			if len(c.request) == 0 {
+				c.reqType = typ
+			}
+			if len(c.request) < tdsMaxRequest {
+				c.request = append(c.request, data...)
+			}
+			if eom {
+				c.requestDone(t, seg.Conversation, &p)
+			}
+		} else {
+			c.response(data, eom, &p)
+		}
+	}
+	t.addPacket(seg, p)
+}
+
+// requestDone decodes complete request message
+func (c *tdsConn) requestDone(t *Parser, conversationId string, p *SQLtcp) {
+	data := c.request
+	c.request = nil
+	switch c.reqType {
+	case tdsSQLBatch:
+		p.SQL = ucs2(tdsSkipHeaders(data))
+	case tdsRPC:
+		c.rpc(conversationId, tdsSkipHeaders(data), p)
+	case tdsAttention:
+		return //Przerwanie biezacego wykonania, koniec przyjdzie w odpowiedzi
+	default:
+		return
+	}
+	if p.SQL != "_" && p.SQL != "" {
+		c.executing = true
+		t.MarkFirstSQL(conversationId, p.SQL, p.Timestamp)
+	}
+}
+
+// rpc decodes RPC request: procedure called by id or name and parameters carrying SQL text or handle
+func (c *tdsConn) rpc(conversationId string, data []byte, p *SQLtcp) {
+	if len(data) < 2 {
+		return
+	}
+	var proc uint16
+	name := ""
+	if nameLen := binary.LittleEndian.Uint16(data); nameLen == 0xffff {
+		if len(data) < 4 {
+			return
+		}
+		proc = binary.LittleEndian.Uint16(data[2:])
+		name, data = tdsProcNames[proc], data[4:]
+	} else {
+		if len(data) < 2+2*int(nameLen) {
+			return
+		}
+		name, data = ucs2(data[2:2+2*int(nameLen)]), data[2+2*int(nameLen):]
+	}
+	if len(data) < 2 {
+		return
+	}
+	params := data[2:] //Za flagami opcji
+	switch proc {
+	case tdsSpExecuteSQL:
+		if stmt, typ, _, ok := tdsParam(params); ok {
+			p.SQL = tdsText(stmt, typ)
+		}
+		return
+	case tdsSpPrepare, tdsSpPrepExec:
+		//@handle OUTPUT, @params, @stmt - uchwyt przyjdzie w RETURNVALUE odpowiedzi
+		var stmt []byte
+		var typ byte
+		ok := true
+		for i := 0; i < 3 && ok; i++ {
+			stmt, typ, params, ok = tdsParam(params)
+		}
+		if !ok {
+			return
+		}
+		c.preparing = tdsText(stmt, typ)
+		if proc == tdsSpPrepExec {
+			p.SQL = c.preparing
+		}
+		return
+	case tdsSpExecute:
+		if value, _, _, ok := tdsParam(params); ok {
+			if handle, ok := tdsInt(value); ok {
+				//Jak wykonanie otwartego kursora w TTC - tresc jest z sp_prepare pod tym uchwytem
+				p.SQL = c.handles[handle]
+				p.IsReused = 1
+				log.Println("Called SQL text from prepared handle: ", p.SQL, conversationId+"_"+strconv.Itoa(int(handle)))
+			}
+		}
+		return
+	case tdsSpUnprepare:
+		if value, _, _, ok := tdsParam(params); ok {
+			if handle, ok := tdsInt(value); ok {
+				delete(c.handles, handle)
+			}
+		}
+		return
+	}
+	if name != "" {
+		p.SQL = "EXEC " + name //Wywolanie procedury po nazwie
+	}
+}
+
+// response finds errors, handle of prepared statement and rows in a packet of response message
+func (c *tdsConn) response(data []byte, eom bool, p *SQLtcp) {
+	if code := tdsError(data); code != "" {
+		p.OraErr = code
+	}
+	if c.preparing != "" {
+		if handle, ok := tdsReturnHandle(data); ok {
+			c.handles[handle] = c.preparing
+			c.preparing = ""
+		}
+	}
+	if !eom {
+		return
+	}
+	c.preparing = ""
+	if c.executing {
+		p.SQL = "SQL_END"
+		p.Rows = tdsDoneRows(data)
+		c.executing = false
+	}
+}
+
+// tdsError returns MSSQL-<number> of the first ERROR token in data, tokens are looked up by their layout:
+// length, number, state, class of an error (11-25) and message length fitting in the token
+func tdsError(data []byte) string {
+	for i := 0; i+11 <= len(data); i++ {
+		if data[i] != tdsTokenError {
+			continue
+		}
+		size := int(binary.LittleEndian.Uint16(data[i+1:]))
+		class := data[i+8]
+		msgLen := int(binary.LittleEndian.Uint16(data[i+9:]))
+		if class < 11 || class > 25 || size < 8+2*msgLen || i+3+size > len(data) {
+			continue
+		}
+		return "MSSQL-" + strconv.Itoa(int(binary.LittleEndian.Uint32(data[i+3:])))
+	}
+	return ""
+}
+
+// tdsReturnHandle finds integer output parameter returned in RETURNVALUE token (handle of sp_prepare/sp_prepexec)
+func tdsReturnHandle(data []byte) (int32, bool) {
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != tdsTokenReturnValue {
+			continue
+		}
+		//Ordinal (2), nazwa B_VARCHAR, status, user type (4), flagi (2), INTN dlugosci 4 z wartoscia
+		j := i + 3 + 1 + 2*int(data[i+3]) + 1 + 4 + 2
+		if j+7 <= len(data) && data[j] == tdsTypeIntN && data[j+1] == 4 && data[j+2] == 4 {
+			return int32(binary.LittleEndian.Uint32(data[j+3:])), true
+		}
+	}
+	return 0, false
+}
+
+// tdsDoneRows returns row count of the last DONE, DONEPROC or DONEINPROC token with count at the end of response
+func tdsDoneRows(data []byte) uint32 {
+	for i := len(data) - tdsDoneLen; i >= 0 && i >= len(data)-8*tdsDoneLen; i-- {
+		switch data[i] {
+		case tdsTokenDone, tdsTokenDoneProc, tdsTokenDoneInProc:
+			if binary.LittleEndian.Uint16(data[i+1:])&tdsDoneCount != 0 {
+				return uint32(binary.LittleEndian.Uint64(data[i+5:]))
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package tnsparse
+
+import "time"
+
+// clockStepThreshold - capture timestamp going back more than that is a step of the capturing host clock
+// (ntpd steps the clock when the offset is above 128ms), smaller jumps back are packets captured out of order
+const clockStepThreshold = 128 * time.Millisecond
+
+// Timing issues of an execution, see Execution.Timing
+const (
+	TimingClockStep     = "clock_step"     //execution spans a backward clock step, corrected
+	TimingReordered     = "reordered"      //packets were captured out of order, corrected by timestamp order
+	TimingSameTimestamp = "same_timestamp" //all packets have the same timestamp, capture clock resolution is too low
+)
+
+// ClockStep is a backward step of the capture clock, packets after it are shifted by Step
+type ClockStep struct {
+	At   time.Time     `json:"at"` //corrected timestamp of the first packet after the step
+	Step time.Duration `json:"step_ns"`
+}
+
+// ClockFixer makes capture timestamps monotonic across clock steps
+type ClockFixer struct {
+	last   time.Time
+	offset time.Duration
+}
+
+// Fix returns corrected timestamp of the packet, a step back bigger than clockStepThreshold is removed
+// by shifting this and all next packets forward. The step is returned too, 0 if the clock didn't step
+func (f *ClockFixer) Fix(ts time.Time) (time.Time, time.Duration) {
+	ts = ts.Add(f.offset)
+	step := time.Duration(0)
+	if !f.last.IsZero() && f.last.Sub(ts) > clockStepThreshold {
+		step = f.last.Sub(ts)
+		f.offset += step
+		ts = f.last
+	}
+	if ts.After(f.last) {
+		f.last = ts
+	}
+	return ts, step
+}
+
+// appendPacket adds packet to conversation keeping timestamp order. A packet captured out of order
+// is inserted at its place and marked as Reordered, RTT of responses is computed from the previous packet
+func (t *Parser) appendPacket(conversationId string, p SQLtcp) {
+	if _, ok := t.Conversations[conversationId]; !ok {
+		for _, hook := range t.ConversationStartHooks {
+			hook(conversationId)
+		}
+	}
+	p.Size = len(p.Payload)
+	if p.OraErr == "" {
+		p.OraErr = OraError(p.Payload)
+	}
+	measurePacket(&p)
+	if LowMemory {
+		p.Payload = nil
+	}
+	packets := append(t.Conversations[conversationId], p)
+	i := len(packets) - 1
+	for ; i > 0 && packets[i-1].Timestamp.After(p.Timestamp); i-- {
+		packets[i] = packets[i-1]
+	}
+	if i < len(packets)-1 {
+		p.Reordered = true
+	}
+	packets[i] = p
+	for _, j := range []int{i, i + 1} {
+		if j < len(packets) && packets[j].Response {
+			packets[j].RTT = 0
+			if j > 0 {
+				packets[j].RTT = packets[j].Timestamp.Sub(packets[j-1].Timestamp).Nanoseconds()
+			}
+		}
+	}
+	t.Conversations[conversationId] = packets
+}
+
+// timingIssue classifies timestamps of an execution made of packets
+func (t *Parser) timingIssue(packets []SQLtcp, appNs int64) string {
+	begin, end := packets[0].Timestamp, packets[len(packets)-1].Timestamp
+	for _, s := range t.ClockSteps {
+		if s.At.After(begin) && !s.At.After(end) {
+			return TimingClockStep
+		}
+	}
+	for _, p := range packets {
+		if p.Reordered {
+			return TimingReordered
+		}
+	}
+	if appNs == 0 && len(packets) > 1 {
+		return TimingSameTimestamp
+	}
+	return ""
+}
@@ -0,0 +1,459 @@
+package tnsparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+	"github.com/ora600pl/stado/sqlid"
+)
+
+const (
+	littleEndianFlag = byte(254)
+	bigEndianFlag    = byte(0)
+	oneByteSizeFlag  = byte(1)
+	uncertainSqlSize = 65279   // 0xFEFF at the beginning of SQL
+	retOpiParam      = byte(8) //TNS Header at @10
+	retStatus        = byte(4) //TNS Header at @10
+	tnsPacketData    = byte(6) //TNS Header at@4
+	tnsPacketConnect = byte(1) //TNS Header at@4
+	tnsPacketAccept  = byte(2)
+	tnsPacketRefuse  = byte(4)
+	tnsPacketResend  = byte(11)
+	tnsMaxPacketType = byte(15)
+	tnsHeaderLen     = 8
+)
+
+var (
+	usedCursorFlag           = []byte{29, 6}  //Packet length 29 and type DATA (0x06)
+	usedCursorFlagAfterError = []byte{48, 6}  //Packet length 48 and type DATA (0x06)
+	endOfDataFlag            = []byte{123, 5} //Flag in ResonseData 0x7b05 before ORA-01403 at the end of fetch
+	rSQL                     = regexp.MustCompile("(?i)SELECT|update|insert|with|delete|commit|alter")
+)
+
+type SQLtcp struct {
+	SQL_id       string
+	SQL          string
+	Conversation string
+	Payload      []byte
+	Seq          uint32
+	Ack          uint32
+	Timestamp    time.Time
+	IsReused     uint
+	RTT          int64
+	Response     bool      //Packet sent by the database
+	Reordered    bool      //Packet was captured out of order and moved to its place by timestamp
+	Rows         uint32    //Rows processed reported in RetStatus response or fetched till the end of fetch
+	Size         int       //Length of payload, kept when -low-memory drops the payload
+	OraErr       string    //ORA- error found in payload, see OraError
+	Metrics      []float64 //Values of CustomMetrics, nil if there are none
+}
+
+type SQLtcpSort []SQLtcp
+
+func (a SQLtcpSort) Len() int           { return len(a) }
+func (a SQLtcpSort) Less(i, j int) bool { return a[j].Seq == a[i].Ack }
+func (a SQLtcpSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// Parser keeps the state of TNS flows between packets and appends classified packets to Conversations.
+// Each parser has its own conversations and connections, so captures can be parsed side by side
+type Parser struct {
+	DBIPs      []string
+	DBPort     string
+	IPTnsBytes map[string]uint64 //TNS bytes per database IP
+	TBegin     time.Time         //liczenie horyzontu czasu od: do: z pliku pcap
+	TEnd       time.Time
+	SoftFilter bool            //capture source couldn't apply BPF filter, so packets from other hosts/ports have to be skipped here
+	Dedup      *Deduper        //drops frames captured twice, nil if disabled
+	Mirror     *MirrorDetector //pairs legs of sessions captured twice, nil if disabled
+	Window     *TimeWindow     //packets outside -from/-to are skipped, nil if all are analyzed
+	Packets    uint64          //all packets passed to Parse
+	Clock      ClockFixer
+
+	Conversations   map[string][]SQLtcp   //Packets of each conversation in timestamp order
+	Connections     map[string]*ConnStats //TCP and TNS connection state of each conversation, also without packets
+	Evicted         []EvictedConversation //Conversations dropped from Conversations, counted back into statistics
+	EvictedDropped  EvictedDrops          //Evicted conversations dropped because of MaxEvicted
+	ClockSteps      []ClockStep           //Backward steps of the capture clock found so far
+	MirrorLegs      map[string]string     //Client side leg of a session captured twice to its server side leg, see MirrorDetector
+	MirroredLegs    map[string]string     //Server side legs to client side legs, they are left out of statistics
+	FragmentsByPeer map[string]uint       //Non-first IP fragments per database<->peer pair, they don't carry TCP ports
+	FragNeeded      map[string]uint16     //Next-hop MTU from ICMP fragmentation needed per database<->router pair
+	NNEDecryptor    Decryptor             //Decrypts sessions encrypted with Native Network Encryption, nil leaves them undecoded
+	ErrorHooks      []func(err error)     //Called for packets which can't be decoded and flows which can't be counted
+
+	ConversationStartHooks []func(conversationId string) //Called with conversation which first packet is about to be kept
+	ConversationEndHooks   []func(conversationId string) //Called when conversation is closed and its last packets were parsed
+	EvictionHooks          []func(conversationId string) //Called with conversation which packets are about to be dropped
+
+	SQLslot      map[string]string
+	sqlTxtFlow   map[string]string      //mapa wykonanych polecen sql w danej konwersacji z przypisaniem do slotu otwartego kursora
+	profiles     map[string]*TTCProfile //TTC layout detected at logon of each conversation
+	assembler    *tcpassembly.Assembler //reassembles TCP streams into TNS packets
+	cur          tnsSegment             //segment being assembled
+	started      map[string]bool        //Stream directions started by SYN or by the first segment with data
+	reusedCursor uint                   //Licznik uzytych ponownie kursorow z klienta
+	mysql        map[string]*mysqlConn  //State of MySQL conversations (-protocol mysql)
+	postgres     map[string]*pgConn     //State of PostgreSQL conversations (-protocol postgres)
+	tds          map[string]*tdsConn    //State of SQL Server conversations (-protocol tds)
+	evictedSize  int                    //Executions and conversations in Evicted
+	errorMu      sync.Mutex             //Serializes ErrorHooks called from workers
+}
+
+// NewParser returns a parser for database listening on dbPort at any of dbIPs
+func NewParser(dbIPs []string, dbPort string) *Parser {
+	//IPv6 ma wiele zapisow tego samego adresu, porownujemy z tym co zwraca net.IP.String()
+	canonical := make([]string, len(dbIPs))
+	for i, dbIP := range dbIPs {
+		canonical[i] = dbIP
+		if addr := net.ParseIP(strings.TrimSpace(dbIP)); addr != nil {
+			canonical[i] = addr.String()
+		}
+	}
+	t := &Parser{
+		DBIPs:      canonical,
+		DBPort:     dbPort,
+		IPTnsBytes: make(map[string]uint64),
+		SQLslot:    make(map[string]string),
+		sqlTxtFlow: make(map[string]string),
+		profiles:   make(map[string]*TTCProfile),
+		mysql:      make(map[string]*mysqlConn),
+		postgres:   make(map[string]*pgConn),
+		tds:        make(map[string]*tdsConn),
+		started:    make(map[string]bool),
+
+		Conversations:   make(map[string][]SQLtcp),
+		Connections:     make(map[string]*ConnStats),
+		MirrorLegs:      make(map[string]string),
+		MirroredLegs:    make(map[string]string),
+		FragmentsByPeer: make(map[string]uint),
+		FragNeeded:      make(map[string]uint16),
+	}
+	t.assembler = tcpassembly.NewAssembler(tcpassembly.NewStreamPool(&tnsStreamFactory{t}))
+	t.assembler.MaxBufferedPagesPerConnection = 1000 //Nie czekamy w nieskonczonosc na zgubiony segment
+	return t
+}
+
+// ipHeader is what the parser needs from IPv4 or IPv6 header
+type ipHeader struct {
+	SrcIP, DstIP  net.IP
+	Id            uint16 //IPv4 identification, 0 for IPv6
+	MoreFragments bool
+	Flow          gopacket.Flow
+}
+
+// IPHeaderOf returns IP header of packet, false if it is neither IPv4 nor IPv6
+func IPHeaderOf(packet gopacket.Packet) (ipHeader, bool) {
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return ipHeader{ip.SrcIP, ip.DstIP, ip.Id, ip.Flags&layers.IPv4MoreFragments != 0, ip.NetworkFlow()}, true
+	case *layers.IPv6:
+		//Pofragmentowany IPv6 nie ma warstwy TCP (gopacket nie sklada fragmentow), wiec tu zawsze pelny pakiet
+		return ipHeader{ip.SrcIP, ip.DstIP, 0, false, ip.NetworkFlow()}, true
+	}
+	return ipHeader{}, false
+}
+
+// Parse classifies a single packet and adds it to its conversation
+func (t *Parser) Parse(packet gopacket.Packet) {
+	var appPort, appIp, found_dbIp, found_dbPort string
+
+	t.Packets++
+	ts, step := t.Clock.Fix(packet.Metadata().Timestamp)
+	if step > 0 {
+		t.ClockSteps = append(t.ClockSteps, ClockStep{At: ts, Step: step})
+		t.reportError(fmt.Errorf("capture clock stepped back by %v at %v, next packets are shifted", step, ts))
+	}
+	packet.Metadata().Timestamp = ts
+	if t.Window != nil && !t.Window.Contains(packet.Metadata().Timestamp) {
+		return
+	}
+	if t.Packets%evictEvery == 0 {
+		t.assembler.FlushOlderThan(packet.Metadata().Timestamp.Add(-StreamTimeout))
+		t.Evict(packet.Metadata().Timestamp)
+	}
+	log.Println("Started packets loop") //Tylko pakiety z wartstwa aplikacyjna (TNS) beda parsowane
+	app := packet.ApplicationLayer()
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	ipv4Layer := packet.Layer(layers.LayerTypeIPv4)
+	log.Println("Created tcp and ip layers from packet")
+	if tcpLayer == nil && ipv4Layer != nil {
+		t.parseFragment(ipv4Layer.(*layers.IPv4), packet)
+		return
+	}
+	ip, ok := IPHeaderOf(packet)
+	if tcpLayer == nil || !ok {
+		log.Println("Not a TCP/IP packet, skipping")
+		return
+	}
+	tcp := tcpLayer.(*layers.TCP)
+	//log.Println(packet)
+	log.Println("Created tcp and ip fields based on layers")
+	if t.Dedup != nil && t.Dedup.Duplicate(ip, tcp, packet.Metadata().Timestamp) {
+		log.Println("Duplicate frame, skipping")
+		return
+	}
+	/*Petla ma na celu ustalenie adresow IP bazy i klienta w badanym pakiecie.
+	  Odbywa sie to na podstawie porownania zrodlowych i docelowych portow z zadeklarowanym
+	  portem z flagi "-p" */
+	for _, checkIP := range t.DBIPs {
+		log.Println("Checking if " + ip.SrcIP.String() +
+			" or " + ip.DstIP.String() + " contains " + string(checkIP))
+
+		//Na loopbacku klient i baza maja ten sam adres - wtedy kierunek rozstrzyga port bazy
+		if strings.Contains(ip.SrcIP.String(), strings.TrimSpace(checkIP)) &&
+			(!strings.Contains(ip.DstIP.String(), strings.TrimSpace(checkIP)) || IsPort(tcp.SrcPort, t.DBPort)) {
+			log.Println("Database ip: " + string(checkIP) + " found in source")
+			appPort = tcp.DstPort.String()
+			appIp = ip.DstIP.String()
+			found_dbIp = ip.SrcIP.String()
+			found_dbPort = tcp.SrcPort.String()
+		} else if strings.Contains(ip.DstIP.String(), strings.TrimSpace(checkIP)) {
+			log.Println("Database ip: " + string(checkIP) + " found in destination")
+			appPort = tcp.SrcPort.String()
+			appIp = ip.SrcIP.String()
+			found_dbIp = ip.DstIP.String()
+			found_dbPort = tcp.DstPort.String()
+		}
+
+	}
+	log.Println("Defined app and db ports")
+	if t.SoftFilter && (found_dbIp == "" || !isPortName(found_dbPort, t.DBPort)) {
+		log.Println("Packet doesn't match database ip and port, skipping")
+		return
+	}
+	conversationId := found_dbIp + ":" + found_dbPort + "<->" + appIp + ":" + appPort //ID konwersjacji jest kluczem wiekszosci map
+	log.Println("Created conversation id", conversationId, tcp.Seq, tcp.Ack)
+
+	//SYN, FIN i RST nie maja payloadu, wiec stan polaczenia trzeba sledzic zanim pakiet odpadnie
+	t.TrackConnection(conversationId, tcp, packet.Metadata().Timestamp, found_dbIp == ip.SrcIP.String(), ip.MoreFragments)
+	if app != nil {
+		t.IPTnsBytes[found_dbIp] += uint64(len(app.Payload())) //zliczenie ilosci przetransferowanych pakietow TNS dla IP bazy
+		log.Println("TNS bytes sent over IP address: ", t.IPTnsBytes)
+	}
+
+	//Pakiety TNS sa skladane ze strumienia bajtow - SQL i odpowiedzi bywaja dluzsze niz segment,
+	//a przy GRO/LRO jeden segment niesie kilka pakietow TNS. Gotowe pakiety trafiaja do handleTNS
+	t.cur = tnsSegment{Conversation: conversationId, AppPort: appPort, ToDB: IsPort(tcp.DstPort, t.DBPort),
+		Timestamp: packet.Metadata().Timestamp, Seq: tcp.Seq, Ack: tcp.Ack}
+	t.startStream(ip.Flow, tcp, packet.Metadata().Timestamp)
+	t.assembler.AssembleWithTimestamp(ip.Flow, tcp, packet.Metadata().Timestamp)
+	t.endConversation(conversationId)
+}
+
+// handleTNS follows connect phase and parses a single reassembled TNS packet
+func (t *Parser) handleTNS(seg tnsSegment, payload []byte) {
+	switch Protocol {
+	case ProtocolMySQL:
+		t.parseMySQL(seg, payload)
+		return
+	case ProtocolPostgres:
+		t.parsePostgres(seg, payload)
+		return
+	case ProtocolTDS:
+		t.parseTDS(seg, payload)
+		return
+	}
+	if len(payload) > 4 {
+		t.TrackConnect(seg.Conversation, payload, seg.ToDB, seg.Timestamp)
+		t.TrackAuth(seg.Conversation, payload, seg.ToDB, seg.Timestamp)
+		t.TrackEncryption(seg.Conversation, payload, seg.ToDB)
+		//Po negocjacji ANO dane sa zaszyfrowane - bez klucza pakiet liczy sie tylko do bajtow i RTT
+		if payload[4] == tnsPacketData && t.sessionEncrypted(seg.Conversation) && !bytes.Contains(payload, anoMagic) {
+			plain := t.decrypt(seg, payload)
+			if plain == nil {
+				t.addPacket(seg, SQLtcp{SQL: "_", Payload: payload, Response: !seg.ToDB})
+				return
+			}
+			payload = plain
+		}
+	}
+	if !seg.ToDB {
+		t.detectProfile(seg.Conversation, payload)
+	}
+	t.parseTNS(seg, payload)
+}
+
+// parseTNS classifies a single TNS packet and adds it to its conversation
+func (t *Parser) parseTNS(seg tnsSegment, payload []byte) {
+	conversationId, appPort := seg.Conversation, seg.AppPort
+	sqlTxt := "_"
+	foundValidPacket := true //flag to filter out packets for testing purposes
+	responsePacket := false
+	profile := t.Profile(conversationId)
+	rows := uint32(0)
+	if seg.ToDB { //Pakiet typu request
+		//Zamkniety kursor zwalnia slot - serwer moze go dac innemu poleceniu
+		for _, cursor := range closedCursors(payload, profile) {
+			log.Println("Cursor closed: ", conversationId, cursor)
+			delete(t.SQLslot, conversationId+"_"+strconv.FormatUint(uint64(cursor), 10))
+		}
+		//Sprawdzenie czy request zawiera tresc polecenia SQL z wyrazenia regularnego
+		// i nie jest jednoczesnie przeslaniem deskryptora polaczenia
+		if mi := rSQL.FindStringIndex(string(payload)); mi != nil &&
+			!strings.Contains(string(payload), "DESCRIPTION") {
+
+			//W niektorych przypadkach dlugosc zapytania jest podawana w formie malego
+			//a w innych wielkiego indianina - jest flaga, ktora o tym mowi
+			sqlLen := 0
+			endianFlag := payload[mi[0]-5 : mi[0]-4]
+			log.Println("Endian flag is: ", endianFlag)
+			sqlLenB := payload[mi[0]-4 : mi[0]]
+			log.Println("SQL len is: ", sqlLenB)
+			log.Println(seg)
+
+			if endianFlag[0] == littleEndianFlag {
+				sqlLen = int(binary.LittleEndian.Uint32(sqlLenB))
+			} else if endianFlag[0] == bigEndianFlag {
+				sqlLen = int(binary.BigEndian.Uint32(sqlLenB))
+			} else if endianFlag[0] == oneByteSizeFlag {
+				sqlLen = int(sqlLenB[3])
+			}
+			//Ale czasem kartofelki i wuj wielki - wtedy trzeba okreslic dlugosc SQL bardziej manualnie.
+			//I to ssie - przydaloby sie znalezc na to lepsza regule
+			if sqlLen == uncertainSqlSize || sqlLen >= len(payload[mi[0]-4:]) {
+				log.Println("Can't determine sqlLen size")
+				sqlBufStart := payload[mi[0]:]
+				sqlTxtEnd := len(sqlBufStart) - 1
+				for i, v := range sqlBufStart {
+					if int(v) == 0 {
+						sqlTxtEnd = i
+						break
+					}
+				}
+				sqlTxt = string(sqlBufStart[0:sqlTxtEnd])
+			} else {
+				sqlTxt = string(payload[mi[0] : mi[0]+sqlLen])
+			}
+			t.sqlTxtFlow[conversationId] = sqlTxt //W tej konwersjacji ostatnio wykonanym zapytaniem jest powyzej znalezione
+			t.MarkFirstSQL(conversationId, sqlTxt, seg.Timestamp)
+
+			log.Println("SQLFlow for conversation ",
+				conversationId, t.sqlTxtFlow[conversationId], sqlid.Get(sqlTxt))
+
+			log.Println("Found SQL Text based on regular expression")
+			foundValidPacket = true
+
+		} else if cursor, ok := executeCursor(payload, profile); ok {
+			//JDBC thin: statement sparsowany raz, potem same wykonania po numerze kursora (moze byc wiekszy niz 1B)
+			cursorSlot := strconv.FormatUint(uint64(cursor), 10)
+			sqlTxt = t.SQLslot[conversationId+"_"+cursorSlot]
+			log.Println("Called SQL text from executed cursor: ",
+				sqlTxt, appPort, seg.Seq, seg.Ack, conversationId+"_"+cursorSlot)
+
+			t.reusedCursor = 1
+			foundValidPacket = true
+
+		} else if len(payload) > profile.UsedCursorSlot && profile.usedCursor(payload) {
+			//Jesli w pakiecie request nie ma tresci zapytania, to znaczy ze uzywam otwartego kursora
+			log.Printf("Used: % 02x => %s, %d\n", payload[3:5], appPort, seg.Seq)
+
+			//Na @13 (UsedCursorSlot) jest 1B z ID slotu, na ktorym po stronie serwera jest zapamietany ten kursor
+			//klient prosi o wykonanie tego kursora ze slotu, wiec ja sobie sprytnie ten slot biere i zapmietuje
+			cursorSlot := slotAt(payload, profile.UsedCursorSlot)
+			//No i go pobieram. Zapamietanie jest na poziomie rozkminy pakietu response -
+			//bo wtedy ony serwer to zwraca
+			sqlTxt = t.SQLslot[conversationId+"_"+cursorSlot]
+
+			log.Println("Called SQL text from reused cursor: ",
+				sqlTxt, appPort, seg.Seq, seg.Ack, conversationId+"_"+cursorSlot)
+
+			t.reusedCursor = 1 //Oznaczam sobie, ze to taki sprytny otwarty kursorek
+			foundValidPacket = true
+		}
+	} else { //A tu juz zachodzi parsowanie pakietu response
+		responsePacket = true //mhm
+		if strings.Contains(string(payload), "ORA-01403") {
+			//Jesli pojawia sie, ze danych brak, to znaczy, ze ony pakiet ostatnim jest w pobraniu z serwera danych
+
+			sqlTxt = "SQL_END"
+			endOfDataI := bytes.Index(payload, profile.EndOfDataFlag) //Jest flaga, na koniec danych w pakiecie endOfDataFlag(0x7b05)
+			log.Println("End Of Data Byte is: ", endOfDataI)
+			if endOfDataI > 0 {
+				rows, _ = fetchedRows(payload, endOfDataI)
+			}
+			cursorSlot := slotAt(payload, endOfDataI+profile.EndOfDataSlot) //I @+6 jest slocik, pod ktorym Pan Serwer kurson ony zapamietal
+			log.Println("Cursor Slot is: ", cursorSlot)
+
+			t.SQLslot[conversationId+"_"+cursorSlot] = t.sqlTxtFlow[conversationId] //To i ja dla tej konwersacyji tresc SQL pamietam
+			foundValidPacket = true
+
+		} else if len(payload) > 20 &&
+			!strings.Contains(string(payload), "AUTH") &&
+			payload[4] == tnsPacketData {
+			//Ale nie zawsze jest tak pieknie, ze reponse ma koniec danych, oj nie zawsze!
+			//Czasem to pakiet po DML a wtedy nic ino flagi retOpiParam albo retStatus
+			//Ale i tam numery slotow znalezn sposobna
+			if payload[profile.MsgType] == retOpiParam {
+				cursorSlot := slotAt(payload, profile.RetOpiParamSlot)
+				log.Println("Cursor Slot in RetOpiParam is: ", cursorSlot, appPort, seg.Seq)
+
+				t.SQLslot[conversationId+"_"+cursorSlot] = t.sqlTxtFlow[conversationId]
+				foundValidPacket = true
+
+			} else if payload[profile.MsgType] == retStatus {
+
+				cursorSlot := slotAt(payload, profile.RetStatusSlot)
+				log.Println("Cursor Slot in RetStatus is: ", cursorSlot, appPort, seg.Seq)
+				rows, _ = rowsProcessed(payload, profile)
+
+				t.SQLslot[conversationId+"_"+cursorSlot] = t.sqlTxtFlow[conversationId]
+				foundValidPacket = true
+
+			}
+		}
+	}
+
+	if foundValidPacket {
+		t.addPacket(seg, SQLtcp{SQL: sqlTxt,
+			Payload:  payload,
+			IsReused: t.reusedCursor,
+			Response: responsePacket,
+			Rows:     rows,
+		})
+		t.reusedCursor = 0
+	}
+}
+
+// addPacket fills sqlid and TCP fields of packet classified by protocol parser and adds it to its conversation
+func (t *Parser) addPacket(seg tnsSegment, p SQLtcp) {
+	if len(p.SQL) == 0 {
+		p.SQL = "_" //A to taki placeholderek dla pakietow posrednich - tam gdzie tresci nie lza
+	}
+	//O a tu, to sobie ogarniamy od kiedy, do kiedy ten PCAP trwal
+	if t.TBegin.IsZero() {
+		t.TBegin = seg.Timestamp //No bo pierwsza date ustawiamy ino roz
+	}
+	t.TEnd = seg.Timestamp //A te ostatnio to ciungle w gore i w gore
+
+	p.SQL_id = sqlid.Get(p.SQL)
+	p.Conversation = seg.Conversation
+	p.Seq, p.Ack, p.Timestamp = seg.Seq, seg.Ack, seg.Timestamp
+	if t.Mirror != nil {
+		t.observeMirror(seg.Conversation, &p)
+	}
+	//RTT pakietu response (czas od poprzedniego pakietu konwersacji) liczy appendPacket
+	t.appendPacket(seg.Conversation, p)
+	log.Println("Added packaet to conversation ID: "+
+		seg.Conversation, p.SQL, p.SQL_id, len(p.SQL), p.IsReused)
+}
+
+// isPortName tells if port string as formatted by layers.TCPPort (i.e. "1521(ncube-lm)") is dbPort
+func isPortName(port string, dbPort string) bool {
+	return port == dbPort || strings.HasPrefix(port, dbPort+"(")
+}
+
+// IsPort tells if TCP port is dbPort
+func IsPort(port layers.TCPPort, dbPort string) bool {
+	return isPortName(port.String(), dbPort)
+}
@@ -0,0 +1,152 @@
+package tnsparse
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TNSNames maps database endpoint "ip:port" to its aliases and service names
+var TNSNames = make(map[string][]string)
+
+var (
+	rTnsAddress = regexp.MustCompile(`(?i)\(\s*ADDRESS\s*=((?:[^()]|\([^()]*\))*)\)`)
+	rTnsHost    = regexp.MustCompile(`(?i)\(\s*HOST\s*=\s*([^)\s]+)\s*\)`)
+	rTnsPort    = regexp.MustCompile(`(?i)\(\s*PORT\s*=\s*(\d+)\s*\)`)
+	rTnsService = regexp.MustCompile(`(?i)\(\s*(?:SERVICE_NAME|SID)\s*=\s*([^)\s]+)\s*\)`)
+	rLdifCn     = regexp.MustCompile(`(?i)^dn:\s*cn=([^,]+)`)
+)
+
+// LoadTNSNames reads tnsnames.ora or LDIF export of OracleContext (orclNetDescString attributes)
+func LoadTNSNames(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if regexp.MustCompile(`(?im)^orclNetDescString:`).Match(content) {
+		loadLdif(string(content))
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		lines = append(lines, strings.SplitN(line, "#", 2)[0])
+	}
+	text := strings.Join(lines, "\n")
+	//Alias to wszystko przed "=" na poziomie zerowym nawiasow, a opis to caly blok nawiasow za nim
+	depth, start := 0, 0
+	alias, pending := "", ""
+	for i, ch := range text {
+		switch {
+		case ch == '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 && alias != "" {
+				addTNSEntry(alias, text[start:i+1])
+				alias = ""
+			}
+		case depth == 0 && ch == '=':
+			alias = strings.TrimSpace(pending)
+			pending = ""
+		case depth == 0:
+			pending += string(ch)
+		}
+	}
+	return nil
+}
+
+func loadLdif(content string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	alias, desc := "", ""
+	flush := func() {
+		if alias != "" && desc != "" {
+			addTNSEntry(alias, desc)
+		}
+		desc = ""
+	}
+	inDesc := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inDesc && strings.HasPrefix(line, " ") {
+			desc += strings.TrimPrefix(line, " ")
+			continue
+		}
+		inDesc = false
+		if m := rLdifCn.FindStringSubmatch(line); m != nil {
+			flush()
+			alias = m[1]
+		} else if strings.HasPrefix(strings.ToLower(line), "orclnetdescstring:") {
+			desc = strings.TrimSpace(line[len("orclnetdescstring:"):])
+			inDesc = true
+		}
+	}
+	flush()
+}
+
+// addTNSEntry registers every ADDRESS of the description under alias (and its service name)
+func addTNSEntry(alias string, desc string) {
+	aliases := strings.Split(alias, ",")
+	for i := range aliases {
+		aliases[i] = strings.TrimSpace(aliases[i])
+	}
+	alias = strings.Join(aliases, ",")
+	label := alias
+	if m := rTnsService.FindStringSubmatch(desc); m != nil && !strings.EqualFold(m[1], alias) {
+		label += "[" + m[1] + "]"
+	}
+	for _, addr := range rTnsAddress.FindAllStringSubmatch(desc, -1) {
+		host := rTnsHost.FindStringSubmatch(addr[1])
+		port := rTnsPort.FindStringSubmatch(addr[1])
+		if host == nil || port == nil {
+			continue
+		}
+		ips := []string{host[1]}
+		if net.ParseIP(host[1]) == nil {
+			if resolved := LookupHost(host[1]); resolved != nil {
+				ips = resolved
+			}
+		}
+		for _, ip := range ips {
+			key := ip + ":" + port[1]
+			if !containsString(TNSNames[key], label) {
+				TNSNames[key] = append(TNSNames[key], label)
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DBLabel returns tnsnames aliases of database endpoint, or ip:port if it's unknown
+func DBLabel(ip string, port string) string {
+	if i := strings.Index(port, "("); i >= 0 {
+		port = port[:i]
+	}
+	if names, ok := TNSNames[ip+":"+port]; ok {
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		return strings.Join(sorted, ",")
+	}
+	return ip + ":" + port
+}
+
+// DBLabelOf returns DBLabel of the database side of conversation id
+func DBLabelOf(conversationId string) string {
+	db := conversationId[:strings.Index(conversationId, "<->")]
+	i := strings.LastIndex(db, ":")
+	return DBLabel(db[:i], db[i+1:])
+}
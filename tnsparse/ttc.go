@@ -0,0 +1,138 @@
+package tnsparse
+
+import "strconv"
+
+// TTC (Two-Task Common) is the protocol of calls and responses carried in TNS DATA packets
+const (
+	ttcProtocolNegotiation = byte(1)    //TTC message type - client and server versions and character sets
+	ttcDataTypes           = byte(2)    //TTC message type - data type representations
+	ttcFunctionCall        = byte(3)    //TTC message type at TTCProfile.MsgType
+	ttcPiggyback           = byte(0x11) //TTC message type - call sent together with the next one
+	ttcFuncOALL8           = byte(0x5e) //Parse, bind, execute and fetch in a single call
+	ttcFuncOCLOSE          = byte(0x08) //Close a single cursor
+	ttcFuncOCCA            = byte(0x69) //Close array of cursors, piggybacked by OCI and JDBC before the next call
+	ttcCallHeader          = 3          //Message type, function code and sequence number before the first field
+)
+
+// readUB4 decodes TTC variable length number at off - a length byte followed by that many bytes
+// of big endian value - and returns the value and offset of the next field
+func readUB4(b []byte, off int) (uint32, int, bool) {
+	if off >= len(b) {
+		return 0, off, false
+	}
+	n := int(b[off] & 0x7f) //Najwyzszy bit to znak, numery kursorow sa dodatnie
+	if n > 4 || off+1+n > len(b) {
+		return 0, off, false
+	}
+	v := uint32(0)
+	for _, c := range b[off+1 : off+1+n] {
+		v = v<<8 | uint32(c)
+	}
+	return v, off + 1 + n, true
+}
+
+// executeCursor returns cursor id of OALL8 call executing already parsed statement. JDBC thin parses
+// a prepared statement once and then sends only the cursor id and binds, without SQL text:
+// options, cursor id, zero SQL text pointer and zero SQL length
+func executeCursor(payload []byte, p *TTCProfile) (uint32, bool) {
+	m := p.MsgType
+	if len(payload) <= m+ttcCallHeader || payload[4] != tnsPacketData ||
+		payload[m] != ttcFunctionCall || payload[m+1] != ttcFuncOALL8 {
+		return 0, false
+	}
+	_, off, ok := readUB4(payload, m+ttcCallHeader) //opcje wywolania
+	if !ok {
+		return 0, false
+	}
+	cursor, off, ok := readUB4(payload, off)
+	if !ok || cursor == 0 || off+1 >= len(payload) || payload[off] != 0 || payload[off+1] != 0 {
+		return 0, false
+	}
+	return cursor, true
+}
+
+// rowsProcessed returns rows processed by the call from RetStatus (end of call) response: call status,
+// end to end sequence number and then current row number, which for DML is number of rows affected
+func rowsProcessed(payload []byte, p *TTCProfile) (uint32, bool) {
+	m := p.MsgType
+	if len(payload) <= m+1 || payload[m] != retStatus {
+		return 0, false
+	}
+	_, off, ok := readUB4(payload, m+1)
+	if !ok {
+		return 0, false
+	}
+	if _, off, ok = readUB4(payload, off); !ok {
+		return 0, false
+	}
+	rows, _, ok := readUB4(payload, off)
+	return rows, ok
+}
+
+// fetchedRows returns rows fetched by the cursor from the error block at the end of fetch. ORA-01403 is
+// sent as UB2 (length 2, 0x057b) and its low byte starts EndOfDataFlag, the current row number is the UB4
+// right before the error number
+func fetchedRows(payload []byte, endOfDataI int) (uint32, bool) {
+	end := endOfDataI - 2 //Dlugosc i starszy bajt numeru bledu
+	if end < 1 || payload[end] != 2 || payload[end+1] != 5 {
+		return 0, false
+	}
+	for n := 4; n > 0; n-- {
+		start := end - 1 - n
+		if start < 0 || int(payload[start]) != n || payload[start+1] == 0 {
+			continue
+		}
+		if v, _, ok := readUB4(payload, start); ok {
+			return v, true
+		}
+	}
+	return 0, payload[end-1] == 0 //Zero wierszy to sam bajt dlugosci 0
+}
+
+// slotAt returns cursor number whose last byte is at off. Cursor numbers above 255 take more than
+// one byte and then the byte before them is the UB4 length, otherwise the single byte at off is used
+func slotAt(b []byte, off int) string {
+	if off >= len(b) {
+		return ""
+	}
+	for n := 4; n > 1; n-- {
+		start := off - n
+		if start < 0 || int(b[start]) != n || b[start+1] == 0 {
+			continue
+		}
+		if v, _, ok := readUB4(b, start); ok {
+			return strconv.FormatUint(uint64(v), 10)
+		}
+	}
+	return strconv.Itoa(int(b[off]))
+}
+
+// closedCursors returns cursor ids closed by OCLOSE call or by OCCA piggyback (pointer, count
+// and that many cursor ids), which may arrive in the same DATA packet as the next call
+func closedCursors(payload []byte, p *TTCProfile) []uint32 {
+	m := p.MsgType
+	if len(payload) <= m+ttcCallHeader || payload[4] != tnsPacketData {
+		return nil
+	}
+	switch {
+	case payload[m] == ttcFunctionCall && payload[m+1] == ttcFuncOCLOSE:
+		if cursor, _, ok := readUB4(payload, m+ttcCallHeader); ok && cursor != 0 {
+			return []uint32{cursor}
+		}
+	case payload[m] == ttcPiggyback && payload[m+1] == ttcFuncOCCA:
+		count, off, ok := readUB4(payload, m+ttcCallHeader+1) //Za wskaznikiem tablicy
+		if !ok {
+			return nil
+		}
+		var cursors []uint32
+		for i := uint32(0); i < count; i++ {
+			var cursor uint32
+			if cursor, off, ok = readUB4(payload, off); !ok {
+				break
+			}
+			cursors = append(cursors, cursor)
+		}
+		return cursors
+	}
+	return nil
+}
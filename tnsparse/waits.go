@@ -0,0 +1,97 @@
+package tnsparse
+
+// Wait classes of wire time - every gap between consecutive packets of an execution falls into one of them
+const (
+	WaitServer    = iota //request -> response: database is processing the call
+	WaitNetwork          //response -> response: rest of the response is in transit
+	WaitClient           //response -> request: client thinks before next fetch or call
+	WaitConnect          //packets before first SQL of a session: connect, auth and session setup
+	WaitCancelled        //whole execution that was cancelled or aborted
+	NumWaitClasses
+)
+
+// WaitClassNames are used as labels in reports
+var WaitClassNames = [NumWaitClasses]string{"server", "network", "client", "connect", "cancelled"}
+
+// CancelErrors mark an execution as cancelled/aborted instead of regular one
+var CancelErrors = map[string]bool{
+	"ORA-01013":  true, //user requested cancel of current operation
+	"MySQL-1317": true, //query execution was interrupted
+	"PG-57014":   true, //canceling statement due to user request or statement_timeout
+	"ORA-00028":  true, //your session has been killed
+	"ORA-03113":  true, //end-of-file on communication channel
+	"ORA-03114":  true, //not connected to ORACLE
+	"ORA-03135":  true, //connection lost contact
+}
+
+// WaitTimes is time (ms) spent in each wait class
+type WaitTimes [NumWaitClasses]float64
+
+func (w *WaitTimes) Add(other WaitTimes) {
+	for i := range w {
+		w[i] += other[i]
+	}
+}
+
+// Sum returns time of all wait classes
+func (w WaitTimes) Sum() float64 {
+	sum := 0.0
+	for _, v := range w {
+		sum += v
+	}
+	return sum
+}
+
+// Percent returns share of each wait class in the whole time
+func (w WaitTimes) Percent() WaitTimes {
+	var pct WaitTimes
+	if sum := w.Sum(); sum > 0 {
+		for i, v := range w {
+			pct[i] = v / sum * 100
+		}
+	}
+	return pct
+}
+
+// Map returns wait times keyed by wait class name, i.e. for JSON
+func (w WaitTimes) Map() map[string]float64 {
+	m := make(map[string]float64, NumWaitClasses)
+	for i, v := range w {
+		m[WaitClassNames[i]] = v
+	}
+	return m
+}
+
+// WaitTimesOf converts wait times keyed by class name (see Map) back
+func WaitTimesOf(m map[string]float64) WaitTimes {
+	var w WaitTimes
+	for i, name := range WaitClassNames {
+		w[i] = m[name]
+	}
+	return w
+}
+
+// WaitClass classifies the gap between prev and p, inSQL tells if the SQL of the flow is already known
+// and firstFlow if it is the first flow of the session (so the time before SQL is logon)
+func WaitClass(prev, p *SQLtcp, inSQL bool, firstFlow bool) int {
+	switch {
+	case !inSQL && firstFlow:
+		return WaitConnect
+	case !inSQL, !p.Response:
+		return WaitClient
+	case prev.Response:
+		return WaitNetwork
+	default:
+		return WaitServer
+	}
+}
+
+// Cancelled moves the whole time of an execution that ended with error to the cancelled class
+func (w *WaitTimes) Cancelled(oraErr string) {
+	if !CancelErrors[oraErr] {
+		return
+	}
+	sum := w.Sum()
+	*w = WaitTimes{}
+	w[WaitCancelled] = sum
+}
@@ -0,0 +1,102 @@
+package tnsparse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeBound is -from or -to: an absolute time, a time of day on the day the capture starts,
+// or a duration relative to the first packet of the capture
+type TimeBound struct {
+	Abs       time.Time
+	Rel       time.Duration
+	TimeOfDay bool //Abs holds only hour, minute and second
+	relative  bool
+}
+
+// timeBoundLayouts are accepted absolute times, in local time zone unless the zone is given
+var timeBoundLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02 15:04", "2006-01-02T15:04:05"}
+
+// ParseTimeBound parses "2024-03-01 14:30:00", RFC3339, "14:30:00", "+5m" or "90s"
+func ParseTimeBound(s string) (TimeBound, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(strings.TrimPrefix(s, "+")); err == nil {
+		return TimeBound{Rel: d, relative: true}, nil
+	}
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return TimeBound{Abs: t}, nil
+		}
+	}
+	for _, layout := range []string{"15:04:05.999999999", "15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return TimeBound{Abs: t, TimeOfDay: true}, nil
+		}
+	}
+	return TimeBound{}, fmt.Errorf("can't parse time %q, expected i.e. \"2006-01-02 15:04:05\", \"15:04:05\" or duration since the capture start \"+5m\"", s)
+}
+
+// At returns the bound for capture starting at start
+func (b TimeBound) At(start time.Time) time.Time {
+	switch {
+	case b.relative:
+		return start.Add(b.Rel)
+	case b.TimeOfDay:
+		start = start.In(time.Local)
+		return time.Date(start.Year(), start.Month(), start.Day(), b.Abs.Hour(), b.Abs.Minute(), b.Abs.Second(),
+			b.Abs.Nanosecond(), time.Local)
+	}
+	return b.Abs
+}
+
+// TimeWindow passes only packets captured between From and To (-from, -to), so a short incident can be
+// analyzed in a long capture. Bounds relative to the capture start are resolved at the first packet
+type TimeWindow struct {
+	From, To *TimeBound //nil is open
+	Outside  uint64     //packets skipped
+
+	started  bool
+	from, to time.Time
+}
+
+// NewTimeWindow parses -from and -to, empty is open. It returns nil if both are empty
+func NewTimeWindow(from, to string) (*TimeWindow, error) {
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	w := &TimeWindow{}
+	if from != "" {
+		b, err := ParseTimeBound(from)
+		if err != nil {
+			return nil, fmt.Errorf("-from: %v", err)
+		}
+		w.From = &b
+	}
+	if to != "" {
+		b, err := ParseTimeBound(to)
+		if err != nil {
+			return nil, fmt.Errorf("-to: %v", err)
+		}
+		w.To = &b
+	}
+	return w, nil
+}
+
+// Contains tells if packet captured at ts is within the window
+func (w *TimeWindow) Contains(ts time.Time) bool {
+	if !w.started {
+		w.started = true
+		if w.From != nil {
+			w.from = w.From.At(ts)
+		}
+		if w.To != nil {
+			w.to = w.To.At(ts)
+		}
+	}
+	if (w.From != nil && ts.Before(w.from)) || (w.To != nil && ts.After(w.to)) {
+		w.Outside++
+		return false
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/ora600pl/stado/stats"
+	"github.com/ora600pl/stado/tnsparse"
+)
+
+// Hop is a vantage point of the topology: a capture taken on it and the next hop its requests go to
+type Hop struct {
+	Name   string
+	File   string
+	NextIP string
+	Port   string
+	SQLs   map[string]stats.SQLstatsJSON
+}
+
+// ParseHops parses "name=file@ip:port,..." ordered from the application to the database
+func ParseHops(list string) ([]*Hop, error) {
+	var hops []*Hop
+	for _, spec := range strings.Split(list, ",") {
+		eq, at, colon := strings.Index(spec, "="), strings.LastIndex(spec, "@"), strings.LastIndex(spec, ":")
+		if eq < 1 || at < eq+2 || colon < at+2 || colon == len(spec)-1 {
+			return nil, fmt.Errorf("hop %q, expected name=file@ip:port", spec)
+		}
+		hops = append(hops, &Hop{Name: spec[:eq], File: spec[eq+1 : at], NextIP: strings.Trim(spec[at+1:colon], "[]"), Port: spec[colon+1:]})
+	}
+	if len(hops) < 2 {
+		return nil, fmt.Errorf("at least two hops are needed for a topology")
+	}
+	return hops, nil
+}
+
+// analyze parses capture of hop and keeps per-sqlid statistics of requests sent to the next hop
+func (h *Hop) analyze(backend string) error {
+	src, err := OpenCaptureSource(backend, h.File, "")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	analyzer := tnsparse.NewAnalyzer([]string{h.NextIP}, h.Port, tnsparse.WithSoftFilter())
+	analyzer.Run(gopacket.NewPacketSource(src, PacketDecoder(src.LinkType())))
+	st := stats.New(analyzer.Parser)
+	st.Count()
+	a := st.Analyze(false)
+	h.SQLs = make(map[string]stats.SQLstatsJSON, len(a.SQLs))
+	for _, r := range a.SQLs {
+		h.SQLs[r.SQLid] = r
+	}
+	return nil
+}
+
+// TopologySQL splits app time per execution of a sqlid into segments between hops. SegmentMs[i] is time
+// between hop i and hop i+1 (network and whatever runs on hop i+1), the last one is time behind the last hop
+type TopologySQL struct {
+	SQLid     string
+	AppMs     []float64 //App time per execution seen at each hop, 0 if the hop did not see the sqlid
+	SegmentMs []float64
+	Worst     int //Segment contributing the most
+}
+
+// Topology splits app time of sqlids seen at the first hop into segments, ordered by app time at the first hop
+func Topology(hops []*Hop) []TopologySQL {
+	first := make([]stats.SQLstatsJSON, 0, len(hops[0].SQLs))
+	for _, r := range hops[0].SQLs {
+		first = append(first, r)
+	}
+	sort.Slice(first, func(i, j int) bool {
+		if first[i].ElaAppMs != first[j].ElaAppMs {
+			return first[i].ElaAppMs > first[j].ElaAppMs
+		}
+		return first[i].SQLid < first[j].SQLid
+	})
+	var ts []TopologySQL
+	for _, r := range first {
+		t := TopologySQL{SQLid: r.SQLid, AppMs: make([]float64, len(hops)), SegmentMs: make([]float64, len(hops))}
+		for i, h := range hops {
+			if hr, ok := h.SQLs[r.SQLid]; ok {
+				t.AppMs[i] = hr.AppPerExecMs
+			}
+		}
+		for i := range hops {
+			if i == len(hops)-1 {
+				t.SegmentMs[i] = t.AppMs[i]
+			} else if t.AppMs[i] > 0 && t.AppMs[i+1] > 0 {
+				t.SegmentMs[i] = t.AppMs[i] - t.AppMs[i+1]
+			}
+			if t.SegmentMs[i] > t.SegmentMs[t.Worst] {
+				t.Worst = i
+			}
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
+
+// segmentName names segment i of hops
+func segmentName(hops []*Hop, i int) string {
+	if i == len(hops)-1 {
+		return hops[i].Name + "->server"
+	}
+	return hops[i].Name + "->" + hops[i+1].Name
+}
+
+// TopologyCmd analyzes captures taken at several hops between the application and the database and
+// reports which segment adds the most latency to each sqlid
+func TopologyCmd(args []string) {
+	fs := flag.NewFlagSet("topology", flag.ExitOnError)
+	hopList := fs.String("hops", "", "captures ordered from the application to the database: name=file@next_hop_ip:port,... i.e. app=app.pcap@10.0.0.7:1521,proxy=proxy.pcap@10.0.0.5:1521")
+	backend := fs.String("capture", "auto", "capture backend used to read the files: "+strings.Join(CaptureBackends, "|"))
+	top := fs.Int("top", 20, "number of sqlids reported (0 - all)")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	hops, err := ParseHops(*hopList)
+	if *hopList == "" || err != nil {
+		if err != nil && *hopList != "" {
+			fmt.Println(err)
+		}
+		fmt.Println("Usage: stado topology -hops app=app.pcap@10.0.0.7:1521,proxy=proxy.pcap@10.0.0.5:1521 [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	for _, h := range hops {
+		if err := h.analyze(*backend); err != nil {
+			fmt.Println(h.Name+":", err)
+			os.Exit(2)
+		}
+	}
+	printTopology(hops, Topology(hops), *top)
+}
+
+func printTopology(hops []*Hop, ts []TopologySQL, top int) {
+	fmt.Println("Hop\t\tCapture\t\tNext hop\t\tSQL IDs\tExec\tEla App (ms)")
+	for _, h := range hops {
+		exec, app := uint(0), 0.0
+		for _, r := range h.SQLs {
+			exec += r.Executions
+			app += r.ElaAppMs
+		}
+		fmt.Printf("%s\t\t%s\t%s:%s\t%d\t%d\t%f\n", h.Name, h.File, h.NextIP, h.Port, len(h.SQLs), exec, app)
+	}
+
+	fmt.Print("\nApp time per execution (ms) seen at each hop and split into segments\nSQL ID\t")
+	for _, h := range hops {
+		fmt.Print("\t" + h.Name)
+	}
+	for i := range hops {
+		fmt.Print("\t" + segmentName(hops, i))
+	}
+	fmt.Println("\tSlowest segment")
+	worst := make([]float64, len(hops)) //Czas segmentow wszystkich sqlidow, wazony liczba wykonan
+	for n, t := range ts {
+		for i, seg := range t.SegmentMs {
+			worst[i] += seg * float64(hops[0].SQLs[t.SQLid].Executions)
+		}
+		if top > 0 && n >= top {
+			continue
+		}
+		fmt.Print(t.SQLid)
+		for _, app := range t.AppMs {
+			fmt.Printf("\t%f", app)
+		}
+		for _, seg := range t.SegmentMs {
+			fmt.Printf("\t%f", seg)
+		}
+		fmt.Printf("\t%s (%.1f%%)\n", segmentName(hops, t.Worst), 100*stats.Ratio(t.SegmentMs[t.Worst], t.AppMs[0]))
+	}
+
+	fmt.Println("\nSegment\t\t\tEla App (ms)\t% App")
+	sum := 0.0
+	for _, w := range worst {
+		sum += w
+	}
+	for i, w := range worst {
+		fmt.Printf("%s\t\t%f\t%.1f\n", segmentName(hops, i), w, 100*stats.Ratio(w, sum))
+	}
+}
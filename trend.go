@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ora600pl/stado/stats"
+)
+
+// TrendPoint is a sqlid in one saved analysis
+type TrendPoint struct {
+	Capture      string       `json:"capture"` //File of the saved analysis
+	TimeBegin    time.Time    `json:"time_begin"`
+	Executions   uint         `json:"executions"`
+	ExecPerHour  float64      `json:"executions_per_hour"`
+	ElaAppMs     float64      `json:"ela_app_ms"`
+	AppPerExecMs float64      `json:"app_per_exec_ms"`
+	AppP95Ms     float64      `json:"app_p95_ms"`
+	NetPerExecMs float64      `json:"net_per_exec_ms"`
+	Apdex        *stats.Apdex `json:"apdex,omitempty"`
+}
+
+// SQLTrend is history of a sqlid across saved analyses, ordered by capture time
+type SQLTrend struct {
+	SQLid    string       `json:"sql_id"`
+	SQLtxt   string       `json:"sql_text"`
+	Points   []TrendPoint `json:"points"`
+	ElaAppMs float64      `json:"ela_app_ms"`          //All captures together
+	Change   float64      `json:"app_per_exec_change"` //Last app time per execution relative to the first one, 0.5 is 50% slower
+	SlopeMs  float64      `json:"app_per_exec_slope_ms_per_day"`
+}
+
+// Trends merges saved analyses into history of each sqlid, analyses are ordered by their time frame
+func Trends(analyses []*stats.Analysis, files []string) []SQLTrend {
+	idx := make([]int, len(analyses))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return analyses[idx[i]].TimeBegin.Before(analyses[idx[j]].TimeBegin) })
+
+	bySQL := make(map[string]*SQLTrend)
+	for _, i := range idx {
+		a := analyses[i]
+		for _, r := range a.SQLs {
+			t, ok := bySQL[r.SQLid]
+			if !ok {
+				t = &SQLTrend{SQLid: r.SQLid, SQLtxt: r.SQLtxt}
+				bySQL[r.SQLid] = t
+			}
+			p := TrendPoint{Capture: files[i], TimeBegin: a.TimeBegin, Executions: r.Executions, ElaAppMs: r.ElaAppMs,
+				AppPerExecMs: r.AppPerExecMs, AppP95Ms: r.AppP95Ms, NetPerExecMs: r.NetPerExecMs, Apdex: r.Apdex}
+			if a.DurationS > 0 {
+				p.ExecPerHour = float64(r.Executions) / a.DurationS * 3600
+			}
+			t.Points = append(t.Points, p)
+			t.ElaAppMs += r.ElaAppMs
+		}
+	}
+
+	trends := []SQLTrend{}
+	for _, t := range bySQL {
+		first, last := t.Points[0], t.Points[len(t.Points)-1]
+		if first.AppPerExecMs > 0 {
+			t.Change = last.AppPerExecMs/first.AppPerExecMs - 1
+		}
+		t.SlopeMs = appSlope(t.Points)
+		trends = append(trends, *t)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].ElaAppMs != trends[j].ElaAppMs {
+			return trends[i].ElaAppMs > trends[j].ElaAppMs
+		}
+		return trends[i].SQLid < trends[j].SQLid
+	})
+	return trends
+}
+
+// appSlope fits app time per execution to capture time with least squares, in ms per day
+func appSlope(points []TrendPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		x := p.TimeBegin.Sub(points[0].TimeBegin).Hours() / 24
+		sx += x
+		sy += p.AppPerExecMs
+		sxx += x * x
+		sxy += x * p.AppPerExecMs
+	}
+	n := float64(len(points))
+	if d := n*sxx - sx*sx; d != 0 {
+		return (n*sxy - sx*sy) / d
+	}
+	return 0
+}
+
+// analysisFiles expands comma separated list of saved analyses, globs and directories (all *.json in them)
+func analysisFiles(list string) ([]string, error) {
+	var files []string
+	for _, f := range strings.Split(list, ",") {
+		f = strings.TrimSpace(f)
+		if st, err := os.Stat(f); err == nil && st.IsDir() {
+			f = filepath.Join(f, "*.json")
+		}
+		matches, err := filepath.Glob(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no saved analyses", f)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// TrendCmd merges analyses saved with -save (i.e. of nightly captures) into trend report of each sqlid
+func TrendCmd(args []string) {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	in := fs.String("in", "", "saved analyses: comma separated files, globs or directories i.e. -in 'nightly/*.json'")
+	top := fs.Int("top", 20, "number of sqlids with the longest app time reported (0 - all)")
+	minCaptures := fs.Int("min-captures", 2, "report only sqlids found in at least that many analyses")
+	sqlID := fs.String("sqlid", "", "print every capture of this sqlid")
+	jsonOut := fs.Bool("json", false, "write trends as JSON instead of text report")
+	fs.Parse(args)
+	log.SetOutput(ioutil.Discard)
+
+	if *in == "" {
+		fmt.Println("Usage: stado trend -in analyses/ [options]")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	files, err := analysisFiles(*in)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	var analyses []*stats.Analysis
+	for _, f := range files {
+		a, err := stats.LoadAnalysis(f)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		analyses = append(analyses, a)
+	}
+
+	var trends []SQLTrend
+	for _, t := range Trends(analyses, files) {
+		if len(t.Points) >= *minCaptures && (*sqlID == "" || t.SQLid == *sqlID) {
+			trends = append(trends, t)
+		}
+	}
+	if *top > 0 && len(trends) > *top {
+		trends = trends[:*top]
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		if err := enc.Encode(trends); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	printTrends(trends, len(analyses), *sqlID != "")
+}
+
+func printTrends(trends []SQLTrend, captures int, detail bool) {
+	fmt.Println("Analyses merged:", captures)
+	fmt.Println("\nSQL ID\t\tCaptures\tEla App (ms)\tFirst App/Exec\tLast App/Exec\tChange %\tSlope (ms/day)")
+	for _, t := range trends {
+		fmt.Printf("%s\t%d\t\t%f\t%f\t%f\t%.1f\t\t%f\n", t.SQLid, len(t.Points), t.ElaAppMs,
+			t.Points[0].AppPerExecMs, t.Points[len(t.Points)-1].AppPerExecMs, 100*t.Change, t.SlopeMs)
+	}
+	if !detail {
+		return
+	}
+	for _, t := range trends {
+		fmt.Println("\n" + t.SQLid + "\t" + t.SQLtxt)
+		fmt.Println("Time begin\t\t\tExec\tExec/h\t\tApp/Exec\tApp p95\t\tNet/Exec\tApdex\tAnalysis")
+		for _, p := range t.Points {
+			apdex := "-" //Analiza zapisana bez -apdex
+			if p.Apdex != nil {
+				apdex = fmt.Sprintf("%.2f", p.Apdex.Score)
+			}
+			fmt.Printf("%s\t%d\t%f\t%f\t%f\t%f\t%s\t%s\n", p.TimeBegin.Format(time.RFC3339), p.Executions, p.ExecPerHour,
+				p.AppPerExecMs, p.AppP95Ms, p.NetPerExecMs, apdex, p.Capture)
+		}
+	}
+}